@@ -11,20 +11,28 @@ import (
 	"github.com/aKaddoura96/api-hosting-execution-platform/backend/shared/logger"
 	"github.com/aKaddoura96/api-hosting-execution-platform/backend/shared/models"
 	"github.com/aKaddoura96/api-hosting-execution-platform/backend/shared/repository"
+	"github.com/aKaddoura96/api-hosting-execution-platform/backend/shared/server"
+	"github.com/aKaddoura96/api-hosting-execution-platform/backend/shared/tracing"
 	"github.com/gorilla/mux"
 	"github.com/joho/godotenv"
 )
 
 func main() {
+	// Load environment variables (before the logger so LOG_LEVEL/LOG_FORMAT apply)
+	godotenv.Load()
+
 	// Initialize logger
 	log := logger.NewLogger("analytics")
 	logger.SetDefaultLogger(log)
 	
-	godotenv.Load()
 	log.Info("Starting Analytics Service", map[string]interface{}{
 		"version": "1.0.0",
 	})
 
+	// Initialize tracing (exporter chosen by OTEL_TRACES_EXPORTER)
+	shutdownTracing := tracing.Init("analytics")
+	defer shutdownTracing()
+
 	// Connect to database
 	log.Info("Connecting to database...")
 	if err := database.Connect(); err != nil {
@@ -73,9 +81,16 @@ func main() {
 		"address": "http://localhost:" + port,
 	})
 	
+	router.Use(tracing.HTTPMiddleware)
 	router.Use(logger.HTTPLoggingMiddleware(log))
 	
-	if err := http.ListenAndServe(":"+port, router); err != nil {
+	srv, err := server.New(":"+port, router)
+	if err != nil {
+		log.Fatal("Invalid server configuration", map[string]interface{}{"error": err.Error()})
+	}
+
+	// Executions being logged are stored before the database is closed
+	if err := srv.Run(nil); err != nil {
 		log.Fatal("Server failed", map[string]interface{}{"error": err.Error()})
 	}
 }
@@ -108,7 +123,7 @@ func handleLogExecution(w http.ResponseWriter, r *http.Request, execRepo *reposi
 	}
 
 	if err := execRepo.Create(execution); err != nil {
-		logger.Error("Failed to log execution", map[string]interface{}{"error": err.Error()})
+		logger.FromContext(r.Context()).Error("Failed to log execution", map[string]interface{}{"error": err.Error()})
 		http.Error(w, "Failed to log execution", http.StatusInternalServerError)
 		return
 	}
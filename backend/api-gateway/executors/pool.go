@@ -0,0 +1,488 @@
+package executors
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/aKaddoura96/api-hosting-execution-platform/backend/shared/logger"
+	"github.com/aKaddoura96/api-hosting-execution-platform/backend/shared/models"
+	"github.com/aKaddoura96/api-hosting-execution-platform/backend/shared/nodeauth"
+	"github.com/aKaddoura96/api-hosting-execution-platform/backend/shared/repository"
+	"github.com/aKaddoura96/api-hosting-execution-platform/backend/shared/tracing"
+)
+
+const (
+	// refreshInterval is how long the node list is used before it is read again
+	refreshInterval = 2 * time.Second
+	// maxAttempts bounds how many nodes one request is offered to
+	maxAttempts = 3
+	// evictAfter is how many failed health checks in a row evict a node
+	evictAfter = 3
+	// downFor is how long a node that refused a connection is avoided
+	downFor = 30 * time.Second
+)
+
+// Balancing strategies
+const (
+	// LeastLoaded picks the node with the fewest executions per slot
+	LeastLoaded = "least-loaded"
+	// Hash keeps each API on the same node while it has free slots, so its
+	// images and caches stay warm
+	Hash = "hash"
+)
+
+// Pool picks the executor node for each request from the nodes registered in
+// the executor_nodes table. Without any, everything goes to EXECUTOR_URL.
+type Pool struct {
+	nodes          *repository.ExecutorNodeRepository
+	fallback       *models.ExecutorNode
+	balancing      string
+	ttl            time.Duration
+	healthInterval time.Duration
+	client         *http.Client // for health checks
+	executorClient *http.Client // for everything else
+
+	mu        sync.Mutex
+	live      []*models.ExecutorNode
+	refreshed time.Time
+	down      map[string]time.Time // node ID to when it may be tried again
+	failures  map[string]int       // failed health checks in a row
+	inflight  map[string]int       // requests sent since the node's heartbeat
+}
+
+// NewPool creates a pool. EXECUTOR_BALANCING is least-loaded (default) or
+// hash, EXECUTOR_NODE_TTL how recent a node's heartbeat must be (default 15s)
+// and EXECUTOR_HEALTH_INTERVAL how often nodes are health checked (default
+// 10s, 0 disables the checks on this instance). Requests to nodes carry
+// EXECUTOR_TOKEN, which is required.
+func NewPool(nodes *repository.ExecutorNodeRepository) (*Pool, error) {
+	token, err := nodeauth.TokenFromEnv()
+	if err != nil {
+		return nil, err
+	}
+
+	executorURL := os.Getenv("EXECUTOR_URL")
+	if executorURL == "" {
+		executorURL = "http://localhost:8081"
+	}
+
+	p := &Pool{
+		nodes:          nodes,
+		fallback:       &models.ExecutorNode{ID: "default", URL: executorURL},
+		balancing:      LeastLoaded,
+		ttl:            15 * time.Second,
+		healthInterval: 10 * time.Second,
+		client:         nodeauth.Client(token, 2*time.Second),
+		executorClient: nodeauth.Client(token, 0),
+		down:           make(map[string]time.Time),
+		failures:       make(map[string]int),
+		inflight:       make(map[string]int),
+	}
+
+	switch v := os.Getenv("EXECUTOR_BALANCING"); v {
+	case "", LeastLoaded:
+	case Hash:
+		p.balancing = Hash
+	default:
+		return nil, fmt.Errorf("invalid EXECUTOR_BALANCING: %q", v)
+	}
+	if v := os.Getenv("EXECUTOR_NODE_TTL"); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil || d <= 0 {
+			return nil, fmt.Errorf("invalid EXECUTOR_NODE_TTL: %q", v)
+		}
+		p.ttl = d
+	}
+	if v := os.Getenv("EXECUTOR_HEALTH_INTERVAL"); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil || d < 0 {
+			return nil, fmt.Errorf("invalid EXECUTOR_HEALTH_INTERVAL: %q", v)
+		}
+		p.healthInterval = d
+	}
+
+	return p, nil
+}
+
+// Run health checks the registered nodes until ctx is cancelled. A node
+// failing evictAfter checks in a row is removed from the registry, as are
+// nodes whose heartbeats stopped.
+func (p *Pool) Run(ctx context.Context) {
+	if p.healthInterval == 0 {
+		logger.Info("Executor health checks disabled")
+		return
+	}
+
+	ticker := time.NewTicker(p.healthInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		if evicted, err := p.nodes.DeleteStale(p.ttl); err != nil {
+			logger.Error("Failed to evict stale executor nodes", map[string]interface{}{"error": err.Error()})
+		} else if evicted > 0 {
+			logger.Warn("Evicted executor nodes without heartbeat", map[string]interface{}{"count": evicted})
+		}
+
+		for _, node := range p.registered() {
+			p.checkHealth(ctx, node)
+		}
+	}
+}
+
+// checkHealth probes a node's /health endpoint
+func (p *Pool) checkHealth(ctx context.Context, node *models.ExecutorNode) {
+	req, err := http.NewRequestWithContext(ctx, "GET", node.URL+"/health", nil)
+	if err != nil {
+		return
+	}
+
+	resp, err := p.client.Do(req)
+	if err == nil {
+		io.Copy(io.Discard, resp.Body)
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			err = fmt.Errorf("health check returned %d", resp.StatusCode)
+		}
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if err == nil {
+		delete(p.failures, node.ID)
+		delete(p.down, node.ID)
+		return
+	}
+	if ctx.Err() != nil {
+		return
+	}
+
+	p.failures[node.ID]++
+	p.down[node.ID] = time.Now().Add(downFor)
+	if p.failures[node.ID] < evictAfter {
+		return
+	}
+
+	delete(p.failures, node.ID)
+	if err := p.nodes.Delete(node.ID); err != nil {
+		logger.Error("Failed to evict executor node", map[string]interface{}{"node_id": node.ID, "error": err.Error()})
+		return
+	}
+	p.refreshed = time.Time{}
+	logger.Warn("Evicted unhealthy executor node", map[string]interface{}{"node_id": node.ID, "url": node.URL})
+}
+
+// Client returns the client for requests to executor nodes, which sends the
+// executor token. It has no timeout; requests set their own deadlines.
+func (p *Pool) Client() *http.Client {
+	return p.executorClient
+}
+
+// Nodes returns the nodes currently taking requests
+func (p *Pool) Nodes() []*models.ExecutorNode {
+	registered := p.registered()
+	if len(registered) == 0 {
+		return []*models.ExecutorNode{p.fallback}
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	var up []*models.ExecutorNode
+	for _, node := range registered {
+		if !p.isDown(node.ID) {
+			up = append(up, node)
+		}
+	}
+	if len(up) == 0 {
+		return registered
+	}
+	return up
+}
+
+// Pick chooses the node for a request about apiID running runtime (either
+// may be empty), skipping the nodes in exclude. Custom runtime APIs are always
+// hashed and stay on their node however busy it is, since another node would
+// first have to build their image.
+func (p *Pool) Pick(apiID, runtime string, exclude map[string]bool) (*models.ExecutorNode, error) {
+	return p.pick(apiID, runtime, exclude, runtime == models.RuntimeCustom)
+}
+
+// PickOwner chooses the node that runs an API's replicas. Like custom runtime
+// APIs the API is hashed and pinned, so every gateway wakes its replicas on
+// the same node.
+func (p *Pool) PickOwner(apiID, runtime string) (*models.ExecutorNode, error) {
+	return p.pick(apiID, runtime, nil, true)
+}
+
+// Node returns the live node with the given ID, or nil
+func (p *Pool) Node(id string) *models.ExecutorNode {
+	for _, node := range p.Nodes() {
+		if node.ID == id {
+			return node
+		}
+	}
+	return nil
+}
+
+// Prepull asks every node that runs runtime to pull its image, so the first
+// execution on each doesn't wait for it. Nodes pull in the background.
+func (p *Pool) Prepull(ctx context.Context, runtime string) error {
+	body, _ := json.Marshal(map[string]string{"runtime": runtime})
+
+	var errs []error
+	for _, node := range p.Nodes() {
+		if !node.CanRun(runtime) {
+			continue
+		}
+		req, err := http.NewRequestWithContext(ctx, "POST", node.URL+"/images/prepull", bytes.NewReader(body))
+		if err != nil {
+			return err
+		}
+		req.Header.Set("Content-Type", "application/json")
+		tracing.Inject(ctx, req.Header)
+		req.Header.Set(logger.RequestIDHeader, logger.RequestID(ctx))
+
+		resp, err := p.executorClient.Do(req)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("executor %s: %w", node.ID, err))
+			continue
+		}
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusAccepted {
+			errs = append(errs, fmt.Errorf("executor %s: status %d", node.ID, resp.StatusCode))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func (p *Pool) pick(apiID, runtime string, exclude map[string]bool, pinned bool) (*models.ExecutorNode, error) {
+	registered := p.registered()
+	if len(registered) == 0 {
+		if exclude[p.fallback.ID] {
+			return nil, fmt.Errorf("executor %s failed", p.fallback.URL)
+		}
+		return p.fallback, nil
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	// Nodes recently down are a last resort
+	var up, down []*models.ExecutorNode
+	for _, node := range registered {
+		if exclude[node.ID] || !node.CanRun(runtime) {
+			continue
+		}
+		if p.isDown(node.ID) {
+			down = append(down, node)
+		} else {
+			up = append(up, node)
+		}
+	}
+	candidates := up
+	if len(candidates) == 0 {
+		candidates = down
+	}
+	if len(candidates) == 0 {
+		if runtime != "" {
+			return nil, fmt.Errorf("no executor node can run runtime %s", runtime)
+		}
+		return nil, fmt.Errorf("no executor node available")
+	}
+
+	if apiID != "" && (p.balancing == Hash || pinned) {
+		return p.byHash(apiID, candidates, pinned), nil
+	}
+	return p.leastLoaded(candidates), nil
+}
+
+// leastLoaded picks the node with the lowest load, counting requests sent
+// since its last heartbeat; p.mu must be held
+func (p *Pool) leastLoaded(candidates []*models.ExecutorNode) *models.ExecutorNode {
+	best := candidates[0]
+	bestLoad := p.load(best)
+	for _, node := range candidates[1:] {
+		if load := p.load(node); load < bestLoad {
+			best, bestLoad = node, load
+		}
+	}
+	return best
+}
+
+// byHash picks by rendezvous hashing: each API ranks the nodes in its own
+// order, so adding or removing a node moves only the APIs it ranks first.
+// Unless pinned, a full node passes the API on to the next in its order.
+func (p *Pool) byHash(apiID string, candidates []*models.ExecutorNode, pinned bool) *models.ExecutorNode {
+	ranked := make([]*models.ExecutorNode, len(candidates))
+	copy(ranked, candidates)
+	sort.Slice(ranked, func(i, j int) bool {
+		return rendezvousScore(apiID, ranked[i].ID) > rendezvousScore(apiID, ranked[j].ID)
+	})
+
+	if !pinned {
+		for _, node := range ranked {
+			if p.load(node) < 1 {
+				return node
+			}
+		}
+	}
+	return ranked[0]
+}
+
+func rendezvousScore(apiID, nodeID string) uint64 {
+	sum := sha256.Sum256([]byte(apiID + "/" + nodeID))
+	return binary.BigEndian.Uint64(sum[:8])
+}
+
+// load is the node's load including requests in flight; p.mu must be held
+func (p *Pool) load(node *models.ExecutorNode) float64 {
+	estimate := *node
+	estimate.Running += p.inflight[node.ID]
+	return estimate.Load()
+}
+
+// isDown reports whether a node failed recently; p.mu must be held
+func (p *Pool) isDown(id string) bool {
+	until, ok := p.down[id]
+	return ok && time.Now().Before(until)
+}
+
+// registered returns the live registered nodes, reading them again once the
+// list is older than refreshInterval
+func (p *Pool) registered() []*models.ExecutorNode {
+	p.mu.Lock()
+	if time.Since(p.refreshed) < refreshInterval {
+		defer p.mu.Unlock()
+		return p.live
+	}
+	p.mu.Unlock()
+
+	live, err := p.nodes.GetLive(p.ttl)
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if err != nil {
+		// Keep using the last list rather than fail every request
+		logger.Error("Failed to list executor nodes", map[string]interface{}{"error": err.Error()})
+		return p.live
+	}
+	// A fresh heartbeat counts what was in flight
+	previous := make(map[string]time.Time, len(p.live))
+	for _, node := range p.live {
+		previous[node.ID] = node.HeartbeatAt
+	}
+	for _, node := range live {
+		if node.HeartbeatAt.After(previous[node.ID]) {
+			delete(p.inflight, node.ID)
+		}
+	}
+	p.live = live
+	p.refreshed = time.Now()
+	return p.live
+}
+
+// Do sends a request built by newRequest for the chosen node. When a node
+// can't be reached or is too busy to admit the execution (503), which both
+// mean no user code ran, the request is retried on another node; if every
+// node is busy the last 503 is returned.
+func (p *Pool) Do(ctx context.Context, apiID, runtime string, newRequest func(node *models.ExecutorNode) (*http.Request, error)) (*http.Response, error) {
+	tried := map[string]bool{}
+	var busy *http.Response
+	var lastErr error
+
+	for attempt := 0; attempt < maxAttempts; attempt++ {
+		node, err := p.Pick(apiID, runtime, tried)
+		if err != nil {
+			if lastErr == nil && busy == nil {
+				lastErr = err
+			}
+			break
+		}
+		tried[node.ID] = true
+
+		req, err := newRequest(node)
+		if err != nil {
+			return nil, err
+		}
+
+		p.track(node.ID, 1)
+		resp, err := p.executorClient.Do(req)
+		if err != nil {
+			p.track(node.ID, -1)
+			if !notSent(err) || ctx.Err() != nil {
+				return nil, err
+			}
+			p.markDown(node.ID)
+			logger.FromContext(ctx).Warn("Executor node unreachable, trying another", map[string]interface{}{
+				"node_id": node.ID,
+				"error":   err.Error(),
+			})
+			lastErr = err
+			continue
+		}
+
+		if busy != nil {
+			busy.Body.Close()
+			busy = nil
+		}
+		resp.Body = &trackedBody{ReadCloser: resp.Body, done: func() { p.track(node.ID, -1) }}
+		if resp.StatusCode != http.StatusServiceUnavailable {
+			return resp, nil
+		}
+		busy = resp
+	}
+
+	if busy != nil {
+		return busy, nil
+	}
+	return nil, lastErr
+}
+
+// notSent reports whether a request failed before reaching the node
+func notSent(err error) bool {
+	var opErr *net.OpError
+	return errors.As(err, &opErr) && opErr.Op == "dial"
+}
+
+func (p *Pool) markDown(id string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.down[id] = time.Now().Add(downFor)
+}
+
+func (p *Pool) track(id string, delta int) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.inflight[id] += delta; p.inflight[id] <= 0 {
+		delete(p.inflight, id)
+	}
+}
+
+// trackedBody ends a request's in-flight count when its response is closed
+type trackedBody struct {
+	io.ReadCloser
+	once sync.Once
+	done func()
+}
+
+func (b *trackedBody) Close() error {
+	b.once.Do(b.done)
+	return b.ReadCloser.Close()
+}
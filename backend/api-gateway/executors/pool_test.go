@@ -0,0 +1,127 @@
+package executors
+
+import (
+	"fmt"
+	"slices"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/aKaddoura96/api-hosting-execution-platform/backend/shared/models"
+)
+
+func newTestPool() *Pool {
+	return &Pool{
+		down:     make(map[string]time.Time),
+		failures: make(map[string]int),
+		inflight: make(map[string]int),
+	}
+}
+
+// ranking returns the node IDs in apiID's rendezvous order
+func ranking(apiID string, ids ...string) []string {
+	ranked := append([]string(nil), ids...)
+	sort.Slice(ranked, func(i, j int) bool {
+		return rendezvousScore(apiID, ranked[i]) > rendezvousScore(apiID, ranked[j])
+	})
+	return ranked
+}
+
+func TestByHash(t *testing.T) {
+	const apiID = "api-1"
+	order := ranking(apiID, "a", "b", "c")
+
+	tests := []struct {
+		name     string
+		running  map[string]int // by node; every node has capacity 2
+		pinned   bool
+		wantRank int // of the node picked, in the API's order
+	}{
+		{name: "first in the API's order", wantRank: 0},
+		{name: "first with free slots", running: map[string]int{order[0]: 2}, wantRank: 1},
+		{name: "skips every full node", running: map[string]int{order[0]: 2, order[1]: 3}, wantRank: 2},
+		{name: "first when all are full", running: map[string]int{order[0]: 2, order[1]: 2, order[2]: 2}, wantRank: 0},
+		{name: "pinned stays on the first however busy", running: map[string]int{order[0]: 5}, pinned: true, wantRank: 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var candidates []*models.ExecutorNode
+			// The order candidates come in doesn't matter
+			for _, id := range []string{"c", "a", "b"} {
+				candidates = append(candidates, &models.ExecutorNode{ID: id, Capacity: 2, Running: tt.running[id]})
+			}
+
+			got := newTestPool().byHash(apiID, candidates, tt.pinned)
+			if want := order[tt.wantRank]; got.ID != want {
+				t.Errorf("byHash() = %s, want %s (order %v)", got.ID, want, order)
+			}
+		})
+	}
+}
+
+func TestByHashCountsInflight(t *testing.T) {
+	const apiID = "api-1"
+	order := ranking(apiID, "a", "b")
+
+	p := newTestPool()
+	p.inflight[order[0]] = 2
+	candidates := []*models.ExecutorNode{
+		{ID: "a", Capacity: 2},
+		{ID: "b", Capacity: 2},
+	}
+	if got := p.byHash(apiID, candidates, false); got.ID != order[1] {
+		t.Errorf("byHash() = %s, want %s past the node with requests in flight", got.ID, order[1])
+	}
+}
+
+func TestRendezvousStability(t *testing.T) {
+	nodes := func(ids ...string) []*models.ExecutorNode {
+		var list []*models.ExecutorNode
+		for _, id := range ids {
+			list = append(list, &models.ExecutorNode{ID: id, Capacity: 1})
+		}
+		return list
+	}
+
+	tests := []struct {
+		name   string
+		before []string
+		after  []string
+	}{
+		{name: "node removed", before: []string{"a", "b", "c", "d"}, after: []string{"a", "b", "d"}},
+		{name: "node added", before: []string{"a", "b", "c"}, after: []string{"a", "b", "c", "d"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := newTestPool()
+			picks := map[string]int{}
+			moved := 0
+			for i := 0; i < 1000; i++ {
+				apiID := fmt.Sprintf("api-%d", i)
+				before := p.byHash(apiID, nodes(tt.before...), true).ID
+				after := p.byHash(apiID, nodes(tt.after...), true).ID
+				picks[after]++
+				if before == after {
+					continue
+				}
+				moved++
+				// Only the APIs of a removed node, or those the new node now
+				// ranks first, may move
+				if slices.Contains(tt.after, before) && slices.Contains(tt.before, after) {
+					t.Fatalf("%s moved from %s to %s", apiID, before, after)
+				}
+			}
+
+			if moved == 0 || moved > 400 {
+				t.Errorf("%d of 1000 APIs moved, want about a quarter", moved)
+			}
+			for _, id := range tt.after {
+				if picks[id] < 150 {
+					t.Errorf("node %s got %d of 1000 APIs, want an even share", id, picks[id])
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,225 @@
+package executors
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+
+	"github.com/aKaddoura96/api-hosting-execution-platform/backend/shared/logger"
+	"github.com/aKaddoura96/api-hosting-execution-platform/backend/shared/models"
+	"github.com/aKaddoura96/api-hosting-execution-platform/backend/shared/repository"
+	"github.com/aKaddoura96/api-hosting-execution-platform/backend/shared/tracing"
+)
+
+// Replicas sends the requests of persistent APIs to their replicas, through
+// the executor node running each. A request goes to the ready replica of the
+// API's current version with the fewest requests in flight; an API without
+// one is woken on its owner node first.
+type Replicas struct {
+	pool *Pool
+	repo *repository.ReplicaRepository
+
+	mu       sync.Mutex
+	inflight map[string]int // requests sent by this gateway, by replica
+}
+
+func NewReplicas(pool *Pool, repo *repository.ReplicaRepository) *Replicas {
+	return &Replicas{
+		pool:     pool,
+		repo:     repo,
+		inflight: make(map[string]int),
+	}
+}
+
+// Forward sends a request built by newRequest for the base URL of the chosen
+// replica; the request path is appended to it. code is what the replicas run
+// if they have to be woken. A replica that went away is replaced by waking
+// the API once.
+func (rs *Replicas) Forward(ctx context.Context, api *models.API, code string, newRequest func(baseURL string) (*http.Request, error)) (*http.Response, error) {
+	wake := false
+	for attempt := 0; attempt < 2; attempt++ {
+		replica, node, err := rs.choose(ctx, api, code, wake)
+		if err != nil {
+			return nil, err
+		}
+
+		req, err := newRequest(fmt.Sprintf("%s/replicas/%s/%s/proxy", node.URL, api.ID, replica.ID))
+		if err != nil {
+			return nil, err
+		}
+
+		rs.track(replica.ID, 1)
+		resp, err := rs.pool.Client().Do(req)
+		if err != nil {
+			rs.track(replica.ID, -1)
+			if !notSent(err) || ctx.Err() != nil || wake {
+				return nil, err
+			}
+			rs.pool.markDown(node.ID)
+			wake = true
+			continue
+		}
+		if resp.StatusCode == http.StatusNotFound && resp.Header.Get(models.ReplicaMissingHeader) != "" {
+			resp.Body.Close()
+			rs.track(replica.ID, -1)
+			wake = true
+			continue
+		}
+
+		id := replica.ID
+		resp.Body = &trackedBody{ReadCloser: resp.Body, done: func() { rs.track(id, -1) }}
+		return resp, nil
+	}
+
+	return nil, fmt.Errorf("no replica of API %s is available", api.ID)
+}
+
+// Wake starts the API's replicas on its owner node if none is ready
+func (rs *Replicas) Wake(ctx context.Context, api *models.API, code string) error {
+	_, _, err := rs.choose(ctx, api, code, true)
+	return err
+}
+
+// Stop asks every node to stop the API's replicas
+func (rs *Replicas) Stop(ctx context.Context, apiID string) error {
+	var errs []error
+	for _, node := range rs.pool.Nodes() {
+		req, err := http.NewRequestWithContext(ctx, "POST", fmt.Sprintf("%s/replicas/%s/stop", node.URL, apiID), nil)
+		if err != nil {
+			return err
+		}
+		tracing.Inject(ctx, req.Header)
+		req.Header.Set(logger.RequestIDHeader, logger.RequestID(ctx))
+
+		resp, err := rs.pool.Client().Do(req)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("executor %s: %w", node.ID, err))
+			continue
+		}
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			errs = append(errs, fmt.Errorf("executor %s: status %d", node.ID, resp.StatusCode))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// choose picks the replica for a request and the node running it, waking the
+// API if it has no ready replica or wake is set
+func (rs *Replicas) choose(ctx context.Context, api *models.API, code string, wake bool) (*models.Replica, *models.ExecutorNode, error) {
+	if !wake {
+		replicas, err := rs.repo.GetByAPIID(api.ID)
+		if err != nil {
+			logger.FromContext(ctx).Error("Failed to list replicas", map[string]interface{}{"error": err.Error()})
+		}
+
+		nodes := map[string]*models.ExecutorNode{}
+		var candidates []*models.Replica
+		for _, replica := range replicas {
+			if replica.Version != api.Version || replica.Status != models.ReplicaReady {
+				continue
+			}
+			node := rs.pool.Node(replica.NodeID)
+			if node == nil {
+				continue
+			}
+			nodes[replica.NodeID] = node
+			candidates = append(candidates, replica)
+		}
+		if replica := rs.leastBusy(candidates); replica != nil {
+			return replica, nodes[replica.NodeID], nil
+		}
+	}
+
+	node, err := rs.pool.PickOwner(api.ID, api.Runtime)
+	if err != nil {
+		return nil, nil, err
+	}
+	replicas, err := rs.wake(ctx, node, api, code)
+	if err != nil {
+		return nil, nil, err
+	}
+	return rs.leastBusy(replicas), node, nil
+}
+
+// wake has node start the API's replicas if none is ready and returns the
+// ready ones
+func (rs *Replicas) wake(ctx context.Context, node *models.ExecutorNode, api *models.API, code string) ([]*models.Replica, error) {
+	ctx, span := tracing.StartSpan(ctx, "POST /replicas/wake", tracing.SpanKindClient)
+	defer span.End()
+	span.SetAttribute("api.id", api.ID)
+	span.SetAttribute("executor.node", node.ID)
+
+	body, _ := json.Marshal(map[string]string{
+		"version":        api.Version,
+		"code":           code,
+		"runtime":        api.Runtime,
+		"resource_class": api.ResourceClass,
+	})
+	req, err := http.NewRequestWithContext(ctx, "POST", fmt.Sprintf("%s/replicas/%s/wake", node.URL, api.ID), bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	tracing.Inject(ctx, req.Header)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(logger.RequestIDHeader, logger.RequestID(ctx))
+
+	resp, err := rs.pool.Client().Do(req)
+	if err != nil {
+		span.SetError(err)
+		if notSent(err) {
+			rs.pool.markDown(node.ID)
+		}
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		message, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+		err := fmt.Errorf("executor %s failed to wake replicas: %s", node.ID, strings.TrimSpace(string(message)))
+		span.SetError(err)
+		return nil, err
+	}
+
+	var result struct {
+		Replicas []*models.Replica `json:"replicas"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return nil, fmt.Errorf("invalid wake response: %w", err)
+	}
+	if len(result.Replicas) == 0 {
+		return nil, fmt.Errorf("executor %s woke no replicas", node.ID)
+	}
+	return result.Replicas, nil
+}
+
+// leastBusy picks the replica with the fewest requests in flight: as last
+// recorded by its node, plus those this gateway sent since
+func (rs *Replicas) leastBusy(replicas []*models.Replica) *models.Replica {
+	rs.mu.Lock()
+	defer rs.mu.Unlock()
+
+	var best *models.Replica
+	bestLoad := 0
+	for _, replica := range replicas {
+		load := replica.InFlight + rs.inflight[replica.ID]
+		if best == nil || load < bestLoad {
+			best, bestLoad = replica, load
+		}
+	}
+	return best
+}
+
+func (rs *Replicas) track(id string, delta int) {
+	rs.mu.Lock()
+	defer rs.mu.Unlock()
+	if rs.inflight[id] += delta; rs.inflight[id] <= 0 {
+		delete(rs.inflight, id)
+	}
+}
@@ -0,0 +1,38 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/aKaddoura96/api-hosting-execution-platform/backend/shared/repository"
+)
+
+// AdminHandler serves the platform's operators, behind middleware.RequireRole
+type AdminHandler struct {
+	cachedImageRepo *repository.CachedImageRepository
+}
+
+func NewAdminHandler(cachedImageRepo *repository.CachedImageRepository) *AdminHandler {
+	return &AdminHandler{cachedImageRepo: cachedImageRepo}
+}
+
+// GetCachedImages lists the images held by each registered executor node,
+// most recently used first, as of each node's last cache sweep
+func (h *AdminHandler) GetCachedImages(w http.ResponseWriter, r *http.Request) {
+	images, err := h.cachedImageRepo.GetRegistered()
+	if err != nil {
+		http.Error(w, "Failed to list cached images", http.StatusInternalServerError)
+		return
+	}
+
+	var total int64
+	for _, image := range images {
+		total += image.SizeBytes
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"images":     images,
+		"size_bytes": total,
+	})
+}
@@ -1,6 +1,8 @@
 package handlers
 
 import (
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
 	"fmt"
 	"io"
@@ -8,6 +10,7 @@ import (
 	"os"
 	"path/filepath"
 	"strings"
+	"time"
 
 	"github.com/aKaddoura96/api-hosting-execution-platform/backend/shared/models"
 	"github.com/aKaddoura96/api-hosting-execution-platform/backend/shared/repository"
@@ -15,19 +18,29 @@ import (
 )
 
 type APIHandler struct {
-	apiRepo *repository.APIRepository
+	apiRepo     *repository.APIRepository
+	versionRepo *repository.APIVersionRepository
+	userRepo    *repository.UserRepository
+	runtimeRepo *repository.RuntimeRepository
 }
 
-func NewAPIHandler(apiRepo *repository.APIRepository) *APIHandler {
-	return &APIHandler{apiRepo: apiRepo}
+func NewAPIHandler(apiRepo *repository.APIRepository, versionRepo *repository.APIVersionRepository, userRepo *repository.UserRepository, runtimeRepo *repository.RuntimeRepository) *APIHandler {
+	return &APIHandler{apiRepo: apiRepo, versionRepo: versionRepo, userRepo: userRepo, runtimeRepo: runtimeRepo}
 }
 
 type CreateAPIRequest struct {
-	Name        string `json:"name"`
-	Description string `json:"description"`
-	Version     string `json:"version"`
-	Runtime     string `json:"runtime"`
-	Visibility  string `json:"visibility"`
+	Name          string `json:"name"`
+	Description   string `json:"description"`
+	Version       string `json:"version"`
+	Runtime       string `json:"runtime"`
+	Visibility    string `json:"visibility"`
+	ResourceClass string `json:"resource_class"`
+}
+
+// ResourceClassInfo is a resource class as offered to a developer
+type ResourceClassInfo struct {
+	*models.ResourceClass
+	Allowed bool `json:"allowed"` // available on the developer's plan
 }
 
 func (h *APIHandler) CreateAPI(w http.ResponseWriter, r *http.Request) {
@@ -53,26 +66,57 @@ func (h *APIHandler) CreateAPI(w http.ResponseWriter, r *http.Request) {
 		req.Visibility = "private"
 	}
 
+	// The runtime must be in the registry and enabled
+	rt, err := h.runtimeRepo.GetByName(req.Runtime)
+	if err != nil || !rt.Enabled {
+		http.Error(w, "Unsupported runtime: "+req.Runtime, http.StatusBadRequest)
+		return
+	}
+	// A family's unversioned name (nodejs, go) outlives the version it has
+	// always run: past that version's date, new APIs get the family's newest
+	var warnings []string
+	if rt.Deprecated(time.Now()) && rt.Name == rt.Family {
+		if latest, err := h.runtimeRepo.GetLatest(rt.Family); err == nil {
+			warnings = append(warnings, rt.DeprecationWarning("", time.Now())+"; "+latest.Name+" is used instead")
+			rt = latest
+			req.Runtime = latest.Name
+		}
+	}
+	if rt.Deprecated(time.Now()) {
+		http.Error(w, h.runtimeWarning(rt), http.StatusBadRequest)
+		return
+	}
+
+	if req.ResourceClass == "" {
+		req.ResourceClass = rt.DefaultResourceClass
+	}
+	if status, msg := h.checkResourceClass(userID, req.ResourceClass); status != 0 {
+		http.Error(w, msg, status)
+		return
+	}
+
 	// Generate endpoint URL
 	endpoint := fmt.Sprintf("/execute/%s/%s", userID[:8], req.Name)
 
 	// Create API record
 	api := &models.API{
-		UserID:      userID,
-		Name:        req.Name,
-		Description: req.Description,
-		Version:     req.Version,
-		Runtime:     req.Runtime,
-		Visibility:  req.Visibility,
-		Status:      "pending",
-		Endpoint:    endpoint,
-		CodePath:    "", // Will be set on upload
+		UserID:        userID,
+		Name:          req.Name,
+		Description:   req.Description,
+		Version:       req.Version,
+		Runtime:       req.Runtime,
+		Visibility:    req.Visibility,
+		Status:        "pending",
+		Endpoint:      endpoint,
+		CodePath:      "", // Will be set on upload
+		ResourceClass: req.ResourceClass,
 	}
 
 	if err := h.apiRepo.Create(api); err != nil {
 		http.Error(w, "Failed to create API: "+err.Error(), http.StatusInternalServerError)
 		return
 	}
+	api.Warnings = warnings
 
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(api)
@@ -109,6 +153,19 @@ func (h *APIHandler) UploadCode(w http.ResponseWriter, r *http.Request) {
 	}
 	defer file.Close()
 
+	// WASM APIs run compiled modules, so catch source uploaded by mistake
+	if api.Runtime == models.RuntimeWASM {
+		magic := make([]byte, 4)
+		if _, err := io.ReadFull(file, magic); err != nil || string(magic) != "\x00asm" {
+			http.Error(w, "Code must be a compiled WebAssembly module for the wasm runtime", http.StatusBadRequest)
+			return
+		}
+		if _, err := file.Seek(0, io.SeekStart); err != nil {
+			http.Error(w, "Failed to read code file", http.StatusInternalServerError)
+			return
+		}
+	}
+
 	// Create upload directory
 	uploadDir := filepath.Join("uploads", userID, apiID)
 	if err := os.MkdirAll(uploadDir, 0755); err != nil {
@@ -136,6 +193,12 @@ func (h *APIHandler) UploadCode(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// Keep a copy per version so earlier versions can still be replayed
+	if err := h.snapshotVersion(api, codePath, header.Filename); err != nil {
+		http.Error(w, "Failed to save version snapshot", http.StatusInternalServerError)
+		return
+	}
+
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(map[string]string{
 		"message": "Code uploaded successfully",
@@ -151,6 +214,7 @@ func (h *APIHandler) GetMyAPIs(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "Failed to get APIs", http.StatusInternalServerError)
 		return
 	}
+	h.addWarnings(apis...)
 
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(apis)
@@ -176,6 +240,7 @@ func (h *APIHandler) GetAPI(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "API not found", http.StatusNotFound)
 		return
 	}
+	h.addWarnings(api)
 
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(api)
@@ -229,9 +294,11 @@ func (h *APIHandler) UpdateAPI(w http.ResponseWriter, r *http.Request) {
 	}
 
 	var req struct {
-		Name        string `json:"name"`
-		Description string `json:"description"`
-		Visibility  string `json:"visibility"`
+		Name          string `json:"name"`
+		Description   string `json:"description"`
+		Visibility    string `json:"visibility"`
+		Version       string `json:"version"`
+		ResourceClass string `json:"resource_class"`
 	}
 
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
@@ -249,6 +316,16 @@ func (h *APIHandler) UpdateAPI(w http.ResponseWriter, r *http.Request) {
 	if req.Visibility != "" && (req.Visibility == "private" || req.Visibility == "public" || req.Visibility == "paid") {
 		api.Visibility = req.Visibility
 	}
+	if req.Version != "" {
+		api.Version = req.Version
+	}
+	if req.ResourceClass != "" {
+		if status, msg := h.checkResourceClass(userID, req.ResourceClass); status != 0 {
+			http.Error(w, msg, status)
+			return
+		}
+		api.ResourceClass = req.ResourceClass
+	}
 
 	// Update endpoint if name changed
 	if req.Name != "" {
@@ -263,3 +340,150 @@ func (h *APIHandler) UpdateAPI(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(api)
 }
+
+// GetVersions lists the code snapshots stored for an API
+func (h *APIHandler) GetVersions(w http.ResponseWriter, r *http.Request) {
+	api, ok := authorizeAPIOwner(w, r, h.apiRepo)
+	if !ok {
+		return
+	}
+
+	versions, err := h.versionRepo.GetByAPIID(api.ID)
+	if err != nil {
+		http.Error(w, "Failed to get versions", http.StatusInternalServerError)
+		return
+	}
+	if versions == nil {
+		versions = []*models.APIVersion{}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(versions)
+}
+
+// snapshotVersion copies uploaded code under versions/<version>/ and records it
+func (h *APIHandler) snapshotVersion(api *models.API, codePath, filename string) error {
+	code, err := os.ReadFile(codePath)
+	if err != nil {
+		return err
+	}
+
+	versionDir := filepath.Join(filepath.Dir(codePath), "versions", sanitizeVersion(api.Version))
+	if err := os.MkdirAll(versionDir, 0755); err != nil {
+		return err
+	}
+
+	snapshotPath := filepath.Join(versionDir, filepath.Base(filename))
+	if err := os.WriteFile(snapshotPath, code, 0644); err != nil {
+		return err
+	}
+
+	sum := sha256.Sum256(code)
+	return h.versionRepo.Upsert(&models.APIVersion{
+		APIID:         api.ID,
+		Version:       api.Version,
+		Runtime:       api.Runtime,
+		CodePath:      snapshotPath,
+		CodeSHA256:    hex.EncodeToString(sum[:]),
+		ResourceClass: api.ResourceClass,
+	})
+}
+
+// checkResourceClass validates a resource class choice against the
+// developer's plan, returning a non-zero status if it is refused
+func (h *APIHandler) checkResourceClass(userID, name string) (int, string) {
+	class, ok := models.GetResourceClass(name)
+	if !ok {
+		return http.StatusBadRequest, "Unknown resource class: " + name
+	}
+
+	plan, err := h.userRepo.GetPlan(userID)
+	if err != nil {
+		return http.StatusInternalServerError, "Failed to get plan"
+	}
+	if !class.AllowedOn(plan) {
+		return http.StatusForbidden, fmt.Sprintf("Resource class %s is not available on the %s plan", name, plan)
+	}
+
+	return 0, ""
+}
+
+// GetResourceClasses lists the resource classes and which the caller's plan allows
+func (h *APIHandler) GetResourceClasses(w http.ResponseWriter, r *http.Request) {
+	userID := r.Context().Value("user_id").(string)
+
+	plan, err := h.userRepo.GetPlan(userID)
+	if err != nil {
+		http.Error(w, "Failed to get plan", http.StatusInternalServerError)
+		return
+	}
+
+	classes := make([]ResourceClassInfo, 0, len(models.ResourceClasses))
+	for _, class := range models.ResourceClasses {
+		classes = append(classes, ResourceClassInfo{ResourceClass: class, Allowed: class.AllowedOn(plan)})
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"plan":    plan,
+		"classes": classes,
+	})
+}
+
+// GetRuntimes lists the enabled runtimes and their deprecation dates,
+// optionally only the versions of ?family=
+func (h *APIHandler) GetRuntimes(w http.ResponseWriter, r *http.Request) {
+	runtimes, err := h.runtimeRepo.GetEnabled(r.URL.Query().Get("family"))
+	if err != nil {
+		http.Error(w, "Failed to get runtimes", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(runtimes)
+}
+
+// runtimeWarning describes a runtime's deprecation and what to move to
+func (h *APIHandler) runtimeWarning(rt *models.Runtime) string {
+	if rt.DeprecatedAt == nil {
+		return ""
+	}
+
+	var successor string
+	if latest, err := h.runtimeRepo.GetLatest(rt.Family); err == nil && latest.Name != rt.Name {
+		successor = latest.Name
+	}
+	return rt.DeprecationWarning(successor, time.Now())
+}
+
+// addWarnings notes on API records whose runtime is, or is about to be,
+// deprecated
+func (h *APIHandler) addWarnings(apis ...*models.API) {
+	warnings := map[string]string{} // by runtime
+	for _, api := range apis {
+		warning, ok := warnings[api.Runtime]
+		if !ok {
+			if rt, err := h.runtimeRepo.GetByName(api.Runtime); err == nil {
+				warning = h.runtimeWarning(rt)
+			}
+			warnings[api.Runtime] = warning
+		}
+		if warning != "" {
+			api.Warnings = append(api.Warnings, warning)
+		}
+	}
+}
+
+// sanitizeVersion makes a version label safe to use as a directory name
+func sanitizeVersion(version string) string {
+	safe := strings.Map(func(r rune) rune {
+		if r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || r == '.' || r == '-' || r == '_' {
+			return r
+		}
+		return '_'
+	}, version)
+	if safe == "" || safe == "." || safe == ".." {
+		return "_"
+	}
+	return safe
+}
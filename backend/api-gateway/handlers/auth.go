@@ -45,7 +45,7 @@ type AuthResponse struct {
 }
 
 func (h *AuthHandler) Signup(w http.ResponseWriter, r *http.Request) {
-	log := logger.NewLogger("auth-handler")
+	log := logger.FromContext(r.Context()).WithFields(map[string]interface{}{"component": "auth-handler"})
 	
 	var req SignupRequest
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
@@ -123,7 +123,7 @@ func (h *AuthHandler) Signup(w http.ResponseWriter, r *http.Request) {
 }
 
 func (h *AuthHandler) Login(w http.ResponseWriter, r *http.Request) {
-	log := logger.NewLogger("auth-handler")
+	log := logger.FromContext(r.Context()).WithFields(map[string]interface{}{"component": "auth-handler"})
 	
 	var req LoginRequest
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
@@ -183,7 +183,7 @@ func (h *AuthHandler) Me(w http.ResponseWriter, r *http.Request) {
 }
 
 func (h *AuthHandler) VerifyEmail(w http.ResponseWriter, r *http.Request) {
-	log := logger.NewLogger("auth-handler")
+	log := logger.FromContext(r.Context()).WithFields(map[string]interface{}{"component": "auth-handler"})
 	vars := mux.Vars(r)
 	token := vars["token"]
 
@@ -242,7 +242,7 @@ type ForgotPasswordRequest struct {
 }
 
 func (h *AuthHandler) ForgotPassword(w http.ResponseWriter, r *http.Request) {
-	log := logger.NewLogger("auth-handler")
+	log := logger.FromContext(r.Context()).WithFields(map[string]interface{}{"component": "auth-handler"})
 
 	var req ForgotPasswordRequest
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
@@ -302,7 +302,7 @@ type ResetPasswordRequest struct {
 }
 
 func (h *AuthHandler) ResetPassword(w http.ResponseWriter, r *http.Request) {
-	log := logger.NewLogger("auth-handler")
+	log := logger.FromContext(r.Context()).WithFields(map[string]interface{}{"component": "auth-handler"})
 
 	var req ResetPasswordRequest
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
@@ -364,7 +364,7 @@ type ChangePasswordRequest struct {
 }
 
 func (h *AuthHandler) ChangePassword(w http.ResponseWriter, r *http.Request) {
-	log := logger.NewLogger("auth-handler")
+	log := logger.FromContext(r.Context()).WithFields(map[string]interface{}{"component": "auth-handler"})
 
 	// Get user ID from context
 	userID, ok := r.Context().Value("user_id").(string)
@@ -0,0 +1,190 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+
+	"github.com/aKaddoura96/api-hosting-execution-platform/backend/shared/models"
+	"github.com/aKaddoura96/api-hosting-execution-platform/backend/shared/repository"
+	"github.com/gorilla/mux"
+)
+
+const redactedValue = "[REDACTED]"
+
+// alwaysRedactedHeaders never reach storage, whatever the API's settings
+var alwaysRedactedHeaders = []string{"Authorization", "Cookie", "Proxy-Authorization", "X-API-Key"}
+
+type CaptureHandler struct {
+	apiRepo     *repository.APIRepository
+	captureRepo *repository.CaptureRepository
+}
+
+func NewCaptureHandler(apiRepo *repository.APIRepository, captureRepo *repository.CaptureRepository) *CaptureHandler {
+	return &CaptureHandler{apiRepo: apiRepo, captureRepo: captureRepo}
+}
+
+type UpdateCaptureSettingsRequest struct {
+	Enabled       bool     `json:"enabled"`
+	RedactHeaders []string `json:"redact_headers"`
+	RedactFields  []string `json:"redact_fields"`
+}
+
+// GetCaptureSettings returns whether executions of the API are captured
+func (h *CaptureHandler) GetCaptureSettings(w http.ResponseWriter, r *http.Request) {
+	api, ok := authorizeAPIOwner(w, r, h.apiRepo)
+	if !ok {
+		return
+	}
+
+	settings, err := h.captureRepo.GetSettings(api.ID)
+	if err != nil {
+		http.Error(w, "Failed to get capture settings", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(settings)
+}
+
+// UpdateCaptureSettings turns capture on or off and sets redaction rules
+func (h *CaptureHandler) UpdateCaptureSettings(w http.ResponseWriter, r *http.Request) {
+	api, ok := authorizeAPIOwner(w, r, h.apiRepo)
+	if !ok {
+		return
+	}
+
+	var req UpdateCaptureSettingsRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	settings := &models.CaptureSettings{
+		APIID:         api.ID,
+		Enabled:       req.Enabled,
+		RedactHeaders: cleanList(req.RedactHeaders),
+		RedactFields:  cleanList(req.RedactFields),
+	}
+
+	if err := h.captureRepo.UpsertSettings(settings); err != nil {
+		http.Error(w, "Failed to update capture settings", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(settings)
+}
+
+// GetCapture returns the captured request and response of one execution
+func (h *CaptureHandler) GetCapture(w http.ResponseWriter, r *http.Request) {
+	api, ok := authorizeAPIOwner(w, r, h.apiRepo)
+	if !ok {
+		return
+	}
+
+	capture, err := h.captureRepo.GetByExecutionID(mux.Vars(r)["execution_id"])
+	if err != nil || capture.APIID != api.ID {
+		http.Error(w, "Capture not found", http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(capture)
+}
+
+// authorizeAPIOwner loads the API named by {id} and checks the caller owns it
+func authorizeAPIOwner(w http.ResponseWriter, r *http.Request, apiRepo *repository.APIRepository) (*models.API, bool) {
+	apiID := mux.Vars(r)["id"]
+	userID := r.Context().Value("user_id").(string)
+
+	api, err := apiRepo.GetByID(apiID)
+	if err != nil {
+		http.Error(w, "API not found", http.StatusNotFound)
+		return nil, false
+	}
+
+	if api.UserID != userID {
+		http.Error(w, "Unauthorized", http.StatusForbidden)
+		return nil, false
+	}
+
+	return api, true
+}
+
+func cleanList(values []string) []string {
+	cleaned := []string{}
+	for _, v := range values {
+		if v = strings.TrimSpace(v); v != "" {
+			cleaned = append(cleaned, v)
+		}
+	}
+	return cleaned
+}
+
+// redactHeaders flattens headers, masking sensitive ones
+func redactHeaders(header http.Header, extra []string) map[string]string {
+	redacted := make(map[string]string, len(header))
+	for name, values := range header {
+		redacted[name] = strings.Join(values, ", ")
+		for _, rule := range append(alwaysRedactedHeaders, extra...) {
+			if strings.EqualFold(name, rule) {
+				redacted[name] = redactedValue
+				break
+			}
+		}
+	}
+	return redacted
+}
+
+// redactJSON masks matching fields in a JSON document. A rule without dots
+// matches that key at any depth; a dotted rule ("input.card.number") matches
+// that path from the root. Non-JSON payloads are stored as a JSON string.
+func redactJSON(doc []byte, rules []string) json.RawMessage {
+	var v interface{}
+	if err := json.Unmarshal(doc, &v); err != nil {
+		quoted, _ := json.Marshal(string(doc))
+		return quoted
+	}
+
+	out, err := json.Marshal(redactValue(v, "", rules))
+	if err != nil {
+		return nil
+	}
+	return out
+}
+
+func redactValue(v interface{}, path string, rules []string) interface{} {
+	switch t := v.(type) {
+	case map[string]interface{}:
+		for key, child := range t {
+			childPath := key
+			if path != "" {
+				childPath = path + "." + key
+			}
+			if matchesRedactRule(key, childPath, rules) {
+				t[key] = redactedValue
+				continue
+			}
+			t[key] = redactValue(child, childPath, rules)
+		}
+	case []interface{}:
+		for i := range t {
+			t[i] = redactValue(t[i], path, rules)
+		}
+	}
+	return v
+}
+
+func matchesRedactRule(key, path string, rules []string) bool {
+	for _, rule := range rules {
+		if strings.Contains(rule, ".") {
+			if strings.EqualFold(rule, path) {
+				return true
+			}
+		} else if strings.EqualFold(rule, key) {
+			return true
+		}
+	}
+	return false
+}
@@ -2,29 +2,37 @@ package handlers
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"fmt"
+	"io"
 	"net/http"
-	"os"
+	"strings"
 
+	"github.com/aKaddoura96/api-hosting-execution-platform/backend/api-gateway/executors"
+	"github.com/aKaddoura96/api-hosting-execution-platform/backend/shared/logger"
+	"github.com/aKaddoura96/api-hosting-execution-platform/backend/shared/models"
 	"github.com/aKaddoura96/api-hosting-execution-platform/backend/shared/repository"
+	"github.com/aKaddoura96/api-hosting-execution-platform/backend/shared/tracing"
+	"github.com/aKaddoura96/api-hosting-execution-platform/backend/shared/webhooks"
 	"github.com/gorilla/mux"
 )
 
 type DeployHandler struct {
 	apiRepo      *repository.APIRepository
-	executorURL string
+	webhookRepo  *repository.WebhookRepository
+	scalingRepo  *repository.ScalingRepository
+	executors    *executors.Pool
+	replicas     *executors.Replicas
 }
 
-func NewDeployHandler(apiRepo *repository.APIRepository) *DeployHandler {
-	executorURL := os.Getenv("EXECUTOR_URL")
-	if executorURL == "" {
-		executorURL = "http://localhost:8081"
-	}
-
+func NewDeployHandler(apiRepo *repository.APIRepository, webhookRepo *repository.WebhookRepository, scalingRepo *repository.ScalingRepository, executors *executors.Pool, replicas *executors.Replicas) *DeployHandler {
 	return &DeployHandler{
 		apiRepo:     apiRepo,
-		executorURL: executorURL,
+		webhookRepo: webhookRepo,
+		scalingRepo: scalingRepo,
+		executors:   executors,
+		replicas:    replicas,
 	}
 }
 
@@ -63,21 +71,36 @@ func (h *DeployHandler) DeployAPI(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Call executor service
+	node, err := h.executors.Pick(apiID, api.Runtime, nil)
+	if err != nil {
+		h.deploymentFailed(r.Context(), api, err.Error())
+		http.Error(w, "Failed to communicate with executor service", http.StatusInternalServerError)
+		return
+	}
 	deployReq := DeployRequest{APIID: apiID}
 	reqBody, _ := json.Marshal(deployReq)
 
-	resp, err := http.Post(
-		h.executorURL+"/deploy",
-		"application/json",
-		bytes.NewBuffer(reqBody),
-	)
+	req, span, err := tracing.NewRequest(r.Context(), "POST", node.URL+"/deploy", bytes.NewBuffer(reqBody))
 	if err != nil {
 		http.Error(w, "Failed to communicate with executor service", http.StatusInternalServerError)
 		return
 	}
+	defer span.End()
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(logger.RequestIDHeader, logger.RequestID(r.Context()))
+
+	resp, err := h.executors.Client().Do(req)
+	if err != nil {
+		span.SetError(err)
+		h.deploymentFailed(r.Context(), api, "executor unavailable")
+		http.Error(w, "Failed to communicate with executor service", http.StatusInternalServerError)
+		return
+	}
 	defer resp.Body.Close()
 
 	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+		h.deploymentFailed(r.Context(), api, strings.TrimSpace(string(body)))
 		http.Error(w, "Deployment failed", resp.StatusCode)
 		return
 	}
@@ -91,12 +114,39 @@ func (h *DeployHandler) DeployAPI(w http.ResponseWriter, r *http.Request) {
 	// Update API status to deployed
 	if err := h.apiRepo.UpdateStatus(apiID, "deployed", deployResp.ContainerID); err != nil {
 		// Log error but don't fail the request
-		fmt.Printf("Warning: Failed to update API status: %v\n", err)
+		logger.FromContext(r.Context()).Warn("Failed to update API status", map[string]interface{}{
+			"api_id": apiID,
+			"error":  err.Error(),
+		})
 	}
 
+	// Pull the runtime's image on every node now rather than on the first
+	// execution; custom images are built when their Dockerfile is saved
+	if api.Runtime != models.RuntimeCustom {
+		if err := h.executors.Prepull(r.Context(), api.Runtime); err != nil {
+			logger.FromContext(r.Context()).Warn("Failed to pre-pull runtime image", map[string]interface{}{
+				"api_id":  apiID,
+				"runtime": api.Runtime,
+				"error":   err.Error(),
+			})
+		}
+	}
+
+	webhooks.Emit(r.Context(), h.webhookRepo, api.UserID, models.EventDeploymentSucceeded, map[string]interface{}{
+		"api_id":       api.ID,
+		"name":         api.Name,
+		"version":      api.Version,
+		"container_id": deployResp.ContainerID,
+	})
+
 	// Get updated API data
 	updatedAPI, _ := h.apiRepo.GetByID(apiID)
 
+	// Start the minimum replicas of an API that runs as replicas
+	if policy, err := h.scalingRepo.GetPolicy(apiID); err == nil && updatedAPI != nil {
+		warmReplicas(r.Context(), h.replicas, policy, updatedAPI)
+	}
+
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(map[string]interface{}{
 		"message":      deployResp.Message,
@@ -125,15 +175,26 @@ func (h *DeployHandler) StopAPI(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Call executor service
-	url := fmt.Sprintf("%s/stop/%s", h.executorURL, apiID)
-	req, _ := http.NewRequest("POST", url, nil)
-	
-	client := &http.Client{}
-	resp, err := client.Do(req)
+	node, err := h.executors.Pick(apiID, "", nil)
 	if err != nil {
 		http.Error(w, "Failed to communicate with executor service", http.StatusInternalServerError)
 		return
 	}
+	url := fmt.Sprintf("%s/stop/%s", node.URL, apiID)
+	req, span, err := tracing.NewRequest(r.Context(), "POST", url, nil)
+	if err != nil {
+		http.Error(w, "Failed to communicate with executor service", http.StatusInternalServerError)
+		return
+	}
+	defer span.End()
+	req.Header.Set(logger.RequestIDHeader, logger.RequestID(r.Context()))
+
+	resp, err := h.executors.Client().Do(req)
+	if err != nil {
+		span.SetError(err)
+		http.Error(w, "Failed to communicate with executor service", http.StatusInternalServerError)
+		return
+	}
 	defer resp.Body.Close()
 
 	if resp.StatusCode != http.StatusOK {
@@ -147,11 +208,27 @@ func (h *DeployHandler) StopAPI(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// Replicas may run on any node
+	if err := h.replicas.Stop(r.Context(), apiID); err != nil {
+		logger.FromContext(r.Context()).Warn("Failed to stop replicas", map[string]interface{}{
+			"api_id": apiID,
+			"error":  err.Error(),
+		})
+	}
+
 	// Update API status to stopped
 	if err := h.apiRepo.UpdateStatus(apiID, "stopped", ""); err != nil {
-		fmt.Printf("Warning: Failed to update API status: %v\n", err)
+		logger.FromContext(r.Context()).Warn("Failed to update API status", map[string]interface{}{
+			"api_id": apiID,
+			"error":  err.Error(),
+		})
 	}
 
+	webhooks.Emit(r.Context(), h.webhookRepo, api.UserID, models.EventAPIStopped, map[string]interface{}{
+		"api_id": api.ID,
+		"name":   api.Name,
+	})
+
 	// Get updated API data
 	updatedAPI, _ := h.apiRepo.GetByID(apiID)
 
@@ -163,14 +240,45 @@ func (h *DeployHandler) StopAPI(w http.ResponseWriter, r *http.Request) {
 	})
 }
 
+// deploymentFailed marks the API failed and raises deployment.failed
+func (h *DeployHandler) deploymentFailed(ctx context.Context, api *models.API, reason string) {
+	if err := h.apiRepo.UpdateStatus(api.ID, "failed", ""); err != nil {
+		logger.FromContext(ctx).Warn("Failed to update API status", map[string]interface{}{
+			"api_id": api.ID,
+			"error":  err.Error(),
+		})
+	}
+
+	webhooks.Emit(ctx, h.webhookRepo, api.UserID, models.EventDeploymentFailed, map[string]interface{}{
+		"api_id":  api.ID,
+		"name":    api.Name,
+		"version": api.Version,
+		"error":   reason,
+	})
+}
+
 func (h *DeployHandler) GetAPIStatus(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
 	apiID := vars["id"]
 
 	// Call executor service
-	url := fmt.Sprintf("%s/status/%s", h.executorURL, apiID)
-	resp, err := http.Get(url)
+	node, err := h.executors.Pick(apiID, "", nil)
+	if err != nil {
+		http.Error(w, "Failed to communicate with executor service", http.StatusInternalServerError)
+		return
+	}
+	url := fmt.Sprintf("%s/status/%s", node.URL, apiID)
+	req, span, err := tracing.NewRequest(r.Context(), "GET", url, nil)
+	if err != nil {
+		http.Error(w, "Failed to communicate with executor service", http.StatusInternalServerError)
+		return
+	}
+	defer span.End()
+	req.Header.Set(logger.RequestIDHeader, logger.RequestID(r.Context()))
+
+	resp, err := h.executors.Client().Do(req)
 	if err != nil {
+		span.SetError(err)
 		http.Error(w, "Failed to communicate with executor service", http.StatusInternalServerError)
 		return
 	}
@@ -0,0 +1,76 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/aKaddoura96/api-hosting-execution-platform/backend/shared/egress"
+	"github.com/aKaddoura96/api-hosting-execution-platform/backend/shared/models"
+	"github.com/aKaddoura96/api-hosting-execution-platform/backend/shared/repository"
+)
+
+type EgressHandler struct {
+	apiRepo    *repository.APIRepository
+	egressRepo *repository.EgressRepository
+}
+
+func NewEgressHandler(apiRepo *repository.APIRepository, egressRepo *repository.EgressRepository) *EgressHandler {
+	return &EgressHandler{apiRepo: apiRepo, egressRepo: egressRepo}
+}
+
+type UpdateEgressPolicyRequest struct {
+	Enabled   bool     `json:"enabled"`
+	Allowlist []string `json:"allowlist"`
+}
+
+func (h *EgressHandler) GetEgressPolicy(w http.ResponseWriter, r *http.Request) {
+	api, ok := authorizeAPIOwner(w, r, h.apiRepo)
+	if !ok {
+		return
+	}
+
+	policy, err := h.egressRepo.GetPolicy(api.ID)
+	if err != nil {
+		http.Error(w, "Failed to get egress policy", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(policy)
+}
+
+// UpdateEgressPolicy replaces the API's egress policy. Allowlist entries are
+// domains, *.domain wildcards, IPs or CIDRs; private addresses are only
+// reachable when listed as an IP or CIDR.
+func (h *EgressHandler) UpdateEgressPolicy(w http.ResponseWriter, r *http.Request) {
+	api, ok := authorizeAPIOwner(w, r, h.apiRepo)
+	if !ok {
+		return
+	}
+
+	var req UpdateEgressPolicyRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	allowlist := cleanList(req.Allowlist)
+	if _, err := egress.Parse(allowlist); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	policy := &models.EgressPolicy{
+		APIID:     api.ID,
+		Enabled:   req.Enabled,
+		Allowlist: allowlist,
+	}
+
+	if err := h.egressRepo.UpsertPolicy(policy); err != nil {
+		http.Error(w, "Failed to update egress policy", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(policy)
+}
@@ -0,0 +1,131 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"regexp"
+	"strings"
+
+	"github.com/aKaddoura96/api-hosting-execution-platform/backend/shared/models"
+	"github.com/aKaddoura96/api-hosting-execution-platform/backend/shared/repository"
+	"github.com/aKaddoura96/api-hosting-execution-platform/backend/shared/secrets"
+	"github.com/gorilla/mux"
+)
+
+// maxEnvValueBytes bounds a single variable's value
+const maxEnvValueBytes = 32 * 1024
+
+var envNamePattern = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// reservedEnvNames are set by the platform and can't be overridden
+var reservedEnvNames = map[string]bool{
+	"TRACEPARENT": true,
+	"PATH":        true,
+	"HOME":        true,
+	"HOSTNAME":    true,
+}
+
+type EnvHandler struct {
+	apiRepo *repository.APIRepository
+	envRepo *repository.EnvVarRepository
+	keyring *secrets.Keyring // nil when SECRETS_ENCRYPTION_KEY is not set
+}
+
+func NewEnvHandler(apiRepo *repository.APIRepository, envRepo *repository.EnvVarRepository, keyring *secrets.Keyring) *EnvHandler {
+	return &EnvHandler{apiRepo: apiRepo, envRepo: envRepo, keyring: keyring}
+}
+
+type SetEnvRequest struct {
+	Value   string `json:"value"`
+	Secret  bool   `json:"secret"`
+	Version string `json:"version"` // empty applies to every version
+}
+
+// GetEnv lists an API's variables. Secret values are never included.
+func (h *EnvHandler) GetEnv(w http.ResponseWriter, r *http.Request) {
+	api, ok := authorizeAPIOwner(w, r, h.apiRepo)
+	if !ok {
+		return
+	}
+
+	vars, err := h.envRepo.GetByAPIID(api.ID)
+	if err != nil {
+		http.Error(w, "Failed to get environment variables", http.StatusInternalServerError)
+		return
+	}
+	if vars == nil {
+		vars = []*models.EnvVar{}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(vars)
+}
+
+// SetEnv creates or replaces the variable {name}. Secrets are encrypted
+// before storage and their value is not echoed back.
+func (h *EnvHandler) SetEnv(w http.ResponseWriter, r *http.Request) {
+	api, ok := authorizeAPIOwner(w, r, h.apiRepo)
+	if !ok {
+		return
+	}
+
+	name := mux.Vars(r)["name"]
+	if !envNamePattern.MatchString(name) {
+		http.Error(w, "Variable names may contain only letters, digits and underscores and must not start with a digit", http.StatusBadRequest)
+		return
+	}
+	if reservedEnvNames[strings.ToUpper(name)] {
+		http.Error(w, name+" is reserved by the platform", http.StatusBadRequest)
+		return
+	}
+
+	var req SetEnvRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	if len(req.Value) > maxEnvValueBytes {
+		http.Error(w, "Value is too large", http.StatusBadRequest)
+		return
+	}
+
+	v := &models.EnvVar{APIID: api.ID, Version: req.Version, Name: name, Value: req.Value}
+	if req.Secret {
+		if h.keyring == nil {
+			http.Error(w, "Secrets are not enabled on this server", http.StatusServiceUnavailable)
+			return
+		}
+		if err := h.keyring.SealEnvVar(v, req.Value); err != nil {
+			http.Error(w, "Failed to encrypt secret", http.StatusInternalServerError)
+			return
+		}
+	}
+
+	if err := h.envRepo.Upsert(v); err != nil {
+		http.Error(w, "Failed to save environment variable", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(v)
+}
+
+// DeleteEnv removes the variable {name}; ?version= selects a version override
+func (h *EnvHandler) DeleteEnv(w http.ResponseWriter, r *http.Request) {
+	api, ok := authorizeAPIOwner(w, r, h.apiRepo)
+	if !ok {
+		return
+	}
+
+	deleted, err := h.envRepo.Delete(api.ID, r.URL.Query().Get("version"), mux.Vars(r)["name"])
+	if err != nil {
+		http.Error(w, "Failed to delete environment variable", http.StatusInternalServerError)
+		return
+	}
+	if !deleted {
+		http.Error(w, "Environment variable not found", http.StatusNotFound)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -2,46 +2,92 @@ package handlers
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"fmt"
 	"io"
 	"net/http"
 	"os"
+	"strconv"
+	"strings"
+	"time"
 
+	"github.com/aKaddoura96/api-hosting-execution-platform/backend/api-gateway/executors"
+	"github.com/aKaddoura96/api-hosting-execution-platform/backend/api-gateway/idempotency"
+	"github.com/aKaddoura96/api-hosting-execution-platform/backend/shared/logger"
 	"github.com/aKaddoura96/api-hosting-execution-platform/backend/shared/models"
 	"github.com/aKaddoura96/api-hosting-execution-platform/backend/shared/repository"
+	"github.com/aKaddoura96/api-hosting-execution-platform/backend/shared/tracing"
+	"github.com/aKaddoura96/api-hosting-execution-platform/backend/shared/webhooks"
+	"github.com/google/uuid"
 	"github.com/gorilla/mux"
 )
 
+// maxExecutorResponseBytes bounds a reply read from the executor. The executor
+// caps output itself (OUTPUT_MAX_RESULT_BYTES), and a reply carries it at most
+// twice: raw and parsed as JSON.
+const maxExecutorResponseBytes = 8 << 20
+
 type ExecuteHandler struct {
-	apiRepo     *repository.APIRepository
-	executorURL string
+	apiRepo          *repository.APIRepository
+	execRepo         *repository.ExecutionRepository
+	captureRepo      *repository.CaptureRepository
+	versionRepo      *repository.APIVersionRepository
+	jobRepo          *repository.JobRepository
+	webhookRepo      *repository.WebhookRepository
+	scalingRepo      *repository.ScalingRepository
+	subscriptionRepo *repository.SubscriptionRepository
+	executors        *executors.Pool
+	replicas         *executors.Replicas
+	keys             *idempotency.Keys
 }
 
-func NewExecuteHandler(apiRepo *repository.APIRepository) *ExecuteHandler {
-	executorURL := os.Getenv("EXECUTOR_URL")
-	if executorURL == "" {
-		executorURL = "http://localhost:8081"
-	}
-
+func NewExecuteHandler(
+	apiRepo *repository.APIRepository,
+	execRepo *repository.ExecutionRepository,
+	captureRepo *repository.CaptureRepository,
+	versionRepo *repository.APIVersionRepository,
+	jobRepo *repository.JobRepository,
+	webhookRepo *repository.WebhookRepository,
+	scalingRepo *repository.ScalingRepository,
+	subscriptionRepo *repository.SubscriptionRepository,
+	executors *executors.Pool,
+	replicas *executors.Replicas,
+	keys *idempotency.Keys,
+) *ExecuteHandler {
 	return &ExecuteHandler{
-		apiRepo:     apiRepo,
-		executorURL: executorURL,
+		apiRepo:          apiRepo,
+		execRepo:         execRepo,
+		captureRepo:      captureRepo,
+		versionRepo:      versionRepo,
+		jobRepo:          jobRepo,
+		webhookRepo:      webhookRepo,
+		scalingRepo:      scalingRepo,
+		subscriptionRepo: subscriptionRepo,
+		executors:        executors,
+		replicas:         replicas,
+		keys:             keys,
 	}
 }
 
 type ExecuteRequest struct {
-	Input      map[string]interface{} `json:"input"`
-	TimeoutSec int                    `json:"timeout_sec,omitempty"`
+	Input       map[string]interface{} `json:"input"`
+	TimeoutSec  int                    `json:"timeout_sec,omitempty"`
+	CallbackURL string                 `json:"callback_url,omitempty"` // async only
 }
 
 type ExecuteResponse struct {
-	Output     string                 `json:"output"`
-	Error      string                 `json:"error,omitempty"`
-	StatusCode int                    `json:"status_code"`
-	DurationMS int                    `json:"duration_ms"`
-	ExitCode   int                    `json:"exit_code"`
-	Result     map[string]interface{} `json:"result,omitempty"`
+	ExecutionID string                 `json:"execution_id"`
+	Output      string                 `json:"output"`
+	Error       string                 `json:"error,omitempty"`
+	StatusCode  int                    `json:"status_code"`
+	DurationMS  int                    `json:"duration_ms"`
+	QueueMS     int                    `json:"queue_ms"`
+	ExitCode    int                    `json:"exit_code"`
+	Result      map[string]interface{} `json:"result,omitempty"`
+	EgressBytes int64                  `json:"egress_bytes,omitempty"`
+	Truncated   bool                   `json:"truncated,omitempty"`
+	RetryAfter  int                    `json:"retry_after,omitempty"` // seconds, when the executor was too busy
 }
 
 // ExecuteAPI handles requests to invoke a deployed API
@@ -84,6 +130,8 @@ func (h *ExecuteHandler) ExecuteAPI(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	ctx := logger.AddFields(r.Context(), map[string]interface{}{"api_id": targetAPI.ID})
+
 	// Check if API is deployed
 	if targetAPI.Status != "deployed" {
 		http.Error(w, fmt.Sprintf("API is not deployed. Current status: %s", targetAPI.Status), http.StatusBadRequest)
@@ -102,46 +150,305 @@ func (h *ExecuteHandler) ExecuteAPI(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "Failed to read API code", http.StatusInternalServerError)
 		return
 	}
+	code := models.EncodeCode(targetAPI.Runtime, codeBytes)
 
-	// Parse input from request
-	var execReq ExecuteRequest
+	// Subscribers are held to the daily quota of their plan
+	if !h.checkQuota(ctx, w, r, targetAPI) {
+		return
+	}
+
+	// Parse input from request (kept raw for capture)
+	var rawBody []byte
 	if r.Body != nil {
-		json.NewDecoder(r.Body).Decode(&execReq)
+		rawBody, _ = io.ReadAll(r.Body)
 	}
 
-	// Prepare executor request
-	executorReq := map[string]interface{}{
-		"code":    string(codeBytes),
-		"runtime": targetAPI.Runtime,
-		"input":   execReq.Input,
+	// Requests with an Idempotency-Key run once; repeats get the same response
+	if key := r.Header.Get(idempotency.Header); key != "" {
+		h.executeOnce(ctx, w, r, key, targetAPI, code, rawBody)
+		return
 	}
+	h.execute(ctx, w, r, targetAPI, code, rawBody)
+}
 
-	if execReq.TimeoutSec > 0 {
-		executorReq["timeout_sec"] = execReq.TimeoutSec
+// execute runs a request to an API: on its replicas, queued as a job,
+// streamed or waited for
+func (h *ExecuteHandler) execute(ctx context.Context, w http.ResponseWriter, r *http.Request, targetAPI *models.API, code string, rawBody []byte) {
+	log := logger.FromContext(ctx)
+
+	// APIs that run as replicas are served by them, request for request
+	policy, err := h.scalingRepo.GetPolicy(targetAPI.ID)
+	if err != nil {
+		http.Error(w, "Failed to lookup API", http.StatusInternalServerError)
+		return
+	}
+	if policy.Persistent() {
+		if r.URL.Query().Get("async") == "true" || streamMode(r) != "" {
+			http.Error(w, "Async and streaming execution are not available for APIs with replicas", http.StatusBadRequest)
+			return
+		}
+		h.serveFromReplicas(ctx, w, r, targetAPI, code, uuid.New().String(), rawBody)
+		return
 	}
 
-	// Call executor service
-	reqBody, _ := json.Marshal(executorReq)
-	resp, err := http.Post(
-		h.executorURL+"/execute",
-		"application/json",
-		bytes.NewBuffer(reqBody),
-	)
+	var execReq ExecuteRequest
+	json.Unmarshal(rawBody, &execReq)
+
+	if msg := checkTimeout(&execReq, targetAPI.ResourceClass); msg != "" {
+		http.Error(w, msg, http.StatusBadRequest)
+		return
+	}
+
+	if r.URL.Query().Get("async") == "true" {
+		h.enqueueExecution(ctx, w, r, targetAPI, code, &execReq)
+		return
+	}
+
+	// Assign the execution ID up front so output logs can be tied to it
+	executionID := uuid.New().String()
+	startTime := time.Now()
+
+	if mode := streamMode(r); mode != "" {
+		h.streamExecution(ctx, w, r, mode, executionID, targetAPI, code, &execReq, rawBody)
+		return
+	}
+
+	target := currentVersion(targetAPI)
+	status, respBody, err := h.invokeExecutor(ctx, executionID, target, targetAPI.UserID, code, &execReq)
 	if err != nil {
+		log.Error("Executor call failed", map[string]interface{}{"error": err.Error()})
 		http.Error(w, "Failed to execute API code", http.StatusInternalServerError)
 		return
 	}
-	defer resp.Body.Close()
+	if status != http.StatusServiceUnavailable {
+		executionStarted(w)
+	}
 
-	// Read response
-	respBody, _ := io.ReadAll(resp.Body)
+	userID, _ := r.Context().Value("api_key_user_id").(string)
+	h.recordExecution(ctx, executionID, target, userID, int64(len(rawBody)), status, respBody, time.Since(startTime))
+	h.captureExecution(ctx, r, executionID, targetAPI, rawBody, status, respBody)
 
 	// Return result
 	w.Header().Set("Content-Type", "application/json")
-	w.WriteHeader(resp.StatusCode)
+	w.Header().Set("X-Execution-ID", executionID)
+	setRetryAfter(w, status, respBody)
+	w.WriteHeader(status)
 	w.Write(respBody)
 }
 
+// currentVersion describes an API's deployed code as the version to execute
+func currentVersion(api *models.API) *models.APIVersion {
+	return &models.APIVersion{
+		APIID:         api.ID,
+		Version:       api.Version,
+		Runtime:       api.Runtime,
+		CodePath:      api.CodePath,
+		ResourceClass: api.ResourceClass,
+	}
+}
+
+// checkTimeout rejects a timeout above the ceiling of the resource class
+func checkTimeout(execReq *ExecuteRequest, resourceClass string) string {
+	class, ok := models.GetResourceClass(resourceClass)
+	if !ok || execReq.TimeoutSec <= class.MaxTimeoutSec {
+		return ""
+	}
+	return fmt.Sprintf("timeout_sec exceeds the %d second limit of the %s resource class", class.MaxTimeoutSec, class.Name)
+}
+
+// sendToExecutor sends code to the /execute endpoint of an executor node,
+// trying another node if the first can't take it. Executions waiting for a
+// slot are scheduled fairly between tenants, the developers owning the APIs.
+// The caller must End the returned span and close the response body.
+func (h *ExecuteHandler) sendToExecutor(ctx context.Context, executionID string, target *models.APIVersion, tenantID, code string, execReq *ExecuteRequest, stream bool) (*http.Response, *tracing.Span, error) {
+	executorReq := map[string]interface{}{
+		"execution_id":   executionID,
+		"api_id":         target.APIID,
+		"tenant_id":      tenantID,
+		"version":        target.Version,
+		"code":           code,
+		"runtime":        target.Runtime,
+		"resource_class": target.ResourceClass,
+		"input":          execReq.Input,
+	}
+
+	if execReq.TimeoutSec > 0 {
+		executorReq["timeout_sec"] = execReq.TimeoutSec
+	}
+	if stream {
+		executorReq["stream"] = true
+	}
+
+	reqBody, _ := json.Marshal(executorReq)
+	ctx, span := tracing.StartSpan(ctx, "POST /execute", tracing.SpanKindClient)
+	span.SetAttribute("http.method", "POST")
+	span.SetAttribute("api.id", target.APIID)
+	span.SetAttribute("api.runtime", target.Runtime)
+
+	resp, err := h.executors.Do(ctx, target.APIID, target.Runtime, func(node *models.ExecutorNode) (*http.Request, error) {
+		req, err := http.NewRequestWithContext(ctx, "POST", node.URL+"/execute", bytes.NewReader(reqBody))
+		if err != nil {
+			return nil, err
+		}
+		span.SetAttribute("executor.node", node.ID)
+		tracing.Inject(ctx, req.Header)
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set(logger.RequestIDHeader, logger.RequestID(ctx))
+		return req, nil
+	})
+	if err != nil {
+		span.SetError(err)
+		return nil, span, err
+	}
+
+	return resp, span, nil
+}
+
+// invokeExecutor runs code on the executor service and returns its raw reply
+func (h *ExecuteHandler) invokeExecutor(ctx context.Context, executionID string, target *models.APIVersion, tenantID, code string, execReq *ExecuteRequest) (int, []byte, error) {
+	resp, span, err := h.sendToExecutor(ctx, executionID, target, tenantID, code, execReq, false)
+	defer span.End()
+	if err != nil {
+		return 0, nil, err
+	}
+	defer resp.Body.Close()
+
+	respBody, err := io.ReadAll(io.LimitReader(resp.Body, maxExecutorResponseBytes+1))
+	if err != nil {
+		span.SetError(err)
+		return 0, nil, err
+	}
+	if len(respBody) > maxExecutorResponseBytes {
+		respBody, _ = json.Marshal(ExecuteResponse{
+			ExecutionID: executionID,
+			Error:       fmt.Sprintf("Response body exceeds the %d byte limit", maxExecutorResponseBytes),
+			StatusCode:  http.StatusRequestEntityTooLarge,
+			Truncated:   true,
+		})
+		return http.StatusRequestEntityTooLarge, respBody, nil
+	}
+
+	// The executor had no slot free; its plain text reply is made a result
+	// so the retry hint reaches the caller
+	if resp.StatusCode == http.StatusServiceUnavailable {
+		retryAfter, _ := strconv.Atoi(resp.Header.Get("Retry-After"))
+		respBody, _ = json.Marshal(ExecuteResponse{
+			ExecutionID: executionID,
+			Error:       strings.TrimSpace(string(respBody)),
+			StatusCode:  http.StatusServiceUnavailable,
+			RetryAfter:  retryAfter,
+		})
+		return http.StatusServiceUnavailable, respBody, nil
+	}
+
+	// The executor replies 200 for failed code, but an oversized response is
+	// the caller's problem too, so it becomes a 413 here
+	var result struct {
+		StatusCode int `json:"status_code"`
+	}
+	if json.Unmarshal(respBody, &result) == nil && result.StatusCode == http.StatusRequestEntityTooLarge {
+		return http.StatusRequestEntityTooLarge, respBody, nil
+	}
+
+	return resp.StatusCode, respBody, nil
+}
+
+// recordExecution stores the executions row for an invocation, billed by the
+// target's resource class. The executor replies 200 even when user code
+// fails, so the status comes from the body. Time spent waiting for an
+// executor slot is recorded but not billed.
+func (h *ExecuteHandler) recordExecution(ctx context.Context, executionID string, target *models.APIVersion, userID string, requestSize int64, httpStatus int, respBody []byte, duration time.Duration) {
+	execution := &models.Execution{
+		ID:            executionID,
+		APIID:         target.APIID,
+		UserID:        userID,
+		StatusCode:    httpStatus,
+		Duration:      duration,
+		RequestSize:   requestSize,
+		ResponseSize:  int64(len(respBody)),
+		ResourceClass: target.ResourceClass,
+	}
+
+	var result ExecuteResponse
+	if err := json.Unmarshal(respBody, &result); err == nil && result.StatusCode != 0 {
+		execution.StatusCode = result.StatusCode
+		execution.Error = result.Error
+		execution.EgressBytes = result.EgressBytes
+		execution.QueueTime = time.Duration(result.QueueMS) * time.Millisecond
+	} else if httpStatus >= 400 {
+		execution.Error = string(respBody)
+	}
+	if execution.StatusCode == http.StatusServiceUnavailable {
+		// Never admitted, so all of it was spent waiting
+		execution.QueueTime = duration
+	}
+	if execution.QueueTime > execution.Duration {
+		execution.QueueTime = execution.Duration
+	}
+	execution.Duration -= execution.QueueTime
+
+	if class, ok := models.GetResourceClass(target.ResourceClass); ok && execution.StatusCode != http.StatusServiceUnavailable {
+		execution.ComputeUnits = class.ComputeUnits(execution.Duration)
+	}
+
+	if err := h.execRepo.Create(execution); err != nil {
+		logger.FromContext(ctx).Error("Failed to record execution", map[string]interface{}{
+			"execution_id": executionID,
+			"error":        err.Error(),
+		})
+	}
+
+	webhooks.EmitExecutionFailed(ctx, h.webhookRepo, execution)
+}
+
+// setRetryAfter passes on the executor's retry hint when it had no slot free
+func setRetryAfter(w http.ResponseWriter, status int, respBody []byte) {
+	if status != http.StatusServiceUnavailable {
+		return
+	}
+	var result ExecuteResponse
+	if json.Unmarshal(respBody, &result) == nil && result.RetryAfter > 0 {
+		w.Header().Set("Retry-After", strconv.Itoa(result.RetryAfter))
+	}
+}
+
+// captureExecution stores the redacted request envelope and response when the
+// API has capture enabled
+func (h *ExecuteHandler) captureExecution(ctx context.Context, r *http.Request, executionID string, api *models.API, rawBody []byte, status int, respBody []byte) {
+	log := logger.FromContext(ctx)
+
+	settings, err := h.captureRepo.GetSettings(api.ID)
+	if err != nil {
+		log.Error("Failed to load capture settings", map[string]interface{}{"error": err.Error()})
+		return
+	}
+	if !settings.Enabled {
+		return
+	}
+
+	capture := &models.ExecutionCapture{
+		ExecutionID:    executionID,
+		APIID:          api.ID,
+		Version:        api.Version,
+		Method:         r.Method,
+		Path:           r.URL.Path,
+		Query:          r.URL.RawQuery,
+		Headers:        redactHeaders(r.Header, settings.RedactHeaders),
+		ResponseStatus: status,
+		ResponseBody:   redactJSON(respBody, settings.RedactFields),
+	}
+	if len(rawBody) > 0 {
+		capture.Body = redactJSON(rawBody, settings.RedactFields)
+	}
+
+	if err := h.captureRepo.Create(capture); err != nil {
+		log.Error("Failed to store execution capture", map[string]interface{}{
+			"execution_id": executionID,
+			"error":        err.Error(),
+		})
+	}
+}
+
 // GetAPIByEndpoint is a helper to find API by its endpoint
 func (h *ExecuteHandler) GetAPIByEndpoint(endpoint string) (*models.API, error) {
 	// This is a simple implementation - in production you'd want to optimize this
@@ -0,0 +1,178 @@
+package handlers
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/aKaddoura96/api-hosting-execution-platform/backend/shared/logger"
+	"github.com/aKaddoura96/api-hosting-execution-platform/backend/shared/models"
+)
+
+const (
+	streamModeSSE     = "sse"
+	streamModeChunked = "chunked"
+
+	// maxStreamEventBytes bounds a single event relayed from the executor; the
+	// final result event is as large as a buffered reply
+	maxStreamEventBytes = maxExecutorResponseBytes
+)
+
+// streamMode picks how output is returned: Server-Sent Events when the client
+// accepts text/event-stream or asks for ?stream=sse, raw chunked stdout for
+// ?stream=true or ?stream=chunked, and a single buffered reply otherwise
+func streamMode(r *http.Request) string {
+	switch strings.ToLower(r.URL.Query().Get("stream")) {
+	case "sse":
+		return streamModeSSE
+	case "true", "1", "chunked":
+		return streamModeChunked
+	}
+	if strings.Contains(r.Header.Get("Accept"), "text/event-stream") {
+		return streamModeSSE
+	}
+	return ""
+}
+
+// executorEvent is one Server-Sent Event read from the executor
+type executorEvent struct {
+	Name string
+	Data []byte
+}
+
+// readExecutorEvents parses the executor's event stream, calling fn per event
+func readExecutorEvents(body io.Reader, fn func(executorEvent) error) error {
+	scanner := bufio.NewScanner(body)
+	scanner.Buffer(make([]byte, 64*1024), maxStreamEventBytes)
+
+	var event executorEvent
+	for scanner.Scan() {
+		line := scanner.Text()
+		switch {
+		case line == "":
+			if event.Name != "" || event.Data != nil {
+				if err := fn(event); err != nil {
+					return err
+				}
+			}
+			event = executorEvent{}
+		case strings.HasPrefix(line, "event:"):
+			event.Name = strings.TrimSpace(strings.TrimPrefix(line, "event:"))
+		case strings.HasPrefix(line, "data:"):
+			event.Data = append(event.Data, strings.TrimPrefix(strings.TrimPrefix(line, "data:"), " ")...)
+		}
+	}
+	return scanner.Err()
+}
+
+// streamExecution runs the API in streaming mode and flushes output to the
+// client as the executor produces it. Timeout and size limits are enforced by
+// the executor exactly as for buffered executions; in chunked mode the final
+// status is sent in the X-Execution-Status and X-Exit-Code trailers.
+func (h *ExecuteHandler) streamExecution(ctx context.Context, w http.ResponseWriter, r *http.Request, mode, executionID string, api *models.API, code string, execReq *ExecuteRequest, rawBody []byte) {
+	log := logger.FromContext(ctx)
+	startTime := time.Now()
+
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "Streaming not supported", http.StatusInternalServerError)
+		return
+	}
+
+	resp, span, err := h.sendToExecutor(ctx, executionID, currentVersion(api), api.UserID, code, execReq, true)
+	defer span.End()
+	span.SetAttribute("stream", mode)
+	if err != nil {
+		log.Error("Executor call failed", map[string]interface{}{"error": err.Error()})
+		http.Error(w, "Failed to execute API code", http.StatusInternalServerError)
+		return
+	}
+	defer resp.Body.Close()
+
+	userID, _ := r.Context().Value("api_key_user_id").(string)
+
+	// Rejected before anything ran: relay the error as a normal reply
+	if resp.StatusCode != http.StatusOK {
+		respBody, _ := io.ReadAll(resp.Body)
+		h.recordExecution(ctx, executionID, currentVersion(api), userID, int64(len(rawBody)), resp.StatusCode, respBody, time.Since(startTime))
+		h.captureExecution(ctx, r, executionID, api, rawBody, resp.StatusCode, respBody)
+		w.Header().Set("X-Execution-ID", executionID)
+		if retryAfter := resp.Header.Get("Retry-After"); retryAfter != "" {
+			w.Header().Set("Retry-After", retryAfter)
+		}
+		http.Error(w, strings.TrimSpace(string(respBody)), resp.StatusCode)
+		return
+	}
+
+	w.Header().Set("X-Execution-ID", executionID)
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("X-Accel-Buffering", "no")
+	if mode == streamModeSSE {
+		w.Header().Set("Content-Type", "text/event-stream")
+	} else {
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		w.Header().Set("Trailer", "X-Execution-Status, X-Exit-Code")
+	}
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	status := http.StatusOK
+	var final []byte
+
+	err = readExecutorEvents(resp.Body, func(event executorEvent) error {
+		switch event.Name {
+		case "result":
+			final = event.Data
+		case "error":
+			status = http.StatusInternalServerError
+			final = event.Data
+		}
+
+		if mode == streamModeSSE {
+			if _, err := fmt.Fprintf(w, "event: %s\ndata: %s\n\n", event.Name, event.Data); err != nil {
+				return err
+			}
+		} else if event.Name == "output" {
+			var chunk struct {
+				Stream string `json:"stream"`
+				Data   string `json:"data"`
+			}
+			if json.Unmarshal(event.Data, &chunk) != nil || chunk.Stream != "stdout" {
+				return nil
+			}
+			if _, err := io.WriteString(w, chunk.Data); err != nil {
+				return err
+			}
+		}
+		flusher.Flush()
+		return nil
+	})
+	if err != nil && r.Context().Err() == nil {
+		span.SetError(err)
+		log.Warn("Execution stream interrupted", map[string]interface{}{"error": err.Error()})
+	}
+
+	if final == nil {
+		status = http.StatusBadGateway
+		final, _ = json.Marshal(map[string]string{"error": "Execution stream ended without a result"})
+	}
+
+	if mode == streamModeChunked {
+		var result ExecuteResponse
+		json.Unmarshal(final, &result)
+		if result.StatusCode == 0 {
+			result.StatusCode = status
+		}
+		w.Header().Set("X-Execution-Status", strconv.Itoa(result.StatusCode))
+		w.Header().Set("X-Exit-Code", strconv.Itoa(result.ExitCode))
+	}
+
+	h.recordExecution(ctx, executionID, currentVersion(api), userID, int64(len(rawBody)), status, final, time.Since(startTime))
+	h.captureExecution(ctx, r, executionID, api, rawBody, status, final)
+}
@@ -0,0 +1,127 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"net/http"
+	"slices"
+
+	"github.com/aKaddoura96/api-hosting-execution-platform/backend/api-gateway/idempotency"
+	"github.com/aKaddoura96/api-hosting-execution-platform/backend/shared/logger"
+	"github.com/aKaddoura96/api-hosting-execution-platform/backend/shared/models"
+)
+
+// executeOnce runs a request sent with an Idempotency-Key at most once per
+// key. A repeat gets the stored response, waiting for it if the first request
+// is still running; a different request with the same key gets 409. Keys are
+// per API and per API key user, so a request without an API key can't use one.
+func (h *ExecuteHandler) executeOnce(ctx context.Context, w http.ResponseWriter, r *http.Request, key string, api *models.API, code string, rawBody []byte) {
+	log := logger.FromContext(ctx)
+
+	if len(key) > idempotency.MaxKeyLength {
+		http.Error(w, "Idempotency-Key is too long", http.StatusBadRequest)
+		return
+	}
+	// A stream can't be replayed
+	if streamMode(r) != "" {
+		http.Error(w, "Idempotency-Key is not supported for streaming execution", http.StatusBadRequest)
+		return
+	}
+
+	caller, _ := r.Context().Value("api_key_user_id").(string)
+	claim, err := h.keys.Begin(ctx, api.ID, caller, key, idempotency.Fingerprint(r, rawBody))
+	switch {
+	case errors.Is(err, idempotency.ErrNoCaller):
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return
+	case errors.Is(err, idempotency.ErrKeyReused):
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	case err != nil && ctx.Err() != nil:
+		// The client gave up waiting for the request holding the key
+		return
+	case err != nil:
+		log.Error("Idempotency key lookup failed", map[string]interface{}{"error": err.Error()})
+		http.Error(w, "Failed to check idempotency key", http.StatusInternalServerError)
+		return
+	}
+
+	if claim.Status == models.IdempotencyCompleted {
+		for name, values := range claim.ResponseHeaders {
+			w.Header()[name] = values
+		}
+		w.Header().Set(idempotency.ReplayedHeader, "true")
+		w.WriteHeader(claim.ResponseStatus)
+		w.Write(claim.ResponseBody)
+		return
+	}
+
+	// The request runs to the end even if the client goes away, so the retry
+	// waiting on the key gets its response
+	recorder := newResponseRecorder(w)
+	h.execute(context.WithoutCancel(ctx), recorder, r, api, code, rawBody)
+
+	if recorder.status == 0 {
+		recorder.WriteHeader(http.StatusOK)
+	}
+
+	// The request failed here, or no executor had a slot for it, so nothing
+	// ran and a retry may run it
+	if !recorder.executed {
+		if err := h.keys.Release(claim); err != nil {
+			log.Error("Failed to release idempotency key", map[string]interface{}{"error": err.Error()})
+		}
+		return
+	}
+	if err := h.keys.Complete(claim, recorder.status, recorder.header, recorder.body.Bytes()); err != nil {
+		log.Error("Failed to store idempotent response", map[string]interface{}{"error": err.Error()})
+		h.keys.Release(claim)
+	}
+}
+
+// responseRecorder passes a response on to the client and keeps a copy of
+// it, with the headers set since it was created
+type responseRecorder struct {
+	http.ResponseWriter
+	before   http.Header
+	header   http.Header
+	status   int
+	body     bytes.Buffer
+	executed bool // set by executionStarted
+}
+
+// executionStarted notes that the request reached user code: an executor or
+// replica answered it, or it was queued as a job. Only then is the response
+// of an idempotent request kept for repeats.
+func executionStarted(w http.ResponseWriter) {
+	if recorder, ok := w.(*responseRecorder); ok {
+		recorder.executed = true
+	}
+}
+
+func newResponseRecorder(w http.ResponseWriter) *responseRecorder {
+	return &responseRecorder{ResponseWriter: w, before: w.Header().Clone()}
+}
+
+func (rr *responseRecorder) WriteHeader(status int) {
+	if rr.status != 0 {
+		return
+	}
+	rr.status = status
+	rr.header = http.Header{}
+	for name, values := range rr.Header() {
+		if !slices.Equal(rr.before[name], values) {
+			rr.header[name] = values
+		}
+	}
+	rr.ResponseWriter.WriteHeader(status)
+}
+
+func (rr *responseRecorder) Write(b []byte) (int, error) {
+	if rr.status == 0 {
+		rr.WriteHeader(http.StatusOK)
+	}
+	rr.body.Write(b)
+	return rr.ResponseWriter.Write(b)
+}
@@ -0,0 +1,157 @@
+package handlers
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/aKaddoura96/api-hosting-execution-platform/backend/api-gateway/executors"
+	"github.com/aKaddoura96/api-hosting-execution-platform/backend/shared/logger"
+	"github.com/aKaddoura96/api-hosting-execution-platform/backend/shared/models"
+	"github.com/aKaddoura96/api-hosting-execution-platform/backend/shared/repository"
+	"github.com/aKaddoura96/api-hosting-execution-platform/backend/shared/tracing"
+)
+
+// maxDockerfileBytes caps the Dockerfile of a custom image
+const maxDockerfileBytes = 64 << 10
+
+type ImageHandler struct {
+	apiRepo   *repository.APIRepository
+	imageRepo *repository.CustomImageRepository
+	executors *executors.Pool
+}
+
+func NewImageHandler(apiRepo *repository.APIRepository, imageRepo *repository.CustomImageRepository, executors *executors.Pool) *ImageHandler {
+	return &ImageHandler{apiRepo: apiRepo, imageRepo: imageRepo, executors: executors}
+}
+
+// UpdateImageRequest sets a custom image from a Dockerfile or, for an image
+// that already contains the handler, just its reference
+type UpdateImageRequest struct {
+	Dockerfile string `json:"dockerfile"`
+	BaseImage  string `json:"base_image"`
+}
+
+// GetImage returns the API's custom image and the state of its build
+func (h *ImageHandler) GetImage(w http.ResponseWriter, r *http.Request) {
+	api, ok := authorizeAPIOwner(w, r, h.apiRepo)
+	if !ok {
+		return
+	}
+
+	img, err := h.imageRepo.GetByAPIID(api.ID)
+	if err != nil {
+		http.Error(w, "No custom image", http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(img)
+}
+
+// UpdateImage replaces the API's Dockerfile and starts building it. The
+// previous image keeps serving until the build succeeds.
+func (h *ImageHandler) UpdateImage(w http.ResponseWriter, r *http.Request) {
+	api, ok := authorizeAPIOwner(w, r, h.apiRepo)
+	if !ok {
+		return
+	}
+	if api.Runtime != models.RuntimeCustom {
+		http.Error(w, "Only APIs with the custom runtime have an image", http.StatusBadRequest)
+		return
+	}
+
+	var req UpdateImageRequest
+	if err := json.NewDecoder(io.LimitReader(r.Body, 2*maxDockerfileBytes)).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	req.BaseImage = strings.TrimSpace(req.BaseImage)
+	switch {
+	case req.Dockerfile != "" && req.BaseImage != "":
+		http.Error(w, "Give either dockerfile or base_image, not both", http.StatusBadRequest)
+		return
+	case req.BaseImage != "":
+		if strings.ContainsAny(req.BaseImage, " \t\r\n") {
+			http.Error(w, "Invalid base_image", http.StatusBadRequest)
+			return
+		}
+		req.Dockerfile = "FROM " + req.BaseImage + "\n"
+	case strings.TrimSpace(req.Dockerfile) == "":
+		http.Error(w, "dockerfile or base_image is required", http.StatusBadRequest)
+		return
+	}
+	if len(req.Dockerfile) > maxDockerfileBytes {
+		http.Error(w, "Dockerfile is too large", http.StatusRequestEntityTooLarge)
+		return
+	}
+
+	img := &models.CustomImage{APIID: api.ID, Dockerfile: req.Dockerfile}
+	if err := h.imageRepo.Upsert(img); err != nil {
+		http.Error(w, "Failed to save Dockerfile", http.StatusInternalServerError)
+		return
+	}
+
+	h.startBuild(w, r, api.ID)
+}
+
+// BuildImage builds the API's current Dockerfile again, e.g. after a build
+// timed out
+func (h *ImageHandler) BuildImage(w http.ResponseWriter, r *http.Request) {
+	api, ok := authorizeAPIOwner(w, r, h.apiRepo)
+	if !ok {
+		return
+	}
+
+	if _, err := h.imageRepo.GetByAPIID(api.ID); err != nil {
+		http.Error(w, "No custom image", http.StatusNotFound)
+		return
+	}
+
+	h.startBuild(w, r, api.ID)
+}
+
+// startBuild asks the executor to build the image and responds with its state.
+// The build runs on the node the API's executions go to.
+func (h *ImageHandler) startBuild(w http.ResponseWriter, r *http.Request, apiID string) {
+	node, err := h.executors.Pick(apiID, models.RuntimeCustom, nil)
+	if err != nil {
+		http.Error(w, "No executor can build custom images", http.StatusServiceUnavailable)
+		return
+	}
+
+	req, span, err := tracing.NewRequest(r.Context(), "POST", node.URL+"/images/"+apiID+"/build", nil)
+	if err != nil {
+		http.Error(w, "Failed to communicate with executor service", http.StatusInternalServerError)
+		return
+	}
+	defer span.End()
+	req.Header.Set(logger.RequestIDHeader, logger.RequestID(r.Context()))
+
+	resp, err := h.executors.Client().Do(req)
+	if err != nil {
+		span.SetError(err)
+		http.Error(w, "Failed to communicate with executor service", http.StatusInternalServerError)
+		return
+	}
+	defer resp.Body.Close()
+
+	// Invalid Dockerfiles (400) and builds already running (409) are relayed
+	if resp.StatusCode != http.StatusAccepted {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+		http.Error(w, strings.TrimSpace(string(body)), resp.StatusCode)
+		return
+	}
+
+	img, err := h.imageRepo.GetByAPIID(apiID)
+	if err != nil {
+		http.Error(w, "Failed to get custom image", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusAccepted)
+	json.NewEncoder(w).Encode(img)
+}
@@ -0,0 +1,148 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"strconv"
+
+	"github.com/aKaddoura96/api-hosting-execution-platform/backend/shared/egress"
+	"github.com/aKaddoura96/api-hosting-execution-platform/backend/shared/logger"
+	"github.com/aKaddoura96/api-hosting-execution-platform/backend/shared/models"
+	"github.com/aKaddoura96/api-hosting-execution-platform/backend/shared/repository"
+	"github.com/gorilla/mux"
+)
+
+type JobHandler struct {
+	apiRepo *repository.APIRepository
+	jobRepo *repository.JobRepository
+}
+
+func NewJobHandler(apiRepo *repository.APIRepository, jobRepo *repository.JobRepository) *JobHandler {
+	return &JobHandler{apiRepo: apiRepo, jobRepo: jobRepo}
+}
+
+type EnqueueResponse struct {
+	JobID     string `json:"job_id"`
+	Status    string `json:"status"`
+	StatusURL string `json:"status_url"`
+}
+
+// enqueueExecution queues the invocation for the executor's job worker and
+// replies 202 with the job ID to poll
+func (h *ExecuteHandler) enqueueExecution(ctx context.Context, w http.ResponseWriter, r *http.Request, api *models.API, code string, execReq *ExecuteRequest) {
+	if execReq.CallbackURL != "" {
+		if err := egress.CheckPublicURL(ctx, execReq.CallbackURL); err != nil {
+			http.Error(w, "callback_url "+err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+
+	timeoutSec := execReq.TimeoutSec
+	if timeoutSec <= 0 {
+		timeoutSec = 30
+	}
+
+	userID, _ := r.Context().Value("api_key_user_id").(string)
+	job := &models.Job{
+		APIID:         api.ID,
+		UserID:        userID,
+		Runtime:       api.Runtime,
+		Code:          code,
+		Input:         execReq.Input,
+		TimeoutSec:    timeoutSec,
+		CallbackURL:   execReq.CallbackURL,
+		ResourceClass: api.ResourceClass,
+	}
+
+	if err := h.jobRepo.Create(job); err != nil {
+		logger.FromContext(ctx).Error("Failed to enqueue job", map[string]interface{}{"error": err.Error()})
+		http.Error(w, "Failed to enqueue execution", http.StatusInternalServerError)
+		return
+	}
+
+	executionStarted(w)
+
+	statusURL := "/api/v1/jobs/" + job.ID
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Location", statusURL)
+	w.WriteHeader(http.StatusAccepted)
+	json.NewEncoder(w).Encode(EnqueueResponse{
+		JobID:     job.ID,
+		Status:    job.Status,
+		StatusURL: statusURL,
+	})
+}
+
+// GetJob returns the status of an async execution and, once finished, its result
+func (h *JobHandler) GetJob(w http.ResponseWriter, r *http.Request) {
+	job, err := h.jobRepo.GetByID(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "Job not found", http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(job)
+}
+
+// ListJobs lists an API's async jobs; ?status=dead shows the dead-letter queue
+func (h *JobHandler) ListJobs(w http.ResponseWriter, r *http.Request) {
+	api, ok := authorizeAPIOwner(w, r, h.apiRepo)
+	if !ok {
+		return
+	}
+
+	status := r.URL.Query().Get("status")
+	switch status {
+	case "", models.JobStatusQueued, models.JobStatusRunning, models.JobStatusSucceeded, models.JobStatusDead:
+	default:
+		http.Error(w, "status must be one of queued, running, succeeded, dead", http.StatusBadRequest)
+		return
+	}
+
+	limit := 50
+	if v, err := strconv.Atoi(r.URL.Query().Get("limit")); err == nil && v > 0 && v <= 500 {
+		limit = v
+	}
+
+	jobs, err := h.jobRepo.GetByAPIID(api.ID, status, limit)
+	if err != nil {
+		http.Error(w, "Failed to get jobs", http.StatusInternalServerError)
+		return
+	}
+	if jobs == nil {
+		jobs = []*models.Job{}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(jobs)
+}
+
+// RetryJob moves a dead-lettered job back into the queue
+func (h *JobHandler) RetryJob(w http.ResponseWriter, r *http.Request) {
+	api, ok := authorizeAPIOwner(w, r, h.apiRepo)
+	if !ok {
+		return
+	}
+
+	job, err := h.jobRepo.GetByID(mux.Vars(r)["job_id"])
+	if err != nil || job.APIID != api.ID {
+		http.Error(w, "Job not found", http.StatusNotFound)
+		return
+	}
+
+	if err := h.jobRepo.Requeue(job.ID); err != nil {
+		http.Error(w, "Only dead-lettered jobs can be retried", http.StatusConflict)
+		return
+	}
+
+	job, err = h.jobRepo.GetByID(job.ID)
+	if err != nil {
+		http.Error(w, "Failed to get job", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(job)
+}
@@ -0,0 +1,239 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/aKaddoura96/api-hosting-execution-platform/backend/api-gateway/executors"
+	"github.com/aKaddoura96/api-hosting-execution-platform/backend/shared/logger"
+	"github.com/aKaddoura96/api-hosting-execution-platform/backend/shared/models"
+	"github.com/aKaddoura96/api-hosting-execution-platform/backend/shared/repository"
+	"github.com/aKaddoura96/api-hosting-execution-platform/backend/shared/server"
+	"github.com/aKaddoura96/api-hosting-execution-platform/backend/shared/tracing"
+	"github.com/gorilla/mux"
+)
+
+type LogHandler struct {
+	apiRepo   *repository.APIRepository
+	logRepo   *repository.ExecutionLogRepository
+	executors *executors.Pool
+}
+
+func NewLogHandler(apiRepo *repository.APIRepository, logRepo *repository.ExecutionLogRepository, executors *executors.Pool) *LogHandler {
+	return &LogHandler{
+		apiRepo:   apiRepo,
+		logRepo:   logRepo,
+		executors: executors,
+	}
+}
+
+type LogsResponse struct {
+	Logs       []*models.ExecutionLog `json:"logs"`
+	NextCursor int64                  `json:"next_cursor,omitempty"`
+}
+
+// authorize loads the API and checks the caller owns it
+func (h *LogHandler) authorize(w http.ResponseWriter, r *http.Request) (*models.API, bool) {
+	apiID := mux.Vars(r)["id"]
+	userID := r.Context().Value("user_id").(string)
+
+	api, err := h.apiRepo.GetByID(apiID)
+	if err != nil {
+		http.Error(w, "API not found", http.StatusNotFound)
+		return nil, false
+	}
+
+	if api.UserID != userID {
+		http.Error(w, "Unauthorized", http.StatusForbidden)
+		return nil, false
+	}
+
+	return api, true
+}
+
+// GetLogs returns persisted output for an API, newest first.
+//
+// Query parameters: execution_id, level, since/until (RFC3339), limit (max 1000)
+// and cursor (the next_cursor of a previous page).
+func (h *LogHandler) GetLogs(w http.ResponseWriter, r *http.Request) {
+	api, ok := h.authorize(w, r)
+	if !ok {
+		return
+	}
+
+	query := r.URL.Query()
+	filter := repository.ExecutionLogFilter{
+		APIID:       api.ID,
+		ExecutionID: query.Get("execution_id"),
+		Level:       query.Get("level"),
+		Limit:       100,
+	}
+
+	if filter.Level != "" && filter.Level != "debug" && filter.Level != "info" &&
+		filter.Level != "warn" && filter.Level != "error" {
+		http.Error(w, "level must be one of debug, info, warn, error", http.StatusBadRequest)
+		return
+	}
+
+	for name, target := range map[string]**time.Time{"since": &filter.Since, "until": &filter.Until} {
+		if v := query.Get(name); v != "" {
+			t, err := time.Parse(time.RFC3339, v)
+			if err != nil {
+				http.Error(w, fmt.Sprintf("Invalid %s: expected RFC3339 timestamp", name), http.StatusBadRequest)
+				return
+			}
+			*target = &t
+		}
+	}
+
+	if v := query.Get("limit"); v != "" {
+		if l, err := strconv.Atoi(v); err == nil && l > 0 && l <= 1000 {
+			filter.Limit = l
+		}
+	}
+	if v := query.Get("cursor"); v != "" {
+		c, err := strconv.ParseInt(v, 10, 64)
+		if err != nil || c <= 0 {
+			http.Error(w, "Invalid cursor", http.StatusBadRequest)
+			return
+		}
+		filter.Cursor = c
+	}
+
+	logs, err := h.logRepo.List(filter)
+	if err != nil {
+		logger.FromContext(r.Context()).Error("Failed to list logs", map[string]interface{}{"error": err.Error()})
+		http.Error(w, "Failed to get logs", http.StatusInternalServerError)
+		return
+	}
+
+	response := LogsResponse{Logs: logs}
+	if response.Logs == nil {
+		response.Logs = []*models.ExecutionLog{}
+	}
+	if len(logs) == filter.Limit {
+		response.NextCursor = logs[len(logs)-1].ID
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
+
+// StreamLogs tails live output from running executions as Server-Sent Events
+// by relaying the executor's stream. The API's executions may run on any
+// executor node, so the streams of all of them are merged; nodes joining
+// later are followed once the client reconnects. ?execution_id= narrows it
+// to one run.
+func (h *LogHandler) StreamLogs(w http.ResponseWriter, r *http.Request) {
+	api, ok := h.authorize(w, r)
+	if !ok {
+		return
+	}
+
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "Streaming not supported", http.StatusInternalServerError)
+		return
+	}
+
+	streamPath := fmt.Sprintf("/logs/%s/stream", api.ID)
+	if executionID := r.URL.Query().Get("execution_id"); executionID != "" {
+		streamPath += "?execution_id=" + url.QueryEscape(executionID)
+	}
+
+	// Waits for the relays below, which write to w, before returning
+	var relays sync.WaitGroup
+	defer relays.Wait()
+	ctx, cancel := context.WithCancel(r.Context())
+	defer cancel()
+
+	// No client timeout: the streams live until the caller disconnects
+	var streams []io.Reader
+	for _, node := range h.executors.Nodes() {
+		req, span, err := tracing.NewRequest(ctx, "GET", node.URL+streamPath, nil)
+		if err != nil {
+			continue
+		}
+		defer span.End()
+		req.Header.Set("Accept", "text/event-stream")
+
+		resp, err := h.executors.Client().Do(req)
+		if err != nil {
+			span.SetError(err)
+			logger.FromContext(ctx).Warn("Failed to open executor log stream", map[string]interface{}{
+				"node_id": node.ID,
+				"error":   err.Error(),
+			})
+			continue
+		}
+		defer resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			continue
+		}
+		streams = append(streams, resp.Body)
+	}
+	if len(streams) == 0 {
+		http.Error(w, "Failed to open log stream", http.StatusBadGateway)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	// Events are relayed whole so streams don't interleave mid-event
+	var mu sync.Mutex
+	write := func(format string, args ...interface{}) error {
+		mu.Lock()
+		defer mu.Unlock()
+		if _, err := fmt.Fprintf(w, format, args...); err != nil {
+			return err
+		}
+		flusher.Flush()
+		return nil
+	}
+
+	done := make(chan struct{}, len(streams))
+	for _, body := range streams {
+		relays.Add(1)
+		go func(body io.Reader) {
+			defer relays.Done()
+			defer func() { done <- struct{}{} }()
+
+			err := readExecutorEvents(body, func(event executorEvent) error {
+				return write("event: %s\ndata: %s\n\n", event.Name, event.Data)
+			})
+			if err != nil && ctx.Err() == nil {
+				logger.FromContext(ctx).Warn("Log stream interrupted", map[string]interface{}{"error": err.Error()})
+			}
+		}(body)
+	}
+
+	// The nodes' keep-alives are dropped when merging, so send our own
+	heartbeat := time.NewTicker(15 * time.Second)
+	defer heartbeat.Stop()
+
+	for open := len(streams); open > 0; {
+		select {
+		case <-ctx.Done():
+			return
+		case <-server.Stopping(ctx):
+			return
+		case <-done:
+			open--
+		case <-heartbeat.C:
+			if write(": keep-alive\n\n") != nil {
+				return
+			}
+		}
+	}
+}
@@ -0,0 +1,200 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"reflect"
+	"sort"
+	"time"
+
+	"github.com/aKaddoura96/api-hosting-execution-platform/backend/shared/logger"
+	"github.com/aKaddoura96/api-hosting-execution-platform/backend/shared/models"
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+)
+
+// replayIgnoredFields differ on every run and are left out of the diff
+var replayIgnoredFields = map[string]bool{"execution_id": true, "duration_ms": true, "queue_ms": true}
+
+type ReplayRequest struct {
+	Version string `json:"version"` // empty or "current" replays the deployed code
+}
+
+type ReplayDiff struct {
+	Path     string      `json:"path"`
+	Original interface{} `json:"original"`
+	Replay   interface{} `json:"replay"`
+}
+
+type ReplayResponse struct {
+	ExecutionID  string          `json:"execution_id"`
+	ReplayedFrom string          `json:"replayed_from"`
+	Version      string          `json:"version"`
+	Original     json.RawMessage `json:"original"`
+	Replay       json.RawMessage `json:"replay"`
+	Identical    bool            `json:"identical"`
+	Diff         []ReplayDiff    `json:"diff"`
+}
+
+// ReplayExecution re-runs a captured request against the current code or a
+// stored version and returns both outputs with their differences
+func (h *ExecuteHandler) ReplayExecution(w http.ResponseWriter, r *http.Request) {
+	api, ok := authorizeAPIOwner(w, r, h.apiRepo)
+	if !ok {
+		return
+	}
+
+	var req ReplayRequest
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "Invalid request body", http.StatusBadRequest)
+			return
+		}
+	}
+
+	// A replica serves whatever version it runs, so there is nothing to
+	// replay a request against
+	policy, err := h.scalingRepo.GetPolicy(api.ID)
+	if err != nil {
+		http.Error(w, "Failed to get scaling policy", http.StatusInternalServerError)
+		return
+	}
+	if policy.Persistent() {
+		http.Error(w, "Replay is not available for APIs with replicas", http.StatusBadRequest)
+		return
+	}
+
+	capture, err := h.captureRepo.GetByExecutionID(mux.Vars(r)["execution_id"])
+	if err != nil || capture.APIID != api.ID {
+		http.Error(w, "Capture not found", http.StatusNotFound)
+		return
+	}
+
+	target := currentVersion(api)
+	if req.Version != "" && req.Version != "current" {
+		v, err := h.versionRepo.GetByVersion(api.ID, req.Version)
+		if err != nil {
+			http.Error(w, "Version not found", http.StatusNotFound)
+			return
+		}
+		target = v
+	}
+
+	if target.CodePath == "" {
+		http.Error(w, "No code uploaded for this API", http.StatusBadRequest)
+		return
+	}
+
+	codeBytes, err := os.ReadFile(target.CodePath)
+	if err != nil {
+		http.Error(w, "Failed to read API code", http.StatusInternalServerError)
+		return
+	}
+
+	// Redacted fields are replayed as their placeholder value
+	var execReq ExecuteRequest
+	json.Unmarshal(capture.Body, &execReq)
+
+	ctx := logger.AddFields(r.Context(), map[string]interface{}{
+		"api_id":        api.ID,
+		"replayed_from": capture.ExecutionID,
+	})
+
+	executionID := uuid.New().String()
+	startTime := time.Now()
+
+	status, respBody, err := h.invokeExecutor(ctx, executionID, target, api.UserID, models.EncodeCode(target.Runtime, codeBytes), &execReq)
+	if err != nil {
+		logger.FromContext(ctx).Error("Executor call failed", map[string]interface{}{"error": err.Error()})
+		http.Error(w, "Failed to execute API code", http.StatusInternalServerError)
+		return
+	}
+
+	h.recordExecution(ctx, executionID, target, api.UserID, int64(len(capture.Body)), status, respBody, time.Since(startTime))
+	if status == http.StatusServiceUnavailable {
+		setRetryAfter(w, status, respBody)
+		http.Error(w, "Executor is busy, try the replay again later", http.StatusServiceUnavailable)
+		return
+	}
+
+	// Compare like with like: the replay output goes through the same redaction
+	settings, err := h.captureRepo.GetSettings(api.ID)
+	if err != nil {
+		http.Error(w, "Failed to get capture settings", http.StatusInternalServerError)
+		return
+	}
+	replay := redactJSON(respBody, settings.RedactFields)
+
+	diff := diffJSON(capture.ResponseBody, replay)
+	response := ReplayResponse{
+		ExecutionID:  executionID,
+		ReplayedFrom: capture.ExecutionID,
+		Version:      target.Version,
+		Original:     capture.ResponseBody,
+		Replay:       replay,
+		Identical:    len(diff) == 0,
+		Diff:         diff,
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("X-Execution-ID", executionID)
+	json.NewEncoder(w).Encode(response)
+}
+
+// diffJSON lists the paths at which two JSON documents differ
+func diffJSON(original, replay json.RawMessage) []ReplayDiff {
+	var a, b interface{}
+	json.Unmarshal(original, &a)
+	json.Unmarshal(replay, &b)
+
+	diff := []ReplayDiff{}
+	diffValues("", a, b, &diff)
+	return diff
+}
+
+func diffValues(path string, a, b interface{}, diff *[]ReplayDiff) {
+	am, aIsMap := a.(map[string]interface{})
+	bm, bIsMap := b.(map[string]interface{})
+	if aIsMap && bIsMap {
+		keys := map[string]bool{}
+		for k := range am {
+			keys[k] = true
+		}
+		for k := range bm {
+			keys[k] = true
+		}
+
+		sorted := make([]string, 0, len(keys))
+		for k := range keys {
+			if path == "" && replayIgnoredFields[k] {
+				continue
+			}
+			sorted = append(sorted, k)
+		}
+		sort.Strings(sorted)
+
+		for _, k := range sorted {
+			childPath := k
+			if path != "" {
+				childPath = path + "." + k
+			}
+			diffValues(childPath, am[k], bm[k], diff)
+		}
+		return
+	}
+
+	as, aIsSlice := a.([]interface{})
+	bs, bIsSlice := b.([]interface{})
+	if aIsSlice && bIsSlice && len(as) == len(bs) {
+		for i := range as {
+			diffValues(fmt.Sprintf("%s[%d]", path, i), as[i], bs[i], diff)
+		}
+		return
+	}
+
+	if !reflect.DeepEqual(a, b) {
+		*diff = append(*diff, ReplayDiff{Path: path, Original: a, Replay: b})
+	}
+}
@@ -0,0 +1,147 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/aKaddoura96/api-hosting-execution-platform/backend/api-gateway/executors"
+	"github.com/aKaddoura96/api-hosting-execution-platform/backend/shared/logger"
+	"github.com/aKaddoura96/api-hosting-execution-platform/backend/shared/models"
+	"github.com/aKaddoura96/api-hosting-execution-platform/backend/shared/tracing"
+	"github.com/aKaddoura96/api-hosting-execution-platform/backend/shared/webhooks"
+)
+
+// replicaRequestHeaders are platform credentials, never passed on to user code
+var replicaRequestHeaders = []string{"Authorization", "X-API-Key", "Cookie"}
+
+// serveFromReplicas answers a request to a persistent API from one of its
+// replicas. The method, query, headers and body are passed on as they came,
+// and the replica's response is returned as it is; each request is recorded
+// as an execution.
+func (h *ExecuteHandler) serveFromReplicas(ctx context.Context, w http.ResponseWriter, r *http.Request, api *models.API, code string, executionID string, rawBody []byte) {
+	log := logger.FromContext(ctx)
+	startTime := time.Now()
+
+	// The resource class timeout bounds a request as it bounds an execution
+	if class, ok := models.GetResourceClass(api.ResourceClass); ok {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, time.Duration(class.MaxTimeoutSec)*time.Second)
+		defer cancel()
+	}
+
+	ctx, span := tracing.StartSpan(ctx, "replica request", tracing.SpanKindClient)
+	defer span.End()
+	span.SetAttribute("api.id", api.ID)
+
+	resp, err := h.replicas.Forward(ctx, api, code, func(baseURL string) (*http.Request, error) {
+		url := baseURL + "/"
+		if r.URL.RawQuery != "" {
+			url += "?" + r.URL.RawQuery
+		}
+		req, err := http.NewRequestWithContext(ctx, r.Method, url, bytes.NewReader(rawBody))
+		if err != nil {
+			return nil, err
+		}
+		req.Header = r.Header.Clone()
+		for _, name := range replicaRequestHeaders {
+			req.Header.Del(name)
+		}
+		tracing.Inject(ctx, req.Header)
+		req.Header.Set(logger.RequestIDHeader, logger.RequestID(ctx))
+		req.Header.Set("X-Execution-ID", executionID)
+		return req, nil
+	})
+	if err != nil {
+		span.SetError(err)
+		log.Error("Replica request failed", map[string]interface{}{"error": err.Error()})
+		h.recordReplicaRequest(ctx, r, executionID, api, rawBody, http.StatusBadGateway, nil, err.Error(), time.Since(startTime))
+		http.Error(w, "API replicas are unavailable", http.StatusBadGateway)
+		return
+	}
+	defer resp.Body.Close()
+	executionStarted(w)
+
+	respBody, err := io.ReadAll(io.LimitReader(resp.Body, maxExecutorResponseBytes+1))
+	if err != nil {
+		span.SetError(err)
+		h.recordReplicaRequest(ctx, r, executionID, api, rawBody, http.StatusBadGateway, nil, err.Error(), time.Since(startTime))
+		http.Error(w, "Failed to read the API response", http.StatusBadGateway)
+		return
+	}
+	if len(respBody) > maxExecutorResponseBytes {
+		msg := fmt.Sprintf("Response body exceeds the %d byte limit", maxExecutorResponseBytes)
+		h.recordReplicaRequest(ctx, r, executionID, api, rawBody, http.StatusRequestEntityTooLarge, nil, msg, time.Since(startTime))
+		http.Error(w, msg, http.StatusRequestEntityTooLarge)
+		return
+	}
+	span.SetAttribute("http.status_code", resp.StatusCode)
+
+	var failure string
+	if resp.StatusCode >= 500 {
+		failure = fmt.Sprintf("Replica responded %d %s", resp.StatusCode, http.StatusText(resp.StatusCode))
+	}
+	h.recordReplicaRequest(ctx, r, executionID, api, rawBody, resp.StatusCode, respBody, failure, time.Since(startTime))
+
+	for name, values := range resp.Header {
+		w.Header()[name] = values
+	}
+	w.Header().Set("X-Execution-ID", executionID)
+	w.WriteHeader(resp.StatusCode)
+	w.Write(respBody)
+}
+
+// recordReplicaRequest stores the executions row of a request served by a
+// replica, billed for the request's duration, and captures it if enabled
+func (h *ExecuteHandler) recordReplicaRequest(ctx context.Context, r *http.Request, executionID string, api *models.API, rawBody []byte, status int, respBody []byte, failure string, duration time.Duration) {
+	userID, _ := r.Context().Value("api_key_user_id").(string)
+	execution := &models.Execution{
+		ID:            executionID,
+		APIID:         api.ID,
+		UserID:        userID,
+		StatusCode:    status,
+		Error:         failure,
+		Duration:      duration,
+		RequestSize:   int64(len(rawBody)),
+		ResponseSize:  int64(len(respBody)),
+		ResourceClass: api.ResourceClass,
+	}
+	if class, ok := models.GetResourceClass(api.ResourceClass); ok && respBody != nil {
+		execution.ComputeUnits = class.ComputeUnits(duration)
+	}
+
+	if err := h.execRepo.Create(execution); err != nil {
+		logger.FromContext(ctx).Error("Failed to record execution", map[string]interface{}{
+			"execution_id": executionID,
+			"error":        err.Error(),
+		})
+	}
+	webhooks.EmitExecutionFailed(ctx, h.webhookRepo, execution)
+
+	if respBody != nil {
+		h.captureExecution(ctx, r, executionID, api, rawBody, status, respBody)
+	}
+}
+
+// warmReplicas starts a deployed API's replicas in the background when its
+// policy keeps some running, so the first request doesn't wait for one
+func warmReplicas(ctx context.Context, replicas *executors.Replicas, policy *models.ScalingPolicy, api *models.API) {
+	if !policy.Persistent() || policy.MinReplicas == 0 || api.Status != "deployed" || api.CodePath == "" {
+		return
+	}
+	log := logger.FromContext(ctx).WithFields(map[string]interface{}{"api_id": api.ID})
+
+	go func() {
+		codeBytes, err := os.ReadFile(api.CodePath)
+		if err == nil {
+			err = replicas.Wake(context.Background(), api, models.EncodeCode(api.Runtime, codeBytes))
+		}
+		if err != nil {
+			log.Warn("Failed to start replicas, they start with the first request", map[string]interface{}{"error": err.Error()})
+		}
+	}()
+}
@@ -0,0 +1,98 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/aKaddoura96/api-hosting-execution-platform/backend/api-gateway/executors"
+	"github.com/aKaddoura96/api-hosting-execution-platform/backend/shared/models"
+	"github.com/aKaddoura96/api-hosting-execution-platform/backend/shared/repository"
+)
+
+type ScalingHandler struct {
+	apiRepo     *repository.APIRepository
+	scalingRepo *repository.ScalingRepository
+	replicaRepo *repository.ReplicaRepository
+	replicas    *executors.Replicas
+}
+
+func NewScalingHandler(apiRepo *repository.APIRepository, scalingRepo *repository.ScalingRepository, replicaRepo *repository.ReplicaRepository, replicas *executors.Replicas) *ScalingHandler {
+	return &ScalingHandler{apiRepo: apiRepo, scalingRepo: scalingRepo, replicaRepo: replicaRepo, replicas: replicas}
+}
+
+type UpdateScalingRequest struct {
+	MinReplicas       int  `json:"min_replicas"`
+	MaxReplicas       int  `json:"max_replicas"`
+	TargetConcurrency *int `json:"target_concurrency"`
+	TargetLatencyMS   int  `json:"target_latency_ms"`
+	IdleTimeoutSec    *int `json:"idle_timeout_sec"`
+}
+
+// GetScaling returns the API's scaling policy and the replicas it has running
+func (h *ScalingHandler) GetScaling(w http.ResponseWriter, r *http.Request) {
+	api, ok := authorizeAPIOwner(w, r, h.apiRepo)
+	if !ok {
+		return
+	}
+
+	policy, err := h.scalingRepo.GetPolicy(api.ID)
+	if err != nil {
+		http.Error(w, "Failed to get scaling policy", http.StatusInternalServerError)
+		return
+	}
+	replicas, err := h.replicaRepo.GetByAPIID(api.ID)
+	if err != nil {
+		http.Error(w, "Failed to get replicas", http.StatusInternalServerError)
+		return
+	}
+	if replicas == nil {
+		replicas = []*models.Replica{}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"policy":   policy,
+		"replicas": replicas,
+	})
+}
+
+// UpdateScaling replaces the API's scaling policy. A max_replicas above zero
+// runs the API as persistent replicas, which executors pick up within one
+// scaling interval; target_concurrency and idle_timeout_sec keep their
+// defaults when left out.
+func (h *ScalingHandler) UpdateScaling(w http.ResponseWriter, r *http.Request) {
+	api, ok := authorizeAPIOwner(w, r, h.apiRepo)
+	if !ok {
+		return
+	}
+
+	var req UpdateScalingRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	policy := models.DefaultScalingPolicy(api.ID)
+	policy.MinReplicas = req.MinReplicas
+	policy.MaxReplicas = req.MaxReplicas
+	policy.TargetLatencyMS = req.TargetLatencyMS
+	if req.TargetConcurrency != nil {
+		policy.TargetConcurrency = *req.TargetConcurrency
+	}
+	if req.IdleTimeoutSec != nil {
+		policy.IdleTimeoutSec = *req.IdleTimeoutSec
+	}
+	if err := policy.Validate(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if err := h.scalingRepo.UpsertPolicy(policy); err != nil {
+		http.Error(w, "Failed to update scaling policy", http.StatusInternalServerError)
+		return
+	}
+	warmReplicas(r.Context(), h.replicas, policy, api)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(policy)
+}
@@ -0,0 +1,218 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/aKaddoura96/api-hosting-execution-platform/backend/api-gateway/scheduler"
+	"github.com/aKaddoura96/api-hosting-execution-platform/backend/shared/models"
+	"github.com/aKaddoura96/api-hosting-execution-platform/backend/shared/repository"
+	"github.com/gorilla/mux"
+)
+
+type ScheduleHandler struct {
+	apiRepo      *repository.APIRepository
+	scheduleRepo *repository.ScheduleRepository
+}
+
+func NewScheduleHandler(apiRepo *repository.APIRepository, scheduleRepo *repository.ScheduleRepository) *ScheduleHandler {
+	return &ScheduleHandler{apiRepo: apiRepo, scheduleRepo: scheduleRepo}
+}
+
+// ScheduleRequest creates a schedule or, with pointer fields left nil,
+// partially updates one
+type ScheduleRequest struct {
+	Name          *string                `json:"name"`
+	CronExpr      *string                `json:"cron_expr"`
+	Timezone      *string                `json:"timezone"`
+	Input         map[string]interface{} `json:"input"`
+	TimeoutSec    *int                   `json:"timeout_sec"`
+	OverlapPolicy *string                `json:"overlap_policy"`
+	CatchUpLimit  *int                   `json:"catch_up_limit"`
+	Enabled       *bool                  `json:"enabled"`
+}
+
+// apply copies the set fields onto s and recomputes its next run
+func (req *ScheduleRequest) apply(s *models.Schedule) (int, string) {
+	if req.Name != nil {
+		s.Name = *req.Name
+	}
+	if req.CronExpr != nil {
+		s.CronExpr = *req.CronExpr
+	}
+	if req.Timezone != nil {
+		s.Timezone = *req.Timezone
+	}
+	if req.Input != nil {
+		s.Input = req.Input
+	}
+	if req.TimeoutSec != nil {
+		s.TimeoutSec = *req.TimeoutSec
+	}
+	if req.OverlapPolicy != nil {
+		s.OverlapPolicy = *req.OverlapPolicy
+	}
+	if req.CatchUpLimit != nil {
+		s.CatchUpLimit = *req.CatchUpLimit
+	}
+	if req.Enabled != nil {
+		s.Enabled = *req.Enabled
+	}
+
+	if s.Name == "" || s.CronExpr == "" {
+		return http.StatusBadRequest, "name and cron_expr are required"
+	}
+	if s.OverlapPolicy != models.OverlapSkip && s.OverlapPolicy != models.OverlapQueue && s.OverlapPolicy != models.OverlapAllow {
+		return http.StatusBadRequest, "overlap_policy must be one of skip, queue, allow"
+	}
+	if s.TimeoutSec <= 0 || s.TimeoutSec > 900 {
+		return http.StatusBadRequest, "timeout_sec must be between 1 and 900"
+	}
+	if s.CatchUpLimit < 0 || s.CatchUpLimit > 100 {
+		return http.StatusBadRequest, "catch_up_limit must be between 0 and 100"
+	}
+
+	next, err := scheduler.NextRun(s.CronExpr, s.Timezone, time.Now())
+	if err != nil {
+		return http.StatusBadRequest, err.Error()
+	}
+	s.NextRunAt = next
+
+	return 0, ""
+}
+
+// authorizeSchedule loads the schedule named by {schedule_id} under the caller's API
+func (h *ScheduleHandler) authorizeSchedule(w http.ResponseWriter, r *http.Request) (*models.Schedule, bool) {
+	api, ok := authorizeAPIOwner(w, r, h.apiRepo)
+	if !ok {
+		return nil, false
+	}
+
+	schedule, err := h.scheduleRepo.GetByID(mux.Vars(r)["schedule_id"])
+	if err != nil || schedule.APIID != api.ID {
+		http.Error(w, "Schedule not found", http.StatusNotFound)
+		return nil, false
+	}
+
+	return schedule, true
+}
+
+func (h *ScheduleHandler) CreateSchedule(w http.ResponseWriter, r *http.Request) {
+	api, ok := authorizeAPIOwner(w, r, h.apiRepo)
+	if !ok {
+		return
+	}
+
+	var req ScheduleRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	schedule := &models.Schedule{
+		APIID:         api.ID,
+		Timezone:      "UTC",
+		TimeoutSec:    30,
+		OverlapPolicy: models.OverlapSkip,
+		Enabled:       true,
+	}
+	if status, msg := req.apply(schedule); status != 0 {
+		http.Error(w, msg, status)
+		return
+	}
+
+	if err := h.scheduleRepo.Create(schedule); err != nil {
+		http.Error(w, "Failed to create schedule", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(schedule)
+}
+
+func (h *ScheduleHandler) GetSchedules(w http.ResponseWriter, r *http.Request) {
+	api, ok := authorizeAPIOwner(w, r, h.apiRepo)
+	if !ok {
+		return
+	}
+
+	schedules, err := h.scheduleRepo.GetByAPIID(api.ID)
+	if err != nil {
+		http.Error(w, "Failed to get schedules", http.StatusInternalServerError)
+		return
+	}
+	if schedules == nil {
+		schedules = []*models.Schedule{}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(schedules)
+}
+
+func (h *ScheduleHandler) UpdateSchedule(w http.ResponseWriter, r *http.Request) {
+	schedule, ok := h.authorizeSchedule(w, r)
+	if !ok {
+		return
+	}
+
+	var req ScheduleRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	if status, msg := req.apply(schedule); status != 0 {
+		http.Error(w, msg, status)
+		return
+	}
+
+	if err := h.scheduleRepo.Update(schedule); err != nil {
+		http.Error(w, "Failed to update schedule", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(schedule)
+}
+
+func (h *ScheduleHandler) DeleteSchedule(w http.ResponseWriter, r *http.Request) {
+	schedule, ok := h.authorizeSchedule(w, r)
+	if !ok {
+		return
+	}
+
+	if err := h.scheduleRepo.Delete(schedule.ID); err != nil {
+		http.Error(w, "Failed to delete schedule", http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// GetScheduleRuns returns the run history of a schedule, newest first
+func (h *ScheduleHandler) GetScheduleRuns(w http.ResponseWriter, r *http.Request) {
+	schedule, ok := h.authorizeSchedule(w, r)
+	if !ok {
+		return
+	}
+
+	limit := 50
+	if v, err := strconv.Atoi(r.URL.Query().Get("limit")); err == nil && v > 0 && v <= 500 {
+		limit = v
+	}
+
+	runs, err := h.scheduleRepo.GetRuns(schedule.ID, limit)
+	if err != nil {
+		http.Error(w, "Failed to get schedule runs", http.StatusInternalServerError)
+		return
+	}
+	if runs == nil {
+		runs = []*models.ScheduleRun{}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(runs)
+}
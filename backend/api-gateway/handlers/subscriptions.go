@@ -0,0 +1,178 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/aKaddoura96/api-hosting-execution-platform/backend/shared/logger"
+	"github.com/aKaddoura96/api-hosting-execution-platform/backend/shared/models"
+	"github.com/aKaddoura96/api-hosting-execution-platform/backend/shared/repository"
+	"github.com/aKaddoura96/api-hosting-execution-platform/backend/shared/webhooks"
+	"github.com/gorilla/mux"
+)
+
+type SubscriptionHandler struct {
+	apiRepo          *repository.APIRepository
+	subscriptionRepo *repository.SubscriptionRepository
+	webhookRepo      *repository.WebhookRepository
+}
+
+func NewSubscriptionHandler(apiRepo *repository.APIRepository, subscriptionRepo *repository.SubscriptionRepository, webhookRepo *repository.WebhookRepository) *SubscriptionHandler {
+	return &SubscriptionHandler{apiRepo: apiRepo, subscriptionRepo: subscriptionRepo, webhookRepo: webhookRepo}
+}
+
+type SubscribeRequest struct {
+	Plan string `json:"plan"`
+}
+
+// Subscribe subscribes the caller to a public API on a plan, which sets the
+// daily quota of their executions with an API key
+func (h *SubscriptionHandler) Subscribe(w http.ResponseWriter, r *http.Request) {
+	userID := r.Context().Value("user_id").(string)
+
+	api, err := h.apiRepo.GetByID(mux.Vars(r)["id"])
+	if err != nil || api.Visibility == "private" {
+		http.Error(w, "API not found", http.StatusNotFound)
+		return
+	}
+	if api.UserID == userID {
+		http.Error(w, "You can't subscribe to your own API", http.StatusBadRequest)
+		return
+	}
+
+	var req SubscribeRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	if req.Plan == "" {
+		req.Plan = models.PlanFree
+	}
+	if _, ok := models.PlanDailyQuotas[req.Plan]; !ok {
+		http.Error(w, "plan must be one of free, basic, premium", http.StatusBadRequest)
+		return
+	}
+
+	subscription := &models.Subscription{
+		UserID:    userID,
+		APIID:     api.ID,
+		Plan:      req.Plan,
+		Status:    models.SubscriptionActive,
+		ExpiresAt: time.Now().Add(models.SubscriptionPeriod),
+	}
+	created, err := h.subscriptionRepo.Subscribe(subscription)
+	if err != nil {
+		http.Error(w, "Failed to create subscription", http.StatusInternalServerError)
+		return
+	}
+	if !created {
+		http.Error(w, "Already subscribed to this API", http.StatusConflict)
+		return
+	}
+
+	webhooks.EmitForAPI(r.Context(), h.webhookRepo, api.ID, models.EventSubscriptionCreated, subscriptionEventData(subscription))
+
+	logger.FromContext(r.Context()).Info("Subscription created", map[string]interface{}{
+		"api_id":          api.ID,
+		"subscription_id": subscription.ID,
+		"plan":            subscription.Plan,
+	})
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(subscription)
+}
+
+// CancelSubscription ends the caller's subscription to an API
+func (h *SubscriptionHandler) CancelSubscription(w http.ResponseWriter, r *http.Request) {
+	userID := r.Context().Value("user_id").(string)
+
+	subscription, err := h.subscriptionRepo.GetByUserAndAPI(userID, mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "Subscription not found", http.StatusNotFound)
+		return
+	}
+
+	cancelled, err := h.subscriptionRepo.Cancel(subscription.ID)
+	if err != nil {
+		http.Error(w, "Failed to cancel subscription", http.StatusInternalServerError)
+		return
+	}
+	if !cancelled {
+		http.Error(w, "Subscription is not active", http.StatusConflict)
+		return
+	}
+	subscription.Status = models.SubscriptionCancelled
+
+	webhooks.EmitForAPI(r.Context(), h.webhookRepo, subscription.APIID, models.EventSubscriptionCancelled, subscriptionEventData(subscription))
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(subscription)
+}
+
+func (h *SubscriptionHandler) GetMySubscriptions(w http.ResponseWriter, r *http.Request) {
+	userID := r.Context().Value("user_id").(string)
+
+	subscriptions, err := h.subscriptionRepo.GetByUserID(userID)
+	if err != nil {
+		http.Error(w, "Failed to fetch subscriptions", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(subscriptions)
+}
+
+func subscriptionEventData(s *models.Subscription) map[string]interface{} {
+	return map[string]interface{}{
+		"subscription_id": s.ID,
+		"api_id":          s.APIID,
+		"user_id":         s.UserID,
+		"plan":            s.Plan,
+		"daily_quota":     s.DailyQuota(),
+		"expires_at":      s.ExpiresAt,
+	}
+}
+
+// checkQuota counts an execution by a subscriber against the daily quota of
+// their plan, and raises quota.near_limit as the count reaches
+// models.QuotaNearLimitPercent of it. Callers without a subscription in force
+// aren't metered. It reports false, having responded, once the quota is used up.
+func (h *ExecuteHandler) checkQuota(ctx context.Context, w http.ResponseWriter, r *http.Request, api *models.API) bool {
+	userID, _ := r.Context().Value("api_key_user_id").(string)
+	if userID == "" {
+		return true
+	}
+	subscription, err := h.subscriptionRepo.GetByUserAndAPI(userID, api.ID)
+	now := time.Now()
+	if err != nil || !subscription.Active(now) {
+		return true
+	}
+
+	count, err := h.subscriptionRepo.CountRequest(subscription.ID, now)
+	if err != nil {
+		http.Error(w, "Failed to check quota", http.StatusInternalServerError)
+		return false
+	}
+
+	quota := subscription.DailyQuota()
+	if count == subscription.NearLimit() {
+		data := subscriptionEventData(subscription)
+		data["used"] = count
+		webhooks.Emit(ctx, h.webhookRepo, userID, models.EventQuotaNearLimit, data)
+		webhooks.EmitForAPI(ctx, h.webhookRepo, api.ID, models.EventQuotaNearLimit, data)
+	}
+	if count > quota {
+		// Quotas reset at midnight UTC
+		tomorrow := now.UTC().Truncate(24 * time.Hour).Add(24 * time.Hour)
+		w.Header().Set("Retry-After", strconv.Itoa(int(tomorrow.Sub(now).Seconds())+1))
+		http.Error(w, fmt.Sprintf("Daily quota of %d executions on the %s plan is used up", quota, subscription.Plan), http.StatusTooManyRequests)
+		return false
+	}
+
+	return true
+}
@@ -0,0 +1,46 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/aKaddoura96/api-hosting-execution-platform/backend/shared/models"
+	"github.com/google/uuid"
+)
+
+type TestRunRequest struct {
+	Code  string                 `json:"code"`
+	Input map[string]interface{} `json:"input"`
+}
+
+// TestCode runs code the owner hasn't uploaded yet with the API's runtime and
+// resource class, for trying it out from the dashboard. Nothing is recorded.
+func (h *ExecuteHandler) TestCode(w http.ResponseWriter, r *http.Request) {
+	api, ok := authorizeAPIOwner(w, r, h.apiRepo)
+	if !ok {
+		return
+	}
+
+	var req TestRunRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Code == "" {
+		http.Error(w, "code is required", http.StatusBadRequest)
+		return
+	}
+	// WebAssembly modules are uploaded, not written in the dashboard
+	if api.Runtime == models.RuntimeWASM {
+		http.Error(w, "Test runs are not available for the wasm runtime", http.StatusBadRequest)
+		return
+	}
+
+	target := currentVersion(api)
+	status, respBody, err := h.invokeExecutor(r.Context(), uuid.New().String(), target, api.UserID, req.Code, &ExecuteRequest{Input: req.Input})
+	if err != nil {
+		http.Error(w, "Failed to execute API code", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	setRetryAfter(w, status, respBody)
+	w.WriteHeader(status)
+	w.Write(respBody)
+}
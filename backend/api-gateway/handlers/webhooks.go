@@ -0,0 +1,221 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"strconv"
+
+	"github.com/aKaddoura96/api-hosting-execution-platform/backend/shared/egress"
+	"github.com/aKaddoura96/api-hosting-execution-platform/backend/shared/models"
+	"github.com/aKaddoura96/api-hosting-execution-platform/backend/shared/repository"
+	"github.com/aKaddoura96/api-hosting-execution-platform/backend/shared/webhooks"
+	"github.com/gorilla/mux"
+)
+
+type WebhookHandler struct {
+	webhookRepo *repository.WebhookRepository
+}
+
+func NewWebhookHandler(webhookRepo *repository.WebhookRepository) *WebhookHandler {
+	return &WebhookHandler{webhookRepo: webhookRepo}
+}
+
+// WebhookRequest creates a webhook or, with pointer fields left nil,
+// partially updates one
+type WebhookRequest struct {
+	URL      *string   `json:"url"`
+	Events   *[]string `json:"events"`
+	IsActive *bool     `json:"is_active"`
+}
+
+// apply copies the set fields onto wh and validates the result
+func (req *WebhookRequest) apply(ctx context.Context, wh *models.Webhook) string {
+	if req.URL != nil {
+		wh.URL = *req.URL
+	}
+	if req.Events != nil {
+		wh.Events = *req.Events
+	}
+	if req.IsActive != nil {
+		wh.IsActive = *req.IsActive
+	}
+
+	if err := egress.CheckPublicURL(ctx, wh.URL); err != nil {
+		return "url " + err.Error()
+	}
+
+	if wh.Events == nil {
+		wh.Events = []string{}
+	}
+	for _, event := range wh.Events {
+		if !isWebhookEvent(event) {
+			return "unknown event type: " + event
+		}
+	}
+
+	return ""
+}
+
+func isWebhookEvent(event string) bool {
+	for _, known := range models.WebhookEventTypes {
+		if event == known {
+			return true
+		}
+	}
+	return false
+}
+
+// authorizeWebhook loads the webhook named by {id} if the caller owns it
+func (h *WebhookHandler) authorizeWebhook(w http.ResponseWriter, r *http.Request) (*models.Webhook, bool) {
+	userID := r.Context().Value("user_id").(string)
+
+	webhook, err := h.webhookRepo.GetByID(mux.Vars(r)["id"])
+	if err != nil || webhook.UserID != userID {
+		http.Error(w, "Webhook not found", http.StatusNotFound)
+		return nil, false
+	}
+
+	return webhook, true
+}
+
+// CreateWebhook registers a webhook. The signing secret is only ever
+// returned in this response.
+func (h *WebhookHandler) CreateWebhook(w http.ResponseWriter, r *http.Request) {
+	userID := r.Context().Value("user_id").(string)
+
+	var req WebhookRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	webhook := &models.Webhook{UserID: userID, IsActive: true}
+	if msg := req.apply(r.Context(), webhook); msg != "" {
+		http.Error(w, msg, http.StatusBadRequest)
+		return
+	}
+
+	secret, err := webhooks.GenerateSecret()
+	if err != nil {
+		http.Error(w, "Failed to generate webhook secret", http.StatusInternalServerError)
+		return
+	}
+	webhook.Secret = secret
+
+	if err := h.webhookRepo.Create(webhook); err != nil {
+		http.Error(w, "Failed to create webhook", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(webhook)
+}
+
+func (h *WebhookHandler) GetWebhooks(w http.ResponseWriter, r *http.Request) {
+	userID := r.Context().Value("user_id").(string)
+
+	hooks, err := h.webhookRepo.GetByUserID(userID)
+	if err != nil {
+		http.Error(w, "Failed to get webhooks", http.StatusInternalServerError)
+		return
+	}
+	if hooks == nil {
+		hooks = []*models.Webhook{}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(hooks)
+}
+
+func (h *WebhookHandler) UpdateWebhook(w http.ResponseWriter, r *http.Request) {
+	webhook, ok := h.authorizeWebhook(w, r)
+	if !ok {
+		return
+	}
+
+	var req WebhookRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	if msg := req.apply(r.Context(), webhook); msg != "" {
+		http.Error(w, msg, http.StatusBadRequest)
+		return
+	}
+
+	if err := h.webhookRepo.Update(webhook); err != nil {
+		http.Error(w, "Failed to update webhook", http.StatusInternalServerError)
+		return
+	}
+
+	webhook.Secret = ""
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(webhook)
+}
+
+func (h *WebhookHandler) DeleteWebhook(w http.ResponseWriter, r *http.Request) {
+	webhook, ok := h.authorizeWebhook(w, r)
+	if !ok {
+		return
+	}
+
+	if err := h.webhookRepo.Delete(webhook.ID); err != nil {
+		http.Error(w, "Failed to delete webhook", http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// GetDeliveries returns the delivery log of a webhook, newest first
+func (h *WebhookHandler) GetDeliveries(w http.ResponseWriter, r *http.Request) {
+	webhook, ok := h.authorizeWebhook(w, r)
+	if !ok {
+		return
+	}
+
+	limit := 50
+	if v, err := strconv.Atoi(r.URL.Query().Get("limit")); err == nil && v > 0 && v <= 500 {
+		limit = v
+	}
+
+	deliveries, err := h.webhookRepo.GetDeliveries(webhook.ID, limit)
+	if err != nil {
+		http.Error(w, "Failed to get deliveries", http.StatusInternalServerError)
+		return
+	}
+	if deliveries == nil {
+		deliveries = []*models.WebhookDelivery{}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(deliveries)
+}
+
+// Redeliver queues the event of an earlier delivery again. The copy keeps
+// the original event ID so receivers can deduplicate.
+func (h *WebhookHandler) Redeliver(w http.ResponseWriter, r *http.Request) {
+	webhook, ok := h.authorizeWebhook(w, r)
+	if !ok {
+		return
+	}
+
+	original, err := h.webhookRepo.GetDelivery(mux.Vars(r)["delivery_id"])
+	if err != nil || original.WebhookID != webhook.ID {
+		http.Error(w, "Delivery not found", http.StatusNotFound)
+		return
+	}
+
+	delivery, err := h.webhookRepo.Redeliver(original.ID)
+	if err != nil {
+		http.Error(w, "Failed to queue redelivery", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusAccepted)
+	json.NewEncoder(w).Encode(delivery)
+}
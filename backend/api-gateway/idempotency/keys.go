@@ -0,0 +1,171 @@
+package idempotency
+
+import (
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/aKaddoura96/api-hosting-execution-platform/backend/shared/logger"
+	"github.com/aKaddoura96/api-hosting-execution-platform/backend/shared/models"
+)
+
+const (
+	// Header carries the client's key on an execute request
+	Header = "Idempotency-Key"
+	// ReplayedHeader marks a response repeated from an earlier request
+	ReplayedHeader = "Idempotent-Replayed"
+	// MaxKeyLength is the longest key accepted
+	MaxKeyLength = 255
+)
+
+const (
+	// holdFor is how long a request in progress holds its key. It outlasts
+	// the longest execution, so a key is only taken over from a gateway that
+	// died mid-request.
+	holdFor = 20 * time.Minute
+	// pollInterval is how often a repeat checks whether the request holding
+	// its key has finished
+	pollInterval = 250 * time.Millisecond
+	// purgeInterval is how often expired keys are deleted
+	purgeInterval = time.Hour
+)
+
+// ErrKeyReused is returned for a key already used for a different request
+var ErrKeyReused = errors.New("idempotency key was already used for a different request")
+
+// ErrNoCaller is returned for a key sent without an API key. Keys are scoped
+// to the caller, so an anonymous one could replay another client's response.
+var ErrNoCaller = errors.New("an API key is required to use an idempotency key")
+
+// Store keeps the keys; repository.IdempotencyRepository keeps them in the
+// database
+type Store interface {
+	Claim(key *models.IdempotencyKey, hold time.Duration) (bool, error)
+	Get(apiID, caller, key string) (*models.IdempotencyKey, error)
+	Complete(key *models.IdempotencyKey, ttl time.Duration) error
+	Release(key *models.IdempotencyKey) error
+	DeleteExpired() (int64, error)
+}
+
+// Keys makes execute requests sent with an Idempotency-Key run once: the
+// first request claims the key and its response is stored, and repeats get
+// that response. Keys are kept in the database, so they hold across gateway
+// instances.
+type Keys struct {
+	repo Store
+	ttl  time.Duration
+}
+
+// New creates the key store. IDEMPOTENCY_KEY_TTL sets how long a response is
+// kept for repeats (default 24h).
+func New(repo Store) (*Keys, error) {
+	k := &Keys{repo: repo, ttl: 24 * time.Hour}
+
+	if v := os.Getenv("IDEMPOTENCY_KEY_TTL"); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil || d <= 0 {
+			return nil, fmt.Errorf("invalid IDEMPOTENCY_KEY_TTL: %q", v)
+		}
+		k.ttl = d
+	}
+
+	return k, nil
+}
+
+// Fingerprint identifies a request by its method, path, query and body, so a
+// key reused for another request is told from a repeat
+func Fingerprint(r *http.Request, body []byte) string {
+	h := sha256.New()
+	fmt.Fprintf(h, "%s %s?%s\n", r.Method, r.URL.Path, r.URL.RawQuery)
+	h.Write(body)
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// Begin claims key for the request with fingerprint. A claimed key comes
+// back pending: the caller runs the request and passes the response to
+// Complete, or calls Release if nothing ran. A key holding the response to
+// the same request comes back completed, to be replayed. While another
+// request with the key is in progress Begin waits for it to finish, until ctx
+// ends. Keys are scoped to the API and caller, which must be known.
+func (k *Keys) Begin(ctx context.Context, apiID, caller, key, fingerprint string) (*models.IdempotencyKey, error) {
+	if caller == "" {
+		return nil, ErrNoCaller
+	}
+	for {
+		claim := &models.IdempotencyKey{
+			APIID:       apiID,
+			Caller:      caller,
+			Key:         key,
+			Fingerprint: fingerprint,
+		}
+		claimed, err := k.repo.Claim(claim, holdFor)
+		if err != nil {
+			return nil, fmt.Errorf("failed to claim idempotency key: %w", err)
+		}
+		if claimed {
+			return claim, nil
+		}
+
+		existing, err := k.repo.Get(apiID, caller, key)
+		if errors.Is(err, sql.ErrNoRows) {
+			// Released or expired since the claim failed
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to load idempotency key: %w", err)
+		}
+		if existing.Fingerprint != fingerprint {
+			return nil, ErrKeyReused
+		}
+		if existing.Status == models.IdempotencyCompleted {
+			return existing, nil
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(pollInterval):
+		}
+	}
+}
+
+// Complete stores the response to a claimed key for repeats
+func (k *Keys) Complete(claim *models.IdempotencyKey, status int, header http.Header, body []byte) error {
+	claim.ResponseStatus = status
+	claim.ResponseHeaders = header
+	claim.ResponseBody = body
+	return k.repo.Complete(claim, k.ttl)
+}
+
+// Release gives up a claimed key, so a repeat runs the request again
+func (k *Keys) Release(claim *models.IdempotencyKey) error {
+	return k.repo.Release(claim)
+}
+
+// Run deletes expired keys until ctx is cancelled
+func (k *Keys) Run(ctx context.Context) {
+	ticker := time.NewTicker(purgeInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			deleted, err := k.repo.DeleteExpired()
+			if err != nil {
+				logger.Error("Failed to delete expired idempotency keys", map[string]interface{}{"error": err.Error()})
+				continue
+			}
+			if deleted > 0 {
+				logger.Debug("Deleted expired idempotency keys", map[string]interface{}{"deleted": deleted})
+			}
+		}
+	}
+}
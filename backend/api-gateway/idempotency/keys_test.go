@@ -0,0 +1,177 @@
+package idempotency
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/aKaddoura96/api-hosting-execution-platform/backend/shared/models"
+)
+
+func TestFingerprint(t *testing.T) {
+	const (
+		target = "/execute/abc12345/orders?region=eu"
+		body   = `{"input":{"order_id":1234}}`
+	)
+	base := Fingerprint(httptest.NewRequest("POST", target, nil), []byte(body))
+
+	tests := []struct {
+		name     string
+		method   string
+		target   string
+		body     string
+		header   map[string]string
+		wantSame bool
+	}{
+		{name: "same request", method: "POST", target: target, body: body, wantSame: true},
+		{
+			name: "headers don't count", method: "POST", target: target, body: body,
+			header:   map[string]string{"Idempotency-Key": "other", "X-Request-ID": "123"},
+			wantSame: true,
+		},
+		{name: "other method", method: "PUT", target: target, body: body},
+		{name: "other path", method: "POST", target: "/execute/abc12345/refunds?region=eu", body: body},
+		{name: "other query", method: "POST", target: "/execute/abc12345/orders?region=us", body: body},
+		{name: "no query", method: "POST", target: "/execute/abc12345/orders", body: body},
+		{name: "other body", method: "POST", target: target, body: `{"input":{"order_id":1235}}`},
+		{name: "body compared byte for byte", method: "POST", target: target, body: `{"input": {"order_id": 1234}}`},
+		{name: "empty body", method: "POST", target: target, body: ""},
+		// The query can't be moved into the path or the body
+		{name: "query moved into the body", method: "POST", target: "/execute/abc12345/orders", body: "region=eu\n" + body},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(tt.method, tt.target, nil)
+			for name, value := range tt.header {
+				r.Header.Set(name, value)
+			}
+
+			got := Fingerprint(r, []byte(tt.body))
+			if (got == base) != tt.wantSame {
+				t.Errorf("Fingerprint() same as the original = %v, want %v", got == base, tt.wantSame)
+			}
+			if len(got) != 64 {
+				t.Errorf("Fingerprint() = %q, want a hex SHA-256", got)
+			}
+		})
+	}
+}
+
+// memoryStore keeps keys in memory. Nothing expires.
+type memoryStore struct {
+	mu   sync.Mutex
+	keys map[[3]string]models.IdempotencyKey
+}
+
+func newMemoryStore() *memoryStore {
+	return &memoryStore{keys: map[[3]string]models.IdempotencyKey{}}
+}
+
+func storeKey(apiID, caller, key string) [3]string {
+	return [3]string{apiID, caller, key}
+}
+
+func (s *memoryStore) Claim(key *models.IdempotencyKey, hold time.Duration) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	id := storeKey(key.APIID, key.Caller, key.Key)
+	if _, ok := s.keys[id]; ok {
+		return false, nil
+	}
+	key.Status = models.IdempotencyPending
+	s.keys[id] = *key
+	return true, nil
+}
+
+func (s *memoryStore) Get(apiID, caller, key string) (*models.IdempotencyKey, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	record, ok := s.keys[storeKey(apiID, caller, key)]
+	if !ok {
+		return nil, sql.ErrNoRows
+	}
+	return &record, nil
+}
+
+func (s *memoryStore) Complete(key *models.IdempotencyKey, ttl time.Duration) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	key.Status = models.IdempotencyCompleted
+	s.keys[storeKey(key.APIID, key.Caller, key.Key)] = *key
+	return nil
+}
+
+func (s *memoryStore) Release(key *models.IdempotencyKey) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.keys, storeKey(key.APIID, key.Caller, key.Key))
+	return nil
+}
+
+func (s *memoryStore) DeleteExpired() (int64, error) {
+	return 0, nil
+}
+
+func TestBeginScopesKeysToCaller(t *testing.T) {
+	const (
+		apiID = "api-1"
+		key   = "order-1234"
+		fp    = "fingerprint"
+	)
+	keys, err := New(newMemoryStore())
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+
+	alice, err := keys.Begin(ctx, apiID, "alice", key, fp)
+	if err != nil {
+		t.Fatalf("Begin() for alice: %v", err)
+	}
+	if err := keys.Complete(alice, http.StatusOK, nil, []byte("alice's response")); err != nil {
+		t.Fatal(err)
+	}
+
+	// Another caller sending the same key with the same request runs it anew
+	bob, err := keys.Begin(ctx, apiID, "bob", key, fp)
+	if err != nil {
+		t.Fatalf("Begin() for bob: %v", err)
+	}
+	if bob.Status != models.IdempotencyPending || bob.ResponseBody != nil {
+		t.Errorf("bob got status %q and body %q, want a pending claim of its own", bob.Status, bob.ResponseBody)
+	}
+
+	// and with another request it isn't a reuse of alice's key
+	if _, err := keys.Begin(ctx, apiID, "carol", key, "other fingerprint"); err != nil {
+		t.Errorf("Begin() for carol with another request: %v", err)
+	}
+
+	replay, err := keys.Begin(ctx, apiID, "alice", key, fp)
+	if err != nil {
+		t.Fatalf("Begin() for alice's repeat: %v", err)
+	}
+	if replay.Status != models.IdempotencyCompleted || string(replay.ResponseBody) != "alice's response" {
+		t.Errorf("alice's repeat got status %q and body %q, want the stored response", replay.Status, replay.ResponseBody)
+	}
+}
+
+func TestBeginRequiresCaller(t *testing.T) {
+	store := newMemoryStore()
+	keys, err := New(store)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := keys.Begin(context.Background(), "api-1", "", "order-1234", "fingerprint"); !errors.Is(err, ErrNoCaller) {
+		t.Errorf("Begin() without a caller: err = %v, want ErrNoCaller", err)
+	}
+	if len(store.keys) != 0 {
+		t.Errorf("Begin() without a caller claimed a key")
+	}
+}
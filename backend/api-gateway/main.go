@@ -1,16 +1,27 @@
 package main
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"net/http"
 	"os"
+	"sync"
 	"time"
 
+	"github.com/aKaddoura96/api-hosting-execution-platform/backend/api-gateway/executors"
 	"github.com/aKaddoura96/api-hosting-execution-platform/backend/api-gateway/handlers"
+	"github.com/aKaddoura96/api-hosting-execution-platform/backend/api-gateway/idempotency"
 	"github.com/aKaddoura96/api-hosting-execution-platform/backend/api-gateway/middleware"
+	"github.com/aKaddoura96/api-hosting-execution-platform/backend/api-gateway/scheduler"
 	"github.com/aKaddoura96/api-hosting-execution-platform/backend/shared/database"
 	"github.com/aKaddoura96/api-hosting-execution-platform/backend/shared/logger"
+	"github.com/aKaddoura96/api-hosting-execution-platform/backend/shared/models"
 	"github.com/aKaddoura96/api-hosting-execution-platform/backend/shared/repository"
+	"github.com/aKaddoura96/api-hosting-execution-platform/backend/shared/secrets"
+	"github.com/aKaddoura96/api-hosting-execution-platform/backend/shared/server"
+	"github.com/aKaddoura96/api-hosting-execution-platform/backend/shared/tracing"
+	"github.com/aKaddoura96/api-hosting-execution-platform/backend/shared/webhooks"
 	"github.com/gorilla/mux"
 	"github.com/joho/godotenv"
 	"github.com/rs/cors"
@@ -23,16 +34,21 @@ type HealthResponse struct {
 }
 
 func main() {
+	// Load environment variables (before the logger so LOG_LEVEL/LOG_FORMAT apply)
+	godotenv.Load()
+
 	// Initialize logger
 	log := logger.NewLogger("api-gateway")
 	logger.SetDefaultLogger(log)
 
-	// Load environment variables
-	godotenv.Load()
 	log.Info("Starting API Gateway", map[string]interface{}{
 		"version": "1.0.0",
 	})
 
+	// Initialize tracing (exporter chosen by OTEL_TRACES_EXPORTER)
+	shutdownTracing := tracing.Init("api-gateway")
+	defer shutdownTracing()
+
 	// Connect to database
 	log.Info("Connecting to database...")
 	if err := database.Connect(); err != nil {
@@ -48,20 +64,92 @@ func main() {
 	userRepo := repository.NewUserRepository(database.DB)
 	apiRepo := repository.NewAPIRepository(database.DB)
 	apiKeyRepo := repository.NewAPIKeyRepository(database.DB)
+	execRepo := repository.NewExecutionRepository(database.DB)
+	logRepo := repository.NewExecutionLogRepository(database.DB)
+	versionRepo := repository.NewAPIVersionRepository(database.DB)
+	captureRepo := repository.NewCaptureRepository(database.DB)
+	jobRepo := repository.NewJobRepository(database.DB)
+	scheduleRepo := repository.NewScheduleRepository(database.DB)
+	webhookRepo := repository.NewWebhookRepository(database.DB)
+	envRepo := repository.NewEnvVarRepository(database.DB)
+	egressRepo := repository.NewEgressRepository(database.DB)
+	runtimeRepo := repository.NewRuntimeRepository(database.DB)
+	imageRepo := repository.NewCustomImageRepository(database.DB)
+	scalingRepo := repository.NewScalingRepository(database.DB)
+	replicaRepo := repository.NewReplicaRepository(database.DB)
+	cachedImageRepo := repository.NewCachedImageRepository(database.DB)
+	subscriptionRepo := repository.NewSubscriptionRepository(database.DB)
+
+	// Secrets need SECRETS_ENCRYPTION_KEY; plain variables work without it
+	keyring, err := secrets.FromEnv()
+	if errors.Is(err, secrets.ErrNotConfigured) {
+		log.Warn("SECRETS_ENCRYPTION_KEY not set, API secrets are disabled")
+	} else if err != nil {
+		log.Fatal("Failed to load secrets key", map[string]interface{}{
+			"error": err.Error(),
+		})
+	}
+
+	// Executions go to the executor nodes registered in the database, or to
+	// EXECUTOR_URL while none are
+	executorPool, err := executors.NewPool(repository.NewExecutorNodeRepository(database.DB))
+	if err != nil {
+		log.Fatal("Invalid executor pool configuration", map[string]interface{}{
+			"error": err.Error(),
+		})
+	}
+	// Background work runs until shutdown starts
+	background, stopBackground := context.WithCancel(context.Background())
+	var backgroundDone sync.WaitGroup
+	runInBackground := func(run func(ctx context.Context)) {
+		backgroundDone.Add(1)
+		go func() {
+			defer backgroundDone.Done()
+			run(background)
+		}()
+	}
+	runInBackground(executorPool.Run)
 
 	// Initialize handlers
 	log.Info("Initializing handlers")
 	authHandler := handlers.NewAuthHandler(userRepo)
-	apiHandler := handlers.NewAPIHandler(apiRepo)
-	deployHandler := handlers.NewDeployHandler(apiRepo)
-	executeHandler := handlers.NewExecuteHandler(apiRepo)
+	apiHandler := handlers.NewAPIHandler(apiRepo, versionRepo, userRepo, runtimeRepo)
+	replicas := executors.NewReplicas(executorPool, replicaRepo)
+	deployHandler := handlers.NewDeployHandler(apiRepo, webhookRepo, scalingRepo, executorPool, replicas)
+	// Execute requests with an Idempotency-Key run once per key
+	idempotencyKeys, err := idempotency.New(repository.NewIdempotencyRepository(database.DB))
+	if err != nil {
+		log.Fatal("Invalid idempotency configuration", map[string]interface{}{
+			"error": err.Error(),
+		})
+	}
+	runInBackground(idempotencyKeys.Run)
+	executeHandler := handlers.NewExecuteHandler(apiRepo, execRepo, captureRepo, versionRepo, jobRepo, webhookRepo, scalingRepo, subscriptionRepo, executorPool, replicas, idempotencyKeys)
+	logHandler := handlers.NewLogHandler(apiRepo, logRepo, executorPool)
+	captureHandler := handlers.NewCaptureHandler(apiRepo, captureRepo)
+	jobHandler := handlers.NewJobHandler(apiRepo, jobRepo)
+	scheduleHandler := handlers.NewScheduleHandler(apiRepo, scheduleRepo)
+	webhookHandler := handlers.NewWebhookHandler(webhookRepo)
+	envHandler := handlers.NewEnvHandler(apiRepo, envRepo, keyring)
+	egressHandler := handlers.NewEgressHandler(apiRepo, egressRepo)
+	imageHandler := handlers.NewImageHandler(apiRepo, imageRepo, executorPool)
+	scalingHandler := handlers.NewScalingHandler(apiRepo, scalingRepo, replicaRepo, replicas)
+	adminHandler := handlers.NewAdminHandler(cachedImageRepo)
+	subscriptionHandler := handlers.NewSubscriptionHandler(apiRepo, subscriptionRepo, webhookRepo)
+
+	// Fire cron schedules in the background
+	runInBackground(scheduler.New(scheduleRepo, apiRepo, jobRepo).Run)
+
+	// Deliver outbound webhooks in the background
+	runInBackground(webhooks.NewDispatcher(webhookRepo, apiKeyRepo).Run)
 	apiKeyHandler := handlers.NewAPIKeyHandler(apiKeyRepo)
 
 	// Setup router
 	log.Info("Setting up routes")
 	router := mux.NewRouter()
 
-	// Add logging middleware
+	// Add tracing and logging middleware (tracing first so logs carry trace_id)
+	router.Use(tracing.HTTPMiddleware)
 	router.Use(logger.HTTPLoggingMiddleware(log))
 
 	// Public routes
@@ -74,8 +162,15 @@ func main() {
 	router.HandleFunc("/api/v1/marketplace/apis", apiHandler.GetPublicAPIs).Methods("GET")
 	router.HandleFunc("/api/v1/marketplace/apis/{id}", apiHandler.GetAPI).Methods("GET")
 	
-	// API Execution endpoint - allows invoking deployed APIs
-	router.PathPrefix("/execute/").HandlerFunc(executeHandler.ExecuteAPI).Methods("POST")
+	// API Execution endpoint - allows invoking deployed APIs. An API key is
+	// optional, and identifies the caller for quotas
+	router.PathPrefix("/execute/").Handler(
+		middleware.APIKeyMiddleware(apiKeyRepo)(http.HandlerFunc(executeHandler.ExecuteAPI)),
+	).Methods("POST")
+
+	// Async job polling - the unguessable job ID is the credential, like the
+	// execute endpoint it is reachable without a login
+	router.HandleFunc("/api/v1/jobs/{id}", jobHandler.GetJob).Methods("GET")
 
 	// Protected routes
 	protected := router.PathPrefix("/api/v1").Subrouter()
@@ -92,22 +187,84 @@ func main() {
 	protected.HandleFunc("/apis/{id}", apiHandler.UpdateAPI).Methods("PUT")
 	protected.HandleFunc("/apis/{id}", apiHandler.DeleteAPI).Methods("DELETE")
 	protected.HandleFunc("/apis/{id}/upload", apiHandler.UploadCode).Methods("POST")
+	protected.HandleFunc("/apis/{id}/versions", apiHandler.GetVersions).Methods("GET")
+	protected.HandleFunc("/resource-classes", apiHandler.GetResourceClasses).Methods("GET")
+	protected.HandleFunc("/runtimes", apiHandler.GetRuntimes).Methods("GET")
 	
+	// Environment variable and secret routes
+	protected.HandleFunc("/apis/{id}/env", envHandler.GetEnv).Methods("GET")
+	protected.HandleFunc("/apis/{id}/env/{name}", envHandler.SetEnv).Methods("PUT")
+	protected.HandleFunc("/apis/{id}/env/{name}", envHandler.DeleteEnv).Methods("DELETE")
+
+	// Outbound network access routes
+	protected.HandleFunc("/apis/{id}/egress", egressHandler.GetEgressPolicy).Methods("GET")
+	protected.HandleFunc("/apis/{id}/egress", egressHandler.UpdateEgressPolicy).Methods("PUT")
+
+	// Persistent replicas and how they scale
+	protected.HandleFunc("/apis/{id}/scaling", scalingHandler.GetScaling).Methods("GET")
+	protected.HandleFunc("/apis/{id}/scaling", scalingHandler.UpdateScaling).Methods("PUT")
+
+	// Custom runtime images
+	protected.HandleFunc("/apis/{id}/image", imageHandler.GetImage).Methods("GET")
+	protected.HandleFunc("/apis/{id}/image", imageHandler.UpdateImage).Methods("PUT")
+	protected.HandleFunc("/apis/{id}/image/build", imageHandler.BuildImage).Methods("POST")
+
 	// Deployment routes
 	protected.HandleFunc("/apis/{id}/deploy", deployHandler.DeployAPI).Methods("POST")
 	protected.HandleFunc("/apis/{id}/stop", deployHandler.StopAPI).Methods("POST")
 	protected.HandleFunc("/apis/{id}/status", deployHandler.GetAPIStatus).Methods("GET")
+
+	// Execution log routes
+	protected.HandleFunc("/apis/{id}/logs", logHandler.GetLogs).Methods("GET")
+	protected.HandleFunc("/apis/{id}/logs/stream", logHandler.StreamLogs).Methods("GET")
+
+	// Execution capture and replay routes
+	protected.HandleFunc("/apis/{id}/capture", captureHandler.GetCaptureSettings).Methods("GET")
+	protected.HandleFunc("/apis/{id}/capture", captureHandler.UpdateCaptureSettings).Methods("PUT")
+	protected.HandleFunc("/apis/{id}/executions/{execution_id}/capture", captureHandler.GetCapture).Methods("GET")
+	protected.HandleFunc("/apis/{id}/executions/{execution_id}/replay", executeHandler.ReplayExecution).Methods("POST")
+	protected.HandleFunc("/apis/{id}/test", executeHandler.TestCode).Methods("POST")
+
+	// Async job routes (listing and dead-letter redrive)
+	protected.HandleFunc("/apis/{id}/jobs", jobHandler.ListJobs).Methods("GET")
+	protected.HandleFunc("/apis/{id}/jobs/{job_id}/retry", jobHandler.RetryJob).Methods("POST")
+
+	// Schedule routes
+	protected.HandleFunc("/apis/{id}/schedules", scheduleHandler.GetSchedules).Methods("GET")
+	protected.HandleFunc("/apis/{id}/schedules", scheduleHandler.CreateSchedule).Methods("POST")
+	protected.HandleFunc("/apis/{id}/schedules/{schedule_id}", scheduleHandler.UpdateSchedule).Methods("PUT")
+	protected.HandleFunc("/apis/{id}/schedules/{schedule_id}", scheduleHandler.DeleteSchedule).Methods("DELETE")
+	protected.HandleFunc("/apis/{id}/schedules/{schedule_id}/runs", scheduleHandler.GetScheduleRuns).Methods("GET")
 	
+	// Webhook routes
+	protected.HandleFunc("/webhooks", webhookHandler.GetWebhooks).Methods("GET")
+	protected.HandleFunc("/webhooks", webhookHandler.CreateWebhook).Methods("POST")
+	protected.HandleFunc("/webhooks/{id}", webhookHandler.UpdateWebhook).Methods("PUT")
+	protected.HandleFunc("/webhooks/{id}", webhookHandler.DeleteWebhook).Methods("DELETE")
+	protected.HandleFunc("/webhooks/{id}/deliveries", webhookHandler.GetDeliveries).Methods("GET")
+	protected.HandleFunc("/webhooks/{id}/deliveries/{delivery_id}/redeliver", webhookHandler.Redeliver).Methods("POST")
+
+	// Subscription routes
+	protected.HandleFunc("/subscriptions", subscriptionHandler.GetMySubscriptions).Methods("GET")
+	protected.HandleFunc("/apis/{id}/subscription", subscriptionHandler.Subscribe).Methods("POST")
+	protected.HandleFunc("/apis/{id}/subscription", subscriptionHandler.CancelSubscription).Methods("DELETE")
+
 	// API Key management routes
 	protected.HandleFunc("/api-keys", apiKeyHandler.GetMyAPIKeys).Methods("GET")
 	protected.HandleFunc("/api-keys", apiKeyHandler.CreateAPIKey).Methods("POST")
 	protected.HandleFunc("/api-keys/{id}", apiKeyHandler.DeactivateAPIKey).Methods("DELETE")
 
+	// Admin routes, for users with the admin role
+	admin := protected.PathPrefix("/admin").Subrouter()
+	admin.Use(middleware.RequireRole(models.RoleAdmin))
+	admin.HandleFunc("/images", adminHandler.GetCachedImages).Methods("GET")
+
 	// CORS configuration
 	c := cors.New(cors.Options{
 		AllowedOrigins:   []string{"http://localhost:3000", "http://localhost:3001"},
 		AllowedMethods:   []string{"GET", "POST", "PUT", "DELETE", "OPTIONS"},
-		AllowedHeaders:   []string{"Content-Type", "Authorization"},
+		AllowedHeaders:   []string{"Content-Type", "Authorization", "traceparent", "X-Request-ID", "Idempotency-Key"},
+		ExposedHeaders:   []string{"traceparent", "X-Request-ID", "X-Execution-ID", "Idempotent-Replayed"},
 		AllowCredentials: true,
 	})
 
@@ -121,7 +278,28 @@ func main() {
 		"address": "http://localhost:" + port,
 	})
 	
-	if err := http.ListenAndServe(":"+port, c.Handler(router)); err != nil {
+	srv, err := server.New(":"+port, c.Handler(router))
+	if err != nil {
+		log.Fatal("Invalid server configuration", map[string]interface{}{
+			"error": err.Error(),
+		})
+	}
+
+	// On shutdown the scheduler and health checks stop, and webhook
+	// deliveries already claimed are sent, while requests in flight finish
+	err = srv.Run(func(ctx context.Context) {
+		stopBackground()
+		done := make(chan struct{})
+		go func() {
+			backgroundDone.Wait()
+			close(done)
+		}()
+		select {
+		case <-done:
+		case <-ctx.Done():
+		}
+	})
+	if err != nil {
 		log.Fatal("Server failed", map[string]interface{}{
 			"error": err.Error(),
 		})
@@ -6,6 +6,7 @@ import (
 	"strings"
 
 	"github.com/aKaddoura96/api-hosting-execution-platform/backend/shared/auth"
+	"github.com/aKaddoura96/api-hosting-execution-platform/backend/shared/logger"
 )
 
 func AuthMiddleware(next http.Handler) http.Handler {
@@ -37,8 +38,23 @@ func AuthMiddleware(next http.Handler) http.Handler {
 		ctx := context.WithValue(r.Context(), "user_id", claims.UserID)
 		ctx = context.WithValue(ctx, "user_email", claims.Email)
 		ctx = context.WithValue(ctx, "user_role", claims.Role)
+		ctx = logger.AddFields(ctx, map[string]interface{}{"user_id": claims.UserID})
 
 		// Call next handler
 		next.ServeHTTP(w, r.WithContext(ctx))
 	})
 }
+
+// RequireRole refuses requests from users without role; it goes after
+// AuthMiddleware
+func RequireRole(role string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if userRole, _ := r.Context().Value("user_role").(string); userRole != role {
+				http.Error(w, "Forbidden", http.StatusForbidden)
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
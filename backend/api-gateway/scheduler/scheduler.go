@@ -0,0 +1,263 @@
+package scheduler
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"time"
+	_ "time/tzdata" // timezones must resolve in minimal containers
+
+	"github.com/aKaddoura96/api-hosting-execution-platform/backend/shared/logger"
+	"github.com/aKaddoura96/api-hosting-execution-platform/backend/shared/models"
+	"github.com/aKaddoura96/api-hosting-execution-platform/backend/shared/repository"
+	"github.com/robfig/cron/v3"
+)
+
+const (
+	// maxDueRuns bounds how many missed fire times are examined per schedule
+	maxDueRuns = 1000
+	// dueBatch is how many due schedules are handled per tick
+	dueBatch = 100
+)
+
+var parser = cron.NewParser(cron.Minute | cron.Hour | cron.Dom | cron.Month | cron.Dow | cron.Descriptor)
+
+// NextRun returns the first fire time of expr after the given time, evaluated
+// in timezone tz so that e.g. "0 9 * * *" follows local daylight saving
+func NextRun(expr, tz string, after time.Time) (time.Time, error) {
+	loc, err := time.LoadLocation(tz)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid timezone %q", tz)
+	}
+
+	schedule, err := parser.Parse(expr)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid cron expression: %w", err)
+	}
+
+	next := schedule.Next(after.In(loc))
+	if next.IsZero() {
+		return time.Time{}, fmt.Errorf("cron expression never fires")
+	}
+	return next.UTC(), nil
+}
+
+// Scheduler fires due schedules by enqueueing async jobs
+type Scheduler struct {
+	schedules *repository.ScheduleRepository
+	apis      *repository.APIRepository
+	jobs      *repository.JobRepository
+	interval  time.Duration
+}
+
+// New creates a scheduler. SCHEDULER_INTERVAL sets how often schedules are
+// checked (default 15s, 0 disables the scheduler on this instance).
+func New(schedules *repository.ScheduleRepository, apis *repository.APIRepository, jobs *repository.JobRepository) *Scheduler {
+	s := &Scheduler{
+		schedules: schedules,
+		apis:      apis,
+		jobs:      jobs,
+		interval:  15 * time.Second,
+	}
+
+	if v := os.Getenv("SCHEDULER_INTERVAL"); v != "" {
+		if d, err := time.ParseDuration(v); err == nil && d >= 0 {
+			s.interval = d
+		}
+	}
+
+	return s
+}
+
+// Run checks for due schedules until ctx is cancelled. With several gateway
+// instances only the one holding the scheduler lock fires runs on each tick.
+func (s *Scheduler) Run(ctx context.Context) {
+	if s.interval == 0 {
+		logger.Info("Scheduler disabled")
+		return
+	}
+
+	ticker := time.NewTicker(s.interval)
+	defer ticker.Stop()
+
+	for {
+		s.tick(ctx)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (s *Scheduler) tick(ctx context.Context) {
+	release, ok, err := s.schedules.TryLock(ctx)
+	if err != nil {
+		logger.Error("Failed to acquire scheduler lock", map[string]interface{}{"error": err.Error()})
+		return
+	}
+	if !ok {
+		return
+	}
+	defer release()
+
+	s.startPending()
+
+	now := time.Now()
+	due, err := s.schedules.GetDue(now, dueBatch)
+	if err != nil {
+		logger.Error("Failed to load due schedules", map[string]interface{}{"error": err.Error()})
+		return
+	}
+
+	for _, schedule := range due {
+		s.fire(ctx, schedule, now)
+	}
+}
+
+// fire handles every fire time of a schedule up to now. After downtime only
+// the latest CatchUpLimit+1 missed times are run; older ones are dropped.
+func (s *Scheduler) fire(ctx context.Context, schedule *models.Schedule, now time.Time) {
+	log := logger.WithContext(ctx).WithFields(map[string]interface{}{
+		"schedule_id": schedule.ID,
+		"api_id":      schedule.APIID,
+	})
+
+	var due []time.Time
+	t := schedule.NextRunAt
+	for !t.After(now) && len(due) < maxDueRuns {
+		due = append(due, t)
+		next, err := NextRun(schedule.CronExpr, schedule.Timezone, t)
+		if err != nil {
+			log.Error("Schedule can no longer be evaluated", map[string]interface{}{"error": err.Error()})
+			return
+		}
+		t = next
+	}
+
+	nextRunAt, err := NextRun(schedule.CronExpr, schedule.Timezone, now)
+	if err != nil {
+		log.Error("Schedule can no longer be evaluated", map[string]interface{}{"error": err.Error()})
+		return
+	}
+
+	// Advance first so a failure below never fires the same times twice
+	if err := s.schedules.Advance(schedule.ID, nextRunAt, now); err != nil {
+		log.Error("Failed to advance schedule", map[string]interface{}{"error": err.Error()})
+		return
+	}
+
+	if keep := schedule.CatchUpLimit + 1; len(due) > keep {
+		log.Warn("Dropping missed schedule runs", map[string]interface{}{
+			"missed": len(due) - keep,
+		})
+		due = due[len(due)-keep:]
+	}
+
+	for _, scheduledFor := range due {
+		if err := s.fireOnce(schedule, scheduledFor); err != nil {
+			log.Error("Failed to fire schedule", map[string]interface{}{
+				"scheduled_for": scheduledFor.Format(time.RFC3339),
+				"error":         err.Error(),
+			})
+		}
+	}
+}
+
+// fireOnce applies the overlap policy to one fire time
+func (s *Scheduler) fireOnce(schedule *models.Schedule, scheduledFor time.Time) error {
+	run := &models.ScheduleRun{ScheduleID: schedule.ID, ScheduledFor: scheduledFor}
+
+	if schedule.OverlapPolicy != models.OverlapAllow {
+		active, err := s.schedules.CountActiveRuns(schedule.ID)
+		if err != nil {
+			return err
+		}
+		pending, err := s.schedules.CountPendingRuns(schedule.ID)
+		if err != nil {
+			return err
+		}
+
+		if active+pending > 0 {
+			if schedule.OverlapPolicy == models.OverlapQueue {
+				run.Status = models.ScheduleRunPending
+			} else {
+				run.Status = models.ScheduleRunSkipped
+				run.Reason = "previous run still active"
+			}
+			_, err := s.schedules.CreateRun(run)
+			return err
+		}
+	}
+
+	run.Status = models.ScheduleRunPending
+	created, err := s.schedules.CreateRun(run)
+	if err != nil || !created {
+		return err
+	}
+	return s.start(schedule, run)
+}
+
+// startPending starts queued runs whose predecessor has finished
+func (s *Scheduler) startPending() {
+	ids, err := s.schedules.GetPendingScheduleIDs()
+	if err != nil {
+		logger.Error("Failed to load pending schedule runs", map[string]interface{}{"error": err.Error()})
+		return
+	}
+
+	for _, id := range ids {
+		active, err := s.schedules.CountActiveRuns(id)
+		if err != nil || active > 0 {
+			continue
+		}
+
+		schedule, err := s.schedules.GetByID(id)
+		if err != nil {
+			continue
+		}
+		run, err := s.schedules.GetOldestPendingRun(id)
+		if err != nil || run == nil {
+			continue
+		}
+
+		if err := s.start(schedule, run); err != nil {
+			logger.Error("Failed to start pending schedule run", map[string]interface{}{
+				"schedule_id": id,
+				"error":       err.Error(),
+			})
+		}
+	}
+}
+
+// start enqueues the API with the schedule's input as an async job
+func (s *Scheduler) start(schedule *models.Schedule, run *models.ScheduleRun) error {
+	api, err := s.apis.GetByID(schedule.APIID)
+	if err != nil {
+		return err
+	}
+
+	if api.Status != "deployed" || api.CodePath == "" {
+		return s.schedules.MarkRunSkipped(run.ID, fmt.Sprintf("API is not deployed (status: %s)", api.Status))
+	}
+
+	code, err := os.ReadFile(api.CodePath)
+	if err != nil {
+		return s.schedules.MarkRunSkipped(run.ID, "failed to read API code")
+	}
+
+	job := &models.Job{
+		APIID:         api.ID,
+		Runtime:       api.Runtime,
+		Code:          models.EncodeCode(api.Runtime, code),
+		Input:         schedule.Input,
+		TimeoutSec:    schedule.TimeoutSec,
+		ResourceClass: api.ResourceClass,
+	}
+	if err := s.jobs.Create(job); err != nil {
+		return err
+	}
+
+	return s.schedules.MarkRunEnqueued(run.ID, job.ID)
+}
@@ -1,30 +1,49 @@
 package main
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
+	"fmt"
 	"net/http"
 	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
 
+	"github.com/aKaddoura96/api-hosting-execution-platform/backend/executor/node"
 	"github.com/aKaddoura96/api-hosting-execution-platform/backend/executor/runtime"
+	"github.com/aKaddoura96/api-hosting-execution-platform/backend/executor/worker"
 	"github.com/aKaddoura96/api-hosting-execution-platform/backend/shared/database"
 	"github.com/aKaddoura96/api-hosting-execution-platform/backend/shared/logger"
+	"github.com/aKaddoura96/api-hosting-execution-platform/backend/shared/nodeauth"
 	"github.com/aKaddoura96/api-hosting-execution-platform/backend/shared/repository"
+	"github.com/aKaddoura96/api-hosting-execution-platform/backend/shared/secrets"
+	"github.com/aKaddoura96/api-hosting-execution-platform/backend/shared/server"
+	"github.com/aKaddoura96/api-hosting-execution-platform/backend/shared/tracing"
 	"github.com/gorilla/mux"
 	"github.com/joho/godotenv"
 	"github.com/rs/cors"
 )
 
 func main() {
+	// Load environment variables (before the logger so LOG_LEVEL/LOG_FORMAT apply)
+	godotenv.Load()
+
 	// Initialize logger
 	log := logger.NewLogger("executor")
 	logger.SetDefaultLogger(log)
 
-	godotenv.Load()
 	log.Info("Starting Executor Service", map[string]interface{}{
 		"version": "2.0.0",
 		"mode":    "production",
 	})
 
+	// Initialize tracing (exporter chosen by OTEL_TRACES_EXPORTER)
+	shutdownTracing := tracing.Init("executor")
+	defer shutdownTracing()
+
 	// Connect to database
 	log.Info("Connecting to database...")
 	if err := database.Connect(); err != nil {
@@ -33,26 +52,119 @@ func main() {
 	defer database.Close()
 	log.Info("Database connected successfully")
 
-	// Initialize executor
-	executor, err := runtime.NewExecutor()
+	// Initialize executor on the backend chosen by EXECUTOR_BACKEND
+	backend, err := runtime.BackendFromEnv()
+	if err != nil {
+		log.Fatal("Failed to initialize execution backend", map[string]interface{}{"error": err.Error()})
+	}
+	executor, err := runtime.NewExecutor(backend)
 	if err != nil {
 		log.Fatal("Failed to initialize executor", map[string]interface{}{"error": err.Error()})
 	}
 	defer executor.Close()
-	log.Info("Executor initialized successfully")
+	log.Info("Executor initialized successfully", map[string]interface{}{"backend": backend.Name()})
+	if backend.Name() == "local" {
+		log.Warn("Local backend runs code on this host without isolation, use it for development only")
+	}
 
 	// Initialize repositories
 	apiRepo := repository.NewAPIRepository(database.DB)
+	jobRepo := repository.NewJobRepository(database.DB)
+	execRepo := repository.NewExecutionRepository(database.DB)
+	executor.SetRuntimeStore(repository.NewRuntimeRepository(database.DB))
+	executor.SetLogStore(repository.NewExecutionLogRepository(database.DB))
+
+	// Inject per-API environment variables; secrets need SECRETS_ENCRYPTION_KEY
+	keyring, err := secrets.FromEnv()
+	if errors.Is(err, secrets.ErrNotConfigured) {
+		log.Warn("SECRETS_ENCRYPTION_KEY not set, APIs with secrets will fail to execute")
+	} else if err != nil {
+		log.Fatal("Failed to load secrets key", map[string]interface{}{"error": err.Error()})
+	}
+	executor.SetEnvStore(secrets.NewEnvResolver(repository.NewEnvVarRepository(database.DB), keyring))
+
+	// Outbound network access for APIs that opt in; without the proxy their
+	// executions fail rather than run unrestricted
+	if err := executor.EnableEgress(context.Background(), runtime.NewEgressProxy(), repository.NewEgressRepository(database.DB)); err != nil {
+		log.Warn("Egress proxy unavailable, APIs with egress enabled will fail to execute", map[string]interface{}{"error": err.Error()})
+	}
+
+	// Images built from developers' Dockerfiles for the custom runtime
+	if imageConfig, err := runtime.CustomImageConfigFromEnv(); err != nil {
+		log.Fatal("Invalid custom image configuration", map[string]interface{}{"error": err.Error()})
+	} else if err := executor.EnableCustomImages(imageConfig, repository.NewCustomImageRepository(database.DB)); err != nil {
+		log.Warn("Custom images unavailable, APIs with the custom runtime will fail to execute", map[string]interface{}{"error": err.Error()})
+	}
+
+	port := os.Getenv("PORT")
+	if port == "" {
+		port = "8081"
+	}
+	executorToken, err := nodeauth.TokenFromEnv()
+	if err != nil {
+		log.Fatal("Invalid executor API configuration", map[string]interface{}{"error": err.Error()})
+	}
+
+	// The node's identity in the registry, which its runs are labelled with
+	nodeRepo := repository.NewExecutorNodeRepository(database.DB)
+	registrar := node.NewRegistrar(executor, nodeRepo, port)
+
+	// Remove what a crash of this or another node left behind, before this
+	// node runs anything of its own
+	if reaperConfig, err := runtime.ReaperConfigFromEnv(); err != nil {
+		log.Fatal("Invalid reaper configuration", map[string]interface{}{"error": err.Error()})
+	} else if err := executor.EnableReaper(registrar.NodeID(), reaperConfig, nodeRepo); err != nil {
+		log.Warn("Reaper unavailable, orphaned containers are not removed", map[string]interface{}{"error": err.Error()})
+	}
+
+	// Keep the images this node pulls and builds within its disk budget
+	if err := executor.EnableImageCache(registrar.NodeID(), repository.NewCachedImageRepository(database.DB)); err != nil {
+		log.Warn("Image cache unavailable, images are never removed", map[string]interface{}{"error": err.Error()})
+	}
+
+	// Persistent replicas of the APIs whose scaling policy asks for them
+	if replicaConfig, err := runtime.ReplicaConfigFromEnv(); err != nil {
+		log.Fatal("Invalid replica configuration", map[string]interface{}{"error": err.Error()})
+	} else if err := executor.EnableReplicas(context.Background(), registrar.NodeID(), replicaConfig, repository.NewScalingRepository(database.DB), repository.NewReplicaRepository(database.DB)); err != nil {
+		log.Warn("Replicas unavailable, APIs with max_replicas set will fail to execute", map[string]interface{}{"error": err.Error()})
+	}
+
+	// Background work runs until shutdown starts
+	background, stopBackground := context.WithCancel(context.Background())
+	var backgroundDone sync.WaitGroup
+	runInBackground := func(run func(ctx context.Context)) {
+		backgroundDone.Add(1)
+		go func() {
+			defer backgroundDone.Done()
+			run(background)
+		}()
+	}
+
+	// Remove runs and code directories no execution will clean up
+	runInBackground(executor.RunReaper)
+
+	// Pull runtime images now rather than on their first execution, and keep
+	// the images within the node's disk budget
+	runInBackground(executor.PrepullImages)
+	runInBackground(executor.RunImageCache)
+
+	// Run queued asynchronous executions in the background
+	runInBackground(worker.NewWorker(executor, jobRepo, execRepo, repository.NewWebhookRepository(database.DB)).Run)
+
+	// Heartbeat to the registry, where gateways find the node
+	runInBackground(registrar.Run)
 
 	// Setup router
 	router := mux.NewRouter()
 
 	// Health check
 	router.HandleFunc("/health", func(w http.ResponseWriter, r *http.Request) {
-		json.NewEncoder(w).Encode(map[string]string{
+		json.NewEncoder(w).Encode(map[string]interface{}{
 			"status":  "healthy",
 			"service": "executor",
 			"version": "2.0.0",
+			"backend": backend.Name(),
+			"load":    executor.Load(),
 		})
 	}).Methods("GET")
 
@@ -61,51 +173,120 @@ func main() {
 		handleExecute(w, r, executor)
 	}).Methods("POST")
 
+	// Live output from running executions (Server-Sent Events)
+	router.HandleFunc("/logs/{api_id}/stream", func(w http.ResponseWriter, r *http.Request) {
+		handleLogStream(w, r, executor)
+	}).Methods("GET")
+
 	// Deploy API endpoint (for uploaded code)
 	router.HandleFunc("/deploy", func(w http.ResponseWriter, r *http.Request) {
 		handleDeploy(w, r, apiRepo)
 	}).Methods("POST")
 
+	// Build an API's custom image in the background
+	router.HandleFunc("/images/{api_id}/build", func(w http.ResponseWriter, r *http.Request) {
+		handleBuildImage(w, r, executor)
+	}).Methods("POST")
+
+	// Pull a runtime's image in the background, for an API being deployed
+	router.HandleFunc("/images/prepull", func(w http.ResponseWriter, r *http.Request) {
+		handlePrepull(w, r, executor)
+	}).Methods("POST")
+
 	// Stop API endpoint
 	router.HandleFunc("/stop/{api_id}", func(w http.ResponseWriter, r *http.Request) {
-		handleStop(w, r, apiRepo)
+		handleStop(w, r, apiRepo, executor)
 	}).Methods("POST")
 
+	// Persistent replicas: start them, forward requests to them, stop them
+	router.HandleFunc("/replicas/{api_id}/wake", func(w http.ResponseWriter, r *http.Request) {
+		handleWakeReplicas(w, r, executor)
+	}).Methods("POST")
+	router.HandleFunc("/replicas/{api_id}/stop", func(w http.ResponseWriter, r *http.Request) {
+		executor.StopReplicas(mux.Vars(r)["api_id"])
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(DeployResponse{
+			Status:  "success",
+			Message: "Replicas stopping",
+		})
+	}).Methods("POST")
+	router.PathPrefix("/replicas/{api_id}/{replica_id}/proxy").HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		handleReplicaRequest(w, r, executor)
+	})
+
 	// Get API status
 	router.HandleFunc("/status/{api_id}", func(w http.ResponseWriter, r *http.Request) {
 		handleStatus(w, r, apiRepo)
 	}).Methods("GET")
 
-	port := os.Getenv("PORT")
-	if port == "" {
-		port = "8081"
-	}
-
 	log.Info("Executor service ready", map[string]interface{}{
 		"port":    port,
 		"address": "http://localhost:" + port,
 	})
 
+	router.Use(tracing.HTTPMiddleware)
 	router.Use(logger.HTTPLoggingMiddleware(log))
 
+	// Only gateways may use the API: replicas run developers' code, so their
+	// networks are refused, and every request must carry EXECUTOR_TOKEN
+	router.Use(func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if executor.FromReplicaNetwork(r) {
+				http.Error(w, "Forbidden", http.StatusForbidden)
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	})
+	router.Use(nodeauth.Require(executorToken))
+
 	// CORS configuration
 	c := cors.New(cors.Options{
 		AllowedOrigins:   []string{"http://localhost:3000", "http://localhost:3001"},
 		AllowedMethods:   []string{"GET", "POST", "PUT", "DELETE", "OPTIONS"},
-		AllowedHeaders:   []string{"Content-Type", "Authorization"},
+		AllowedHeaders:   []string{"Content-Type", "Authorization", "traceparent"},
 		AllowCredentials: true,
 	})
 
-	if err := http.ListenAndServe(":"+port, c.Handler(router)); err != nil {
+	srv, err := server.New(":"+port, c.Handler(router))
+	if err != nil {
+		log.Fatal("Invalid server configuration", map[string]interface{}{"error": err.Error()})
+	}
+
+	// On shutdown the node deregisters so gateways send work elsewhere, stops
+	// claiming jobs and waits for its executions and replicas
+	err = srv.Run(func(ctx context.Context) {
+		stopBackground()
+		if err := executor.Drain(ctx); err != nil {
+			log.Warn("Drain timed out, runs still going were removed", map[string]interface{}{"error": err.Error()})
+		}
+
+		done := make(chan struct{})
+		go func() {
+			backgroundDone.Wait()
+			close(done)
+		}()
+		select {
+		case <-done:
+		case <-ctx.Done():
+		}
+	})
+	if err != nil {
 		log.Fatal("Server failed", map[string]interface{}{"error": err.Error()})
 	}
 }
 
 type ExecuteRequest struct {
-	Code       string                 `json:"code"`
-	Runtime    string                 `json:"runtime"`
-	Input      map[string]interface{} `json:"input,omitempty"`
-	TimeoutSec int                    `json:"timeout_sec,omitempty"`
+	ExecutionID   string                 `json:"execution_id,omitempty"`
+	APIID         string                 `json:"api_id,omitempty"`
+	Version       string                 `json:"version,omitempty"`
+	ResourceClass string                 `json:"resource_class,omitempty"`
+	Code          string                 `json:"code"`
+	Runtime       string                 `json:"runtime"`
+	Input         map[string]interface{} `json:"input,omitempty"`
+	TimeoutSec    int                    `json:"timeout_sec,omitempty"`
+	TenantID      string                 `json:"tenant_id,omitempty"`
+	Stream        bool                   `json:"stream,omitempty"`
 }
 
 func handleExecute(w http.ResponseWriter, r *http.Request, executor *runtime.Executor) {
@@ -128,15 +309,28 @@ func handleExecute(w http.ResponseWriter, r *http.Request, executor *runtime.Exe
 
 	// Execute code
 	execReq := &runtime.ExecutionRequest{
-		Code:       req.Code,
-		Runtime:    req.Runtime,
-		Input:      req.Input,
-		TimeoutSec: req.TimeoutSec,
+		ExecutionID:   req.ExecutionID,
+		APIID:         req.APIID,
+		Version:       req.Version,
+		ResourceClass: req.ResourceClass,
+		Code:          req.Code,
+		Runtime:       req.Runtime,
+		Input:         req.Input,
+		TimeoutSec:    req.TimeoutSec,
+		TenantID:      req.TenantID,
 	}
 
-	result, err := executor.Execute(execReq)
+	if req.Stream {
+		handleExecuteStream(w, r, executor, execReq)
+		return
+	}
+
+	result, err := executor.Execute(r.Context(), execReq)
+	if rejectAdmission(w, err) {
+		return
+	}
 	if err != nil {
-		logger.Error("Execution failed", map[string]interface{}{
+		logger.FromContext(r.Context()).Error("Execution failed", map[string]interface{}{
 			"error":   err.Error(),
 			"runtime": req.Runtime,
 		})
@@ -148,6 +342,132 @@ func handleExecute(w http.ResponseWriter, r *http.Request, executor *runtime.Exe
 	json.NewEncoder(w).Encode(result)
 }
 
+// OutputEvent is one chunk of output in a streaming execution
+type OutputEvent struct {
+	Stream string `json:"stream"`
+	Data   string `json:"data"`
+}
+
+// rejectAdmission responds 503 with a Retry-After if err is an execution
+// that was not admitted
+func rejectAdmission(w http.ResponseWriter, err error) bool {
+	var admissionErr *runtime.AdmissionError
+	if !errors.As(err, &admissionErr) {
+		return false
+	}
+
+	seconds := int(admissionErr.RetryAfter.Seconds())
+	if seconds < 1 {
+		seconds = 1
+	}
+	w.Header().Set("Retry-After", strconv.Itoa(seconds))
+	http.Error(w, err.Error(), http.StatusServiceUnavailable)
+	return true
+}
+
+// handleExecuteStream runs code and relays its output as Server-Sent Events:
+// "output" events while the container runs, then a single "result" event
+// carrying the ExecutionResult (or an "error" event if execution failed).
+// The stream opens with the first event, so an execution that is not
+// admitted is still answered with a plain 503.
+func handleExecuteStream(w http.ResponseWriter, r *http.Request, executor *runtime.Executor, execReq *runtime.ExecutionRequest) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "Streaming not supported", http.StatusInternalServerError)
+		return
+	}
+
+	// Output arrives on the container log goroutine; serialize writes and
+	// drop anything still trailing in after the final event
+	var mu sync.Mutex
+	started, closed := false, false
+	send := func(event string, v interface{}) {
+		data, _ := json.Marshal(v)
+		mu.Lock()
+		defer mu.Unlock()
+		if closed {
+			return
+		}
+		if !started {
+			w.Header().Set("Content-Type", "text/event-stream")
+			w.Header().Set("Cache-Control", "no-cache")
+			w.Header().Set("X-Accel-Buffering", "no")
+			w.WriteHeader(http.StatusOK)
+			started = true
+		}
+		fmt.Fprintf(w, "event: %s\ndata: %s\n\n", event, data)
+		flusher.Flush()
+	}
+	finish := func(event string, v interface{}) {
+		send(event, v)
+		mu.Lock()
+		closed = true
+		mu.Unlock()
+	}
+
+	result, err := executor.ExecuteStream(r.Context(), execReq, func(stream string, chunk []byte) {
+		send("output", OutputEvent{Stream: stream, Data: string(chunk)})
+	})
+	// Admission comes before any output
+	if rejectAdmission(w, err) {
+		return
+	}
+	if err != nil {
+		logger.FromContext(r.Context()).Error("Execution failed", map[string]interface{}{
+			"error":   err.Error(),
+			"runtime": execReq.Runtime,
+		})
+		finish("error", map[string]string{"error": "Execution failed: " + err.Error()})
+		return
+	}
+
+	finish("result", result)
+}
+
+// handleLogStream tails live output for an API as Server-Sent Events.
+// ?execution_id= limits the stream to a single execution.
+func handleLogStream(w http.ResponseWriter, r *http.Request, executor *runtime.Executor) {
+	apiID := mux.Vars(r)["api_id"]
+	executionID := r.URL.Query().Get("execution_id")
+
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "Streaming not supported", http.StatusInternalServerError)
+		return
+	}
+
+	lines, unsubscribe := executor.Logs().Subscribe(apiID)
+	defer unsubscribe()
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	heartbeat := time.NewTicker(15 * time.Second)
+	defer heartbeat.Stop()
+
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case <-server.Stopping(r.Context()):
+			return
+		case <-heartbeat.C:
+			fmt.Fprint(w, ": keep-alive\n\n")
+			flusher.Flush()
+		case line := <-lines:
+			if executionID != "" && line.ExecutionID != executionID {
+				continue
+			}
+			data, _ := json.Marshal(line)
+			fmt.Fprintf(w, "event: log\ndata: %s\n\n", data)
+			flusher.Flush()
+		}
+	}
+}
+
 type DeployRequest struct {
 	APIID string `json:"api_id"`
 }
@@ -193,9 +513,10 @@ func handleDeploy(w http.ResponseWriter, r *http.Request, apiRepo *repository.AP
 	})
 }
 
-func handleStop(w http.ResponseWriter, r *http.Request, apiRepo *repository.APIRepository) {
+func handleStop(w http.ResponseWriter, r *http.Request, apiRepo *repository.APIRepository, executor *runtime.Executor) {
 	vars := mux.Vars(r)
 	apiID := vars["api_id"]
+	executor.StopReplicas(apiID)
 
 	// Update status to stopped
 	if err := apiRepo.UpdateStatus(apiID, "stopped", ""); err != nil {
@@ -210,6 +531,108 @@ func handleStop(w http.ResponseWriter, r *http.Request, apiRepo *repository.APIR
 	})
 }
 
+func handleBuildImage(w http.ResponseWriter, r *http.Request, executor *runtime.Executor) {
+	apiID := mux.Vars(r)["api_id"]
+
+	err := executor.StartCustomImageBuild(apiID)
+	switch {
+	case errors.Is(err, runtime.ErrInvalidDockerfile):
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	case errors.Is(err, runtime.ErrBuildInProgress):
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	case err != nil:
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusAccepted)
+	json.NewEncoder(w).Encode(DeployResponse{
+		Status:  "building",
+		Message: "Image build started",
+	})
+}
+
+type PrepullRequest struct {
+	Runtime string `json:"runtime"`
+}
+
+func handlePrepull(w http.ResponseWriter, r *http.Request, executor *runtime.Executor) {
+	var req PrepullRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Runtime == "" {
+		http.Error(w, "Runtime is required", http.StatusBadRequest)
+		return
+	}
+
+	if err := executor.PrepullRuntime(req.Runtime); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusAccepted)
+	json.NewEncoder(w).Encode(DeployResponse{
+		Status:  "pulling",
+		Message: "Image pull started",
+	})
+}
+
+// handleWakeReplicas starts the API's replicas if none is ready and lists
+// the ready ones
+func handleWakeReplicas(w http.ResponseWriter, r *http.Request, executor *runtime.Executor) {
+	var req runtime.WakeRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	req.APIID = mux.Vars(r)["api_id"]
+	if req.Code == "" || req.Runtime == "" {
+		http.Error(w, "Code and runtime are required", http.StatusBadRequest)
+		return
+	}
+
+	replicas, err := executor.WakeReplicas(r.Context(), &req)
+	switch {
+	case errors.Is(err, runtime.ErrReplicasUnavailable):
+		http.Error(w, err.Error(), http.StatusNotImplemented)
+		return
+	case errors.Is(err, runtime.ErrNotPersistent):
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	case errors.Is(err, runtime.ErrDraining):
+		http.Error(w, err.Error(), http.StatusServiceUnavailable)
+		return
+	case err != nil:
+		logger.FromContext(r.Context()).Error("Failed to wake replicas", map[string]interface{}{
+			"api_id": req.APIID,
+			"error":  err.Error(),
+		})
+		http.Error(w, "Failed to start replica: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{"replicas": replicas})
+}
+
+// handleReplicaRequest forwards a request to a replica, with the path after
+// /proxy as its path
+func handleReplicaRequest(w http.ResponseWriter, r *http.Request, executor *runtime.Executor) {
+	vars := mux.Vars(r)
+	prefix := fmt.Sprintf("/replicas/%s/%s/proxy", vars["api_id"], vars["replica_id"])
+	path := strings.TrimPrefix(r.URL.Path, prefix)
+	if path == "" {
+		path = "/"
+	} else if !strings.HasPrefix(path, "/") {
+		http.NotFound(w, r)
+		return
+	}
+
+	executor.ServeReplica(w, r, vars["api_id"], vars["replica_id"], path)
+}
+
 type StatusResponse struct {
 	APIID  string `json:"api_id"`
 	Status string `json:"status"`
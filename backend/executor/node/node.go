@@ -0,0 +1,102 @@
+package node
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/aKaddoura96/api-hosting-execution-platform/backend/executor/runtime"
+	"github.com/aKaddoura96/api-hosting-execution-platform/backend/shared/logger"
+	"github.com/aKaddoura96/api-hosting-execution-platform/backend/shared/models"
+	"github.com/aKaddoura96/api-hosting-execution-platform/backend/shared/repository"
+)
+
+// Registrar keeps this executor registered in the executor_nodes table, so
+// gateways can send it executions
+type Registrar struct {
+	executor *runtime.Executor
+	nodes    *repository.ExecutorNodeRepository
+	node     models.ExecutorNode
+	interval time.Duration
+}
+
+// NewRegistrar registers the executor listening on port. EXECUTOR_NODE_ID
+// names the node (default host:port), EXECUTOR_ADVERTISE_URL is where
+// gateways reach it (default http://host:port) and EXECUTOR_HEARTBEAT_INTERVAL
+// how often its entry is refreshed (default 5s).
+func NewRegistrar(executor *runtime.Executor, nodes *repository.ExecutorNodeRepository, port string) *Registrar {
+	hostname, _ := os.Hostname()
+
+	r := &Registrar{
+		executor: executor,
+		nodes:    nodes,
+		node: models.ExecutorNode{
+			ID:      os.Getenv("EXECUTOR_NODE_ID"),
+			URL:     os.Getenv("EXECUTOR_ADVERTISE_URL"),
+			Backend: executor.Backend().Name(),
+		},
+		interval: 5 * time.Second,
+	}
+
+	if r.node.ID == "" {
+		r.node.ID = fmt.Sprintf("%s:%s", hostname, port)
+	}
+	if r.node.URL == "" {
+		r.node.URL = fmt.Sprintf("http://%s:%s", hostname, port)
+	}
+	if d, err := time.ParseDuration(os.Getenv("EXECUTOR_HEARTBEAT_INTERVAL")); err == nil && d > 0 {
+		r.interval = d
+	}
+
+	return r
+}
+
+// NodeID is the ID the node is registered under
+func (r *Registrar) NodeID() string {
+	return r.node.ID
+}
+
+// Run sends heartbeats until ctx is cancelled, then deregisters the node
+func (r *Registrar) Run(ctx context.Context) {
+	logger.Info("Registering executor node", map[string]interface{}{
+		"node_id": r.node.ID,
+		"url":     r.node.URL,
+	})
+
+	ticker := time.NewTicker(r.interval)
+	defer ticker.Stop()
+
+	for {
+		r.heartbeat()
+
+		select {
+		case <-ctx.Done():
+			if err := r.nodes.Delete(r.node.ID); err != nil {
+				logger.Error("Failed to deregister executor node", map[string]interface{}{"error": err.Error()})
+			}
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// heartbeat refreshes the node's runtimes and load
+func (r *Registrar) heartbeat() {
+	runtimes, err := r.executor.Runtimes()
+	if err != nil {
+		// Keep advertising the last known runtimes
+		logger.Warn("Failed to list runtimes for heartbeat", map[string]interface{}{"error": err.Error()})
+	} else {
+		r.node.Runtimes = runtimes
+	}
+
+	load := r.executor.Load()
+	r.node.Capacity = load.MaxConcurrent
+	r.node.Running = load.Running
+	r.node.Queued = load.Queued
+
+	if err := r.nodes.Heartbeat(&r.node); err != nil {
+		logger.Error("Executor heartbeat failed", map[string]interface{}{"error": err.Error()})
+	}
+}
@@ -0,0 +1,320 @@
+package runtime
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// AdmissionConfig bounds how many executions run at once and how many may
+// wait for a slot
+type AdmissionConfig struct {
+	MaxConcurrent int // across all APIs
+	MaxPerAPI     int
+	MaxQueue      int // executions waiting, across all tenants
+	// MaxQueuePerTenant keeps one tenant from filling the whole queue
+	MaxQueuePerTenant int
+	QueueTimeout      time.Duration
+}
+
+// AdmissionConfigFromEnv reads EXECUTOR_MAX_CONCURRENT (default 16),
+// EXECUTOR_MAX_CONCURRENT_PER_API (4), EXECUTOR_QUEUE_SIZE (100),
+// EXECUTOR_QUEUE_PER_TENANT (25) and EXECUTOR_QUEUE_TIMEOUT (30s)
+func AdmissionConfigFromEnv() (AdmissionConfig, error) {
+	config := AdmissionConfig{
+		MaxConcurrent:     16,
+		MaxPerAPI:         4,
+		MaxQueue:          100,
+		MaxQueuePerTenant: 25,
+		QueueTimeout:      30 * time.Second,
+	}
+
+	for name, limit := range map[string]*int{
+		"EXECUTOR_MAX_CONCURRENT":         &config.MaxConcurrent,
+		"EXECUTOR_MAX_CONCURRENT_PER_API": &config.MaxPerAPI,
+		"EXECUTOR_QUEUE_SIZE":             &config.MaxQueue,
+		"EXECUTOR_QUEUE_PER_TENANT":       &config.MaxQueuePerTenant,
+	} {
+		v := os.Getenv(name)
+		if v == "" {
+			continue
+		}
+		n, err := strconv.Atoi(v)
+		if err != nil || n <= 0 {
+			return config, fmt.Errorf("invalid %s: %q", name, v)
+		}
+		*limit = n
+	}
+	if v := os.Getenv("EXECUTOR_QUEUE_TIMEOUT"); v != "" {
+		timeout, err := time.ParseDuration(v)
+		if err != nil || timeout <= 0 {
+			return config, fmt.Errorf("invalid EXECUTOR_QUEUE_TIMEOUT: %q", v)
+		}
+		config.QueueTimeout = timeout
+	}
+
+	return config, nil
+}
+
+// AdmissionError is returned for an execution that was not admitted, either
+// because the queue was full or because it waited too long
+type AdmissionError struct {
+	Reason string
+	// RetryAfter estimates when a slot will be free
+	RetryAfter time.Duration
+}
+
+func (e *AdmissionError) Error() string {
+	return e.Reason
+}
+
+// Load is a snapshot of the executor's admission state
+type Load struct {
+	Running       int `json:"running"`
+	Queued        int `json:"queued"`
+	MaxConcurrent int `json:"max_concurrent"`
+}
+
+// admission hands out execution slots. Waiting executions are queued per
+// tenant and slots go to tenants in turn, so a tenant with many queued
+// executions gets no more slots than one with a few. Within a tenant the
+// queue is FIFO, skipping executions whose API is at its own limit.
+type admission struct {
+	config AdmissionConfig
+
+	mu      sync.Mutex
+	running int
+	perAPI  map[string]int
+	queues  map[string][]*admissionWaiter // by tenant
+	tenants []string                      // tenants with waiters, in turn order
+	next    int                           // index into tenants of the next turn
+	queued  int
+	avgRun  time.Duration // moving average run time, for RetryAfter
+
+	// Once draining, nothing more is admitted and waiters give up
+	draining bool
+	drained  chan struct{} // closed when draining starts
+	idle     chan struct{} // closed once draining and nothing runs
+}
+
+type admissionWaiter struct {
+	apiID    string
+	admitted chan struct{} // closed when given a slot
+}
+
+func newAdmission(config AdmissionConfig) *admission {
+	return &admission{
+		config:  config,
+		perAPI:  make(map[string]int),
+		queues:  make(map[string][]*admissionWaiter),
+		avgRun:  time.Second,
+		drained: make(chan struct{}),
+		idle:    make(chan struct{}),
+	}
+}
+
+// acquire waits for a slot for an execution of apiID on behalf of tenant. It
+// returns how long the execution waited and a function that gives the slot
+// back, which must be called once the execution is done.
+func (a *admission) acquire(ctx context.Context, tenant, apiID string) (func(), time.Duration, error) {
+	start := time.Now()
+
+	a.mu.Lock()
+	if a.draining {
+		a.mu.Unlock()
+		return nil, 0, &AdmissionError{Reason: ErrDraining.Error(), RetryAfter: time.Second}
+	}
+	// Free slots are always handed to waiters first, so one that is free now
+	// is one no waiter can use
+	if a.hasSlot(apiID) {
+		a.take(apiID)
+		a.mu.Unlock()
+		return a.releaser(apiID), 0, nil
+	}
+	if a.queued >= a.config.MaxQueue || len(a.queues[tenant]) >= a.config.MaxQueuePerTenant {
+		err := &AdmissionError{Reason: "execution queue is full", RetryAfter: a.retryAfter()}
+		a.mu.Unlock()
+		return nil, 0, err
+	}
+
+	waiter := &admissionWaiter{apiID: apiID, admitted: make(chan struct{})}
+	if len(a.queues[tenant]) == 0 {
+		a.tenants = append(a.tenants, tenant)
+	}
+	a.queues[tenant] = append(a.queues[tenant], waiter)
+	a.queued++
+	a.mu.Unlock()
+
+	timer := time.NewTimer(a.config.QueueTimeout)
+	defer timer.Stop()
+
+	var reason string
+	select {
+	case <-waiter.admitted:
+		return a.releaser(apiID), time.Since(start), nil
+	case <-timer.C:
+		reason = fmt.Sprintf("execution waited over %s for a slot", a.config.QueueTimeout)
+	case <-a.drained:
+		reason = ErrDraining.Error()
+	case <-ctx.Done():
+		reason = ctx.Err().Error()
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	select {
+	case <-waiter.admitted:
+		// Admitted while giving up; the slot is no longer wanted
+		a.put(apiID, 0)
+	default:
+		a.remove(tenant, waiter)
+	}
+	return nil, time.Since(start), &AdmissionError{Reason: reason, RetryAfter: a.retryAfter()}
+}
+
+// drain stops admitting executions and turns away those waiting. The
+// returned channel is closed once the running ones have given back their
+// slots.
+func (a *admission) drain() <-chan struct{} {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if !a.draining {
+		a.draining = true
+		close(a.drained)
+		if a.running == 0 {
+			close(a.idle)
+		}
+	}
+	return a.idle
+}
+
+// Load reports how many executions are running and waiting
+func (a *admission) Load() Load {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return Load{Running: a.running, Queued: a.queued, MaxConcurrent: a.config.MaxConcurrent}
+}
+
+func (a *admission) hasSlot(apiID string) bool {
+	return a.running < a.config.MaxConcurrent && a.perAPI[apiID] < a.config.MaxPerAPI
+}
+
+func (a *admission) take(apiID string) {
+	a.running++
+	a.perAPI[apiID]++
+}
+
+// releaser returns the function that gives back a slot taken now
+func (a *admission) releaser(apiID string) func() {
+	start := time.Now()
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			a.mu.Lock()
+			defer a.mu.Unlock()
+			a.put(apiID, time.Since(start))
+		})
+	}
+}
+
+// put gives back a slot held for ran and hands out whatever is now free
+func (a *admission) put(apiID string, ran time.Duration) {
+	a.running--
+	if a.perAPI[apiID]--; a.perAPI[apiID] <= 0 {
+		delete(a.perAPI, apiID)
+	}
+	if ran > 0 {
+		a.avgRun = (a.avgRun*7 + ran) / 8
+	}
+	if a.draining {
+		if a.running == 0 {
+			close(a.idle)
+		}
+		return
+	}
+	a.dispatch()
+}
+
+// dispatch admits waiters while there are slots, one tenant per turn
+func (a *admission) dispatch() {
+	for a.running < a.config.MaxConcurrent && len(a.tenants) > 0 {
+		admitted := false
+		for i := 0; i < len(a.tenants); i++ {
+			turn := (a.next + i) % len(a.tenants)
+			tenant := a.tenants[turn]
+			if waiter := a.firstEligible(tenant); waiter != nil {
+				a.remove(tenant, waiter)
+				a.take(waiter.apiID)
+				close(waiter.admitted)
+				// remove may have dropped the tenant, shifting the next one
+				// into its place
+				if turn < len(a.tenants) && a.tenants[turn] == tenant {
+					turn++
+				}
+				a.next = turn
+				admitted = true
+				break
+			}
+		}
+		if !admitted {
+			return // every waiter's API is at its limit
+		}
+	}
+}
+
+func (a *admission) firstEligible(tenant string) *admissionWaiter {
+	for _, waiter := range a.queues[tenant] {
+		if a.perAPI[waiter.apiID] < a.config.MaxPerAPI {
+			return waiter
+		}
+	}
+	return nil
+}
+
+// remove takes a waiter out of its tenant's queue, dropping the tenant from
+// the turn order once it has none left
+func (a *admission) remove(tenant string, waiter *admissionWaiter) {
+	queue := a.queues[tenant]
+	for i, w := range queue {
+		if w == waiter {
+			queue = append(queue[:i:i], queue[i+1:]...)
+			a.queued--
+			break
+		}
+	}
+	if len(queue) > 0 {
+		a.queues[tenant] = queue
+		return
+	}
+
+	delete(a.queues, tenant)
+	for i, t := range a.tenants {
+		if t == tenant {
+			a.tenants = append(a.tenants[:i:i], a.tenants[i+1:]...)
+			if a.next > i {
+				a.next--
+			}
+			break
+		}
+	}
+	if len(a.tenants) > 0 {
+		a.next %= len(a.tenants)
+	} else {
+		a.next = 0
+	}
+}
+
+// retryAfter estimates how long until the queue has drained enough to take
+// another execution
+func (a *admission) retryAfter() time.Duration {
+	waves := float64(a.queued)/float64(a.config.MaxConcurrent) + 1
+	estimate := time.Duration(math.Ceil(waves*a.avgRun.Seconds())) * time.Second
+	if estimate > time.Minute {
+		return time.Minute
+	}
+	return estimate
+}
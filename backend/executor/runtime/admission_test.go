@@ -0,0 +1,179 @@
+package runtime
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestAdmissionFairness(t *testing.T) {
+	type waiter struct{ name, tenant, apiID string }
+
+	tests := []struct {
+		name   string
+		config AdmissionConfig
+		// held are the APIs holding every slot to begin with; the last is
+		// given back to start admitting the queue
+		held  []string
+		queue []waiter
+		want  []string // names in the order they are admitted
+	}{
+		{
+			name:   "tenants take turns",
+			config: AdmissionConfig{MaxConcurrent: 1, MaxPerAPI: 10},
+			held:   []string{"held"},
+			queue: []waiter{
+				{"a1", "a", "api-a"},
+				{"a2", "a", "api-a"},
+				{"a3", "a", "api-a"},
+				{"b1", "b", "api-b"},
+			},
+			want: []string{"a1", "b1", "a2", "a3"},
+		},
+		{
+			name:   "three tenants",
+			config: AdmissionConfig{MaxConcurrent: 1, MaxPerAPI: 10},
+			held:   []string{"held"},
+			queue: []waiter{
+				{"a1", "a", "api-a"},
+				{"a2", "a", "api-a"},
+				{"b1", "b", "api-b"},
+				{"b2", "b", "api-b"},
+				{"c1", "c", "api-c"},
+			},
+			want: []string{"a1", "b1", "c1", "a2", "b2"},
+		},
+		{
+			name:   "first in first out within a tenant",
+			config: AdmissionConfig{MaxConcurrent: 1, MaxPerAPI: 10},
+			held:   []string{"held"},
+			queue: []waiter{
+				{"a1", "a", "api-x"},
+				{"a2", "a", "api-y"},
+				{"a3", "a", "api-x"},
+			},
+			want: []string{"a1", "a2", "a3"},
+		},
+		{
+			name:   "an API at its limit is skipped",
+			config: AdmissionConfig{MaxConcurrent: 2, MaxPerAPI: 1},
+			held:   []string{"busy", "held"},
+			queue: []waiter{
+				{"a-busy", "a", "busy"},
+				{"a-other", "a", "other"},
+				{"b1", "b", "api-b"},
+			},
+			want: []string{"a-other", "b1"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.config.MaxQueue = 100
+			tt.config.MaxQueuePerTenant = 100
+			tt.config.QueueTimeout = 10 * time.Second
+			a := newAdmission(tt.config)
+			defer a.drain()
+
+			var release func()
+			for _, apiID := range tt.held {
+				r, _, err := a.acquire(context.Background(), "holder", apiID)
+				if err != nil {
+					t.Fatalf("acquire(%s) error = %v", apiID, err)
+				}
+				release = r
+			}
+
+			type admitted struct {
+				name    string
+				release func()
+			}
+			admissions := make(chan admitted, len(tt.queue))
+			for i, w := range tt.queue {
+				go func() {
+					r, _, err := a.acquire(context.Background(), w.tenant, w.apiID)
+					if err == nil {
+						admissions <- admitted{w.name, r}
+					}
+				}()
+				waitFor(t, func() bool { return a.Load().Queued == i+1 })
+			}
+
+			// One admission at a time, each giving its slot to the next
+			release()
+			var got []string
+			for range tt.want {
+				select {
+				case next := <-admissions:
+					got = append(got, next.name)
+					next.release()
+				case <-time.After(5 * time.Second):
+					t.Fatalf("admitted %v, want %v", got, tt.want)
+				}
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("admitted %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestAdmissionQueueLimits(t *testing.T) {
+	tests := []struct {
+		name   string
+		config AdmissionConfig
+		queue  []string // tenants of the executions queued first
+		tenant string
+	}{
+		{
+			name:   "queue full",
+			config: AdmissionConfig{MaxQueue: 2, MaxQueuePerTenant: 2},
+			queue:  []string{"a", "b"},
+			tenant: "c",
+		},
+		{
+			name:   "tenant's share full",
+			config: AdmissionConfig{MaxQueue: 10, MaxQueuePerTenant: 2},
+			queue:  []string{"a", "a"},
+			tenant: "a",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.config.MaxConcurrent = 1
+			tt.config.MaxPerAPI = 1
+			tt.config.QueueTimeout = 10 * time.Second
+			a := newAdmission(tt.config)
+			defer a.drain()
+
+			if _, _, err := a.acquire(context.Background(), "holder", "held"); err != nil {
+				t.Fatalf("acquire error = %v", err)
+			}
+			for i, tenant := range tt.queue {
+				go a.acquire(context.Background(), tenant, "api")
+				waitFor(t, func() bool { return a.Load().Queued == i+1 })
+			}
+
+			_, _, err := a.acquire(context.Background(), tt.tenant, "api")
+			var admissionErr *AdmissionError
+			if !errors.As(err, &admissionErr) || admissionErr.Reason != "execution queue is full" {
+				t.Errorf("acquire error = %v, want the queue to be full", err)
+			}
+		})
+	}
+}
+
+// waitFor polls cond until it holds, failing the test after a few seconds
+func waitFor(t *testing.T, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatal("condition not met in time")
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
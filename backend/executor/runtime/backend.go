@@ -0,0 +1,142 @@
+package runtime
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/aKaddoura96/api-hosting-execution-platform/backend/shared/models"
+)
+
+// ExecutionBackend is where user code actually runs. The Executor handles
+// everything around a run (code files, environment, egress, output limits);
+// a backend only isolates and runs the process.
+type ExecutionBackend interface {
+	// Name identifies the backend in logs and health checks
+	Name() string
+	// Prepare makes a runtime image available before its first run
+	Prepare(ctx context.Context, image string) error
+	// Run starts spec and returns an ID for the other methods
+	Run(ctx context.Context, spec *RunSpec) (string, error)
+	// Wait blocks until the run exits and returns its exit code
+	Wait(ctx context.Context, id string) (int, error)
+	// Logs copies the run's output into stdout and stderr until it exits or
+	// a writer returns an error
+	Logs(ctx context.Context, id string, stdout, stderr io.Writer) error
+	// Stats reports what the run used; call it after Wait
+	Stats(ctx context.Context, id string) (*RunStats, error)
+	// Stop ends a run that is still going
+	Stop(ctx context.Context, id string) error
+	// Remove releases everything the run held
+	Remove(id string) error
+	Close() error
+}
+
+// RunSpec describes one run of user code
+type RunSpec struct {
+	Image   string
+	Cmd     []string
+	Env     []string
+	CodeDir string // host directory holding the code and input files
+	Class   *models.ResourceClass
+	Network string // network to join; empty has no network
+	// Stdin is the execution input as JSON, for backends that attach stdin
+	// (local, wasm); containers read input.json from CodeDir instead
+	Stdin []byte
+	// Labels identify the run to the reaper, on backends whose runs can
+	// outlive the executor
+	Labels map[string]string
+}
+
+// RunStats is the resource usage of a finished run. Backends fill in what
+// they can measure.
+type RunStats struct {
+	CPUTime   time.Duration `json:"cpu_time"`
+	OOMKilled bool          `json:"oom_killed"`
+}
+
+// networkBackend is implemented by backends that can give runs a network,
+// which egress needs
+type networkBackend interface {
+	// EnsureNetwork creates an internal network if needed and returns the
+	// address runs on it reach the host at
+	EnsureNetwork(ctx context.Context, name string) (string, error)
+}
+
+// isolatedNetworkBackend is implemented by backends that can give each API's
+// replicas a network of their own, shared only with the executor
+type isolatedNetworkBackend interface {
+	// JoinNetwork creates an internal network if needed, attaches the
+	// executor to it and returns the network's subnet
+	JoinNetwork(ctx context.Context, name string) (string, error)
+	// LeaveNetwork detaches the executor from the network and removes it
+	LeaveNetwork(ctx context.Context, name string) error
+}
+
+// serverBackend is implemented by backends that can run code as a
+// long-lived server, which persistent replicas need
+type serverBackend interface {
+	// StartServer runs spec with PORT set to the port it should listen on
+	// and returns the run's ID and the host:port the executor reaches it at
+	StartServer(ctx context.Context, spec *RunSpec) (string, string, error)
+}
+
+// runLister is implemented by backends whose runs outlive an executor that
+// crashes (Docker), so the reaper can find them
+type runLister interface {
+	// LabelledRuns lists the runs carrying the reaper's labels
+	LabelledRuns(ctx context.Context) ([]LabelledRun, error)
+}
+
+// LabelledRun is a run found by a runLister
+type LabelledRun struct {
+	ID     string
+	Labels map[string]string
+}
+
+// runtimeChecker is implemented by backends that can't run every container
+// runtime (local, which needs the interpreter on the host)
+type runtimeChecker interface {
+	CanRun(rt *models.Runtime) bool
+}
+
+// BackendFromEnv creates the backend named by EXECUTOR_BACKEND: docker (the
+// default), local to run code as host processes without isolation, for
+// development only, or stub to return canned output without running anything
+func BackendFromEnv() (ExecutionBackend, error) {
+	switch name := os.Getenv("EXECUTOR_BACKEND"); name {
+	case "", "docker":
+		return NewDockerBackend()
+	case "local":
+		return NewLocalBackend(), nil
+	case "stub":
+		return NewStubBackend(), nil
+	default:
+		return nil, fmt.Errorf("unknown EXECUTOR_BACKEND: %q", name)
+	}
+}
+
+// copyOutput copies a run's two output pipes until both reach EOF. Once a
+// writer refuses more output the rest of its pipe is discarded so the run
+// doesn't block on a full pipe.
+func copyOutput(stdout, stderr io.Writer, stdoutPipe, stderrPipe io.Reader) error {
+	var wg sync.WaitGroup
+	errs := make([]error, 2)
+	copyStream := func(i int, dst io.Writer, src io.Reader) {
+		defer wg.Done()
+		if _, errs[i] = io.Copy(dst, src); errs[i] != nil {
+			io.Copy(io.Discard, src)
+		}
+	}
+
+	wg.Add(2)
+	go copyStream(0, stdout, stdoutPipe)
+	go copyStream(1, stderr, stderrPipe)
+	wg.Wait()
+
+	return errors.Join(errs...)
+}
@@ -0,0 +1,393 @@
+package runtime
+
+import (
+	"bufio"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/aKaddoura96/api-hosting-execution-platform/backend/shared/logger"
+	"github.com/aKaddoura96/api-hosting-execution-platform/backend/shared/models"
+)
+
+// Errors from StartCustomImageBuild that are the caller's to fix
+var (
+	ErrInvalidDockerfile = errors.New("invalid Dockerfile")
+	ErrBuildInProgress   = errors.New("a build of this image is already running")
+)
+
+// buildLogLimit is how much of the end of the build output is kept
+const buildLogLimit = 64 << 10
+
+// CustomImageStore supplies and records custom image builds (implemented by
+// repository.CustomImageRepository)
+type CustomImageStore interface {
+	GetByAPIID(apiID string) (*models.CustomImage, error)
+	MarkBuilding(apiID string) (bool, error)
+	// MarkReady and MarkFailed ignore builds of a Dockerfile since replaced
+	MarkReady(apiID, dockerfile, image string, sizeBytes int64, buildLog string) error
+	MarkFailed(apiID, dockerfile, buildLog, buildErr string) error
+}
+
+// CustomImageConfig limits custom image builds
+type CustomImageConfig struct {
+	// Registries are the only registries FROM and COPY --from may pull from
+	Registries   []string
+	MaxSizeBytes int64
+	BuildTimeout time.Duration
+}
+
+// CustomImageConfigFromEnv reads CUSTOM_IMAGE_REGISTRIES (comma separated,
+// default localhost:5000), CUSTOM_IMAGE_MAX_MB (default 1024) and
+// CUSTOM_IMAGE_BUILD_TIMEOUT (default 10m)
+func CustomImageConfigFromEnv() (CustomImageConfig, error) {
+	config := CustomImageConfig{
+		Registries:   []string{"localhost:5000"},
+		MaxSizeBytes: 1024 << 20,
+		BuildTimeout: 10 * time.Minute,
+	}
+
+	if v := os.Getenv("CUSTOM_IMAGE_REGISTRIES"); v != "" {
+		config.Registries = nil
+		for _, registry := range strings.Split(v, ",") {
+			if registry = strings.ToLower(strings.TrimSpace(registry)); registry != "" {
+				config.Registries = append(config.Registries, registry)
+			}
+		}
+	}
+	if v := os.Getenv("CUSTOM_IMAGE_MAX_MB"); v != "" {
+		mb, err := strconv.Atoi(v)
+		if err != nil || mb <= 0 {
+			return config, fmt.Errorf("invalid CUSTOM_IMAGE_MAX_MB: %q", v)
+		}
+		config.MaxSizeBytes = int64(mb) << 20
+	}
+	if v := os.Getenv("CUSTOM_IMAGE_BUILD_TIMEOUT"); v != "" {
+		timeout, err := time.ParseDuration(v)
+		if err != nil || timeout <= 0 {
+			return config, fmt.Errorf("invalid CUSTOM_IMAGE_BUILD_TIMEOUT: %q", v)
+		}
+		config.BuildTimeout = timeout
+	}
+
+	return config, nil
+}
+
+// imageBuilder is implemented by backends that can build images (Docker)
+type imageBuilder interface {
+	// BuildImage builds dockerfile, with nothing else in the build context,
+	// as tag. An existing image with the tag is reused.
+	BuildImage(ctx context.Context, dockerfile, tag string) (*BuiltImage, error)
+	RemoveImage(tag string) error
+}
+
+// BuiltImage is the result of a build
+type BuiltImage struct {
+	SizeBytes  int64
+	Entrypoint []string
+	Cmd        []string
+	Log        string // the end of the build output
+	Cached     bool   // the image already existed
+}
+
+// EnableCustomImages lets APIs with the custom runtime build and run their
+// own images. Only backends that build images (Docker) support it.
+func (e *Executor) EnableCustomImages(config CustomImageConfig, store CustomImageStore) error {
+	builder, ok := e.backend.(imageBuilder)
+	if !ok {
+		return fmt.Errorf("the %s backend does not support custom images", e.backend.Name())
+	}
+
+	e.builder = builder
+	e.imageConfig = config
+	e.imageStore = store
+	return nil
+}
+
+// StartCustomImageBuild checks the API's Dockerfile and builds it in the
+// background; the outcome is recorded in the store
+func (e *Executor) StartCustomImageBuild(apiID string) error {
+	if e.imageStore == nil {
+		return fmt.Errorf("custom images are not available on this executor")
+	}
+
+	img, err := e.imageStore.GetByAPIID(apiID)
+	if err != nil {
+		return fmt.Errorf("failed to load custom image: %w", err)
+	}
+
+	if err := checkDockerfile(img.Dockerfile, e.imageConfig.Registries); err != nil {
+		e.imageStore.MarkFailed(apiID, img.Dockerfile, "", err.Error())
+		return fmt.Errorf("%w: %v", ErrInvalidDockerfile, err)
+	}
+
+	claimed, err := e.imageStore.MarkBuilding(apiID)
+	if err != nil {
+		return fmt.Errorf("failed to start build: %w", err)
+	}
+	if !claimed {
+		return ErrBuildInProgress
+	}
+
+	go e.buildCustomImage(apiID, img.Dockerfile)
+	return nil
+}
+
+func (e *Executor) buildCustomImage(apiID, dockerfile string) {
+	ctx, cancel := context.WithTimeout(context.Background(), e.imageConfig.BuildTimeout)
+	defer cancel()
+
+	tag := customImageTag(apiID, dockerfile)
+	built, err := e.builder.BuildImage(ctx, dockerfile, tag)
+	if err == nil {
+		err = e.checkBuiltImage(built)
+		if err != nil && !built.Cached {
+			e.builder.RemoveImage(tag)
+		}
+	}
+	if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		err = fmt.Errorf("build timed out after %s", e.imageConfig.BuildTimeout)
+	}
+
+	var buildLog string
+	if built != nil {
+		buildLog = built.Log
+	}
+	if err != nil {
+		logger.Warn("Custom image build failed", map[string]interface{}{"api_id": apiID, "error": err.Error()})
+		if err := e.imageStore.MarkFailed(apiID, dockerfile, buildLog, err.Error()); err != nil {
+			logger.Error("Failed to record custom image build", map[string]interface{}{"api_id": apiID, "error": err.Error()})
+		}
+		return
+	}
+
+	logger.Info("Custom image built", map[string]interface{}{
+		"api_id": apiID,
+		"image":  tag,
+		"size":   built.SizeBytes,
+		"cached": built.Cached,
+	})
+	e.images.touch(tag)
+	if err := e.imageStore.MarkReady(apiID, dockerfile, tag, built.SizeBytes, buildLog); err != nil {
+		logger.Error("Failed to record custom image build", map[string]interface{}{"api_id": apiID, "error": err.Error()})
+	}
+}
+
+// checkBuiltImage enforces the size limit and the handler contract: the image
+// must say what to run, rather than fall back to a bare shell
+func (e *Executor) checkBuiltImage(built *BuiltImage) error {
+	if built.SizeBytes > e.imageConfig.MaxSizeBytes {
+		return fmt.Errorf("image is %dMB, the limit is %dMB", built.SizeBytes>>20, e.imageConfig.MaxSizeBytes>>20)
+	}
+
+	if len(built.Entrypoint) == 0 {
+		if len(built.Cmd) == 0 {
+			return fmt.Errorf("image must set CMD or ENTRYPOINT to run the handler")
+		}
+		if len(built.Cmd) == 1 {
+			switch path.Base(built.Cmd[0]) {
+			case "sh", "bash", "ash", "dash", "zsh":
+				return fmt.Errorf("image must set CMD or ENTRYPOINT to run the handler, not a shell")
+			}
+		}
+	}
+	return nil
+}
+
+// customImage returns the image to run for an API with the custom runtime.
+// While a new Dockerfile builds, or if its build failed, the last image
+// built keeps serving. An image built on another executor node is built here
+// too before it runs.
+func (e *Executor) customImage(ctx context.Context, apiID string) (string, error) {
+	if e.imageStore == nil {
+		return "", fmt.Errorf("custom images are not available on this executor")
+	}
+	if apiID == "" {
+		return "", fmt.Errorf("the custom runtime runs only deployed APIs")
+	}
+
+	img, err := e.imageStore.GetByAPIID(apiID)
+	if err != nil || img.Image == "" {
+		return "", fmt.Errorf("custom image has not been built")
+	}
+
+	// Only the current Dockerfile can be built again; an image from one since
+	// replaced runs only where it was built
+	if customImageTag(apiID, img.Dockerfile) != img.Image {
+		e.images.touch(img.Image)
+		return img.Image, nil
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, e.imageConfig.BuildTimeout)
+	defer cancel()
+	built, err := e.builder.BuildImage(ctx, img.Dockerfile, img.Image)
+	if err != nil {
+		return "", fmt.Errorf("failed to build custom image on this node: %w", err)
+	}
+	if !built.Cached {
+		logger.Info("Custom image built on this node", map[string]interface{}{"api_id": apiID, "image": img.Image})
+	}
+	e.images.touch(img.Image)
+	return img.Image, nil
+}
+
+// customImageTag names an image after its API and Dockerfile, so an unchanged
+// Dockerfile is not rebuilt
+func customImageTag(apiID, dockerfile string) string {
+	sum := sha256.Sum256([]byte(dockerfile))
+	return "apiplatform-custom/" + apiID + ":" + hex.EncodeToString(sum[:6])
+}
+
+// checkDockerfile allows only images from registries to be pulled: the FROM
+// of every stage and COPY --from must name an earlier stage, scratch or an
+// image in one of them. Build arguments in either are refused, as they can't
+// be checked before the build. The build has no network, so ADD may not
+// fetch URLs, which would otherwise get around the registries. Parser
+// directives are refused too: escape changes how lines are read, and syntax
+// swaps in a frontend from another image.
+func checkDockerfile(dockerfile string, registries []string) error {
+	if directive := parserDirective(dockerfile); directive != "" {
+		return fmt.Errorf("parser directives are not allowed: %s", directive)
+	}
+
+	images, err := dockerfileImages(dockerfile)
+	if err != nil {
+		return err
+	}
+	for _, ref := range images {
+		if !slices.Contains(registries, imageRegistry(ref)) {
+			return fmt.Errorf("image %s is not from an allowed registry (%s)", ref, strings.Join(registries, ", "))
+		}
+	}
+
+	for _, line := range dockerfileInstructions(dockerfile) {
+		fields := strings.Fields(line)
+		if !strings.EqualFold(fields[0], "ADD") {
+			continue
+		}
+		for _, arg := range fields[1:] {
+			if strings.HasPrefix(arg, "--") {
+				continue
+			}
+			if strings.Contains(arg, "://") || strings.HasPrefix(strings.Trim(arg, `["`), "git@") {
+				return fmt.Errorf("ADD from a URL is not allowed: %s", line)
+			}
+		}
+	}
+	return nil
+}
+
+// dockerfileImages returns the images a build pulls: those named by a FROM or
+// COPY --from that isn't an earlier stage or scratch
+func dockerfileImages(dockerfile string) ([]string, error) {
+	var images []string
+	stages := map[string]bool{}
+	stageCount := 0
+
+	addImage := func(ref string) error {
+		ref = strings.ToLower(ref)
+		if strings.Contains(ref, "$") {
+			return fmt.Errorf("build arguments are not allowed in image references: %s", ref)
+		}
+		if ref != "scratch" && !stages[ref] && !slices.Contains(images, ref) {
+			images = append(images, ref)
+		}
+		return nil
+	}
+
+	for _, line := range dockerfileInstructions(dockerfile) {
+		fields := strings.Fields(line)
+		switch strings.ToUpper(fields[0]) {
+		case "FROM":
+			args := fields[1:]
+			for len(args) > 0 && strings.HasPrefix(args[0], "--") {
+				args = args[1:]
+			}
+			if len(args) == 0 {
+				return nil, fmt.Errorf("FROM without an image")
+			}
+			if err := addImage(args[0]); err != nil {
+				return nil, err
+			}
+			if len(args) == 3 && strings.EqualFold(args[1], "AS") {
+				stages[strings.ToLower(args[2])] = true
+			}
+			stages[strconv.Itoa(stageCount)] = true
+			stageCount++
+		case "COPY", "ADD":
+			for _, arg := range fields[1:] {
+				if from, ok := strings.CutPrefix(arg, "--from="); ok {
+					if err := addImage(from); err != nil {
+						return nil, err
+					}
+				}
+			}
+		}
+	}
+
+	if stageCount == 0 {
+		return nil, fmt.Errorf("no FROM instruction in the Dockerfile")
+	}
+	return images, nil
+}
+
+// directivePattern matches a parser directive: a "# key=value" comment
+var directivePattern = regexp.MustCompile(`^#\s*[A-Za-z][A-Za-z0-9_-]*\s*=`)
+
+// parserDirective returns the parser directive a Dockerfile starts with, if
+// any. BuildKit stops looking for directives at the first line that isn't
+// one, so a Dockerfile without one on its first line has none.
+func parserDirective(dockerfile string) string {
+	first, _, _ := strings.Cut(strings.TrimPrefix(dockerfile, "\ufeff"), "\n")
+	if first = strings.TrimSpace(first); directivePattern.MatchString(first) {
+		return first
+	}
+	return ""
+}
+
+// dockerfileInstructions splits a Dockerfile into instructions, joining
+// continuation lines and dropping comments. It assumes the default escape
+// character, which checkDockerfile ensures.
+func dockerfileInstructions(dockerfile string) []string {
+	var instructions []string
+	var current strings.Builder
+
+	scanner := bufio.NewScanner(strings.NewReader(dockerfile))
+	scanner.Buffer(make([]byte, 0, 64<<10), 1<<20)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		if strings.HasSuffix(line, "\\") {
+			current.WriteString(strings.TrimSuffix(line, "\\") + " ")
+			continue
+		}
+		current.WriteString(line)
+		instructions = append(instructions, current.String())
+		current.Reset()
+	}
+	if current.Len() > 0 {
+		instructions = append(instructions, current.String())
+	}
+	return instructions
+}
+
+// imageRegistry returns the registry an image reference pulls from; Docker
+// Hub is docker.io
+func imageRegistry(ref string) string {
+	first, _, found := strings.Cut(ref, "/")
+	if found && (strings.ContainsAny(first, ".:") || first == "localhost") {
+		return first
+	}
+	return "docker.io"
+}
@@ -0,0 +1,175 @@
+package runtime
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestCheckDockerfile(t *testing.T) {
+	registries := []string{"localhost:5000", "registry.example.com"}
+
+	tests := []struct {
+		name       string
+		dockerfile string
+		wantErr    string // empty if the Dockerfile is allowed
+	}{
+		{
+			name:       "allowed registry",
+			dockerfile: "FROM localhost:5000/base:1\nCMD [\"./handler\"]",
+		},
+		{
+			name:       "Docker Hub is not allowed",
+			dockerfile: "FROM python:3.12-slim",
+			wantErr:    "not from an allowed registry",
+		},
+		{
+			name:       "registry prefix is not enough",
+			dockerfile: "FROM registry.example.com.evil.io/base:1",
+			wantErr:    "not from an allowed registry",
+		},
+		{
+			name:       "platform flag",
+			dockerfile: "FROM --platform=linux/amd64 registry.example.com/base:1",
+		},
+		{
+			name:       "scratch",
+			dockerfile: "FROM scratch\nCOPY handler /handler",
+		},
+		{
+			name: "earlier stages by name and index",
+			dockerfile: `FROM localhost:5000/builder:1 AS build
+RUN make
+FROM localhost:5000/base:1
+COPY --from=build /out/handler /handler
+COPY --from=0 /out/lib /lib`,
+		},
+		{
+			name:       "COPY --from another registry",
+			dockerfile: "FROM localhost:5000/base:1\nCOPY --from=alpine:3 /bin/sh /bin/sh",
+			wantErr:    "not from an allowed registry",
+		},
+		{
+			name:       "build argument in FROM",
+			dockerfile: "ARG BASE=localhost:5000/base:1\nFROM $BASE",
+			wantErr:    "build arguments are not allowed",
+		},
+		{
+			name:       "build argument in COPY --from",
+			dockerfile: "FROM localhost:5000/base:1\nCOPY --from=${IMAGE} /a /a",
+			wantErr:    "build arguments are not allowed",
+		},
+		{
+			name:       "continuation lines and comments",
+			dockerfile: "# base image\nFROM \\\n  localhost:5000/base:1\n# done",
+		},
+		{
+			name:       "escape directive",
+			dockerfile: "# escape=`\nFROM localhost:5000/base:1 AS ok \\\nFROM python:3.12-slim",
+			wantErr:    "parser directives are not allowed",
+		},
+		{
+			name:       "syntax directive",
+			dockerfile: "# syntax=docker/dockerfile:1\nFROM localhost:5000/base:1",
+			wantErr:    "parser directives are not allowed",
+		},
+		{
+			name:       "directive in any case and spacing, after a BOM",
+			dockerfile: "\ufeff  #  Syntax = evil.io/frontend\nFROM localhost:5000/base:1",
+			wantErr:    "parser directives are not allowed",
+		},
+		{
+			name:       "directive form after the first line is a comment",
+			dockerfile: "# base image\n# escape=`\nFROM localhost:5000/base:1",
+		},
+		{
+			name:       "directive form after an empty line is a comment",
+			dockerfile: "\n# syntax=docker/dockerfile:1\nFROM localhost:5000/base:1",
+		},
+		{
+			name:       "FROM without an image",
+			dockerfile: "FROM --platform=linux/amd64",
+			wantErr:    "FROM without an image",
+		},
+		{
+			name:       "no FROM",
+			dockerfile: "# nothing here\nRUN true",
+			wantErr:    "no FROM instruction",
+		},
+		{
+			name:       "ADD from the build context",
+			dockerfile: "FROM localhost:5000/base:1\nADD --chown=1000:1000 handler.tar.gz /app",
+		},
+		{
+			name:       "ADD from a URL",
+			dockerfile: "FROM localhost:5000/base:1\nADD https://example.com/tool.tar.gz /opt",
+			wantErr:    "ADD from a URL",
+		},
+		{
+			name:       "ADD from a URL with a checksum",
+			dockerfile: "FROM localhost:5000/base:1\nADD --checksum=sha256:abc http://example.com/tool /opt/tool",
+			wantErr:    "ADD from a URL",
+		},
+		{
+			name:       "ADD from a URL in exec form",
+			dockerfile: "FROM localhost:5000/base:1\nadd [\"https://example.com/tool\", \"/opt/tool\"]",
+			wantErr:    "ADD from a URL",
+		},
+		{
+			name:       "ADD from a git repository",
+			dockerfile: "FROM localhost:5000/base:1\nADD git@github.com:example/tool.git /src",
+			wantErr:    "ADD from a URL",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := checkDockerfile(tt.dockerfile, registries)
+			switch {
+			case tt.wantErr == "" && err != nil:
+				t.Errorf("checkDockerfile() error = %v, want none", err)
+			case tt.wantErr != "" && (err == nil || !strings.Contains(err.Error(), tt.wantErr)):
+				t.Errorf("checkDockerfile() error = %v, want one containing %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestDockerfileImages(t *testing.T) {
+	tests := []struct {
+		name       string
+		dockerfile string
+		want       []string
+	}{
+		{
+			name:       "single stage",
+			dockerfile: "FROM localhost:5000/Base:1",
+			want:       []string{"localhost:5000/base:1"},
+		},
+		{
+			name: "stages and scratch are not pulled",
+			dockerfile: `FROM localhost:5000/builder:1 AS build
+FROM scratch
+COPY --from=build /out /out
+COPY --from=localhost:5000/tools:2 /bin/tool /bin/tool`,
+			want: []string{"localhost:5000/builder:1", "localhost:5000/tools:2"},
+		},
+		{
+			name:       "each image once",
+			dockerfile: "FROM localhost:5000/base:1\nFROM localhost:5000/base:1\nCOPY --from=localhost:5000/base:1 /a /a",
+			want:       []string{"localhost:5000/base:1"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := dockerfileImages(tt.dockerfile)
+			if err != nil {
+				t.Fatalf("dockerfileImages() error = %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("dockerfileImages() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
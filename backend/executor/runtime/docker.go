@@ -0,0 +1,489 @@
+package runtime
+
+import (
+	"archive/tar"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"time"
+
+	"github.com/aKaddoura96/api-hosting-execution-platform/backend/shared/tracing"
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/api/types/filters"
+	"github.com/docker/docker/api/types/image"
+	"github.com/docker/docker/api/types/network"
+	"github.com/docker/docker/client"
+	"github.com/docker/docker/pkg/stdcopy"
+)
+
+// DockerBackend runs each execution in its own container, limited by the
+// resource class and locked down by the sandbox profile
+type DockerBackend struct {
+	client  *client.Client
+	sandbox *SandboxProfile
+}
+
+// NewDockerBackend connects to the Docker daemon from the environment
+// (DOCKER_HOST etc.) and loads the sandbox profile (SANDBOX_*)
+func NewDockerBackend() (*DockerBackend, error) {
+	cli, err := client.NewClientWithOpts(client.FromEnv, client.WithAPIVersionNegotiation())
+	if err != nil {
+		return nil, fmt.Errorf("failed to create Docker client: %w", err)
+	}
+
+	sandbox, err := SandboxProfileFromEnv()
+	if err != nil {
+		cli.Close()
+		return nil, fmt.Errorf("invalid sandbox configuration: %w", err)
+	}
+
+	return &DockerBackend{client: cli, sandbox: sandbox}, nil
+}
+
+func (d *DockerBackend) Name() string {
+	return "docker"
+}
+
+// Prepare pulls the image unless it is already present
+func (d *DockerBackend) Prepare(ctx context.Context, imageName string) error {
+	ctx, span := tracing.StartSpan(ctx, "executor.ensure_image", tracing.SpanKindInternal)
+	defer span.End()
+	span.SetAttribute("image", imageName)
+
+	// Check if image exists
+	_, _, err := d.client.ImageInspectWithRaw(ctx, imageName)
+	if err == nil {
+		return nil // Image exists
+	}
+
+	// Pull image
+	reader, err := d.client.ImagePull(ctx, imageName, image.PullOptions{})
+	if err != nil {
+		return fmt.Errorf("failed to pull image: %w", err)
+	}
+	defer reader.Close()
+
+	// Wait for pull to complete
+	_, err = io.Copy(io.Discard, reader)
+	return err
+}
+
+// Run creates and starts the container
+func (d *DockerBackend) Run(ctx context.Context, spec *RunSpec) (string, error) {
+	networkMode := "none" // Disable network for security
+	if spec.Network != "" {
+		networkMode = spec.Network
+	}
+
+	// Create container configuration
+	containerConfig := &container.Config{
+		Image:        spec.Image,
+		Cmd:          spec.Cmd,
+		WorkingDir:   "/app",
+		Env:          spec.Env,
+		AttachStdout: true,
+		AttachStderr: true,
+		Tty:          false,
+		// The code is copied into a volume, which stays writable under a
+		// read-only root filesystem
+		Volumes: map[string]struct{}{"/app": {}},
+		Labels:  spec.Labels,
+	}
+
+	// Host configuration with the resource class limits
+	hostConfig := &container.HostConfig{
+		Resources: container.Resources{
+			Memory:    spec.Class.MemoryMB * 1024 * 1024,
+			NanoCPUs:  int64(spec.Class.CPUs * 1e9),
+			PidsLimit: newInt64(spec.Class.PidsLimit), // Limit processes
+		},
+		// Scratch space is a size-capped tmpfs counted against the class
+		Tmpfs: map[string]string{
+			"/tmp": fmt.Sprintf("rw,nosuid,size=%dm", spec.Class.TmpDiskMB),
+		},
+		NetworkMode: container.NetworkMode(networkMode),
+	}
+	d.sandbox.apply(containerConfig, hostConfig)
+
+	// Create container
+	resp, err := d.client.ContainerCreate(ctx, containerConfig, hostConfig, nil, nil, "")
+	if err != nil {
+		return "", fmt.Errorf("failed to create container: %w", err)
+	}
+
+	// Copy the code directory in before the container starts
+	codeArchive, err := tarDir(spec.CodeDir)
+	if err == nil {
+		err = d.client.CopyToContainer(ctx, resp.ID, "/app", codeArchive, container.CopyToContainerOptions{})
+	}
+	if err != nil {
+		d.Remove(resp.ID)
+		return "", fmt.Errorf("failed to copy code into container: %w", err)
+	}
+
+	// Start container
+	if err := d.client.ContainerStart(ctx, resp.ID, container.StartOptions{}); err != nil {
+		d.Remove(resp.ID)
+		return "", fmt.Errorf("failed to start container: %w", err)
+	}
+
+	return resp.ID, nil
+}
+
+// StartServer runs a replica listening on replicaPort and returns its address
+// on spec.Network, which the executor must be attached to
+func (d *DockerBackend) StartServer(ctx context.Context, spec *RunSpec) (string, string, error) {
+	if spec.Network == "" {
+		return "", "", fmt.Errorf("replicas need a network")
+	}
+	server := *spec
+	server.Env = append(append([]string{}, spec.Env...), fmt.Sprintf("PORT=%d", replicaPort))
+
+	id, err := d.Run(ctx, &server)
+	if err != nil {
+		return "", "", err
+	}
+
+	info, err := d.client.ContainerInspect(ctx, id)
+	if err != nil {
+		d.Remove(id)
+		return "", "", fmt.Errorf("failed to inspect container: %w", err)
+	}
+	var ip string
+	if info.NetworkSettings != nil {
+		if endpoint, ok := info.NetworkSettings.Networks[spec.Network]; ok {
+			ip = endpoint.IPAddress
+		}
+	}
+	if ip == "" {
+		d.Remove(id)
+		return "", "", fmt.Errorf("container has no address on network %s", spec.Network)
+	}
+
+	return id, net.JoinHostPort(ip, strconv.Itoa(replicaPort)), nil
+}
+
+func (d *DockerBackend) Wait(ctx context.Context, id string) (int, error) {
+	statusCh, errCh := d.client.ContainerWait(ctx, id, container.WaitConditionNotRunning)
+	select {
+	case err := <-errCh:
+		return 0, err
+	case status := <-statusCh:
+		return int(status.StatusCode), nil
+	}
+}
+
+// Logs follows the container's output using Docker's follow mode
+func (d *DockerBackend) Logs(ctx context.Context, id string, stdout, stderr io.Writer) error {
+	options := container.LogsOptions{
+		ShowStdout: true,
+		ShowStderr: true,
+		Follow:     true,
+	}
+
+	reader, err := d.client.ContainerLogs(ctx, id, options)
+	if err != nil {
+		return err
+	}
+	defer reader.Close()
+
+	// Without a TTY Docker multiplexes both streams with frame headers
+	_, err = stdcopy.StdCopy(stdout, stderr, reader)
+	return err
+}
+
+// Stats reports whether the container was killed for exceeding its memory
+// limit; Docker keeps no usage figures once a container has exited
+func (d *DockerBackend) Stats(ctx context.Context, id string) (*RunStats, error) {
+	info, err := d.client.ContainerInspect(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	stats := &RunStats{}
+	if info.State != nil {
+		stats.OOMKilled = info.State.OOMKilled
+	}
+	return stats, nil
+}
+
+// Stop gives the container a few seconds to exit before killing it
+func (d *DockerBackend) Stop(ctx context.Context, id string) error {
+	timeout := 5
+	return d.client.ContainerStop(ctx, id, container.StopOptions{Timeout: &timeout})
+}
+
+func (d *DockerBackend) Remove(id string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	return d.client.ContainerRemove(ctx, id, container.RemoveOptions{Force: true, RemoveVolumes: true})
+}
+
+// LabelledRuns lists the containers, running or not, labelled with the time
+// the executor created them
+func (d *DockerBackend) LabelledRuns(ctx context.Context) ([]LabelledRun, error) {
+	containers, err := d.client.ContainerList(ctx, container.ListOptions{
+		All:     true,
+		Filters: filters.NewArgs(filters.Arg("label", labelCreated)),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list containers: %w", err)
+	}
+
+	runs := make([]LabelledRun, 0, len(containers))
+	for _, c := range containers {
+		runs = append(runs, LabelledRun{ID: c.ID, Labels: c.Labels})
+	}
+	return runs, nil
+}
+
+// ImageSizes returns the size of every tagged image on the host. Images
+// sharing layers are each counted in full.
+func (d *DockerBackend) ImageSizes(ctx context.Context) (map[string]int64, error) {
+	images, err := d.client.ImageList(ctx, image.ListOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list images: %w", err)
+	}
+
+	sizes := make(map[string]int64)
+	for _, img := range images {
+		for _, tag := range img.RepoTags {
+			sizes[tag] = img.Size
+		}
+	}
+	return sizes, nil
+}
+
+func (d *DockerBackend) Close() error {
+	return d.client.Close()
+}
+
+// EnsureNetwork creates an internal bridge network, which has no route out,
+// and returns its gateway
+func (d *DockerBackend) EnsureNetwork(ctx context.Context, name string) (string, error) {
+	nw, err := d.client.NetworkInspect(ctx, name, network.InspectOptions{})
+	if err != nil {
+		if _, err := d.client.NetworkCreate(ctx, name, network.CreateOptions{
+			Driver:   "bridge",
+			Internal: true, // no route out except through the proxy
+			Labels:   map[string]string{"managed-by": "api-platform"},
+		}); err != nil {
+			return "", fmt.Errorf("failed to create network: %w", err)
+		}
+		if nw, err = d.client.NetworkInspect(ctx, name, network.InspectOptions{}); err != nil {
+			return "", fmt.Errorf("failed to inspect network: %w", err)
+		}
+	}
+
+	if len(nw.IPAM.Config) == 0 {
+		return "", nil
+	}
+	return nw.IPAM.Config[0].Gateway, nil
+}
+
+// JoinNetwork creates an internal network if needed and attaches the
+// executor's own container to it, named by EXECUTOR_CONTAINER (default the
+// hostname, which Docker sets to the container ID), and returns the
+// network's subnet. An executor running on the host rather than in a
+// container reaches the network through its gateway and isn't attached.
+func (d *DockerBackend) JoinNetwork(ctx context.Context, name string) (string, error) {
+	if _, err := d.EnsureNetwork(ctx, name); err != nil {
+		return "", err
+	}
+	nw, err := d.client.NetworkInspect(ctx, name, network.InspectOptions{})
+	if err != nil {
+		return "", fmt.Errorf("failed to inspect network: %w", err)
+	}
+	if len(nw.IPAM.Config) == 0 || nw.IPAM.Config[0].Subnet == "" {
+		return "", fmt.Errorf("network %s has no subnet", name)
+	}
+	subnet := nw.IPAM.Config[0].Subnet
+
+	self := executorContainer()
+	info, err := d.client.ContainerInspect(ctx, self)
+	if client.IsErrNotFound(err) {
+		return subnet, nil // not in a container
+	}
+	if err != nil {
+		return "", fmt.Errorf("failed to inspect executor container: %w", err)
+	}
+	if _, attached := info.NetworkSettings.Networks[name]; attached {
+		return subnet, nil
+	}
+	if err := d.client.NetworkConnect(ctx, name, self, nil); err != nil {
+		return "", fmt.Errorf("failed to attach executor to network: %w", err)
+	}
+	return subnet, nil
+}
+
+// LeaveNetwork detaches the executor's container from a network made by
+// JoinNetwork and removes the network
+func (d *DockerBackend) LeaveNetwork(ctx context.Context, name string) error {
+	err := d.client.NetworkDisconnect(ctx, name, executorContainer(), true)
+	if err != nil && !client.IsErrNotFound(err) {
+		return fmt.Errorf("failed to detach executor from network: %w", err)
+	}
+	if err := d.client.NetworkRemove(ctx, name); err != nil && !client.IsErrNotFound(err) {
+		return fmt.Errorf("failed to remove network: %w", err)
+	}
+	return nil
+}
+
+func executorContainer() string {
+	if name := os.Getenv("EXECUTOR_CONTAINER"); name != "" {
+		return name
+	}
+	hostname, _ := os.Hostname()
+	return hostname
+}
+
+// Limits on each step of a custom image build
+const (
+	buildMemoryBytes = 2 << 30
+	buildCPUs        = 2
+	buildShmBytes    = 64 << 20
+)
+
+// BuildImage builds a custom image with the classic builder, which can't
+// mount other images into RUN steps, so checkDockerfile sees every image the
+// build pulls. Steps run without a network and within the build limits.
+// Layers are cached by Docker as for any build.
+func (d *DockerBackend) BuildImage(ctx context.Context, dockerfile, tag string) (*BuiltImage, error) {
+	// The tag is derived from the Dockerfile, so an existing image is current
+	if info, _, err := d.client.ImageInspectWithRaw(ctx, tag); err == nil {
+		return builtImage(info, "", true), nil
+	}
+
+	var buildContext bytes.Buffer
+	tw := tar.NewWriter(&buildContext)
+	tw.WriteHeader(&tar.Header{Name: "Dockerfile", Mode: 0644, Size: int64(len(dockerfile)), ModTime: time.Now()})
+	tw.Write([]byte(dockerfile))
+	if err := tw.Close(); err != nil {
+		return nil, err
+	}
+
+	// The base images are pulled here, by the daemon, so the build's own
+	// steps can run without a network
+	images, err := dockerfileImages(dockerfile)
+	if err != nil {
+		return nil, err
+	}
+	for _, ref := range images {
+		if err := d.Prepare(ctx, ref); err != nil {
+			return nil, fmt.Errorf("failed to pull %s: %w", ref, err)
+		}
+	}
+
+	resp, err := d.client.ImageBuild(ctx, &buildContext, types.ImageBuildOptions{
+		Tags:        []string{tag},
+		Dockerfile:  "Dockerfile",
+		Remove:      true,
+		ForceRemove: true,
+		Version:     types.BuilderV1,
+		Labels:      map[string]string{"managed-by": "api-platform"},
+		NetworkMode: "none",
+		Memory:      buildMemoryBytes,
+		MemorySwap:  buildMemoryBytes,
+		CPUPeriod:   100000,
+		CPUQuota:    buildCPUs * 100000,
+		ShmSize:     buildShmBytes,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to start build: %w", err)
+	}
+	defer resp.Body.Close()
+
+	// The build reports progress, and failure, as a stream of JSON messages
+	var buildLog bytes.Buffer
+	decoder := json.NewDecoder(resp.Body)
+	for {
+		var msg struct {
+			Stream      string `json:"stream"`
+			ErrorDetail *struct {
+				Message string `json:"message"`
+			} `json:"errorDetail"`
+		}
+		if err := decoder.Decode(&msg); errors.Is(err, io.EOF) {
+			break
+		} else if err != nil {
+			return &BuiltImage{Log: tail(buildLog.String(), buildLogLimit)}, fmt.Errorf("build interrupted: %w", err)
+		}
+		buildLog.WriteString(msg.Stream)
+		if msg.ErrorDetail != nil {
+			return &BuiltImage{Log: tail(buildLog.String(), buildLogLimit)}, errors.New(msg.ErrorDetail.Message)
+		}
+	}
+
+	info, _, err := d.client.ImageInspectWithRaw(ctx, tag)
+	if err != nil {
+		return &BuiltImage{Log: tail(buildLog.String(), buildLogLimit)}, fmt.Errorf("failed to inspect image: %w", err)
+	}
+	return builtImage(info, tail(buildLog.String(), buildLogLimit), false), nil
+}
+
+func builtImage(info image.InspectResponse, buildLog string, cached bool) *BuiltImage {
+	built := &BuiltImage{SizeBytes: info.Size, Log: buildLog, Cached: cached}
+	if info.Config != nil {
+		built.Entrypoint = info.Config.Entrypoint
+		built.Cmd = info.Config.Cmd
+	}
+	return built
+}
+
+func (d *DockerBackend) RemoveImage(tag string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	_, err := d.client.ImageRemove(ctx, tag, image.RemoveOptions{PruneChildren: true})
+	return err
+}
+
+// tail returns the last limit bytes of s
+func tail(s string, limit int) string {
+	if len(s) <= limit {
+		return s
+	}
+	return s[len(s)-limit:]
+}
+
+// tarDir archives the files of dir, which holds no subdirectories, readable
+// by the sandbox user
+func tarDir(dir string) (io.Reader, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	var buf bytes.Buffer
+	tw := tar.NewWriter(&buf)
+	for _, entry := range entries {
+		if !entry.Type().IsRegular() {
+			continue
+		}
+		data, err := os.ReadFile(filepath.Join(dir, entry.Name()))
+		if err != nil {
+			return nil, err
+		}
+		header := &tar.Header{Name: entry.Name(), Mode: 0644, Size: int64(len(data)), ModTime: time.Now()}
+		if err := tw.WriteHeader(header); err != nil {
+			return nil, err
+		}
+		if _, err := tw.Write(data); err != nil {
+			return nil, err
+		}
+	}
+	if err := tw.Close(); err != nil {
+		return nil, err
+	}
+	return &buf, nil
+}
+
+func newInt64(i int64) *int64 {
+	return &i
+}
@@ -0,0 +1,75 @@
+package runtime
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/aKaddoura96/api-hosting-execution-platform/backend/shared/logger"
+)
+
+// ErrDraining is returned for work sent to an executor that is shutting down
+var ErrDraining = errors.New("executor is shutting down")
+
+// track records a run so Drain can remove it if it outlives the drain. It
+// reports false once Drain has removed the runs, in which case the caller
+// removes this one itself.
+func (e *Executor) track(backend ExecutionBackend, id string) bool {
+	e.runsMu.Lock()
+	defer e.runsMu.Unlock()
+	if e.runsRemoved {
+		return false
+	}
+	e.runs[id] = backend
+	return true
+}
+
+func (e *Executor) untrack(id string) {
+	e.runsMu.Lock()
+	defer e.runsMu.Unlock()
+	delete(e.runs, id)
+}
+
+// runsWereRemoved reports whether Drain removed the runs, ending them early
+func (e *Executor) runsWereRemoved() bool {
+	e.runsMu.Lock()
+	defer e.runsMu.Unlock()
+	return e.runsRemoved
+}
+
+// Drain stops the executor taking work and waits for what it is doing:
+// executions that haven't started are turned away with an AdmissionError,
+// running ones finish and replicas are stopped once their requests are done.
+// Whatever still runs when ctx ends is removed, failing its execution.
+func (e *Executor) Drain(ctx context.Context) error {
+	executions := e.admit.drain()
+	replicas := e.replicas.drain()
+
+	for _, done := range []<-chan struct{}{executions, replicas} {
+		select {
+		case <-done:
+		case <-ctx.Done():
+			return e.removeRuns(ctx.Err())
+		}
+	}
+	return nil
+}
+
+// removeRuns removes every run still going after the drain ended with cause
+func (e *Executor) removeRuns(cause error) error {
+	e.runsMu.Lock()
+	runs := e.runs
+	e.runs = make(map[string]ExecutionBackend)
+	e.runsRemoved = true
+	e.runsMu.Unlock()
+
+	for id, backend := range runs {
+		if err := backend.Remove(id); err != nil {
+			logger.Error("Failed to remove run", map[string]interface{}{
+				"run_id": id,
+				"error":  err.Error(),
+			})
+		}
+	}
+	return fmt.Errorf("removed %d runs still going: %w", len(runs), cause)
+}
@@ -0,0 +1,315 @@
+package runtime
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/aKaddoura96/api-hosting-execution-platform/backend/shared/egress"
+	"github.com/aKaddoura96/api-hosting-execution-platform/backend/shared/logger"
+	"github.com/aKaddoura96/api-hosting-execution-platform/backend/shared/models"
+)
+
+// EgressStore supplies per-API egress policies (implemented by repository.EgressRepository)
+type EgressStore interface {
+	GetPolicy(apiID string) (*models.EgressPolicy, error)
+}
+
+// EgressProxy is the only way out of the internal egress network. Each
+// execution with egress enabled gets its own proxy credentials, which select
+// the allowlist its connections are checked against and the counter its
+// traffic is added to.
+type EgressProxy struct {
+	listenAddr string
+	network    string
+	proxyURL   string // how containers reach the proxy, without credentials
+
+	mu       sync.Mutex
+	sessions map[string]*egressSession // by token
+
+	dialer *net.Dialer
+}
+
+// NewEgressProxy configures the proxy from the environment: EGRESS_PROXY_ADDR
+// is its listen address (default :3128), EGRESS_NETWORK the internal Docker
+// network containers join (default apiplatform-egress) and EGRESS_PROXY_URL
+// how containers reach it (default: the network's gateway).
+func NewEgressProxy() *EgressProxy {
+	p := &EgressProxy{
+		listenAddr: ":3128",
+		network:    "apiplatform-egress",
+		proxyURL:   os.Getenv("EGRESS_PROXY_URL"),
+		sessions:   make(map[string]*egressSession),
+		dialer:     &net.Dialer{Timeout: 10 * time.Second},
+	}
+
+	if v := os.Getenv("EGRESS_PROXY_ADDR"); v != "" {
+		p.listenAddr = v
+	}
+	if v := os.Getenv("EGRESS_NETWORK"); v != "" {
+		p.network = v
+	}
+
+	return p
+}
+
+type egressSession struct {
+	executionID string
+	allow       *egress.Allowlist
+	bytes       atomic.Int64
+}
+
+// EnableEgress creates the internal network if needed and starts the proxy.
+// Without it, executions of APIs with egress enabled fail. Only backends that
+// manage networks (Docker) support it.
+func (e *Executor) EnableEgress(ctx context.Context, proxy *EgressProxy, store EgressStore) error {
+	nb, ok := e.backend.(networkBackend)
+	if !ok {
+		return fmt.Errorf("the %s backend does not support egress", e.backend.Name())
+	}
+
+	gateway, err := nb.EnsureNetwork(ctx, proxy.network)
+	if err != nil {
+		return fmt.Errorf("failed to set up egress network: %w", err)
+	}
+
+	if proxy.proxyURL == "" {
+		if gateway == "" {
+			return fmt.Errorf("egress network has no gateway, set EGRESS_PROXY_URL")
+		}
+		_, port, err := net.SplitHostPort(proxy.listenAddr)
+		if err != nil {
+			return fmt.Errorf("invalid EGRESS_PROXY_ADDR: %w", err)
+		}
+		proxy.proxyURL = "http://" + net.JoinHostPort(gateway, port)
+	}
+
+	listener, err := net.Listen("tcp", proxy.listenAddr)
+	if err != nil {
+		return fmt.Errorf("failed to start egress proxy: %w", err)
+	}
+	go http.Serve(listener, proxy)
+
+	e.egress = proxy
+	e.egressStore = store
+	return nil
+}
+
+// open admits an execution, returning the container environment that points
+// it at the proxy and a function that ends the session and returns the bytes
+// it transferred
+func (p *EgressProxy) open(executionID string, allow *egress.Allowlist) ([]string, func() int64) {
+	b := make([]byte, 16)
+	rand.Read(b)
+	token := hex.EncodeToString(b)
+
+	session := &egressSession{executionID: executionID, allow: allow}
+	p.mu.Lock()
+	p.sessions[token] = session
+	p.mu.Unlock()
+
+	proxyURL := strings.Replace(p.proxyURL, "://", "://exec:"+token+"@", 1)
+	env := []string{
+		"HTTP_PROXY=" + proxyURL,
+		"HTTPS_PROXY=" + proxyURL,
+		"http_proxy=" + proxyURL,
+		"https_proxy=" + proxyURL,
+	}
+
+	return env, func() int64 {
+		p.mu.Lock()
+		delete(p.sessions, token)
+		p.mu.Unlock()
+		return session.bytes.Load()
+	}
+}
+
+func (p *EgressProxy) session(r *http.Request) *egressSession {
+	auth, ok := strings.CutPrefix(r.Header.Get("Proxy-Authorization"), "Basic ")
+	if !ok {
+		return nil
+	}
+	decoded, err := base64.StdEncoding.DecodeString(auth)
+	if err != nil {
+		return nil
+	}
+	_, token, _ := strings.Cut(string(decoded), ":")
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.sessions[token]
+}
+
+// ServeHTTP handles CONNECT tunnels (HTTPS) and plain HTTP forwarding
+func (p *EgressProxy) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	session := p.session(r)
+	if session == nil {
+		w.Header().Set("Proxy-Authenticate", `Basic realm="egress"`)
+		http.Error(w, "Proxy authentication required", http.StatusProxyAuthRequired)
+		return
+	}
+
+	hostport := r.Host
+	if r.Method != http.MethodConnect {
+		hostport = r.URL.Host
+		if r.URL.Port() == "" {
+			hostport = net.JoinHostPort(r.URL.Hostname(), "80")
+		}
+	}
+
+	addr, err := p.resolve(r.Context(), session, hostport)
+	if err != nil {
+		logger.Warn("Egress connection denied", map[string]interface{}{
+			"execution_id": session.executionID,
+			"destination":  hostport,
+			"error":        err.Error(),
+		})
+		http.Error(w, "Destination not allowed: "+err.Error(), http.StatusForbidden)
+		return
+	}
+
+	if r.Method == http.MethodConnect {
+		p.tunnel(w, r, session, addr)
+		return
+	}
+	p.forward(w, r, session, addr)
+}
+
+// resolve checks hostport against the session's allowlist and returns the
+// address to dial. The checked IP is dialled directly so a second DNS lookup
+// can't change where the connection goes.
+func (p *EgressProxy) resolve(ctx context.Context, session *egressSession, hostport string) (string, error) {
+	host, port, err := net.SplitHostPort(hostport)
+	if err != nil {
+		return "", err
+	}
+
+	if ip := net.ParseIP(host); ip != nil {
+		if !session.allow.AllowsIP(ip) {
+			return "", fmt.Errorf("%s is not on the allowlist", host)
+		}
+		return hostport, nil
+	}
+
+	addrs, err := net.DefaultResolver.LookupIPAddr(ctx, host)
+	if err != nil {
+		return "", fmt.Errorf("failed to resolve %s", host)
+	}
+	for _, addr := range addrs {
+		if session.allow.Permits(host, addr.IP) {
+			return net.JoinHostPort(addr.IP.String(), port), nil
+		}
+	}
+	return "", fmt.Errorf("%s is not on the allowlist", host)
+}
+
+func (p *EgressProxy) tunnel(w http.ResponseWriter, r *http.Request, session *egressSession, addr string) {
+	upstream, err := p.dialer.DialContext(r.Context(), "tcp", addr)
+	if err != nil {
+		http.Error(w, "Failed to connect", http.StatusBadGateway)
+		return
+	}
+	defer upstream.Close()
+
+	hijacker, ok := w.(http.Hijacker)
+	if !ok {
+		http.Error(w, "Tunnelling not supported", http.StatusInternalServerError)
+		return
+	}
+	client, buffered, err := hijacker.Hijack()
+	if err != nil {
+		return
+	}
+	defer client.Close()
+
+	client.Write([]byte("HTTP/1.1 200 Connection Established\r\n\r\n"))
+
+	done := make(chan struct{}, 2)
+	go func() {
+		io.Copy(&countingWriter{w: upstream, n: &session.bytes}, buffered)
+		if tcp, ok := upstream.(*net.TCPConn); ok {
+			tcp.CloseWrite()
+		}
+		done <- struct{}{}
+	}()
+	go func() {
+		io.Copy(&countingWriter{w: client, n: &session.bytes}, upstream)
+		done <- struct{}{}
+	}()
+	// Once either side finishes, tear down both so the other copy returns
+	<-done
+	client.Close()
+	upstream.Close()
+	<-done
+}
+
+func (p *EgressProxy) forward(w http.ResponseWriter, r *http.Request, session *egressSession, addr string) {
+	transport := &http.Transport{
+		DialContext: func(ctx context.Context, network, _ string) (net.Conn, error) {
+			return p.dialer.DialContext(ctx, network, addr)
+		},
+		DisableKeepAlives: true,
+	}
+
+	out := r.Clone(r.Context())
+	out.RequestURI = ""
+	out.Header.Del("Proxy-Authorization")
+	out.Header.Del("Proxy-Connection")
+	if r.Body != nil {
+		out.Body = &countingReader{r: r.Body, n: &session.bytes}
+	}
+
+	resp, err := transport.RoundTrip(out)
+	if err != nil {
+		http.Error(w, "Failed to reach destination", http.StatusBadGateway)
+		return
+	}
+	defer resp.Body.Close()
+
+	for name, values := range resp.Header {
+		for _, v := range values {
+			w.Header().Add(name, v)
+		}
+	}
+	w.WriteHeader(resp.StatusCode)
+	n, _ := io.Copy(w, resp.Body)
+	session.bytes.Add(n)
+}
+
+// countingWriter adds bytes to n as they are written, so a session's total
+// is current even while its tunnels are still open
+type countingWriter struct {
+	w io.Writer
+	n *atomic.Int64
+}
+
+func (c *countingWriter) Write(p []byte) (int, error) {
+	n, err := c.w.Write(p)
+	c.n.Add(int64(n))
+	return n, err
+}
+
+type countingReader struct {
+	r io.ReadCloser
+	n *atomic.Int64
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.n.Add(int64(n))
+	return n, err
+}
+
+func (c *countingReader) Close() error {
+	return c.r.Close()
+}
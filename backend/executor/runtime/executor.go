@@ -1,160 +1,381 @@
 package runtime
 
 import (
-	"bytes"
 	"context"
+	"encoding/base64"
 	"encoding/json"
+	"errors"
 	"fmt"
-	"io"
 	"os"
 	"path/filepath"
 	"strings"
+	"sync"
 	"time"
 
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/image"
-	"github.com/docker/docker/client"
+	"github.com/aKaddoura96/api-hosting-execution-platform/backend/shared/egress"
+	"github.com/aKaddoura96/api-hosting-execution-platform/backend/shared/logger"
+	"github.com/aKaddoura96/api-hosting-execution-platform/backend/shared/models"
+	"github.com/aKaddoura96/api-hosting-execution-platform/backend/shared/tracing"
+	"github.com/google/uuid"
 )
 
 type ExecutionRequest struct {
-	Code       string                 `json:"code"`
-	Runtime    string                 `json:"runtime"`
-	Input      map[string]interface{} `json:"input,omitempty"`
-	TimeoutSec int                    `json:"timeout_sec,omitempty"`
+	ExecutionID string `json:"execution_id,omitempty"`
+	APIID       string `json:"api_id,omitempty"`
+	Version     string `json:"version,omitempty"` // selects the API's env vars; empty is current
+	// ResourceClass sets the container limits (models.ResourceClasses); empty is the default
+	ResourceClass string                 `json:"resource_class,omitempty"`
+	Code          string                 `json:"code"`
+	Runtime       string                 `json:"runtime"`
+	Input         map[string]interface{} `json:"input,omitempty"`
+	TimeoutSec    int                    `json:"timeout_sec,omitempty"`
+	// TenantID is who queued executions are scheduled fairly between; empty
+	// is the API itself
+	TenantID string `json:"tenant_id,omitempty"`
 }
 
 type ExecutionResult struct {
-	Output     string                 `json:"output"`
-	Error      string                 `json:"error,omitempty"`
-	StatusCode int                    `json:"status_code"`
-	Duration   int64                  `json:"duration_ms"`
-	ExitCode   int                    `json:"exit_code"`
-	Result     map[string]interface{} `json:"result,omitempty"`
+	ExecutionID string                 `json:"execution_id"`
+	Output      string                 `json:"output"`
+	Error       string                 `json:"error,omitempty"`
+	StatusCode  int                    `json:"status_code"`
+	Duration    int64                  `json:"duration_ms"`
+	QueueMs     int64                  `json:"queue_ms"` // waiting for a slot, not in Duration
+	ExitCode    int                    `json:"exit_code"`
+	Result      map[string]interface{} `json:"result,omitempty"`
+	// StreamTruncated is set when streamed output exceeded maxStreamBytes
+	StreamTruncated bool `json:"stream_truncated,omitempty"`
+	// Truncated is set when stdout, stderr or the response hit OutputLimits
+	Truncated bool `json:"truncated,omitempty"`
+	// EgressBytes is the traffic through the egress proxy, both directions
+	EgressBytes int64 `json:"egress_bytes,omitempty"`
 }
 
 type Executor struct {
-	client *client.Client
+	backend  ExecutionBackend
+	wasm     *WasmBackend // runs the wasm runtime whatever the backend
+	logs     *LogHub
+	logStore LogStore
+	envStore EnvStore
+	limits   OutputLimits
+	runtimes *runtimeRegistry
+	admit    *admission
+
+	egress      *EgressProxy
+	egressStore EgressStore
+
+	builder     imageBuilder
+	imageConfig CustomImageConfig
+	imageStore  CustomImageStore
+
+	replicas *replicaManager
+
+	images *imageCache
+
+	// Set by EnableReaper: the node runs are labelled with and the directory
+	// code files are written under (the system default if empty)
+	nodeID  string
+	workDir string
+	reaper  *reaper
+
+	// Containers and processes running, for Drain
+	runsMu      sync.Mutex
+	runs        map[string]ExecutionBackend
+	runsRemoved bool
 }
 
-func NewExecutor() (*Executor, error) {
-	cli, err := client.NewClientWithOpts(client.FromEnv, client.WithAPIVersionNegotiation())
+// EnvStore supplies the environment variables of an API version as NAME=value
+// pairs (implemented by secrets.EnvResolver)
+type EnvStore interface {
+	Resolve(apiID, version string) ([]string, error)
+}
+
+// NewExecutor runs code on backend
+func NewExecutor(backend ExecutionBackend) (*Executor, error) {
+	limits, err := OutputLimitsFromEnv()
+	if err != nil {
+		return nil, fmt.Errorf("invalid output limits: %w", err)
+	}
+	admissionConfig, err := AdmissionConfigFromEnv()
+	if err != nil {
+		return nil, fmt.Errorf("invalid admission limits: %w", err)
+	}
+	imageConfig, err := ImageCacheConfigFromEnv()
+	if err != nil {
+		return nil, fmt.Errorf("invalid image cache configuration: %w", err)
+	}
+
+	return &Executor{
+		backend: backend,
+		wasm:    NewWasmBackend(),
+		logs:    NewLogHub(),
+		limits:  limits,
+		admit:   newAdmission(admissionConfig),
+		images:  newImageCache(imageConfig),
+		runs:    make(map[string]ExecutionBackend),
+	}, nil
+}
+
+// Load reports how many executions are running and queued
+func (e *Executor) Load() Load {
+	return e.admit.Load()
+}
+
+// Backend returns the backend code runs on
+func (e *Executor) Backend() ExecutionBackend {
+	return e.backend
+}
+
+// SetLogStore enables persisting each execution's output
+func (e *Executor) SetLogStore(store LogStore) {
+	e.logStore = store
+}
+
+// SetRuntimeStore sets the registry runtimes are looked up in; without one
+// every execution fails
+func (e *Executor) SetRuntimeStore(store RuntimeStore) {
+	e.runtimes = newRuntimeRegistry(store)
+}
+
+// SetEnvStore enables injecting per-API environment variables and secrets
+func (e *Executor) SetEnvStore(store EnvStore) {
+	e.envStore = store
+}
+
+// containerEgress is the proxy session of one execution
+type containerEgress struct {
+	env   []string
+	close func() int64
+}
+
+// openEgress starts a proxy session if the API has egress enabled
+func (e *Executor) openEgress(req *ExecutionRequest) (*containerEgress, error) {
+	policy, err := e.egressStore.GetPolicy(req.APIID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load egress policy: %w", err)
+	}
+	if !policy.Enabled {
+		return nil, nil
+	}
+	if e.egress == nil {
+		return nil, fmt.Errorf("outbound network access is not available on this executor")
+	}
+
+	allow, err := egress.Parse(policy.Allowlist)
+	if err != nil {
+		return nil, fmt.Errorf("invalid egress allowlist: %w", err)
+	}
+
+	env, closeSession := e.egress.open(req.ExecutionID, allow)
+	return &containerEgress{env: env, close: closeSession}, nil
+}
+
+// Logs returns the hub that streams live output from running containers
+func (e *Executor) Logs() *LogHub {
+	return e.logs
+}
+
+// Runtimes lists the enabled runtimes this executor can run
+func (e *Executor) Runtimes() ([]string, error) {
+	if e.runtimes == nil {
+		return []string{}, nil
+	}
+
+	enabled, err := e.runtimes.store.GetEnabled("")
 	if err != nil {
-		return nil, fmt.Errorf("failed to create Docker client: %w", err)
+		return nil, fmt.Errorf("failed to list runtimes: %w", err)
+	}
+
+	names := []string{}
+	for _, rt := range enabled {
+		if e.canRun(rt) {
+			names = append(names, rt.Name)
+		}
+	}
+	return names, nil
+}
+
+// canRun reports whether this executor has what a runtime needs
+func (e *Executor) canRun(rt *models.Runtime) bool {
+	switch {
+	case rt.Engine == models.EngineWASM:
+		return true
+	case rt.Name == models.RuntimeCustom:
+		return e.builder != nil
 	}
+	if checker, ok := e.backend.(runtimeChecker); ok {
+		return checker.CanRun(rt)
+	}
+	return true
+}
 
-	return &Executor{client: cli}, nil
+// backendFor picks where a runtime's code runs
+func (e *Executor) backendFor(rt *models.Runtime) ExecutionBackend {
+	if rt.Engine == models.EngineWASM {
+		return e.wasm
+	}
+	return e.backend
 }
 
 func (e *Executor) Close() error {
-	return e.client.Close()
+	e.wasm.Close()
+	return e.backend.Close()
 }
 
-// Execute runs code in a containerized environment
-func (e *Executor) Execute(req *ExecutionRequest) (*ExecutionResult, error) {
-	startTime := time.Now()
+// Execute runs code in a containerized environment. The trace carried by ctx
+// is continued here and handed to the container as TRACEPARENT.
+func (e *Executor) Execute(ctx context.Context, req *ExecutionRequest) (*ExecutionResult, error) {
+	return e.ExecuteStream(ctx, req, nil)
+}
 
-	// Set default timeout
-	if req.TimeoutSec == 0 {
-		req.TimeoutSec = 30
+// ExecuteStream is Execute, additionally passing output to onOutput as soon as
+// the container writes it. The timeout is the same; streamed output stops
+// after maxStreamBytes.
+func (e *Executor) ExecuteStream(ctx context.Context, req *ExecutionRequest, onOutput OutputFunc) (*ExecutionResult, error) {
+	if req.ExecutionID == "" {
+		req.ExecutionID = uuid.New().String()
 	}
 
-	ctx, cancel := context.WithTimeout(context.Background(), time.Duration(req.TimeoutSec)*time.Second)
-	defer cancel()
+	ctx, span := tracing.StartSpan(ctx, "executor.execute", tracing.SpanKindInternal)
+	defer span.End()
+	span.SetAttribute("runtime", req.Runtime)
+	span.SetAttribute("execution_id", req.ExecutionID)
 
-	// Get runtime configuration
-	runtimeConfig, err := e.getRuntimeConfig(req.Runtime)
+	// Look up the runtime, whose defaults apply to what the request leaves out
+	rt, err := e.getRuntime(req.Runtime)
 	if err != nil {
+		span.SetError(err)
 		return nil, err
 	}
+	if req.TimeoutSec == 0 {
+		req.TimeoutSec = rt.DefaultTimeoutSec
+	}
+	if req.ResourceClass == "" {
+		req.ResourceClass = rt.DefaultResourceClass
+	}
 
-	// Ensure image exists
-	if err := e.ensureImage(ctx, runtimeConfig.Image); err != nil {
+	// Resolve the resource class; its timeout ceiling applies even to direct
+	// callers and runtime defaults, and is settled before the timeout starts
+	class, ok := models.GetResourceClass(req.ResourceClass)
+	if !ok {
+		err := fmt.Errorf("unknown resource class: %s", req.ResourceClass)
+		span.SetError(err)
 		return nil, err
 	}
+	if req.TimeoutSec > class.MaxTimeoutSec {
+		req.TimeoutSec = class.MaxTimeoutSec
+	}
+	span.SetAttribute("resource_class", class.Name)
 
-	// Prepare code and input files
-	tempDir, err := e.prepareCodeFiles(req, runtimeConfig)
-	if err != nil {
+	// Custom runtime APIs run the image built from their Dockerfile; other
+	// images are pulled if missing. Either happens before the code waits for
+	// a slot, and outside its timeout.
+	if rt.Name == models.RuntimeCustom {
+		image, err := e.customImage(ctx, req.APIID)
+		if err != nil {
+			span.SetError(err)
+			return nil, err
+		}
+		custom := *rt
+		custom.Image = image
+		rt = &custom
+	} else if err := e.images.pull(ctx, e.backendFor(rt), rt.Image); err != nil {
+		span.SetError(err)
 		return nil, err
 	}
-	defer os.RemoveAll(tempDir)
 
-	// Create and run container
-	result, err := e.runContainer(ctx, runtimeConfig, tempDir, req.TimeoutSec)
+	// Wait for a slot; the timeout starts once the code gets one
+	tenant := req.TenantID
+	if tenant == "" {
+		tenant = req.APIID
+	}
+	release, queued, err := e.admit.acquire(ctx, tenant, req.APIID)
 	if err != nil {
+		span.SetError(err)
 		return nil, err
 	}
+	defer release()
+	span.SetAttribute("queue_ms", queued.Milliseconds())
+	startTime := time.Now()
 
-	result.Duration = time.Since(startTime).Milliseconds()
-	return result, nil
-}
-
-type runtimeConfig struct {
-	Image      string
-	Extension  string
-	EntryPoint []string
-	Command    []string
-}
+	ctx, cancel := context.WithTimeout(ctx, time.Duration(req.TimeoutSec)*time.Second)
+	defer cancel()
 
-func (e *Executor) getRuntimeConfig(runtime string) (*runtimeConfig, error) {
-	configs := map[string]*runtimeConfig{
-		"python": {
-			Image:      "python:3.11-slim",
-			Extension:  ".py",
-			EntryPoint: []string{"python"},
-			Command:    []string{"/app/main.py"},
-		},
-		"nodejs": {
-			Image:      "node:18-alpine",
-			Extension:  ".js",
-			EntryPoint: []string{"node"},
-			Command:    []string{"/app/main.js"},
-		},
-		"go": {
-			Image:      "golang:1.22-alpine",
-			Extension:  ".go",
-			EntryPoint: []string{"/bin/sh"},
-			Command:    []string{"-c", "cd /app && go run main.go"},
-		},
-	}
-
-	config, ok := configs[strings.ToLower(runtime)]
-	if !ok {
-		return nil, fmt.Errorf("unsupported runtime: %s", runtime)
+	// Resolve the API's environment before doing any work
+	var apiEnv []string
+	if e.envStore != nil && req.APIID != "" {
+		if apiEnv, err = e.envStore.Resolve(req.APIID, req.Version); err != nil {
+			span.SetError(err)
+			return nil, err
+		}
 	}
 
-	return config, nil
-}
+	// Prepare code and input files
+	tempDir, err := e.prepareCodeFiles(req, rt)
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(tempDir)
 
-func (e *Executor) ensureImage(ctx context.Context, imageName string) error {
-	// Check if image exists
-	_, _, err := e.client.ImageInspectWithRaw(ctx, imageName)
-	if err == nil {
-		return nil // Image exists
+	// Containers of APIs with egress enabled are routed through the proxy;
+	// WASI modules have no sockets to route
+	var egressSession *containerEgress
+	if e.egressStore != nil && req.APIID != "" && rt.Engine != models.EngineWASM {
+		if egressSession, err = e.openEgress(req); err != nil {
+			span.SetError(err)
+			return nil, err
+		}
 	}
 
-	// Pull image
-	reader, err := e.client.ImagePull(ctx, imageName, image.PullOptions{})
+	// Create and run container, collecting output as it is produced
+	output := newOutputCollector(req.ExecutionID, req.APIID, e.logs, onOutput, e.limits)
+	result, err := e.runContainer(ctx, rt, req.Code, class, tempDir, apiEnv, egressSession, output)
+	e.persistLogs(ctx, output)
+	var egressBytes int64
+	if egressSession != nil {
+		egressBytes = egressSession.close()
+	}
 	if err != nil {
-		return fmt.Errorf("failed to pull image: %w", err)
+		span.SetError(err)
+		return nil, err
 	}
-	defer reader.Close()
 
-	// Wait for pull to complete
-	_, err = io.Copy(io.Discard, reader)
-	return err
+	result.ExecutionID = req.ExecutionID
+	result.StreamTruncated = output.StreamTruncated()
+	result.Truncated = result.Truncated || output.Truncated("")
+	result.EgressBytes = egressBytes
+	result.Duration = time.Since(startTime).Milliseconds()
+	result.QueueMs = queued.Milliseconds()
+	span.SetAttribute("exit_code", result.ExitCode)
+	span.SetAttribute("status_code", result.StatusCode)
+	return result, nil
+}
+
+// getRuntime looks up an enabled runtime in the registry
+func (e *Executor) getRuntime(name string) (*models.Runtime, error) {
+	if e.runtimes == nil {
+		return nil, fmt.Errorf("unsupported runtime: %s", name)
+	}
+	return e.runtimes.get(name)
 }
 
-func (e *Executor) prepareCodeFiles(req *ExecutionRequest, config *runtimeConfig) (string, error) {
+func (e *Executor) prepareCodeFiles(req *ExecutionRequest, rt *models.Runtime) (string, error) {
 	// Create temporary directory
-	tempDir, err := os.MkdirTemp("", "api-exec-*")
+	tempDir, err := os.MkdirTemp(e.workDir, "api-exec-*")
 	if err != nil {
 		return "", fmt.Errorf("failed to create temp directory: %w", err)
 	}
 
 	// Write code file
-	codeFile := filepath.Join(tempDir, "main"+config.Extension)
-	if err := os.WriteFile(codeFile, []byte(req.Code), 0644); err != nil {
+	code := []byte(req.Code)
+	if rt.Engine == models.EngineWASM {
+		if code, err = base64.StdEncoding.DecodeString(req.Code); err != nil {
+			os.RemoveAll(tempDir)
+			return "", fmt.Errorf("wasm code must be a base64 encoded module: %w", err)
+		}
+	}
+	codeFile := filepath.Join(tempDir, rt.CodeFile())
+	if err := os.WriteFile(codeFile, code, 0644); err != nil {
 		os.RemoveAll(tempDir)
 		return "", fmt.Errorf("failed to write code file: %w", err)
 	}
@@ -177,95 +398,122 @@ func (e *Executor) prepareCodeFiles(req *ExecutionRequest, config *runtimeConfig
 	return tempDir, nil
 }
 
-func (e *Executor) runContainer(ctx context.Context, config *runtimeConfig, codePath string, timeoutSec int) (*ExecutionResult, error) {
-	// Read code and input files
-	codeContent, err := os.ReadFile(filepath.Join(codePath, "main"+config.Extension))
-	if err != nil {
-		return nil, fmt.Errorf("failed to read code file: %w", err)
-	}
-
-	// Create inline script based on runtime
-	var cmd []string
-	switch config.Extension {
-	case ".py":
-		cmd = []string{"python", "-c", string(codeContent)}
-	case ".js":
-		cmd = []string{"node", "-e", string(codeContent)}
-	case ".go":
-		// For Go, we still need file-based execution
-		cmd = config.Command
-	default:
-		cmd = config.Command
-	}
-
-	// Create container configuration
-	containerConfig := &container.Config{
-		Image:      config.Image,
-		Cmd:        cmd,
-		WorkingDir: "/app",
-		Env: []string{
-			"PYTHONUNBUFFERED=1",
-			"NODE_ENV=production",
-		},
-		AttachStdout: true,
-		AttachStderr: true,
-		Tty:          false,
-	}
-
-	// Host configuration with resource limits
-	hostConfig := &container.HostConfig{
-		Resources: container.Resources{
-			Memory:     256 * 1024 * 1024, // 256MB
-			NanoCPUs:   500000000,         // 0.5 CPU
-			PidsLimit:  newInt64(50),      // Limit processes
-		},
-		NetworkMode: "none", // Disable network for security
-		ReadonlyRootfs: false,
-	}
-
-	// Create container
-	resp, err := e.client.ContainerCreate(ctx, containerConfig, hostConfig, nil, nil, "")
-	if err != nil {
-		return nil, fmt.Errorf("failed to create container: %w", err)
+// persistLogs stores the collected output; failures are logged, not returned
+func (e *Executor) persistLogs(ctx context.Context, output *outputCollector) {
+	if e.logStore == nil {
+		return
+	}
+	if err := e.logStore.CreateBatch(output.Persisted()); err != nil {
+		logger.FromContext(ctx).Error("Failed to persist execution logs", map[string]interface{}{
+			"execution_id": output.executionID,
+			"error":        err.Error(),
+		})
 	}
+}
 
-	// Ensure container is removed after execution
-	defer e.client.ContainerRemove(context.Background(), resp.ID, container.RemoveOptions{Force: true})
+func (e *Executor) runContainer(ctx context.Context, rt *models.Runtime, code string, class *models.ResourceClass, codePath string, apiEnv []string, egressSession *containerEgress, output *outputCollector) (*ExecutionResult, error) {
+	// Runtimes either run the code file or take the code inline
+	cmd := rt.Command(code)
 
-	// Start container
-	if err := e.client.ContainerStart(ctx, resp.ID, container.StartOptions{}); err != nil {
-		return nil, fmt.Errorf("failed to start container: %w", err)
+	// API variables come after the defaults so they can override them
+	env := []string{
+		"PYTHONUNBUFFERED=1",
+		"NODE_ENV=production",
 	}
+	env = append(env, apiEnv...)
 
-	// Wait for container to finish or timeout
-	statusCh, errCh := e.client.ContainerWait(ctx, resp.ID, container.WaitConditionNotRunning)
-	
-	var exitCode int64
-	select {
-	case err := <-errCh:
-		if err != nil {
-			return nil, fmt.Errorf("container wait error: %w", err)
-		}
-	case status := <-statusCh:
-		exitCode = status.StatusCode
-	case <-ctx.Done():
-		// Timeout - kill the container
-		timeout := 5
-		e.client.ContainerStop(context.Background(), resp.ID, container.StopOptions{Timeout: &timeout})
+	var network string
+	if egressSession != nil {
+		env = append(env, egressSession.env...)
+		network = e.egress.network
+	}
+
+	backend := e.backendFor(rt)
+	ctx, span := tracing.StartSpan(ctx, "executor.run_container", tracing.SpanKindInternal)
+	defer span.End()
+	span.SetAttribute("backend", backend.Name())
+
+	// Let user code continue the trace
+	if traceEnv := tracing.Env(ctx); traceEnv != "" {
+		env = append(env, traceEnv)
+	}
+
+	// Input is also offered on stdin where the backend supports it
+	stdin, _ := os.ReadFile(filepath.Join(codePath, "input.json"))
+
+	deadline, _ := ctx.Deadline()
+	id, err := backend.Run(ctx, &RunSpec{
+		Image:   rt.Image,
+		Cmd:     cmd,
+		Env:     env,
+		CodeDir: codePath,
+		Class:   class,
+		Network: network,
+		Stdin:   stdin,
+		Labels:  e.runLabels(labelExecution, output.executionID, output.apiID, deadline),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// Ensure the run is cleaned up after execution
+	defer backend.Remove(id)
+	span.SetAttribute("container_id", id)
+	if !e.track(backend, id) {
+		return nil, ErrDraining
+	}
+	defer e.untrack(id)
+
+	// Follow logs while the code runs so output streams live
+	logsDone := e.followLogs(backend, id, output)
+
+	// Wait for the run to finish or timeout
+	exitCode, err := backend.Wait(ctx, id)
+	if ctx.Err() != nil {
+		// Timeout - stop the run
+		span.SetError(ctx.Err())
+		backend.Stop(context.Background(), id)
+		waitForLogs(logsDone)
 		return &ExecutionResult{
+			Output:     output.Output(),
 			Error:      "Execution timeout exceeded",
 			StatusCode: 408,
 			ExitCode:   -1,
 		}, nil
 	}
-
-	// Get container logs
-	logs, err := e.getContainerLogs(resp.ID)
+	if e.runsWereRemoved() {
+		return nil, ErrDraining
+	}
 	if err != nil {
+		return nil, fmt.Errorf("container wait error: %w", err)
+	}
+
+	// The log stream ends once the container exits
+	if err := waitForLogs(logsDone); err != nil {
 		return &ExecutionResult{
 			Error:      fmt.Sprintf("Failed to retrieve logs: %v", err),
 			StatusCode: 500,
-			ExitCode:   int(exitCode),
+			ExitCode:   exitCode,
+		}, nil
+	}
+	logs := output.Output()
+
+	// stdout is the function's response body, so losing any of it fails the
+	// call; stderr is returned alongside but doesn't count towards the limit
+	if output.Truncated("stdout") || output.StdoutBytes() > e.limits.Result {
+		limit := e.limits.Result
+		if output.Truncated("stdout") && e.limits.Stdout < limit {
+			limit = e.limits.Stdout
+		}
+		if len(logs) > e.limits.Result+e.limits.Stderr {
+			logs = logs[:e.limits.Result+e.limits.Stderr]
+		}
+		return &ExecutionResult{
+			Output:     logs,
+			Error:      fmt.Sprintf("Response body exceeds the %d byte limit", limit),
+			StatusCode: 413,
+			ExitCode:   exitCode,
+			Truncated:  true,
 		}, nil
 	}
 
@@ -273,12 +521,15 @@ func (e *Executor) runContainer(ctx context.Context, config *runtimeConfig, code
 	result := &ExecutionResult{
 		Output:     logs,
 		StatusCode: 200,
-		ExitCode:   int(exitCode),
+		ExitCode:   exitCode,
 	}
 
 	if exitCode != 0 {
 		result.Error = "Code execution failed"
 		result.StatusCode = 500
+		if stats, err := backend.Stats(ctx, id); err == nil && stats.OOMKilled {
+			result.Error = fmt.Sprintf("Memory limit of %dMB exceeded", class.MemoryMB)
+		}
 	}
 
 	// Try to parse JSON output if it looks like JSON
@@ -293,31 +544,33 @@ func (e *Executor) runContainer(ctx context.Context, config *runtimeConfig, code
 	return result, nil
 }
 
-func (e *Executor) getContainerLogs(containerID string) (string, error) {
-	ctx := context.Background()
+// followLogs streams the run's stdout/stderr into output. The returned
+// channel yields once the stream ends.
+func (e *Executor) followLogs(backend ExecutionBackend, id string, output *outputCollector) <-chan error {
+	done := make(chan error, 1)
 
-	options := container.LogsOptions{
-		ShowStdout: true,
-		ShowStderr: true,
-		Follow:     false,
-		Tail:       "1000",
-	}
+	go func() {
+		stdout := output.writer("stdout")
+		stderr := output.writer("stderr")
 
-	reader, err := e.client.ContainerLogs(ctx, containerID, options)
-	if err != nil {
-		return "", err
-	}
-	defer reader.Close()
-
-	var buf bytes.Buffer
-	_, err = io.Copy(&buf, reader)
-	if err != nil {
-		return "", err
-	}
+		err := backend.Logs(context.Background(), id, stdout, stderr)
+		stdout.Flush()
+		stderr.Flush()
+		if errors.Is(err, errOutputLimit) {
+			err = nil
+		}
+		done <- err
+	}()
 
-	return buf.String(), nil
+	return done
 }
 
-func newInt64(i int64) *int64 {
-	return &i
+// waitForLogs waits briefly for the follow stream to drain after exit
+func waitForLogs(done <-chan error) error {
+	select {
+	case err := <-done:
+		return err
+	case <-time.After(5 * time.Second):
+		return fmt.Errorf("timed out waiting for container logs")
+	}
 }
@@ -0,0 +1,454 @@
+package runtime
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/aKaddoura96/api-hosting-execution-platform/backend/shared/logger"
+	"github.com/aKaddoura96/api-hosting-execution-platform/backend/shared/models"
+)
+
+// ImageStore records the images each node holds (implemented by
+// repository.CachedImageRepository)
+type ImageStore interface {
+	GetByNode(nodeID string) ([]*models.CachedImage, error)
+	Save(image *models.CachedImage) error
+	Delete(nodeID, image string) error
+}
+
+// imageLister is implemented by backends that keep images on the host
+// (Docker), whose cache the executor can manage
+type imageLister interface {
+	// ImageSizes returns the size of every tagged image by tag
+	ImageSizes(ctx context.Context) (map[string]int64, error)
+	RemoveImage(tag string) error
+}
+
+// ImageCacheConfig sets how long pulls may take and how many images are kept
+type ImageCacheConfig struct {
+	// PullTimeout bounds a pull, which runs apart from the timeout of the
+	// execution waiting for it
+	PullTimeout time.Duration
+	// BudgetBytes is the disk the images may take before the least recently
+	// used are removed; zero keeps them all
+	BudgetBytes int64
+	// RetainPerAPI is how many custom images of an API are kept, the one it
+	// runs included
+	RetainPerAPI int
+	Interval     time.Duration
+}
+
+// ImageCacheConfigFromEnv reads IMAGE_PULL_TIMEOUT (default 10m),
+// IMAGE_CACHE_BUDGET_MB (20480, 0 for no limit), IMAGE_CACHE_RETAIN_PER_API
+// (2) and IMAGE_CACHE_INTERVAL (10m)
+func ImageCacheConfigFromEnv() (ImageCacheConfig, error) {
+	config := ImageCacheConfig{
+		PullTimeout:  10 * time.Minute,
+		BudgetBytes:  20480 << 20,
+		RetainPerAPI: 2,
+		Interval:     10 * time.Minute,
+	}
+
+	for name, d := range map[string]*time.Duration{
+		"IMAGE_PULL_TIMEOUT":   &config.PullTimeout,
+		"IMAGE_CACHE_INTERVAL": &config.Interval,
+	} {
+		v := os.Getenv(name)
+		if v == "" {
+			continue
+		}
+		parsed, err := time.ParseDuration(v)
+		if err != nil || parsed <= 0 {
+			return config, fmt.Errorf("invalid %s: %q", name, v)
+		}
+		*d = parsed
+	}
+	if v := os.Getenv("IMAGE_CACHE_BUDGET_MB"); v != "" {
+		mb, err := strconv.Atoi(v)
+		if err != nil || mb < 0 {
+			return config, fmt.Errorf("invalid IMAGE_CACHE_BUDGET_MB: %q", v)
+		}
+		config.BudgetBytes = int64(mb) << 20
+	}
+	if v := os.Getenv("IMAGE_CACHE_RETAIN_PER_API"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 {
+			return config, fmt.Errorf("invalid IMAGE_CACHE_RETAIN_PER_API: %q", v)
+		}
+		config.RetainPerAPI = n
+	}
+
+	return config, nil
+}
+
+// imageCache shares pulls between the executions waiting for an image and,
+// once EnableImageCache is called, tracks the images the node holds
+type imageCache struct {
+	config ImageCacheConfig
+
+	mu    sync.Mutex
+	pulls map[string]*imagePull // in progress, by image
+	held  map[string]*models.CachedImage
+
+	// Set by EnableImageCache
+	nodeID string
+	store  ImageStore
+	lister imageLister
+}
+
+type imagePull struct {
+	done chan struct{}
+	err  error
+}
+
+func newImageCache(config ImageCacheConfig) *imageCache {
+	return &imageCache{
+		config: config,
+		pulls:  make(map[string]*imagePull),
+		held:   make(map[string]*models.CachedImage),
+	}
+}
+
+// pull makes image available on backend. Callers waiting for the same image
+// share one pull, which runs for up to PullTimeout whatever happens to them:
+// a caller whose ctx ends stops waiting, but the pull goes on for the next.
+func (c *imageCache) pull(ctx context.Context, backend ExecutionBackend, image string) error {
+	c.mu.Lock()
+	p, ok := c.pulls[image]
+	if !ok {
+		p = &imagePull{done: make(chan struct{})}
+		c.pulls[image] = p
+		go c.runPull(context.WithoutCancel(ctx), backend, image, p)
+	}
+	c.mu.Unlock()
+
+	select {
+	case <-p.done:
+		return p.err
+	case <-ctx.Done():
+		return fmt.Errorf("gave up waiting for image %s: %w", image, ctx.Err())
+	}
+}
+
+func (c *imageCache) runPull(ctx context.Context, backend ExecutionBackend, image string, p *imagePull) {
+	ctx, cancel := context.WithTimeout(ctx, c.config.PullTimeout)
+	defer cancel()
+
+	p.err = backend.Prepare(ctx, image)
+	if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		p.err = fmt.Errorf("pull of image %s timed out after %s", image, c.config.PullTimeout)
+	}
+
+	c.mu.Lock()
+	delete(c.pulls, image)
+	c.mu.Unlock()
+	if p.err == nil {
+		c.touch(image)
+	}
+	close(p.done)
+}
+
+// touch records that image was just pulled, built or run
+func (c *imageCache) touch(image string) {
+	if image == "" {
+		return
+	}
+	image = imageTag(image)
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.lister == nil {
+		return
+	}
+	held, ok := c.held[image]
+	if !ok {
+		held = &models.CachedImage{NodeID: c.nodeID, Image: image, APIID: customImageAPI(image)}
+		c.held[image] = held
+	}
+	held.LastUsedAt = time.Now()
+}
+
+// EnableImageCache keeps track of the images this node pulls and builds,
+// recording them in store with when each last ran. Every interval
+// RunImageCache removes the custom images of an API beyond RetainPerAPI and
+// then, while the images take more than BudgetBytes, the least recently
+// used. Images of enabled runtimes are never removed, nor are images the
+// executor didn't pull or build. Only backends that keep images on the host
+// (Docker) support it.
+func (e *Executor) EnableImageCache(nodeID string, store ImageStore) error {
+	lister, ok := e.backend.(imageLister)
+	if !ok {
+		return fmt.Errorf("the %s backend does not keep images", e.backend.Name())
+	}
+
+	// A node restarting picks up where it left off
+	recorded, err := store.GetByNode(nodeID)
+	if err != nil {
+		return fmt.Errorf("failed to load cached images: %w", err)
+	}
+
+	c := e.images
+	c.mu.Lock()
+	c.nodeID = nodeID
+	c.store = store
+	c.lister = lister
+	for _, image := range recorded {
+		c.held[image.Image] = image
+	}
+	c.mu.Unlock()
+	return nil
+}
+
+// PrepullImages pulls the images of the enabled runtimes this node runs, so
+// their first executions don't wait for a pull. Failures are logged.
+func (e *Executor) PrepullImages(ctx context.Context) {
+	if e.runtimes == nil {
+		return
+	}
+	enabled, err := e.runtimes.store.GetEnabled("")
+	if err != nil {
+		logger.Error("Failed to list runtimes to pre-pull", map[string]interface{}{"error": err.Error()})
+		return
+	}
+
+	start := time.Now()
+	pulled := 0
+	for _, rt := range enabled {
+		if rt.Engine == models.EngineWASM || rt.Name == models.RuntimeCustom || !e.canRun(rt) {
+			continue
+		}
+		if err := e.images.pull(ctx, e.backend, rt.Image); err != nil {
+			if ctx.Err() != nil {
+				return
+			}
+			logger.Warn("Failed to pre-pull runtime image", map[string]interface{}{
+				"runtime": rt.Name,
+				"image":   rt.Image,
+				"error":   err.Error(),
+			})
+			continue
+		}
+		pulled++
+	}
+	logger.Info("Runtime images pre-pulled", map[string]interface{}{
+		"images":      pulled,
+		"duration_ms": time.Since(start).Milliseconds(),
+	})
+}
+
+// PrepullRuntime pulls a runtime's image in the background, for an API just
+// deployed with it. Custom images are built by StartCustomImageBuild instead.
+func (e *Executor) PrepullRuntime(name string) error {
+	rt, err := e.getRuntime(name)
+	if err != nil {
+		return err
+	}
+	if rt.Engine == models.EngineWASM || rt.Name == models.RuntimeCustom {
+		return nil
+	}
+
+	go func() {
+		if err := e.images.pull(context.Background(), e.backend, rt.Image); err != nil {
+			logger.Warn("Failed to pre-pull runtime image", map[string]interface{}{
+				"runtime": rt.Name,
+				"image":   rt.Image,
+				"error":   err.Error(),
+			})
+		}
+	}()
+	return nil
+}
+
+// RunImageCache sweeps the images every interval until ctx is cancelled. It
+// returns at once if EnableImageCache wasn't called.
+func (e *Executor) RunImageCache(ctx context.Context) {
+	e.images.mu.Lock()
+	enabled := e.images.store != nil
+	e.images.mu.Unlock()
+	if !enabled {
+		return
+	}
+
+	ticker := time.NewTicker(e.images.config.Interval)
+	defer ticker.Stop()
+
+	for {
+		e.sweepImages(ctx)
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// sweepImages applies the retention and the budget, then records what the
+// node holds
+func (e *Executor) sweepImages(ctx context.Context) {
+	c := e.images
+
+	sizes, err := c.lister.ImageSizes(ctx)
+	if err != nil {
+		logger.Error("Failed to list images", map[string]interface{}{"error": err.Error()})
+		return
+	}
+	// Without the runtimes nothing is known to be safe to remove
+	pinned, err := e.runtimeImages()
+	if err != nil {
+		logger.Error("Failed to list runtime images", map[string]interface{}{"error": err.Error()})
+		return
+	}
+
+	// Images removed by hand, or never pulled, are forgotten
+	c.mu.Lock()
+	var held, gone []*models.CachedImage
+	for tag, image := range c.held {
+		size, ok := sizes[tag]
+		if !ok {
+			gone = append(gone, image)
+			delete(c.held, tag)
+			continue
+		}
+		image.SizeBytes = size
+		image.Pinned = pinned[tag]
+		copied := *image
+		held = append(held, &copied)
+	}
+	c.mu.Unlock()
+
+	// Most recently used first
+	sort.Slice(held, func(i, j int) bool {
+		return held[i].LastUsedAt.After(held[j].LastUsedAt)
+	})
+
+	remove := func(image *models.CachedImage, reason string) bool {
+		fields := map[string]interface{}{
+			"image":      image.Image,
+			"size_bytes": image.SizeBytes,
+			"last_used":  image.LastUsedAt,
+			"reason":     reason,
+		}
+		// Images still used by a container are refused
+		if err := c.lister.RemoveImage(image.Image); err != nil {
+			fields["error"] = err.Error()
+			logger.Warn("Failed to remove cached image", fields)
+			return false
+		}
+		logger.Info("Removed cached image", fields)
+		gone = append(gone, image)
+		return true
+	}
+
+	// The custom images of an API beyond the retention, besides the one it
+	// runs; none go while that one can't be looked up
+	current := make(map[string]string)
+	others := make(map[string]int)
+	var retained []*models.CachedImage
+	for _, image := range held {
+		if apiID := image.APIID; apiID != "" {
+			if _, ok := current[apiID]; !ok {
+				current[apiID] = e.currentCustomImage(apiID)
+			}
+			if image.Image != current[apiID] {
+				if current[apiID] != "" && others[apiID] >= c.config.RetainPerAPI-1 &&
+					remove(image, "beyond the API's retention") {
+					continue
+				}
+				others[apiID]++
+			}
+		}
+		retained = append(retained, image)
+	}
+
+	// Then the least recently used while over budget
+	var total int64
+	for _, image := range retained {
+		total += image.SizeBytes
+	}
+	held = nil
+	for i := len(retained) - 1; i >= 0; i-- {
+		image := retained[i]
+		if c.config.BudgetBytes > 0 && total > c.config.BudgetBytes && !image.Pinned &&
+			remove(image, "least recently used over the disk budget") {
+			total -= image.SizeBytes
+			continue
+		}
+		held = append(held, image)
+	}
+
+	c.mu.Lock()
+	for _, image := range gone {
+		delete(c.held, image.Image)
+	}
+	c.mu.Unlock()
+
+	for _, image := range gone {
+		if err := c.store.Delete(c.nodeID, image.Image); err != nil {
+			logger.Error("Failed to delete cached image record", map[string]interface{}{"image": image.Image, "error": err.Error()})
+		}
+	}
+	for _, image := range held {
+		if err := c.store.Save(image); err != nil {
+			logger.Error("Failed to record cached image", map[string]interface{}{"image": image.Image, "error": err.Error()})
+		}
+	}
+}
+
+// runtimeImages returns the images of the enabled runtimes by tag
+func (e *Executor) runtimeImages() (map[string]bool, error) {
+	images := make(map[string]bool)
+	if e.runtimes == nil {
+		return images, nil
+	}
+	enabled, err := e.runtimes.store.GetEnabled("")
+	if err != nil {
+		return nil, err
+	}
+	for _, rt := range enabled {
+		if rt.Image != "" {
+			images[imageTag(rt.Image)] = true
+		}
+	}
+	return images, nil
+}
+
+// currentCustomImage returns the image an API with the custom runtime runs,
+// or "" if it can't be looked up
+func (e *Executor) currentCustomImage(apiID string) string {
+	if e.imageStore == nil {
+		return ""
+	}
+	img, err := e.imageStore.GetByAPIID(apiID)
+	if err != nil {
+		return ""
+	}
+	return img.Image
+}
+
+// imageTag is how the host lists an image reference: with :latest if it
+// names no tag or digest
+func imageTag(image string) string {
+	name := image[strings.LastIndex(image, "/")+1:]
+	if strings.ContainsAny(name, ":@") {
+		return image
+	}
+	return image + ":latest"
+}
+
+// customImageAPI returns the API a custom image was built for, or "" for
+// any other image
+func customImageAPI(image string) string {
+	rest, ok := strings.CutPrefix(image, "apiplatform-custom/")
+	if !ok {
+		return ""
+	}
+	apiID, _, _ := strings.Cut(rest, ":")
+	return apiID
+}
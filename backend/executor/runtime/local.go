@@ -0,0 +1,208 @@
+package runtime
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"os/exec"
+	"sync"
+
+	"github.com/aKaddoura96/api-hosting-execution-platform/backend/shared/models"
+	"github.com/google/uuid"
+)
+
+// LocalBackend runs code as a plain process on the executor's host. There is
+// no isolation, resource limit or network restriction beyond the timeout, so
+// it is only for development and tests on machines without Docker.
+type LocalBackend struct {
+	mu    sync.Mutex
+	procs map[string]*localProcess
+}
+
+type localProcess struct {
+	cmd    *exec.Cmd
+	stdout *io.PipeReader
+	stderr *io.PipeReader
+	done   chan struct{} // closed once the process has exited
+	err    error         // from cmd.Wait, set before done is closed
+}
+
+func NewLocalBackend() *LocalBackend {
+	return &LocalBackend{procs: make(map[string]*localProcess)}
+}
+
+func (l *LocalBackend) Name() string {
+	return "local"
+}
+
+// Prepare does nothing; the runtime's interpreter must be installed on the host
+func (l *LocalBackend) Prepare(ctx context.Context, image string) error {
+	return nil
+}
+
+// CanRun reports whether the runtime's interpreter is installed on the host
+func (l *LocalBackend) CanRun(rt *models.Runtime) bool {
+	if len(rt.RunCommand) == 0 {
+		return false
+	}
+	if _, err := exec.LookPath(rt.RunCommand[0]); err != nil {
+		return false
+	}
+	if rt.BuildCommand != "" {
+		_, err := exec.LookPath("sh")
+		return err == nil
+	}
+	return true
+}
+
+// Run starts spec.Cmd in the code directory with the host environment plus
+// spec.Env and spec.Stdin on standard input
+func (l *LocalBackend) Run(ctx context.Context, spec *RunSpec) (string, error) {
+	if len(spec.Cmd) == 0 {
+		return "", fmt.Errorf("no command to run")
+	}
+
+	cmd := exec.Command(spec.Cmd[0], spec.Cmd[1:]...)
+	cmd.Dir = spec.CodeDir
+	cmd.Env = append(os.Environ(), spec.Env...)
+	cmd.Stdin = bytes.NewReader(spec.Stdin)
+
+	stdout, stdoutWriter := io.Pipe()
+	stderr, stderrWriter := io.Pipe()
+	cmd.Stdout = stdoutWriter
+	cmd.Stderr = stderrWriter
+
+	if err := cmd.Start(); err != nil {
+		return "", fmt.Errorf("failed to start process: %w", err)
+	}
+
+	proc := &localProcess{cmd: cmd, stdout: stdout, stderr: stderr, done: make(chan struct{})}
+	go func() {
+		proc.err = cmd.Wait()
+		stdoutWriter.Close()
+		stderrWriter.Close()
+		close(proc.done)
+	}()
+
+	id := "local-" + uuid.New().String()
+	l.mu.Lock()
+	l.procs[id] = proc
+	l.mu.Unlock()
+
+	return id, nil
+}
+
+// StartServer runs a replica listening on a free port of the loopback
+// interface
+func (l *LocalBackend) StartServer(ctx context.Context, spec *RunSpec) (string, string, error) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return "", "", fmt.Errorf("failed to find a free port: %w", err)
+	}
+	addr := listener.Addr().String()
+	listener.Close()
+
+	_, port, _ := net.SplitHostPort(addr)
+	server := *spec
+	server.Env = append(append([]string{}, spec.Env...), "PORT="+port)
+
+	id, err := l.Run(ctx, &server)
+	if err != nil {
+		return "", "", err
+	}
+	return id, addr, nil
+}
+
+func (l *LocalBackend) process(id string) (*localProcess, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	proc, ok := l.procs[id]
+	if !ok {
+		return nil, fmt.Errorf("no such process: %s", id)
+	}
+	return proc, nil
+}
+
+func (l *LocalBackend) Wait(ctx context.Context, id string) (int, error) {
+	proc, err := l.process(id)
+	if err != nil {
+		return 0, err
+	}
+
+	select {
+	case <-proc.done:
+	case <-ctx.Done():
+		return 0, ctx.Err()
+	}
+
+	var exitErr *exec.ExitError
+	if proc.err != nil && !errors.As(proc.err, &exitErr) {
+		return 0, proc.err
+	}
+	return proc.cmd.ProcessState.ExitCode(), nil
+}
+
+// Logs copies the process's output until it exits
+func (l *LocalBackend) Logs(ctx context.Context, id string, stdout, stderr io.Writer) error {
+	proc, err := l.process(id)
+	if err != nil {
+		return err
+	}
+
+	return copyOutput(stdout, stderr, proc.stdout, proc.stderr)
+}
+
+// Stats reports the CPU time the process used
+func (l *LocalBackend) Stats(ctx context.Context, id string) (*RunStats, error) {
+	proc, err := l.process(id)
+	if err != nil {
+		return nil, err
+	}
+
+	select {
+	case <-proc.done:
+	default:
+		return nil, fmt.Errorf("process %s is still running", id)
+	}
+
+	state := proc.cmd.ProcessState
+	return &RunStats{CPUTime: state.UserTime() + state.SystemTime()}, nil
+}
+
+func (l *LocalBackend) Stop(ctx context.Context, id string) error {
+	proc, err := l.process(id)
+	if err != nil {
+		return err
+	}
+
+	select {
+	case <-proc.done:
+		return nil
+	default:
+	}
+	if err := proc.cmd.Process.Kill(); err != nil && !errors.Is(err, os.ErrProcessDone) {
+		return err
+	}
+	<-proc.done
+	return nil
+}
+
+// Remove kills the process if it is still running and forgets it
+func (l *LocalBackend) Remove(id string) error {
+	if err := l.Stop(context.Background(), id); err != nil {
+		return err
+	}
+
+	l.mu.Lock()
+	delete(l.procs, id)
+	l.mu.Unlock()
+	return nil
+}
+
+func (l *LocalBackend) Close() error {
+	return nil
+}
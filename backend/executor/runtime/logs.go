@@ -0,0 +1,336 @@
+package runtime
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/aKaddoura96/api-hosting-execution-platform/backend/shared/models"
+)
+
+const (
+	// maxPersistedLines caps the log lines stored per execution
+	maxPersistedLines = 10000
+	// maxLineBytes splits pathological output without newlines
+	maxLineBytes = 64 * 1024
+	// maxStreamBytes caps the output forwarded to a streaming client
+	maxStreamBytes = 10 * 1024 * 1024
+)
+
+// OutputLimits caps how much output one execution may produce
+type OutputLimits struct {
+	Stdout int // bytes of stdout read from the container
+	Stderr int // bytes of stderr read from the container
+	Result int // bytes of output returned as the response body
+}
+
+// OutputLimitsFromEnv reads OUTPUT_MAX_STDOUT_BYTES, OUTPUT_MAX_STDERR_BYTES
+// and OUTPUT_MAX_RESULT_BYTES, each defaulting to 1MB
+func OutputLimitsFromEnv() (OutputLimits, error) {
+	limits := OutputLimits{Stdout: 1 << 20, Stderr: 1 << 20, Result: 1 << 20}
+	for name, limit := range map[string]*int{
+		"OUTPUT_MAX_STDOUT_BYTES": &limits.Stdout,
+		"OUTPUT_MAX_STDERR_BYTES": &limits.Stderr,
+		"OUTPUT_MAX_RESULT_BYTES": &limits.Result,
+	} {
+		v := os.Getenv(name)
+		if v == "" {
+			continue
+		}
+		n, err := strconv.Atoi(v)
+		if err != nil || n <= 0 {
+			return limits, fmt.Errorf("invalid %s: %q", name, v)
+		}
+		*limit = n
+	}
+	return limits, nil
+}
+
+// errOutputLimit ends the log stream once every stream has hit its limit
+var errOutputLimit = errors.New("output limit reached")
+
+// OutputFunc receives raw output chunks as the container produces them
+type OutputFunc func(stream string, chunk []byte)
+
+// LogStore persists execution output (implemented by repository.ExecutionLogRepository)
+type LogStore interface {
+	CreateBatch(logs []*models.ExecutionLog) error
+}
+
+// LogHub fans out live log lines to subscribers, keyed by API ID
+type LogHub struct {
+	mu          sync.Mutex
+	subscribers map[string]map[chan *models.ExecutionLog]struct{}
+}
+
+// NewLogHub creates an empty hub
+func NewLogHub() *LogHub {
+	return &LogHub{subscribers: make(map[string]map[chan *models.ExecutionLog]struct{})}
+}
+
+// Subscribe returns a channel of live lines for an API and a function to stop
+// receiving them. Slow subscribers miss lines rather than block executions.
+func (h *LogHub) Subscribe(apiID string) (<-chan *models.ExecutionLog, func()) {
+	ch := make(chan *models.ExecutionLog, 256)
+
+	h.mu.Lock()
+	if h.subscribers[apiID] == nil {
+		h.subscribers[apiID] = make(map[chan *models.ExecutionLog]struct{})
+	}
+	h.subscribers[apiID][ch] = struct{}{}
+	h.mu.Unlock()
+
+	var once sync.Once
+	return ch, func() {
+		once.Do(func() {
+			h.mu.Lock()
+			delete(h.subscribers[apiID], ch)
+			if len(h.subscribers[apiID]) == 0 {
+				delete(h.subscribers, apiID)
+			}
+			h.mu.Unlock()
+		})
+	}
+}
+
+// Publish delivers a line to every subscriber of its API
+func (h *LogHub) Publish(line *models.ExecutionLog) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	for ch := range h.subscribers[line.APIID] {
+		select {
+		case ch <- line:
+		default:
+		}
+	}
+}
+
+// outputCollector gathers the output of one execution as it is produced
+type outputCollector struct {
+	executionID string
+	apiID       string
+	hub         *LogHub
+
+	onOutput OutputFunc // set for streaming executions
+	limits   OutputLimits
+
+	mu              sync.Mutex
+	lines           []string // returned inline, bounded by the stream limits
+	stdoutBytes     int      // of lines, the response body
+	persisted       []*models.ExecutionLog
+	streamed        int
+	streamTruncated bool
+	truncated       map[string]bool // streams that hit their limit
+}
+
+func newOutputCollector(executionID, apiID string, hub *LogHub, onOutput OutputFunc, limits OutputLimits) *outputCollector {
+	return &outputCollector{
+		executionID: executionID,
+		apiID:       apiID,
+		hub:         hub,
+		onOutput:    onOutput,
+		limits:      limits,
+		truncated:   make(map[string]bool),
+	}
+}
+
+// truncate records that stream hit its limit and reports whether every
+// stream has, so reading can stop
+func (c *outputCollector) truncate(stream string) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.truncated[stream] = true
+	return c.truncated["stdout"] && c.truncated["stderr"]
+}
+
+// Truncated reports whether stream was cut off at its limit; an empty stream
+// name asks about either
+func (c *outputCollector) Truncated(stream string) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if stream == "" {
+		return len(c.truncated) > 0
+	}
+	return c.truncated[stream]
+}
+
+// forward passes a raw chunk to the streaming client until maxStreamBytes
+func (c *outputCollector) forward(stream string, chunk []byte) {
+	if c.onOutput == nil {
+		return
+	}
+
+	c.mu.Lock()
+	if c.streamTruncated || c.streamed+len(chunk) > maxStreamBytes {
+		c.streamTruncated = true
+		c.mu.Unlock()
+		return
+	}
+	c.streamed += len(chunk)
+	c.mu.Unlock()
+
+	c.onOutput(stream, chunk)
+}
+
+// StreamTruncated reports whether streamed output hit maxStreamBytes
+func (c *outputCollector) StreamTruncated() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.streamTruncated
+}
+
+func (c *outputCollector) emit(stream, message string) {
+	line := &models.ExecutionLog{
+		ExecutionID: c.executionID,
+		APIID:       c.apiID,
+		Stream:      stream,
+		Level:       detectLevel(stream, message),
+		Message:     message,
+		LoggedAt:    time.Now(),
+	}
+
+	c.mu.Lock()
+	c.lines = append(c.lines, message)
+	if stream == "stdout" {
+		c.stdoutBytes += len(message) + 1
+	}
+	if c.apiID != "" && len(c.persisted) < maxPersistedLines {
+		c.persisted = append(c.persisted, line)
+	}
+	c.mu.Unlock()
+
+	if c.apiID != "" && c.hub != nil {
+		c.hub.Publish(line)
+	}
+}
+
+// Output returns the retained output joined back into a single string
+func (c *outputCollector) Output() string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if len(c.lines) == 0 {
+		return ""
+	}
+	return strings.Join(c.lines, "\n") + "\n"
+}
+
+// StdoutBytes returns how much of the output came from stdout
+func (c *outputCollector) StdoutBytes() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.stdoutBytes
+}
+
+// Persisted returns the lines to be stored for this execution
+func (c *outputCollector) Persisted() []*models.ExecutionLog {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.persisted
+}
+
+// writer returns an io.Writer that splits a stream into lines, stopping at
+// the stream's limit
+func (c *outputCollector) writer(stream string) *lineWriter {
+	limit := c.limits.Stdout
+	if stream == "stderr" {
+		limit = c.limits.Stderr
+	}
+	return &lineWriter{stream: stream, limit: limit, emit: c.emit, forward: c.forward, truncate: c.truncate}
+}
+
+// lineWriter turns a byte stream into individual lines
+type lineWriter struct {
+	stream   string
+	buf      []byte
+	emit     func(stream, line string)
+	forward  func(stream string, chunk []byte) // raw chunks, before line splitting
+	truncate func(stream string) bool
+
+	limit   int // 0 is unlimited
+	written int
+	full    bool
+}
+
+// Write accepts output up to the limit. Past it a marker line is emitted once
+// and the rest discarded; errOutputLimit is returned once no stream has room.
+func (w *lineWriter) Write(p []byte) (int, error) {
+	if w.full {
+		return len(p), nil
+	}
+	n := len(p)
+	if w.limit > 0 && w.written+len(p) > w.limit {
+		p = p[:w.limit-w.written]
+		w.full = true
+	}
+	w.written += len(p)
+
+	if err := w.write(p); err != nil || !w.full {
+		return n, err
+	}
+
+	w.Flush()
+	w.emit(w.stream, fmt.Sprintf("[%s truncated at %d bytes]", w.stream, w.limit))
+	if w.truncate(w.stream) {
+		return n, errOutputLimit
+	}
+	return n, nil
+}
+
+func (w *lineWriter) write(p []byte) error {
+	if len(p) == 0 {
+		return nil
+	}
+	if w.forward != nil {
+		w.forward(w.stream, p)
+	}
+
+	w.buf = append(w.buf, p...)
+	for {
+		i := bytes.IndexByte(w.buf, '\n')
+		if i < 0 {
+			break
+		}
+		w.emit(w.stream, strings.TrimSuffix(string(w.buf[:i]), "\r"))
+		w.buf = w.buf[i+1:]
+	}
+	if len(w.buf) >= maxLineBytes {
+		w.emit(w.stream, string(w.buf))
+		w.buf = nil
+	}
+	return nil
+}
+
+// Flush emits any trailing output that had no final newline
+func (w *lineWriter) Flush() {
+	if len(w.buf) > 0 {
+		w.emit(w.stream, string(w.buf))
+		w.buf = nil
+	}
+}
+
+// detectLevel infers a level from common prefixes, falling back to the stream
+func detectLevel(stream, line string) string {
+	upper := strings.ToUpper(strings.TrimLeft(line, " \t[<"))
+	switch {
+	case strings.HasPrefix(upper, "ERROR"), strings.HasPrefix(upper, "FATAL"),
+		strings.HasPrefix(upper, "CRITICAL"), strings.HasPrefix(upper, "TRACEBACK"):
+		return "error"
+	case strings.HasPrefix(upper, "WARN"):
+		return "warn"
+	case strings.HasPrefix(upper, "INFO"):
+		return "info"
+	case strings.HasPrefix(upper, "DEBUG"), strings.HasPrefix(upper, "TRACE"):
+		return "debug"
+	}
+
+	if stream == "stderr" {
+		return "error"
+	}
+	return "info"
+}
@@ -0,0 +1,284 @@
+package runtime
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"time"
+
+	"github.com/aKaddoura96/api-hosting-execution-platform/backend/shared/logger"
+	"github.com/aKaddoura96/api-hosting-execution-platform/backend/shared/models"
+)
+
+// Labels on the containers the executor creates, by which the reaper finds
+// those an executor crash left behind
+const (
+	labelManagedBy = "managed-by"
+	labelNode      = "api-platform.node-id"
+	labelAPI       = "api-platform.api-id"
+	labelExecution = "api-platform.execution-id"
+	labelReplica   = "api-platform.replica-id"
+	labelCreated   = "api-platform.created-at"
+	labelDeadline  = "api-platform.deadline" // none on replicas
+)
+
+// reapGrace is how long past its deadline a run is left to the execution
+// that started it, which stops and removes it itself
+const reapGrace = time.Minute
+
+// NodeStore lists the executor nodes with a recent heartbeat (implemented by
+// repository.ExecutorNodeRepository)
+type NodeStore interface {
+	GetLive(maxAge time.Duration) ([]*models.ExecutorNode, error)
+}
+
+// ReaperConfig sets how often orphaned runs are looked for and when a node
+// counts as gone
+type ReaperConfig struct {
+	Interval time.Duration
+	// DeadNodeAfter is how long a node must be missing from the registry
+	// before its runs are removed; a node evicted by a gateway registers
+	// again with its next heartbeat
+	DeadNodeAfter time.Duration
+}
+
+// ReaperConfigFromEnv reads REAPER_INTERVAL (default 1m) and
+// REAPER_DEAD_NODE_AFTER (2m)
+func ReaperConfigFromEnv() (ReaperConfig, error) {
+	config := ReaperConfig{
+		Interval:      time.Minute,
+		DeadNodeAfter: 2 * time.Minute,
+	}
+
+	for name, d := range map[string]*time.Duration{
+		"REAPER_INTERVAL":        &config.Interval,
+		"REAPER_DEAD_NODE_AFTER": &config.DeadNodeAfter,
+	} {
+		v := os.Getenv(name)
+		if v == "" {
+			continue
+		}
+		parsed, err := time.ParseDuration(v)
+		if err != nil || parsed <= 0 {
+			return config, fmt.Errorf("invalid %s: %q", name, v)
+		}
+		*d = parsed
+	}
+
+	return config, nil
+}
+
+// reaper removes the runs and code directories that no execution will clean
+// up: those of a previous run of this node, those of nodes that are gone and
+// runs well past their deadline
+type reaper struct {
+	executor *Executor
+	lister   runLister // nil if the backend's runs end with the executor
+	nodeID   string
+	config   ReaperConfig
+	nodes    NodeStore
+	started  time.Time
+
+	// missing is when each node was first seen missing from the registry
+	missing map[string]time.Time
+}
+
+// EnableReaper labels runs with nodeID and keeps code directories under a
+// directory of the node's own, which is emptied now: whatever a previous run
+// of the node left there is no longer in use. RunReaper then looks for
+// orphaned runs and directories. Call it before the executor runs anything.
+func (e *Executor) EnableReaper(nodeID string, config ReaperConfig, nodes NodeStore) error {
+	workDir := filepath.Join(workRoot(), nodeDirName(nodeID))
+	if err := os.RemoveAll(workDir); err != nil {
+		return fmt.Errorf("failed to clear work directory: %w", err)
+	}
+	if err := os.MkdirAll(workDir, 0755); err != nil {
+		return fmt.Errorf("failed to create work directory: %w", err)
+	}
+	e.nodeID = nodeID
+	e.workDir = workDir
+
+	r := &reaper{
+		executor: e,
+		nodeID:   nodeID,
+		config:   config,
+		nodes:    nodes,
+		started:  time.Now(),
+		missing:  make(map[string]time.Time),
+	}
+	r.lister, _ = e.backend.(runLister)
+	e.reaper = r
+	return nil
+}
+
+// RunReaper looks for orphaned runs and directories every interval until ctx
+// is cancelled. It returns at once if EnableReaper wasn't called.
+func (e *Executor) RunReaper(ctx context.Context) {
+	if e.reaper != nil {
+		e.reaper.run(ctx)
+	}
+}
+
+// runLabels labels a run of apiID as kind (labelExecution or labelReplica)
+// id; deadline is zero for runs without one
+func (e *Executor) runLabels(kind, id, apiID string, deadline time.Time) map[string]string {
+	labels := map[string]string{
+		labelManagedBy: "api-platform",
+		labelNode:      e.nodeID,
+		labelAPI:       apiID,
+		kind:           id,
+		labelCreated:   time.Now().UTC().Format(time.RFC3339),
+	}
+	if !deadline.IsZero() {
+		labels[labelDeadline] = deadline.UTC().Format(time.RFC3339)
+	}
+	return labels
+}
+
+// tracking reports whether the run is one this executor is running
+func (e *Executor) tracking(id string) bool {
+	e.runsMu.Lock()
+	defer e.runsMu.Unlock()
+	_, ok := e.runs[id]
+	return ok
+}
+
+func (r *reaper) run(ctx context.Context) {
+	ticker := time.NewTicker(r.config.Interval)
+	defer ticker.Stop()
+
+	for {
+		r.sweep(ctx)
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (r *reaper) sweep(ctx context.Context) {
+	now := time.Now()
+
+	// Without the registry no node is taken for gone
+	live, err := r.liveNodes()
+	if err != nil {
+		logger.Error("Failed to list executor nodes for the reaper", map[string]interface{}{"error": err.Error()})
+	}
+
+	if r.lister != nil {
+		runs, err := r.lister.LabelledRuns(ctx)
+		if err != nil {
+			logger.Error("Failed to list runs for the reaper", map[string]interface{}{"error": err.Error()})
+		}
+		for _, run := range runs {
+			reason := r.orphaned(run, live, now)
+			if reason == "" {
+				continue
+			}
+			fields := map[string]interface{}{
+				"run_id":  run.ID,
+				"node_id": run.Labels[labelNode],
+				"api_id":  run.Labels[labelAPI],
+				"reason":  reason,
+			}
+			if err := r.executor.backend.Remove(run.ID); err != nil {
+				fields["error"] = err.Error()
+				logger.Error("Failed to remove orphaned run", fields)
+				continue
+			}
+			logger.Warn("Removed orphaned run", fields)
+		}
+	}
+
+	// Other nodes sharing this host leave their directories next to ours
+	entries, err := os.ReadDir(workRoot())
+	if err != nil {
+		return
+	}
+	for _, entry := range entries {
+		name := entry.Name()
+		if !entry.IsDir() || name == nodeDirName(r.nodeID) || !r.gone(name, live, now) {
+			continue
+		}
+		if err := os.RemoveAll(filepath.Join(workRoot(), name)); err != nil {
+			logger.Error("Failed to remove work directory of a node that is gone", map[string]interface{}{
+				"directory": name,
+				"error":     err.Error(),
+			})
+		}
+	}
+}
+
+// orphaned returns why run is to be removed, or "" if it is not
+func (r *reaper) orphaned(run LabelledRun, live map[string]bool, now time.Time) string {
+	node := run.Labels[labelNode]
+	if node == r.nodeID && r.executor.tracking(run.ID) {
+		return ""
+	}
+
+	if deadline, err := time.Parse(time.RFC3339, run.Labels[labelDeadline]); err == nil && now.After(deadline.Add(reapGrace)) {
+		return "past its deadline"
+	}
+	if node == "" {
+		return ""
+	}
+	if node == r.nodeID {
+		created, err := time.Parse(time.RFC3339, run.Labels[labelCreated])
+		// Labels are to the second, so only runs well before this one count
+		if err == nil && created.Before(r.started.Add(-time.Second)) {
+			return "left by a previous run of this node"
+		}
+		return ""
+	}
+	if r.gone(nodeDirName(node), live, now) {
+		return "its node is gone"
+	}
+	return ""
+}
+
+// gone reports whether the node has been missing from the registry for
+// DeadNodeAfter; nodes are compared by nodeDirName. A nil live set counts
+// every node as present.
+func (r *reaper) gone(node string, live map[string]bool, now time.Time) bool {
+	if live == nil || live[node] {
+		delete(r.missing, node)
+		return false
+	}
+	since, ok := r.missing[node]
+	if !ok {
+		r.missing[node] = now
+		return false
+	}
+	return now.Sub(since) >= r.config.DeadNodeAfter
+}
+
+// liveNodes returns the registered nodes by nodeDirName. Any heartbeat in
+// DeadNodeAfter counts, so the only nodes missing are those that are gone
+// or were evicted.
+func (r *reaper) liveNodes() (map[string]bool, error) {
+	nodes, err := r.nodes.GetLive(r.config.DeadNodeAfter)
+	if err != nil {
+		return nil, err
+	}
+	live := make(map[string]bool, len(nodes)+1)
+	live[nodeDirName(r.nodeID)] = true
+	for _, node := range nodes {
+		live[nodeDirName(node.ID)] = true
+	}
+	return live, nil
+}
+
+// workRoot holds a work directory per node
+func workRoot() string {
+	return filepath.Join(os.TempDir(), "api-platform-executor")
+}
+
+var unsafeDirChars = regexp.MustCompile(`[^A-Za-z0-9._-]`)
+
+// nodeDirName is the name of a node's work directory
+func nodeDirName(nodeID string) string {
+	return unsafeDirChars.ReplaceAllString(nodeID, "_")
+}
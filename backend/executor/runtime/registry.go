@@ -0,0 +1,69 @@
+package runtime
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/aKaddoura96/api-hosting-execution-platform/backend/shared/models"
+)
+
+// runtimeCacheTTL is how long a registry entry is used before it is looked up
+// again, so runtimes added or changed in the database apply without a restart
+const runtimeCacheTTL = 30 * time.Second
+
+// RuntimeStore supplies runtime definitions (implemented by repository.RuntimeRepository)
+type RuntimeStore interface {
+	GetByName(name string) (*models.Runtime, error)
+	// GetEnabled lists the enabled runtimes of family, or all if empty
+	GetEnabled(family string) ([]*models.Runtime, error)
+}
+
+// runtimeRegistry caches lookups in a RuntimeStore
+type runtimeRegistry struct {
+	store RuntimeStore
+
+	mu      sync.Mutex
+	entries map[string]runtimeEntry
+}
+
+type runtimeEntry struct {
+	runtime *models.Runtime
+	fetched time.Time
+}
+
+func newRuntimeRegistry(store RuntimeStore) *runtimeRegistry {
+	return &runtimeRegistry{store: store, entries: make(map[string]runtimeEntry)}
+}
+
+// get returns an enabled runtime by name
+func (r *runtimeRegistry) get(name string) (*models.Runtime, error) {
+	name = strings.ToLower(name)
+
+	r.mu.Lock()
+	entry, ok := r.entries[name]
+	r.mu.Unlock()
+
+	if !ok || time.Since(entry.fetched) > runtimeCacheTTL {
+		rt, err := r.store.GetByName(name)
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, fmt.Errorf("unsupported runtime: %s", name)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to load runtime %s: %w", name, err)
+		}
+
+		entry = runtimeEntry{runtime: rt, fetched: time.Now()}
+		r.mu.Lock()
+		r.entries[name] = entry
+		r.mu.Unlock()
+	}
+
+	if !entry.runtime.Enabled {
+		return nil, fmt.Errorf("runtime %s is disabled", name)
+	}
+	return entry.runtime, nil
+}
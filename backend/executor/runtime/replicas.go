@@ -0,0 +1,912 @@
+package runtime
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"net"
+	"net/http"
+	"net/http/httputil"
+	"net/url"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/aKaddoura96/api-hosting-execution-platform/backend/shared/logger"
+	"github.com/aKaddoura96/api-hosting-execution-platform/backend/shared/models"
+	"github.com/google/uuid"
+)
+
+// replicaPort is the port replica containers listen on
+const replicaPort = 8080
+
+// drainTimeout bounds how long a replica being stopped may finish the
+// requests it is handling
+const drainTimeout = 30 * time.Second
+
+// restartDelay is how long scaling waits to start a replica after one failed
+// to start
+const restartDelay = 30 * time.Second
+
+// Errors from WakeReplicas that are the caller's to fix
+var (
+	ErrReplicasUnavailable = errors.New("replicas are not enabled on this executor")
+	ErrNotPersistent       = errors.New("the API does not run as replicas")
+)
+
+// ScalingStore supplies the scaling policies of APIs (implemented by
+// repository.ScalingRepository)
+type ScalingStore interface {
+	GetPolicy(apiID string) (*models.ScalingPolicy, error)
+}
+
+// ReplicaStore records the replicas running on this node, where gateways find
+// them (implemented by repository.ReplicaRepository)
+type ReplicaStore interface {
+	Save(replica *models.Replica) error
+	Delete(id string) error
+	DeleteByNode(nodeID string) error
+}
+
+// ReplicaConfig sets how replicas are run and scaled
+type ReplicaConfig struct {
+	Network      string        // prefix of each API's replica network name
+	Interval     time.Duration // between scaling decisions
+	StartTimeout time.Duration // for a replica to start listening
+	// ScaleDownDelay is how long after the last scaling change a replica
+	// may be removed, so a brief lull doesn't undo a scale-up
+	ScaleDownDelay time.Duration
+}
+
+// ReplicaConfigFromEnv reads REPLICA_NETWORK (default api-platform-replicas;
+// each API's replicas join <REPLICA_NETWORK>-<api_id>),
+// SCALING_INTERVAL (5s), REPLICA_START_TIMEOUT (60s) and SCALE_DOWN_DELAY (1m)
+func ReplicaConfigFromEnv() (ReplicaConfig, error) {
+	config := ReplicaConfig{
+		Network:        "api-platform-replicas",
+		Interval:       5 * time.Second,
+		StartTimeout:   60 * time.Second,
+		ScaleDownDelay: time.Minute,
+	}
+
+	if v := os.Getenv("REPLICA_NETWORK"); v != "" {
+		config.Network = v
+	}
+	for name, d := range map[string]*time.Duration{
+		"SCALING_INTERVAL":      &config.Interval,
+		"REPLICA_START_TIMEOUT": &config.StartTimeout,
+		"SCALE_DOWN_DELAY":      &config.ScaleDownDelay,
+	} {
+		v := os.Getenv(name)
+		if v == "" {
+			continue
+		}
+		parsed, err := time.ParseDuration(v)
+		if err != nil || parsed <= 0 {
+			return config, fmt.Errorf("invalid %s: %q", name, v)
+		}
+		*d = parsed
+	}
+
+	return config, nil
+}
+
+// WakeRequest is the code an API's replicas run
+type WakeRequest struct {
+	APIID         string `json:"api_id"`
+	Version       string `json:"version"`
+	Code          string `json:"code"`
+	Runtime       string `json:"runtime"`
+	ResourceClass string `json:"resource_class,omitempty"`
+}
+
+// replicaManager runs the replicas of persistent APIs on this node and scales
+// them. All of its state is guarded by mu.
+type replicaManager struct {
+	executor *Executor
+	server   serverBackend
+	nodeID   string
+	config   ReplicaConfig
+	scaling  ScalingStore
+	store    ReplicaStore
+	isolated isolatedNetworkBackend // nil if replicas have no network
+
+	// netMu guards networks, and is held while one is joined or left
+	netMu    sync.Mutex
+	networks map[string]*replicaNetwork // by API
+	// subnets are those of networks, which the executor API refuses
+	// requests from
+	subnets sync.Map // CIDR string to *net.IPNet
+
+	mu       sync.Mutex
+	sets     map[string]*replicaSet // by API
+	draining bool                   // no replica starts once set
+
+	// running counts launches and followers, so drain knows when every
+	// replica has exited
+	running sync.WaitGroup
+}
+
+// replicaSet is the replicas of one API
+type replicaSet struct {
+	apiID    string
+	spec     WakeRequest // what new replicas run
+	policy   *models.ScalingPolicy
+	replicas map[string]*replica
+	changed  chan struct{} // closed and replaced when a replica starts, fails or exits
+	startErr error         // why the last replica failed to start
+
+	lastRequest time.Time
+	lastScale   time.Time
+
+	// Requests finished since the last scaling decision
+	requests int
+	busy     time.Duration // their total time
+}
+
+// replicaNetwork is the network of one API's replicas
+type replicaNetwork struct {
+	name   string
+	subnet string
+	users  int // replicas booting or running on it
+}
+
+type replica struct {
+	info     models.Replica
+	runID    string
+	codeDir  string
+	proxy    *httputil.ReverseProxy
+	inFlight int
+	stopping bool
+}
+
+// EnableReplicas lets the APIs whose scaling policy allows it run as
+// persistent replicas on this node, recorded under nodeID. Only backends that
+// run servers (Docker, local) support it; on Docker each API's replicas get a
+// network of their own, which the executor joins to reach them.
+func (e *Executor) EnableReplicas(ctx context.Context, nodeID string, config ReplicaConfig, scaling ScalingStore, store ReplicaStore) error {
+	server, ok := e.backend.(serverBackend)
+	if !ok {
+		return fmt.Errorf("the %s backend does not support replicas", e.backend.Name())
+	}
+	isolated, _ := e.backend.(isolatedNetworkBackend)
+
+	// Replicas recorded by a previous run of this node are gone
+	if err := store.DeleteByNode(nodeID); err != nil {
+		return fmt.Errorf("failed to clear old replicas: %w", err)
+	}
+
+	m := &replicaManager{
+		executor: e,
+		server:   server,
+		nodeID:   nodeID,
+		config:   config,
+		scaling:  scaling,
+		store:    store,
+		isolated: isolated,
+		networks: make(map[string]*replicaNetwork),
+		sets:     make(map[string]*replicaSet),
+	}
+	e.replicas = m
+	go m.run()
+	return nil
+}
+
+// WakeReplicas makes sure the API has a ready replica running req and returns
+// the ready ones, starting a replica and waiting for it if there is none.
+// Replicas of other versions keep serving until one of req's is ready.
+func (e *Executor) WakeReplicas(ctx context.Context, req *WakeRequest) ([]models.Replica, error) {
+	m := e.replicas
+	if m == nil {
+		return nil, ErrReplicasUnavailable
+	}
+
+	policy, err := m.scaling.GetPolicy(req.APIID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get scaling policy: %w", err)
+	}
+	if !policy.Persistent() {
+		return nil, ErrNotPersistent
+	}
+
+	timer := time.NewTimer(m.config.StartTimeout)
+	defer timer.Stop()
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.draining {
+		return nil, ErrDraining
+	}
+
+	set := m.sets[req.APIID]
+	if set == nil {
+		set = &replicaSet{
+			apiID:    req.APIID,
+			replicas: make(map[string]*replica),
+			changed:  make(chan struct{}),
+		}
+		m.sets[req.APIID] = set
+	}
+	if set.spec != *req {
+		set.spec = *req
+		set.startErr = nil
+	}
+	set.policy = policy
+	set.lastRequest = time.Now()
+
+	started := false
+	for {
+		if ready := set.ready(req.Version); len(ready) > 0 {
+			return ready, nil
+		}
+		if set.starting(req.Version) == 0 {
+			if started && set.startErr != nil {
+				return nil, set.startErr
+			}
+			m.start(set)
+			started = true
+		}
+
+		changed := set.changed
+		m.mu.Unlock()
+		select {
+		case <-changed:
+			m.mu.Lock()
+		case <-timer.C:
+			m.mu.Lock()
+			return nil, fmt.Errorf("no replica became ready within %s", m.config.StartTimeout)
+		case <-ctx.Done():
+			m.mu.Lock()
+			return nil, ctx.Err()
+		}
+	}
+}
+
+// ServeReplica forwards r to a replica of the API, with path as the request
+// path. A replica this node doesn't run is answered 404 with
+// models.ReplicaMissingHeader set, so the gateway knows to wake the API.
+func (e *Executor) ServeReplica(w http.ResponseWriter, r *http.Request, apiID, replicaID, path string) {
+	set, rep := e.replicas.checkout(apiID, replicaID)
+	if rep == nil {
+		w.Header().Set(models.ReplicaMissingHeader, "true")
+		http.Error(w, "Replica not found", http.StatusNotFound)
+		return
+	}
+
+	start := time.Now()
+	r.URL.Path = path
+	r.URL.RawPath = ""
+	rep.proxy.ServeHTTP(w, r)
+
+	m := e.replicas
+	m.mu.Lock()
+	rep.inFlight--
+	set.requests++
+	set.busy += time.Since(start)
+	set.lastRequest = time.Now()
+	m.mu.Unlock()
+}
+
+// checkout finds a ready replica and counts a request in flight on it
+func (m *replicaManager) checkout(apiID, replicaID string) (*replicaSet, *replica) {
+	if m == nil {
+		return nil, nil
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	set := m.sets[apiID]
+	if set == nil {
+		return nil, nil
+	}
+	rep := set.replicas[replicaID]
+	if rep == nil || rep.info.Status != models.ReplicaReady {
+		return nil, nil
+	}
+	rep.inFlight++
+	set.lastRequest = time.Now()
+	return set, rep
+}
+
+// StopReplicas stops every replica of the API once it finishes the requests
+// it is handling
+func (e *Executor) StopReplicas(apiID string) {
+	m := e.replicas
+	if m == nil {
+		return
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	set := m.sets[apiID]
+	if set == nil {
+		return
+	}
+	for _, rep := range set.replicas {
+		m.retire(rep)
+	}
+	delete(m.sets, apiID)
+}
+
+// drain stops every replica once it finishes its requests and keeps new ones
+// from starting. The returned channel is closed once all have exited.
+func (m *replicaManager) drain() <-chan struct{} {
+	done := make(chan struct{})
+	if m == nil {
+		close(done)
+		return done
+	}
+
+	m.mu.Lock()
+	m.draining = true
+	for apiID, set := range m.sets {
+		for _, rep := range set.replicas {
+			m.retire(rep)
+		}
+		delete(m.sets, apiID)
+	}
+	m.mu.Unlock()
+
+	go func() {
+		m.running.Wait()
+		close(done)
+	}()
+	return done
+}
+
+// ready returns the ready replicas of version that are not being stopped
+func (s *replicaSet) ready(version string) []models.Replica {
+	var ready []models.Replica
+	for _, rep := range s.replicas {
+		if rep.info.Version == version && rep.info.Status == models.ReplicaReady && !rep.stopping {
+			info := rep.info
+			info.InFlight = rep.inFlight
+			ready = append(ready, info)
+		}
+	}
+	return ready
+}
+
+// starting counts the replicas of version still starting
+func (s *replicaSet) starting(version string) int {
+	n := 0
+	for _, rep := range s.replicas {
+		if rep.info.Version == version && rep.info.Status == models.ReplicaStarting && !rep.stopping {
+			n++
+		}
+	}
+	return n
+}
+
+// broadcast wakes everything waiting for the set to change; m.mu must be held
+func (s *replicaSet) broadcast() {
+	close(s.changed)
+	s.changed = make(chan struct{})
+}
+
+// start adds a replica running the set's spec and boots it in the
+// background; m.mu must be held
+func (m *replicaManager) start(set *replicaSet) {
+	now := time.Now()
+	rep := &replica{info: models.Replica{
+		ID:        uuid.New().String(),
+		APIID:     set.apiID,
+		NodeID:    m.nodeID,
+		Version:   set.spec.Version,
+		Status:    models.ReplicaStarting,
+		StartedAt: now,
+		UpdatedAt: now,
+	}}
+	set.replicas[rep.info.ID] = rep
+	set.lastScale = now
+
+	m.running.Add(1)
+	go m.launch(set, rep, set.spec)
+}
+
+// launch boots a replica and marks it ready, or drops it if it fails to start
+func (m *replicaManager) launch(set *replicaSet, rep *replica, spec WakeRequest) {
+	defer m.running.Done()
+	log := logger.WithContext(context.Background()).WithFields(map[string]interface{}{
+		"api_id":     set.apiID,
+		"replica_id": rep.info.ID,
+		"version":    spec.Version,
+	})
+
+	ctx, cancel := context.WithTimeout(context.Background(), m.config.StartTimeout)
+	defer cancel()
+	err := m.boot(ctx, set, rep, &spec)
+
+	m.mu.Lock()
+	if err != nil {
+		delete(set.replicas, rep.info.ID)
+		set.startErr = err
+		set.broadcast()
+		m.mu.Unlock()
+		log.Error("Replica failed to start", map[string]interface{}{"error": err.Error()})
+		return
+	}
+	rep.info.Status = models.ReplicaReady
+	set.startErr = nil
+	info := rep.info
+	stopping := rep.stopping
+	set.broadcast()
+	m.mu.Unlock()
+
+	// Stopped while it was starting
+	if stopping {
+		m.executor.backend.Stop(context.Background(), rep.runID)
+		return
+	}
+
+	if err := m.store.Save(&info); err != nil {
+		log.Error("Failed to record replica", map[string]interface{}{"error": err.Error()})
+	}
+	log.Info("Replica ready")
+}
+
+// boot starts the replica's server and waits until it accepts connections
+func (m *replicaManager) boot(ctx context.Context, set *replicaSet, rep *replica, spec *WakeRequest) error {
+	e := m.executor
+
+	rt, err := e.getRuntime(spec.Runtime)
+	if err != nil {
+		return err
+	}
+	if rt.Engine == models.EngineWASM {
+		return fmt.Errorf("the %s runtime can't run replicas", rt.Name)
+	}
+	if rt.Name == models.RuntimeCustom {
+		image, err := e.customImage(ctx, spec.APIID)
+		if err != nil {
+			return err
+		}
+		custom := *rt
+		custom.Image = image
+		rt = &custom
+	} else if err := e.images.pull(ctx, e.backend, rt.Image); err != nil {
+		return err
+	}
+
+	resourceClass := spec.ResourceClass
+	if resourceClass == "" {
+		resourceClass = rt.DefaultResourceClass
+	}
+	class, ok := models.GetResourceClass(resourceClass)
+	if !ok {
+		return fmt.Errorf("unknown resource class: %s", resourceClass)
+	}
+
+	env := []string{
+		"PYTHONUNBUFFERED=1",
+		"NODE_ENV=production",
+	}
+	if e.envStore != nil {
+		apiEnv, err := e.envStore.Resolve(spec.APIID, spec.Version)
+		if err != nil {
+			return err
+		}
+		env = append(env, apiEnv...)
+	}
+
+	codeDir, err := e.prepareCodeFiles(&ExecutionRequest{APIID: spec.APIID, Code: spec.Code}, rt)
+	if err != nil {
+		return err
+	}
+
+	network, err := m.joinNetwork(ctx, spec.APIID)
+	if err != nil {
+		os.RemoveAll(codeDir)
+		return err
+	}
+	runID, addr, err := m.server.StartServer(ctx, &RunSpec{
+		Image:   rt.Image,
+		Cmd:     rt.Command(spec.Code),
+		Env:     env,
+		CodeDir: codeDir,
+		Class:   class,
+		Network: network,
+		Labels:  e.runLabels(labelReplica, rep.info.ID, spec.APIID, time.Time{}),
+	})
+	if err != nil {
+		m.leaveNetwork(spec.APIID)
+		os.RemoveAll(codeDir)
+		return err
+	}
+	if !e.track(e.backend, runID) {
+		e.backend.Remove(runID)
+		m.leaveNetwork(spec.APIID)
+		os.RemoveAll(codeDir)
+		return ErrDraining
+	}
+
+	target := &url.URL{Scheme: "http", Host: addr}
+	m.mu.Lock()
+	rep.runID = runID
+	rep.codeDir = codeDir
+	rep.proxy = &httputil.ReverseProxy{
+		Rewrite: func(pr *httputil.ProxyRequest) {
+			pr.SetURL(target)
+		},
+		ErrorHandler: func(w http.ResponseWriter, r *http.Request, err error) {
+			http.Error(w, "Replica unavailable: "+err.Error(), http.StatusBadGateway)
+		},
+	}
+	m.mu.Unlock()
+
+	exited := make(chan struct{})
+	m.running.Add(1)
+	go m.follow(set, rep, exited)
+
+	// The server is ready once it accepts connections
+	ticker := time.NewTicker(100 * time.Millisecond)
+	defer ticker.Stop()
+	for {
+		conn, err := net.DialTimeout("tcp", addr, time.Second)
+		if err == nil {
+			conn.Close()
+			return nil
+		}
+
+		select {
+		case <-exited:
+			return fmt.Errorf("replica exited before listening on $PORT")
+		case <-ctx.Done():
+			m.executor.backend.Stop(context.Background(), runID)
+			return fmt.Errorf("replica did not listen on $PORT within %s", m.config.StartTimeout)
+		case <-ticker.C:
+		}
+	}
+}
+
+// follow publishes the replica's output as live log lines, under the
+// replica's ID, and cleans up once it exits
+func (m *replicaManager) follow(set *replicaSet, rep *replica, exited chan struct{}) {
+	defer m.running.Done()
+	backend := m.executor.backend
+	publish := func(stream, message string) {
+		m.executor.logs.Publish(&models.ExecutionLog{
+			ExecutionID: rep.info.ID,
+			APIID:       set.apiID,
+			Stream:      stream,
+			Level:       detectLevel(stream, message),
+			Message:     message,
+			LoggedAt:    time.Now(),
+		})
+	}
+	go func() {
+		stdout := &lineWriter{stream: "stdout", emit: publish}
+		stderr := &lineWriter{stream: "stderr", emit: publish}
+		backend.Logs(context.Background(), rep.runID, stdout, stderr)
+		stdout.Flush()
+		stderr.Flush()
+	}()
+
+	exitCode, err := backend.Wait(context.Background(), rep.runID)
+	close(exited)
+
+	m.mu.Lock()
+	expected := rep.stopping || rep.info.Status == models.ReplicaStarting
+	if set.replicas[rep.info.ID] == rep {
+		delete(set.replicas, rep.info.ID)
+		set.broadcast()
+	}
+	m.mu.Unlock()
+
+	if !expected {
+		fields := map[string]interface{}{
+			"api_id":     set.apiID,
+			"replica_id": rep.info.ID,
+			"exit_code":  exitCode,
+		}
+		if err != nil {
+			fields["error"] = err.Error()
+		}
+		logger.Warn("Replica exited unexpectedly", fields)
+	}
+
+	backend.Remove(rep.runID)
+	m.leaveNetwork(set.apiID)
+	m.executor.untrack(rep.runID)
+	os.RemoveAll(rep.codeDir)
+	if err := m.store.Delete(rep.info.ID); err != nil {
+		logger.Error("Failed to remove replica record", map[string]interface{}{
+			"replica_id": rep.info.ID,
+			"error":      err.Error(),
+		})
+	}
+}
+
+// joinNetwork returns the network for a replica of the API to join, creating
+// it and attaching the executor for the first. Each call must be matched by
+// leaveNetwork once the replica is removed.
+func (m *replicaManager) joinNetwork(ctx context.Context, apiID string) (string, error) {
+	if m.isolated == nil {
+		return "", nil
+	}
+
+	m.netMu.Lock()
+	defer m.netMu.Unlock()
+	nw := m.networks[apiID]
+	if nw == nil {
+		name := m.config.Network + "-" + apiID
+		subnet, err := m.isolated.JoinNetwork(ctx, name)
+		if err != nil {
+			return "", fmt.Errorf("failed to set up replica network: %w", err)
+		}
+		_, ipNet, err := net.ParseCIDR(subnet)
+		if err != nil {
+			return "", fmt.Errorf("replica network has an invalid subnet %q", subnet)
+		}
+		m.subnets.Store(subnet, ipNet)
+		nw = &replicaNetwork{name: name, subnet: subnet}
+		m.networks[apiID] = nw
+	}
+	nw.users++
+	return nw.name, nil
+}
+
+// leaveNetwork releases the API's network from a replica, removing it after
+// the last
+func (m *replicaManager) leaveNetwork(apiID string) {
+	if m.isolated == nil {
+		return
+	}
+
+	m.netMu.Lock()
+	defer m.netMu.Unlock()
+	nw := m.networks[apiID]
+	if nw == nil {
+		return
+	}
+	if nw.users--; nw.users > 0 {
+		return
+	}
+	delete(m.networks, apiID)
+	m.subnets.Delete(nw.subnet)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	if err := m.isolated.LeaveNetwork(ctx, nw.name); err != nil {
+		logger.Error("Failed to remove replica network", map[string]interface{}{
+			"api_id":  apiID,
+			"network": nw.name,
+			"error":   err.Error(),
+		})
+	}
+}
+
+// FromReplicaNetwork reports whether r came from a replica's network. The
+// executor API must not answer those: replicas run developers' code.
+func (e *Executor) FromReplicaNetwork(r *http.Request) bool {
+	m := e.replicas
+	if m == nil {
+		return false
+	}
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return false
+	}
+	ip := net.ParseIP(host)
+	if ip == nil {
+		return false
+	}
+
+	from := false
+	m.subnets.Range(func(_, value any) bool {
+		from = value.(*net.IPNet).Contains(ip)
+		return !from
+	})
+	return from
+}
+
+// retire stops a replica once it has finished its requests; m.mu must be held
+func (m *replicaManager) retire(rep *replica) {
+	if rep.stopping {
+		return
+	}
+	rep.stopping = true
+	if rep.info.Status != models.ReplicaReady {
+		return // launch stops it once it has started
+	}
+
+	go func() {
+		// Gateways stop sending requests once the record is gone
+		if err := m.store.Delete(rep.info.ID); err != nil {
+			logger.Error("Failed to remove replica record", map[string]interface{}{
+				"replica_id": rep.info.ID,
+				"error":      err.Error(),
+			})
+		}
+
+		deadline := time.Now().Add(drainTimeout)
+		for time.Now().Before(deadline) {
+			m.mu.Lock()
+			inFlight := rep.inFlight
+			m.mu.Unlock()
+			if inFlight == 0 {
+				break
+			}
+			time.Sleep(100 * time.Millisecond)
+		}
+		m.executor.backend.Stop(context.Background(), rep.runID)
+	}()
+}
+
+// run makes a scaling decision for every API every interval
+func (m *replicaManager) run() {
+	ticker := time.NewTicker(m.config.Interval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		m.tick()
+	}
+}
+
+func (m *replicaManager) tick() {
+	// Policies are read without holding the lock; an API whose policy can't
+	// be read keeps the last one
+	m.mu.Lock()
+	apiIDs := make([]string, 0, len(m.sets))
+	for apiID := range m.sets {
+		apiIDs = append(apiIDs, apiID)
+	}
+	m.mu.Unlock()
+
+	policies := make(map[string]*models.ScalingPolicy, len(apiIDs))
+	for _, apiID := range apiIDs {
+		policy, err := m.scaling.GetPolicy(apiID)
+		if err != nil {
+			logger.Error("Failed to get scaling policy", map[string]interface{}{
+				"api_id": apiID,
+				"error":  err.Error(),
+			})
+			continue
+		}
+		policies[apiID] = policy
+	}
+
+	now := time.Now()
+	var records []models.Replica
+	m.mu.Lock()
+	for apiID, set := range m.sets {
+		if policy, ok := policies[apiID]; ok {
+			set.policy = policy
+		}
+		m.scale(set, now)
+
+		for _, rep := range set.replicas {
+			if rep.info.Status == models.ReplicaReady && !rep.stopping {
+				rep.info.InFlight = rep.inFlight
+				records = append(records, rep.info)
+			}
+		}
+		set.requests = 0
+		set.busy = 0
+
+		// Scaled to zero; the next wake brings the code again
+		if len(set.replicas) == 0 {
+			delete(m.sets, apiID)
+		}
+	}
+	m.mu.Unlock()
+
+	// Refreshing the records also restores any removed with an evicted node
+	for i := range records {
+		if err := m.store.Save(&records[i]); err != nil {
+			logger.Error("Failed to record replica", map[string]interface{}{
+				"replica_id": records[i].ID,
+				"error":      err.Error(),
+			})
+		}
+	}
+}
+
+// scale starts or retires replicas to bring the set to its desired size;
+// m.mu must be held
+func (m *replicaManager) scale(set *replicaSet, now time.Time) {
+	policy := set.policy
+
+	var live, ready, outdated []*replica
+	inFlight := 0
+	for _, rep := range set.replicas {
+		switch {
+		case rep.stopping:
+		case rep.info.Version != set.spec.Version:
+			outdated = append(outdated, rep)
+		default:
+			live = append(live, rep)
+			inFlight += rep.inFlight
+			if rep.info.Status == models.ReplicaReady {
+				ready = append(ready, rep)
+			}
+		}
+	}
+
+	// Scaling was turned off
+	if !policy.Persistent() {
+		for _, rep := range set.replicas {
+			m.retire(rep)
+		}
+		return
+	}
+
+	// Older versions serve until the current one does
+	if len(ready) > 0 {
+		for _, rep := range outdated {
+			m.retire(rep)
+		}
+	}
+
+	desired := m.desired(set, len(ready), inFlight, now)
+	switch {
+	case desired > len(live) && set.startErr != nil && now.Sub(set.lastScale) < restartDelay:
+		// The last replica failed to start; don't retry in a tight loop
+
+	case desired > len(live):
+		logger.Info("Scaling up replicas", map[string]interface{}{
+			"api_id": set.apiID,
+			"from":   len(live),
+			"to":     desired,
+		})
+		for i := len(live); i < desired; i++ {
+			m.start(set)
+		}
+
+	case desired == 0 && len(live) > 0:
+		logger.Info("Scaling replicas to zero after idle timeout", map[string]interface{}{"api_id": set.apiID})
+		for _, rep := range live {
+			m.retire(rep)
+		}
+		set.lastScale = now
+
+	case desired < len(live) && len(ready) > 0 && now.Sub(set.lastScale) >= m.config.ScaleDownDelay:
+		// One at a time, the least busy first
+		least := ready[0]
+		for _, rep := range ready[1:] {
+			if rep.inFlight < least.inFlight {
+				least = rep
+			}
+		}
+		logger.Info("Scaling down replicas", map[string]interface{}{
+			"api_id": set.apiID,
+			"from":   len(live),
+			"to":     len(live) - 1,
+		})
+		m.retire(least)
+		set.lastScale = now
+	}
+}
+
+// desired is how many replicas the set needs: enough for its concurrency at
+// the target per replica, one more while requests are slower than the target
+// latency, and at least one until it has been idle for the idle timeout
+func (m *replicaManager) desired(set *replicaSet, ready, inFlight int, now time.Time) int {
+	policy := set.policy
+
+	// Average requests in flight over the interval, or right now if higher
+	concurrency := set.busy.Seconds() / m.config.Interval.Seconds()
+	if float64(inFlight) > concurrency {
+		concurrency = float64(inFlight)
+	}
+	desired := int(math.Ceil(concurrency / float64(policy.TargetConcurrency)))
+
+	if policy.TargetLatencyMS > 0 && set.requests > 0 && desired <= ready {
+		average := set.busy / time.Duration(set.requests)
+		if average > time.Duration(policy.TargetLatencyMS)*time.Millisecond {
+			desired = ready + 1
+		}
+	}
+
+	if desired < 1 && now.Sub(set.lastRequest) < policy.IdleTimeout() {
+		desired = 1
+	}
+	if desired < policy.MinReplicas {
+		desired = policy.MinReplicas
+	}
+	if desired > policy.MaxReplicas {
+		desired = policy.MaxReplicas
+	}
+	return desired
+}
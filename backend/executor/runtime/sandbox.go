@@ -0,0 +1,124 @@
+package runtime
+
+import (
+	_ "embed"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/docker/docker/api/types/container"
+)
+
+// builtinSeccomp allows everything except syscalls that reach into the
+// kernel or host: mounting, namespaces, tracing other processes, loading
+// modules or BPF, keyrings, clock and swap control. clone3 reports ENOSYS so
+// libc falls back to clone, whose namespace flags are refused.
+//
+//go:embed seccomp.json
+var builtinSeccomp string
+
+// SandboxProfile is how far untrusted code is locked down beyond the
+// resource class limits
+type SandboxProfile struct {
+	ReadonlyRootfs   bool   // only /tmp (a tmpfs) is writable
+	User             string // uid:gid code runs as; empty keeps the image's user
+	DropCapabilities bool
+	NoNewPrivileges  bool   // setuid binaries can't raise privileges
+	Seccomp          string // profile JSON; empty uses Docker's default
+	NoFile           int64  // open file limit; 0 keeps Docker's default
+	Runtime          string // OCI runtime, e.g. runsc for gVisor; empty is Docker's default
+}
+
+// SandboxProfileFromEnv builds the profile from the environment. Everything
+// is on by default; SANDBOX_HARDENED=false turns it all off for local
+// development, and individual settings can be overridden:
+//
+//	SANDBOX_READONLY_ROOTFS  true|false (default true)
+//	SANDBOX_USER             uid:gid (default 65534:65534, nobody)
+//	SANDBOX_SECCOMP          builtin, docker-default or a profile path (default builtin)
+//	SANDBOX_NOFILE           open file limit (default 256)
+//	SANDBOX_RUNTIME          OCI runtime such as runsc (default Docker's)
+func SandboxProfileFromEnv() (*SandboxProfile, error) {
+	p := &SandboxProfile{Runtime: os.Getenv("SANDBOX_RUNTIME")}
+
+	hardened, err := envBool("SANDBOX_HARDENED", true)
+	if err != nil {
+		return nil, err
+	}
+	if !hardened {
+		return p, nil
+	}
+
+	p.DropCapabilities = true
+	p.NoNewPrivileges = true
+	if p.ReadonlyRootfs, err = envBool("SANDBOX_READONLY_ROOTFS", true); err != nil {
+		return nil, err
+	}
+
+	p.User = "65534:65534"
+	if v, ok := os.LookupEnv("SANDBOX_USER"); ok {
+		p.User = v
+	}
+
+	p.NoFile = 256
+	if v := os.Getenv("SANDBOX_NOFILE"); v != "" {
+		if p.NoFile, err = strconv.ParseInt(v, 10, 64); err != nil || p.NoFile < 0 {
+			return nil, fmt.Errorf("invalid SANDBOX_NOFILE: %q", v)
+		}
+	}
+
+	switch v := os.Getenv("SANDBOX_SECCOMP"); v {
+	case "", "builtin":
+		p.Seccomp = builtinSeccomp
+	case "docker-default":
+	default:
+		data, err := os.ReadFile(v)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read seccomp profile: %w", err)
+		}
+		if !json.Valid(data) {
+			return nil, fmt.Errorf("seccomp profile %s is not valid JSON", v)
+		}
+		p.Seccomp = string(data)
+	}
+
+	return p, nil
+}
+
+// apply adds the profile's restrictions to a container's configuration
+func (p *SandboxProfile) apply(config *container.Config, host *container.HostConfig) {
+	host.ReadonlyRootfs = p.ReadonlyRootfs
+	host.Runtime = p.Runtime
+
+	if p.User != "" {
+		config.User = p.User
+		// The image's home usually isn't writable by an arbitrary uid
+		config.Env = append(config.Env, "HOME=/tmp", "GOCACHE=/tmp/.cache/go-build", "GOPATH=/tmp/go")
+	}
+	if p.DropCapabilities {
+		host.CapDrop = []string{"ALL"}
+	}
+	if p.NoNewPrivileges {
+		host.SecurityOpt = append(host.SecurityOpt, "no-new-privileges:true")
+	}
+	if p.Seccomp != "" {
+		host.SecurityOpt = append(host.SecurityOpt, "seccomp="+p.Seccomp)
+	}
+	if p.NoFile > 0 {
+		host.Ulimits = append(host.Ulimits, &container.Ulimit{Name: "nofile", Soft: p.NoFile, Hard: p.NoFile})
+	}
+}
+
+func envBool(name string, def bool) (bool, error) {
+	v := os.Getenv(name)
+	if v == "" {
+		return def, nil
+	}
+	b, err := strconv.ParseBool(strings.TrimSpace(v))
+	if err != nil {
+		return false, fmt.Errorf("invalid %s: %q", name, v)
+	}
+	return b, nil
+}
@@ -0,0 +1,209 @@
+package runtime
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/docker/docker/api/types/container"
+)
+
+var sandboxEnv = []string{
+	"SANDBOX_HARDENED",
+	"SANDBOX_READONLY_ROOTFS",
+	"SANDBOX_USER",
+	"SANDBOX_SECCOMP",
+	"SANDBOX_NOFILE",
+	"SANDBOX_RUNTIME",
+}
+
+// unsetSandboxEnv clears the sandbox variables for the test, restoring them
+// after it
+func unsetSandboxEnv(t *testing.T) {
+	for _, name := range sandboxEnv {
+		t.Setenv(name, "")
+		os.Unsetenv(name)
+	}
+}
+
+func TestSandboxProfileFromEnv(t *testing.T) {
+	seccompFile := filepath.Join(t.TempDir(), "seccomp.json")
+	if err := os.WriteFile(seccompFile, []byte(`{"defaultAction":"SCMP_ACT_ALLOW"}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	invalidFile := filepath.Join(t.TempDir(), "invalid.json")
+	if err := os.WriteFile(invalidFile, []byte(`{`), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	hardened := SandboxProfile{
+		ReadonlyRootfs:   true,
+		User:             "65534:65534",
+		DropCapabilities: true,
+		NoNewPrivileges:  true,
+		Seccomp:          builtinSeccomp,
+		NoFile:           256,
+	}
+
+	tests := []struct {
+		name    string
+		env     map[string]string
+		want    func(p SandboxProfile) SandboxProfile // applied to hardened
+		wantErr bool
+	}{
+		{
+			name: "hardened by default",
+			want: func(p SandboxProfile) SandboxProfile { return p },
+		},
+		{
+			name: "hardening off keeps the OCI runtime",
+			env:  map[string]string{"SANDBOX_HARDENED": "false", "SANDBOX_RUNTIME": "runsc"},
+			want: func(SandboxProfile) SandboxProfile { return SandboxProfile{Runtime: "runsc"} },
+		},
+		{
+			name: "writable root filesystem",
+			env:  map[string]string{"SANDBOX_READONLY_ROOTFS": "false"},
+			want: func(p SandboxProfile) SandboxProfile { p.ReadonlyRootfs = false; return p },
+		},
+		{
+			name: "empty user keeps the image's",
+			env:  map[string]string{"SANDBOX_USER": ""},
+			want: func(p SandboxProfile) SandboxProfile { p.User = ""; return p },
+		},
+		{
+			name: "custom user",
+			env:  map[string]string{"SANDBOX_USER": "1000:1000"},
+			want: func(p SandboxProfile) SandboxProfile { p.User = "1000:1000"; return p },
+		},
+		{
+			name: "no file limit",
+			env:  map[string]string{"SANDBOX_NOFILE": "0"},
+			want: func(p SandboxProfile) SandboxProfile { p.NoFile = 0; return p },
+		},
+		{
+			name: "docker default seccomp",
+			env:  map[string]string{"SANDBOX_SECCOMP": "docker-default"},
+			want: func(p SandboxProfile) SandboxProfile { p.Seccomp = ""; return p },
+		},
+		{
+			name: "seccomp profile from a file",
+			env:  map[string]string{"SANDBOX_SECCOMP": seccompFile},
+			want: func(p SandboxProfile) SandboxProfile {
+				p.Seccomp = `{"defaultAction":"SCMP_ACT_ALLOW"}`
+				return p
+			},
+		},
+		{
+			name:    "invalid hardened flag",
+			env:     map[string]string{"SANDBOX_HARDENED": "maybe"},
+			wantErr: true,
+		},
+		{
+			name:    "invalid file limit",
+			env:     map[string]string{"SANDBOX_NOFILE": "-1"},
+			wantErr: true,
+		},
+		{
+			name:    "missing seccomp profile",
+			env:     map[string]string{"SANDBOX_SECCOMP": filepath.Join(t.TempDir(), "missing.json")},
+			wantErr: true,
+		},
+		{
+			name:    "seccomp profile that isn't JSON",
+			env:     map[string]string{"SANDBOX_SECCOMP": invalidFile},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			unsetSandboxEnv(t)
+			for name, value := range tt.env {
+				t.Setenv(name, value)
+			}
+
+			got, err := SandboxProfileFromEnv()
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("SandboxProfileFromEnv() = %+v, want an error", got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("SandboxProfileFromEnv() error = %v", err)
+			}
+			if want := tt.want(hardened); !reflect.DeepEqual(*got, want) {
+				t.Errorf("SandboxProfileFromEnv() = %+v, want %+v", *got, want)
+			}
+		})
+	}
+}
+
+func TestSandboxProfileApply(t *testing.T) {
+	tests := []struct {
+		name     string
+		profile  SandboxProfile
+		wantUser string
+		wantEnv  []string
+		wantHost container.HostConfig
+	}{
+		{
+			name:    "nothing set",
+			wantEnv: []string{"A=1"},
+		},
+		{
+			name: "everything set",
+			profile: SandboxProfile{
+				ReadonlyRootfs:   true,
+				User:             "65534:65534",
+				DropCapabilities: true,
+				NoNewPrivileges:  true,
+				Seccomp:          `{}`,
+				NoFile:           256,
+				Runtime:          "runsc",
+			},
+			wantUser: "65534:65534",
+			wantEnv:  []string{"A=1", "HOME=/tmp", "GOCACHE=/tmp/.cache/go-build", "GOPATH=/tmp/go"},
+			wantHost: container.HostConfig{
+				ReadonlyRootfs: true,
+				Runtime:        "runsc",
+				CapDrop:        []string{"ALL"},
+				SecurityOpt:    []string{"no-new-privileges:true", "seccomp={}"},
+				Resources: container.Resources{
+					Ulimits: []*container.Ulimit{{Name: "nofile", Soft: 256, Hard: 256}},
+				},
+			},
+		},
+		{
+			name:     "user only",
+			profile:  SandboxProfile{User: "1000:1000"},
+			wantUser: "1000:1000",
+			wantEnv:  []string{"A=1", "HOME=/tmp", "GOCACHE=/tmp/.cache/go-build", "GOPATH=/tmp/go"},
+		},
+		{
+			name:     "docker default seccomp",
+			profile:  SandboxProfile{NoNewPrivileges: true},
+			wantEnv:  []string{"A=1"},
+			wantHost: container.HostConfig{SecurityOpt: []string{"no-new-privileges:true"}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config := &container.Config{Env: []string{"A=1"}}
+			host := &container.HostConfig{}
+			tt.profile.apply(config, host)
+
+			if config.User != tt.wantUser {
+				t.Errorf("User = %q, want %q", config.User, tt.wantUser)
+			}
+			if !reflect.DeepEqual(config.Env, tt.wantEnv) {
+				t.Errorf("Env = %q, want %q", config.Env, tt.wantEnv)
+			}
+			if !reflect.DeepEqual(*host, tt.wantHost) {
+				t.Errorf("HostConfig = %+v, want %+v", *host, tt.wantHost)
+			}
+		})
+	}
+}
@@ -0,0 +1,75 @@
+package runtime
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"sync"
+
+	"github.com/google/uuid"
+)
+
+// StubBackend runs nothing: every execution succeeds immediately and prints
+// a JSON object describing what would have run. It stands in for the real
+// backends when the platform is exercised without executing code.
+type StubBackend struct {
+	mu   sync.Mutex
+	runs map[string]*RunSpec
+}
+
+func NewStubBackend() *StubBackend {
+	return &StubBackend{runs: make(map[string]*RunSpec)}
+}
+
+func (s *StubBackend) Name() string {
+	return "stub"
+}
+
+func (s *StubBackend) Prepare(ctx context.Context, image string) error {
+	return nil
+}
+
+func (s *StubBackend) Run(ctx context.Context, spec *RunSpec) (string, error) {
+	id := "stub-" + uuid.New().String()
+	s.mu.Lock()
+	s.runs[id] = spec
+	s.mu.Unlock()
+	return id, nil
+}
+
+func (s *StubBackend) Wait(ctx context.Context, id string) (int, error) {
+	return 0, nil
+}
+
+func (s *StubBackend) Logs(ctx context.Context, id string, stdout, stderr io.Writer) error {
+	s.mu.Lock()
+	spec := s.runs[id]
+	s.mu.Unlock()
+
+	output := map[string]interface{}{"stub": true}
+	if spec != nil {
+		output["image"] = spec.Image
+	}
+	data, _ := json.Marshal(output)
+	_, err := stdout.Write(append(data, '\n'))
+	return err
+}
+
+func (s *StubBackend) Stats(ctx context.Context, id string) (*RunStats, error) {
+	return &RunStats{}, nil
+}
+
+func (s *StubBackend) Stop(ctx context.Context, id string) error {
+	return nil
+}
+
+func (s *StubBackend) Remove(id string) error {
+	s.mu.Lock()
+	delete(s.runs, id)
+	s.mu.Unlock()
+	return nil
+}
+
+func (s *StubBackend) Close() error {
+	return nil
+}
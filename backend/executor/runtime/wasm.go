@@ -0,0 +1,229 @@
+package runtime
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/tetratelabs/wazero"
+	"github.com/tetratelabs/wazero/imports/wasi_snapshot_preview1"
+	"github.com/tetratelabs/wazero/sys"
+)
+
+// wasmPagesPerMB converts the resource class memory to 64KiB WebAssembly pages
+const wasmPagesPerMB = 16
+
+// WasmBackend runs WebAssembly (WASI) modules inside the executor process
+// with wazero. Each run gets its own runtime, so the memory limit of its
+// resource class applies; compiled code is cached across runs. Modules have
+// no filesystem or network access, and the timeout interrupts them mid-run.
+type WasmBackend struct {
+	cache wazero.CompilationCache
+
+	mu   sync.Mutex
+	runs map[string]*wasmRun
+}
+
+type wasmRun struct {
+	runtime wazero.Runtime
+	stdout  *io.PipeReader
+	stderr  *io.PipeReader
+	cancel  context.CancelFunc
+
+	done     chan struct{} // closed once the module has exited
+	exitCode int
+	elapsed  time.Duration
+}
+
+func NewWasmBackend() *WasmBackend {
+	return &WasmBackend{cache: wazero.NewCompilationCache(), runs: make(map[string]*wasmRun)}
+}
+
+func (b *WasmBackend) Name() string {
+	return "wasm"
+}
+
+// Prepare does nothing; modules are compiled when they run
+func (b *WasmBackend) Prepare(ctx context.Context, image string) error {
+	return nil
+}
+
+// Run compiles the module spec.Cmd[0] from the code directory and starts it
+// with spec.Cmd as its arguments, spec.Env as its environment and spec.Stdin
+// on standard input. An invalid module fails here rather than as a run.
+func (b *WasmBackend) Run(ctx context.Context, spec *RunSpec) (string, error) {
+	if len(spec.Cmd) == 0 {
+		return "", fmt.Errorf("no module to run")
+	}
+	module, err := os.ReadFile(filepath.Join(spec.CodeDir, spec.Cmd[0]))
+	if err != nil {
+		return "", fmt.Errorf("failed to read module: %w", err)
+	}
+
+	// The run outlives this call but not the execution
+	runCtx, cancel := context.WithCancel(ctx)
+
+	config := wazero.NewRuntimeConfig().
+		WithCompilationCache(b.cache).
+		WithCloseOnContextDone(true).
+		WithMemoryLimitPages(uint32(spec.Class.MemoryMB * wasmPagesPerMB))
+	r := wazero.NewRuntimeWithConfig(runCtx, config)
+
+	if _, err := wasi_snapshot_preview1.Instantiate(runCtx, r); err != nil {
+		r.Close(context.Background())
+		cancel()
+		return "", fmt.Errorf("failed to set up WASI: %w", err)
+	}
+	compiled, err := r.CompileModule(runCtx, module)
+	if err != nil {
+		r.Close(context.Background())
+		cancel()
+		return "", fmt.Errorf("invalid WebAssembly module: %w", err)
+	}
+
+	stdout, stdoutWriter := io.Pipe()
+	stderr, stderrWriter := io.Pipe()
+
+	moduleConfig := wazero.NewModuleConfig().
+		WithArgs(spec.Cmd...).
+		WithStdin(bytes.NewReader(spec.Stdin)).
+		WithStdout(stdoutWriter).
+		WithStderr(stderrWriter).
+		WithSysWalltime().
+		WithSysNanotime().
+		WithRandSource(rand.Reader)
+	for _, kv := range spec.Env {
+		if name, value, ok := strings.Cut(kv, "="); ok {
+			moduleConfig = moduleConfig.WithEnv(name, value)
+		}
+	}
+
+	run := &wasmRun{runtime: r, stdout: stdout, stderr: stderr, cancel: cancel, done: make(chan struct{})}
+	go func() {
+		start := time.Now()
+		_, err := r.InstantiateModule(runCtx, compiled, moduleConfig)
+		run.elapsed = time.Since(start)
+		run.exitCode = wasmExitCode(err)
+		if run.exitCode != 0 && err != nil {
+			// Traps and interruptions are reported like a crash would be
+			fmt.Fprintf(stderrWriter, "%v\n", err)
+		}
+		stdoutWriter.Close()
+		stderrWriter.Close()
+		close(run.done)
+	}()
+
+	id := "wasm-" + uuid.New().String()
+	b.mu.Lock()
+	b.runs[id] = run
+	b.mu.Unlock()
+
+	return id, nil
+}
+
+// wasmExitCode maps the result of running a module to a process exit code:
+// proc_exit's code when it called it, -1 when interrupted and 1 for a trap
+func wasmExitCode(err error) int {
+	if err == nil {
+		return 0
+	}
+	var exitErr *sys.ExitError
+	if errors.As(err, &exitErr) {
+		switch exitErr.ExitCode() {
+		case sys.ExitCodeDeadlineExceeded, sys.ExitCodeContextCanceled:
+			return -1
+		}
+		return int(exitErr.ExitCode())
+	}
+	return 1
+}
+
+func (b *WasmBackend) run(id string) (*wasmRun, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	run, ok := b.runs[id]
+	if !ok {
+		return nil, fmt.Errorf("no such run: %s", id)
+	}
+	return run, nil
+}
+
+func (b *WasmBackend) Wait(ctx context.Context, id string) (int, error) {
+	run, err := b.run(id)
+	if err != nil {
+		return 0, err
+	}
+
+	select {
+	case <-run.done:
+		return run.exitCode, nil
+	case <-ctx.Done():
+		return 0, ctx.Err()
+	}
+}
+
+// Logs copies the module's output until it exits
+func (b *WasmBackend) Logs(ctx context.Context, id string, stdout, stderr io.Writer) error {
+	run, err := b.run(id)
+	if err != nil {
+		return err
+	}
+
+	return copyOutput(stdout, stderr, run.stdout, run.stderr)
+}
+
+// Stats approximates CPU time with the module's run time, as a module runs on
+// a single goroutine
+func (b *WasmBackend) Stats(ctx context.Context, id string) (*RunStats, error) {
+	run, err := b.run(id)
+	if err != nil {
+		return nil, err
+	}
+
+	select {
+	case <-run.done:
+		return &RunStats{CPUTime: run.elapsed}, nil
+	default:
+		return nil, fmt.Errorf("run %s is still running", id)
+	}
+}
+
+// Stop interrupts the module
+func (b *WasmBackend) Stop(ctx context.Context, id string) error {
+	run, err := b.run(id)
+	if err != nil {
+		return err
+	}
+	run.cancel()
+	<-run.done
+	return nil
+}
+
+// Remove stops the module if needed and frees its runtime
+func (b *WasmBackend) Remove(id string) error {
+	run, err := b.run(id)
+	if err != nil {
+		return err
+	}
+	run.cancel()
+	<-run.done
+	run.runtime.Close(context.Background())
+
+	b.mu.Lock()
+	delete(b.runs, id)
+	b.mu.Unlock()
+	return nil
+}
+
+func (b *WasmBackend) Close() error {
+	return b.cache.Close(context.Background())
+}
@@ -0,0 +1,290 @@
+package worker
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/rand"
+	"net/http"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/aKaddoura96/api-hosting-execution-platform/backend/executor/runtime"
+	"github.com/aKaddoura96/api-hosting-execution-platform/backend/shared/egress"
+	"github.com/aKaddoura96/api-hosting-execution-platform/backend/shared/logger"
+	"github.com/aKaddoura96/api-hosting-execution-platform/backend/shared/models"
+	"github.com/aKaddoura96/api-hosting-execution-platform/backend/shared/repository"
+	"github.com/aKaddoura96/api-hosting-execution-platform/backend/shared/webhooks"
+	"github.com/google/uuid"
+)
+
+const (
+	// leaseGrace is added to a job's timeout before another worker may reclaim it
+	leaseGrace = 60 * time.Second
+	// baseBackoff and maxBackoff bound the delay between attempts
+	baseBackoff = 10 * time.Second
+	maxBackoff  = 10 * time.Minute
+	// callbackAttempts is how often a completion callback is tried
+	callbackAttempts = 3
+)
+
+// Worker runs queued asynchronous executions
+type Worker struct {
+	id           string
+	executor     *runtime.Executor
+	jobs         *repository.JobRepository
+	execRepo     *repository.ExecutionRepository
+	webhookRepo  *repository.WebhookRepository
+	concurrency  int
+	pollInterval time.Duration
+	client       *http.Client
+}
+
+// NewWorker creates a worker pool. JOB_WORKERS sets how many jobs run at once
+// (default 2, 0 disables) and JOB_POLL_INTERVAL how often an idle worker
+// checks the queue (default 2s).
+func NewWorker(executor *runtime.Executor, jobs *repository.JobRepository, execRepo *repository.ExecutionRepository, webhookRepo *repository.WebhookRepository) *Worker {
+	hostname, _ := os.Hostname()
+
+	w := &Worker{
+		id:           fmt.Sprintf("%s-%s", hostname, uuid.New().String()[:8]),
+		executor:     executor,
+		jobs:         jobs,
+		execRepo:     execRepo,
+		webhookRepo:  webhookRepo,
+		concurrency:  2,
+		pollInterval: 2 * time.Second,
+		client:       egress.PublicClient(10 * time.Second),
+	}
+
+	if v, err := strconv.Atoi(os.Getenv("JOB_WORKERS")); err == nil && v >= 0 {
+		w.concurrency = v
+	}
+	if d, err := time.ParseDuration(os.Getenv("JOB_POLL_INTERVAL")); err == nil && d > 0 {
+		w.pollInterval = d
+	}
+
+	return w
+}
+
+// Run processes jobs until ctx is cancelled. Jobs already claimed then run to
+// completion, bounded by the executor's drain, and Run returns once they have.
+func (w *Worker) Run(ctx context.Context) {
+	if w.concurrency == 0 {
+		logger.Info("Job worker disabled")
+		return
+	}
+
+	logger.Info("Job worker started", map[string]interface{}{
+		"worker_id":   w.id,
+		"concurrency": w.concurrency,
+	})
+
+	var wg sync.WaitGroup
+	for i := 0; i < w.concurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			w.loop(ctx)
+		}()
+	}
+	wg.Wait()
+}
+
+func (w *Worker) loop(ctx context.Context) {
+	for ctx.Err() == nil {
+		job, err := w.jobs.Dequeue(w.id, leaseGrace)
+		if err != nil {
+			logger.Error("Failed to dequeue job", map[string]interface{}{"error": err.Error()})
+		}
+
+		if job != nil {
+			w.process(context.WithoutCancel(ctx), job)
+			continue
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(w.pollInterval):
+		}
+	}
+}
+
+// process runs one attempt of a job and records its outcome
+func (w *Worker) process(ctx context.Context, job *models.Job) {
+	log := logger.WithContext(ctx).WithFields(map[string]interface{}{
+		"job_id":  job.ID,
+		"api_id":  job.APIID,
+		"attempt": job.Attempts,
+	})
+
+	// Claimed again after its worker died on the final attempt
+	if job.Attempts > job.MaxAttempts {
+		w.deadLetter(log, job, "", "worker lost during final attempt", nil)
+		return
+	}
+
+	executionID := uuid.New().String()
+	startTime := time.Now()
+
+	result, err := w.executor.Execute(ctx, &runtime.ExecutionRequest{
+		ExecutionID:   executionID,
+		APIID:         job.APIID,
+		Code:          job.Code,
+		Runtime:       job.Runtime,
+		Input:         job.Input,
+		TimeoutSec:    job.TimeoutSec,
+		ResourceClass: job.ResourceClass,
+	})
+
+	var resultJSON json.RawMessage
+	var failure string
+	execution := &models.Execution{
+		ID:            executionID,
+		APIID:         job.APIID,
+		UserID:        job.UserID,
+		Duration:      time.Since(startTime),
+		ResourceClass: job.ResourceClass,
+	}
+	if job.Input != nil {
+		input, _ := json.Marshal(job.Input)
+		execution.RequestSize = int64(len(input))
+	}
+
+	var admissionErr *runtime.AdmissionError
+	if errors.As(err, &admissionErr) {
+		// Never admitted; the attempt is retried like any failure
+		failure = err.Error()
+		execution.StatusCode = http.StatusServiceUnavailable
+		execution.Error = failure
+		execution.QueueTime = execution.Duration
+		execution.Duration = 0
+	} else if err != nil {
+		failure = err.Error()
+		execution.StatusCode = http.StatusInternalServerError
+		execution.Error = failure
+	} else {
+		resultJSON, _ = json.Marshal(result)
+		execution.StatusCode = result.StatusCode
+		execution.Error = result.Error
+		execution.ResponseSize = int64(len(resultJSON))
+		execution.EgressBytes = result.EgressBytes
+		execution.QueueTime = time.Duration(result.QueueMs) * time.Millisecond
+		execution.Duration -= execution.QueueTime
+		if result.StatusCode >= 400 {
+			failure = result.Error
+		}
+	}
+
+	// Time waiting for a slot is recorded but not billed
+	if class, ok := models.GetResourceClass(job.ResourceClass); ok && admissionErr == nil {
+		execution.ComputeUnits = class.ComputeUnits(execution.Duration)
+	}
+
+	if err := w.execRepo.Create(execution); err != nil {
+		log.Error("Failed to record execution", map[string]interface{}{"error": err.Error()})
+	}
+	webhooks.EmitExecutionFailed(ctx, w.webhookRepo, execution)
+
+	if failure == "" {
+		if err := w.jobs.Complete(job.ID, executionID, resultJSON); err != nil {
+			log.Error("Failed to complete job", map[string]interface{}{"error": err.Error()})
+			return
+		}
+		log.Info("Job succeeded")
+		job.Status = models.JobStatusSucceeded
+		job.ExecutionID = executionID
+		job.Result = resultJSON
+		w.notify(log, job)
+		return
+	}
+
+	if job.Attempts >= job.MaxAttempts {
+		w.deadLetter(log, job, executionID, failure, resultJSON)
+		return
+	}
+
+	runAt := time.Now().Add(backoff(job.Attempts))
+	if err := w.jobs.Retry(job.ID, executionID, failure, resultJSON, runAt); err != nil {
+		log.Error("Failed to reschedule job", map[string]interface{}{"error": err.Error()})
+		return
+	}
+	log.Warn("Job attempt failed, retrying", map[string]interface{}{
+		"error":  failure,
+		"run_at": runAt.Format(time.RFC3339),
+	})
+}
+
+func (w *Worker) deadLetter(log *logger.Logger, job *models.Job, executionID, failure string, result json.RawMessage) {
+	if err := w.jobs.DeadLetter(job.ID, executionID, failure, result); err != nil {
+		log.Error("Failed to dead-letter job", map[string]interface{}{"error": err.Error()})
+		return
+	}
+	log.Error("Job dead-lettered", map[string]interface{}{"error": failure})
+
+	job.Status = models.JobStatusDead
+	job.LastError = failure
+	if executionID != "" {
+		job.ExecutionID = executionID
+	}
+	if result != nil {
+		job.Result = result
+	}
+	w.notify(log, job)
+}
+
+// notify POSTs the finished job to its callback URL, if it has one
+func (w *Worker) notify(log *logger.Logger, job *models.Job) {
+	if job.CallbackURL == "" {
+		return
+	}
+
+	body, _ := json.Marshal(job)
+	for attempt := 1; attempt <= callbackAttempts; attempt++ {
+		req, err := http.NewRequest("POST", job.CallbackURL, bytes.NewReader(body))
+		if err != nil {
+			log.Error("Invalid callback URL", map[string]interface{}{"error": err.Error()})
+			return
+		}
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("X-Job-ID", job.ID)
+
+		// The URL was checked when the job was queued, but its host may have
+		// been pointed at an internal address since
+		err = egress.CheckPublicURL(context.Background(), job.CallbackURL)
+		if errors.Is(err, egress.ErrNotPublic) {
+			log.Error("Callback URL is not public", map[string]interface{}{"callback_url": job.CallbackURL})
+			return
+		}
+
+		resp, err := w.client.Do(req)
+		if err == nil {
+			resp.Body.Close()
+			if resp.StatusCode < 300 {
+				w.jobs.MarkCallbackDelivered(job.ID)
+				return
+			}
+			err = fmt.Errorf("callback returned status %d", resp.StatusCode)
+		}
+
+		log.Warn("Job callback failed", map[string]interface{}{
+			"attempt": attempt,
+			"error":   err.Error(),
+		})
+		time.Sleep(time.Duration(attempt) * time.Second)
+	}
+}
+
+// backoff returns the delay before the next attempt: exponential with jitter
+func backoff(attempt int) time.Duration {
+	d := baseBackoff << uint(attempt-1)
+	if d <= 0 || d > maxBackoff {
+		d = maxBackoff
+	}
+	return d + time.Duration(rand.Int63n(int64(d/5)+1))
+}
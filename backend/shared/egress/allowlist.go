@@ -0,0 +1,115 @@
+package egress
+
+import (
+	"fmt"
+	"net"
+	"strings"
+)
+
+// MaxRules bounds the size of an allowlist
+const MaxRules = 50
+
+// Allowlist decides which destinations an execution may connect to. Rules
+// are exact domains ("api.example.com"), subdomain wildcards
+// ("*.example.com"), IP addresses or CIDR ranges.
+type Allowlist struct {
+	domains  map[string]bool
+	suffixes []string // ".example.com"
+	nets     []*net.IPNet
+}
+
+// Parse validates rules and builds an allowlist from them
+func Parse(rules []string) (*Allowlist, error) {
+	if len(rules) > MaxRules {
+		return nil, fmt.Errorf("allowlist may have at most %d entries", MaxRules)
+	}
+
+	a := &Allowlist{domains: map[string]bool{}}
+	for _, rule := range rules {
+		rule = strings.ToLower(strings.TrimSpace(rule))
+
+		if strings.Contains(rule, "/") {
+			_, ipNet, err := net.ParseCIDR(rule)
+			if err != nil {
+				return nil, fmt.Errorf("invalid CIDR %q", rule)
+			}
+			a.nets = append(a.nets, ipNet)
+			continue
+		}
+
+		if ip := net.ParseIP(rule); ip != nil {
+			bits := 32
+			if ip.To4() == nil {
+				bits = 128
+			}
+			a.nets = append(a.nets, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+			continue
+		}
+
+		if domain, ok := strings.CutPrefix(rule, "*."); ok {
+			if !validDomain(domain) {
+				return nil, fmt.Errorf("invalid domain %q", rule)
+			}
+			a.suffixes = append(a.suffixes, "."+domain)
+			continue
+		}
+
+		if !validDomain(rule) {
+			return nil, fmt.Errorf("invalid domain %q", rule)
+		}
+		a.domains[rule] = true
+	}
+
+	return a, nil
+}
+
+// AllowsHost reports whether a host name matches a domain rule
+func (a *Allowlist) AllowsHost(host string) bool {
+	host = strings.TrimSuffix(strings.ToLower(host), ".")
+	if a.domains[host] {
+		return true
+	}
+	for _, suffix := range a.suffixes {
+		if strings.HasSuffix(host, suffix) {
+			return true
+		}
+	}
+	return false
+}
+
+// AllowsIP reports whether an address matches an IP or CIDR rule
+func (a *Allowlist) AllowsIP(ip net.IP) bool {
+	for _, ipNet := range a.nets {
+		if ipNet.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// Permits decides whether ip may be dialled for host. A domain rule only
+// admits public addresses, so a DNS answer can't point an allowed name at
+// internal services; those must be listed explicitly as IPs or CIDRs.
+func (a *Allowlist) Permits(host string, ip net.IP) bool {
+	if a.AllowsIP(ip) {
+		return true
+	}
+	return a.AllowsHost(host) && IsPublic(ip)
+}
+
+func validDomain(domain string) bool {
+	if len(domain) == 0 || len(domain) > 253 || !strings.Contains(domain, ".") {
+		return false
+	}
+	for _, label := range strings.Split(domain, ".") {
+		if len(label) == 0 || len(label) > 63 || label[0] == '-' || label[len(label)-1] == '-' {
+			return false
+		}
+		for _, c := range label {
+			if !(c >= 'a' && c <= 'z' || c >= '0' && c <= '9' || c == '-') {
+				return false
+			}
+		}
+	}
+	return true
+}
@@ -0,0 +1,81 @@
+package egress
+
+import (
+	"fmt"
+	"net"
+	"testing"
+)
+
+func TestParse(t *testing.T) {
+	tooMany := make([]string, MaxRules+1)
+	for i := range tooMany {
+		tooMany[i] = fmt.Sprintf("host%d.example.com", i)
+	}
+
+	tests := []struct {
+		name    string
+		rules   []string
+		wantErr bool
+	}{
+		{name: "empty", rules: nil},
+		{name: "every kind of rule", rules: []string{"api.example.com", "*.example.org", "203.0.113.7", "10.0.0.0/8", "2001:db8::/32"}},
+		{name: "case and spaces", rules: []string{"  API.Example.COM "}},
+		{name: "as many as allowed", rules: tooMany[:MaxRules]},
+		{name: "too many", rules: tooMany, wantErr: true},
+		{name: "invalid CIDR", rules: []string{"10.0.0.0/33"}, wantErr: true},
+		{name: "bare name", rules: []string{"localhost"}, wantErr: true},
+		{name: "bare wildcard", rules: []string{"*"}, wantErr: true},
+		{name: "wildcard of a bare name", rules: []string{"*.com"}, wantErr: true},
+		{name: "label starting with a hyphen", rules: []string{"-bad.example.com"}, wantErr: true},
+		{name: "empty label", rules: []string{"api..example.com"}, wantErr: true},
+		{name: "invalid character", rules: []string{"api_1.example.com"}, wantErr: true},
+		{name: "URL", rules: []string{"https://api.example.com"}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := Parse(tt.rules)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Parse(%q) error = %v, wantErr %v", tt.rules, err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestAllowlistPermits(t *testing.T) {
+	allow, err := Parse([]string{"api.example.com", "*.example.org", "203.0.113.7", "10.1.0.0/16"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name string
+		host string
+		ip   string
+		want bool
+	}{
+		{name: "exact domain", host: "api.example.com", ip: "93.184.216.34", want: true},
+		{name: "exact domain, any case, trailing dot", host: "API.Example.com.", ip: "93.184.216.34", want: true},
+		{name: "other subdomain of an exact domain", host: "www.example.com", ip: "93.184.216.34", want: false},
+		{name: "wildcard subdomain", host: "a.b.example.org", ip: "93.184.216.34", want: true},
+		{name: "wildcard doesn't match the apex", host: "example.org", ip: "93.184.216.34", want: false},
+		{name: "suffix that isn't a subdomain", host: "badexample.org", ip: "93.184.216.34", want: false},
+		{name: "domain resolving to loopback", host: "api.example.com", ip: "127.0.0.1", want: false},
+		{name: "domain resolving to a private address", host: "api.example.com", ip: "192.168.1.10", want: false},
+		{name: "domain resolving to link-local", host: "a.example.org", ip: "169.254.169.254", want: false},
+		{name: "domain resolving to IPv6 loopback", host: "api.example.com", ip: "::1", want: false},
+		{name: "listed IP", host: "", ip: "203.0.113.7", want: true},
+		{name: "listed IP under any name", host: "other.example.net", ip: "203.0.113.7", want: true},
+		{name: "listed private range", host: "db.internal", ip: "10.1.2.3", want: true},
+		{name: "private address outside the range", host: "db.internal", ip: "10.2.0.1", want: false},
+		{name: "unlisted", host: "other.example.net", ip: "93.184.216.34", want: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := allow.Permits(tt.host, net.ParseIP(tt.ip)); got != tt.want {
+				t.Errorf("Permits(%q, %s) = %v, want %v", tt.host, tt.ip, got, tt.want)
+			}
+		})
+	}
+}
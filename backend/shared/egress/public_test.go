@@ -0,0 +1,79 @@
+package egress
+
+import (
+	"context"
+	"errors"
+	"net"
+	"testing"
+)
+
+func TestIsPublic(t *testing.T) {
+	tests := []struct {
+		ip   string
+		want bool
+	}{
+		{"93.184.216.34", true},
+		{"2606:2800:220:1:248:1893:25c8:1946", true},
+		{"127.0.0.1", false},
+		{"::1", false},
+		{"10.0.0.1", false},
+		{"172.16.0.1", false},
+		{"192.168.0.1", false},
+		{"fd00::1", false},
+		{"169.254.169.254", false},
+		{"fe80::1", false},
+		{"0.0.0.0", false},
+		{"::", false},
+		{"224.0.0.1", false},
+		{"::ffff:127.0.0.1", false},
+		{"0.1.2.3", false},
+		{"100.64.0.1", false},
+		{"100.127.255.254", false},
+		{"100.128.0.1", true},
+		{"192.0.0.170", false},
+		{"198.18.0.1", false},
+		{"198.19.255.254", false},
+		{"240.0.0.1", false},
+		{"255.255.255.255", false},
+		{"::ffff:100.64.0.1", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.ip, func(t *testing.T) {
+			if got := IsPublic(net.ParseIP(tt.ip)); got != tt.want {
+				t.Errorf("IsPublic(%s) = %v, want %v", tt.ip, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCheckPublicURL(t *testing.T) {
+	tests := []struct {
+		url           string
+		wantErr       bool
+		wantNotPublic bool
+	}{
+		{url: "https://93.184.216.34/hook"},
+		{url: "http://[2606:2800:220:1:248:1893:25c8:1946]:8080/hook"},
+		{url: "http://127.0.0.1:8081/execute", wantErr: true, wantNotPublic: true},
+		{url: "http://[::1]/", wantErr: true, wantNotPublic: true},
+		{url: "http://169.254.169.254/latest/meta-data", wantErr: true, wantNotPublic: true},
+		{url: "https://10.0.0.5/hook", wantErr: true, wantNotPublic: true},
+		{url: "ftp://93.184.216.34/hook", wantErr: true},
+		{url: "/relative/path", wantErr: true},
+		{url: "http://", wantErr: true},
+		{url: "://bad", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.url, func(t *testing.T) {
+			err := CheckPublicURL(context.Background(), tt.url)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("CheckPublicURL(%q) error = %v, wantErr %v", tt.url, err, tt.wantErr)
+			}
+			if errors.Is(err, ErrNotPublic) != tt.wantNotPublic {
+				t.Errorf("CheckPublicURL(%q) error = %v, want ErrNotPublic %v", tt.url, err, tt.wantNotPublic)
+			}
+		})
+	}
+}
@@ -0,0 +1,35 @@
+package logger
+
+import "context"
+
+type loggerKey struct{}
+type requestIDKey struct{}
+
+// RequestIDHeader carries the request ID between services
+const RequestIDHeader = "X-Request-ID"
+
+// NewContext returns a context carrying a request-scoped logger
+func NewContext(ctx context.Context, l *Logger) context.Context {
+	return context.WithValue(ctx, loggerKey{}, l)
+}
+
+// FromContext returns the request-scoped logger stored in ctx. Without one it
+// falls back to the default logger tagged with ctx's trace fields.
+func FromContext(ctx context.Context) *Logger {
+	if l, ok := ctx.Value(loggerKey{}).(*Logger); ok {
+		return l
+	}
+	return defaultLogger.WithContext(ctx)
+}
+
+// AddFields returns a context whose request-scoped logger also carries fields,
+// e.g. the user_id once a request is authenticated or the api_id once resolved
+func AddFields(ctx context.Context, fields map[string]interface{}) context.Context {
+	return NewContext(ctx, FromContext(ctx).WithFields(fields))
+}
+
+// RequestID returns the request ID assigned by HTTPLoggingMiddleware, if any
+func RequestID(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDKey{}).(string)
+	return id
+}
@@ -0,0 +1,109 @@
+package logger
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Entry is a single log record handed to an Encoder
+type Entry struct {
+	Time    time.Time
+	Level   LogLevel
+	Service string
+	Message string
+	Fields  map[string]interface{}
+	Caller  string // set for WARN and above
+}
+
+// Encoder renders an entry as one line of output (including the newline)
+type Encoder interface {
+	Encode(entry Entry) []byte
+}
+
+// EncoderFromEnv returns the encoder selected by LOG_FORMAT ("json" or "text")
+func EncoderFromEnv() Encoder {
+	if strings.EqualFold(os.Getenv("LOG_FORMAT"), "json") {
+		return JSONEncoder{}
+	}
+	return TextEncoder{}
+}
+
+// TextEncoder produces the human-readable bracketed format:
+//
+//	[2006-01-02 15:04:05.000] [INFO] [service] message | k=v k=v | caller=file:line
+type TextEncoder struct{}
+
+func (TextEncoder) Encode(entry Entry) []byte {
+	var b strings.Builder
+
+	fmt.Fprintf(&b, "[%s] [%s] [%s] %s",
+		entry.Time.Format("2006-01-02 15:04:05.000"),
+		entry.Level,
+		entry.Service,
+		entry.Message,
+	)
+
+	// Fields are sorted so lines are stable and easy to grep
+	if len(entry.Fields) > 0 {
+		b.WriteString(" |")
+		for _, k := range sortedKeys(entry.Fields) {
+			fmt.Fprintf(&b, " %s=%v", k, entry.Fields[k])
+		}
+	}
+
+	if entry.Caller != "" {
+		fmt.Fprintf(&b, " | caller=%s", entry.Caller)
+	}
+
+	b.WriteByte('\n')
+	return []byte(b.String())
+}
+
+// JSONEncoder produces one JSON object per line with fields at the top level
+type JSONEncoder struct{}
+
+func (JSONEncoder) Encode(entry Entry) []byte {
+	obj := make(map[string]interface{}, len(entry.Fields)+5)
+	for k, v := range entry.Fields {
+		// Errors marshal as {} by default
+		if err, ok := v.(error); ok {
+			v = err.Error()
+		}
+		obj[k] = v
+	}
+
+	// Reserved keys win over fields of the same name
+	obj["time"] = entry.Time.UTC().Format(time.RFC3339Nano)
+	obj["level"] = entry.Level
+	obj["service"] = entry.Service
+	obj["msg"] = entry.Message
+	if entry.Caller != "" {
+		obj["caller"] = entry.Caller
+	}
+
+	line, err := json.Marshal(obj)
+	if err != nil {
+		line, _ = json.Marshal(map[string]interface{}{
+			"time":    entry.Time.UTC().Format(time.RFC3339Nano),
+			"level":   entry.Level,
+			"service": entry.Service,
+			"msg":     entry.Message,
+			"error":   "failed to encode log fields: " + err.Error(),
+		})
+	}
+
+	return append(line, '\n')
+}
+
+func sortedKeys(m map[string]interface{}) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -1,11 +1,19 @@
 package logger
 
 import (
+	"context"
 	"fmt"
+	"io"
 	"log"
+	"math/rand"
 	"os"
 	"runtime"
+	"strconv"
+	"strings"
+	"sync"
 	"time"
+
+	"github.com/aKaddoura96/api-hosting-execution-platform/backend/shared/tracing"
 )
 
 // LogLevel represents the severity of a log message
@@ -19,17 +27,84 @@ const (
 	FATAL LogLevel = "FATAL"
 )
 
+// severity orders levels so we can compare them
+func (l LogLevel) severity() int {
+	switch l {
+	case DEBUG:
+		return 0
+	case INFO:
+		return 1
+	case WARN:
+		return 2
+	case ERROR:
+		return 3
+	case FATAL:
+		return 4
+	default:
+		return 1
+	}
+}
+
+// ParseLevel converts a level name such as "debug" or "WARN" to a LogLevel
+func ParseLevel(s string) (LogLevel, error) {
+	switch strings.ToUpper(strings.TrimSpace(s)) {
+	case "DEBUG":
+		return DEBUG, nil
+	case "INFO":
+		return INFO, nil
+	case "WARN", "WARNING":
+		return WARN, nil
+	case "ERROR":
+		return ERROR, nil
+	case "FATAL":
+		return FATAL, nil
+	default:
+		return INFO, fmt.Errorf("unknown log level: %q", s)
+	}
+}
+
+// sink is the output shared by a logger and all loggers derived from it
+type sink struct {
+	mu      sync.Mutex
+	out     io.Writer
+	encoder Encoder
+}
+
 // Logger handles structured logging
 type Logger struct {
 	serviceName string
 	level       LogLevel
+	fields      map[string]interface{} // attached to every entry
+	sink        *sink
+
+	// httpSampleRate is the fraction of successful LogHTTPRequest entries kept
+	httpSampleRate float64
 }
 
-// NewLogger creates a new logger instance
+// NewLogger creates a new logger instance.
+//
+// LOG_LEVEL sets the minimum level (default INFO), LOG_FORMAT selects the
+// encoder ("text" or "json", default text) and LOG_HTTP_SAMPLE_RATE keeps only
+// that fraction of successful HTTP request entries (default 1).
 func NewLogger(serviceName string) *Logger {
+	level := INFO
+	if lvl, err := ParseLevel(os.Getenv("LOG_LEVEL")); err == nil {
+		level = lvl
+	}
+
+	sampleRate := 1.0
+	if rate, err := strconv.ParseFloat(os.Getenv("LOG_HTTP_SAMPLE_RATE"), 64); err == nil && rate >= 0 && rate <= 1 {
+		sampleRate = rate
+	}
+
 	return &Logger{
 		serviceName: serviceName,
-		level:       INFO, // Default to INFO
+		level:       level,
+		sink: &sink{
+			out:     os.Stdout,
+			encoder: EncoderFromEnv(),
+		},
+		httpSampleRate: sampleRate,
 	}
 }
 
@@ -38,41 +113,88 @@ func (l *Logger) SetLevel(level LogLevel) {
 	l.level = level
 }
 
-// log formats and writes a log message
-func (l *Logger) log(level LogLevel, message string, fields map[string]interface{}) {
-	// Get caller information
-	_, file, line, ok := runtime.Caller(2)
-	caller := "unknown"
-	if ok {
-		caller = fmt.Sprintf("%s:%d", file, line)
+// SetOutput redirects this logger (and loggers derived from it) to w
+func (l *Logger) SetOutput(w io.Writer) {
+	l.sink.mu.Lock()
+	defer l.sink.mu.Unlock()
+	l.sink.out = w
+}
+
+// SetEncoder changes how entries are rendered
+func (l *Logger) SetEncoder(encoder Encoder) {
+	l.sink.mu.Lock()
+	defer l.sink.mu.Unlock()
+	l.sink.encoder = encoder
+}
+
+// SetHTTPSampleRate keeps only the given fraction (0-1) of successful
+// LogHTTPRequest entries. Client and server errors are always logged.
+func (l *Logger) SetHTTPSampleRate(rate float64) {
+	l.httpSampleRate = rate
+}
+
+// WithFields returns a child logger that adds the given fields to every entry
+func (l *Logger) WithFields(fields map[string]interface{}) *Logger {
+	merged := make(map[string]interface{}, len(l.fields)+len(fields))
+	for k, v := range l.fields {
+		merged[k] = v
+	}
+	for k, v := range fields {
+		merged[k] = v
 	}
+	return &Logger{
+		serviceName:    l.serviceName,
+		level:          l.level,
+		fields:         merged,
+		sink:           l.sink,
+		httpSampleRate: l.httpSampleRate,
+	}
+}
 
-	// Format timestamp
-	timestamp := time.Now().Format("2006-01-02 15:04:05.000")
+// WithContext returns a child logger tagged with the trace_id and span_id
+// carried by ctx, or l itself if ctx has no trace
+func (l *Logger) WithContext(ctx context.Context) *Logger {
+	sc, ok := tracing.SpanContextFromContext(ctx)
+	if !ok {
+		return l
+	}
+	return l.WithFields(map[string]interface{}{
+		"trace_id": sc.TraceIDString(),
+		"span_id":  sc.SpanIDString(),
+	})
+}
 
-	// Build log entry
-	entry := fmt.Sprintf("[%s] [%s] [%s] %s", 
-		timestamp,
-		level,
-		l.serviceName,
-		message,
-	)
+// log formats and writes a log message
+func (l *Logger) log(level LogLevel, message string, fields map[string]interface{}) {
+	if level.severity() < l.level.severity() {
+		return
+	}
 
-	// Add fields if provided
-	if len(fields) > 0 {
-		entry += " |"
-		for k, v := range fields {
-			entry += fmt.Sprintf(" %s=%v", k, v)
-		}
+	entry := Entry{
+		Time:    time.Now(),
+		Level:   level,
+		Service: l.serviceName,
+		Message: message,
+		Fields:  make(map[string]interface{}, len(l.fields)+len(fields)),
+	}
+	for k, v := range l.fields {
+		entry.Fields[k] = v
+	}
+	for k, v := range fields {
+		entry.Fields[k] = v
 	}
 
 	// Add caller for WARN, ERROR, FATAL
 	if level == WARN || level == ERROR || level == FATAL {
-		entry += fmt.Sprintf(" | caller=%s", caller)
+		entry.Caller = "unknown"
+		if _, file, line, ok := runtime.Caller(2); ok {
+			entry.Caller = fmt.Sprintf("%s:%d", file, line)
+		}
 	}
 
-	// Write to stdout
-	fmt.Println(entry)
+	l.sink.mu.Lock()
+	l.sink.out.Write(l.sink.encoder.Encode(entry))
+	l.sink.mu.Unlock()
 
 	// Exit on FATAL
 	if level == FATAL {
@@ -82,13 +204,11 @@ func (l *Logger) log(level LogLevel, message string, fields map[string]interface
 
 // Debug logs a debug message
 func (l *Logger) Debug(message string, fields ...map[string]interface{}) {
-	if l.level == DEBUG {
-		var f map[string]interface{}
-		if len(fields) > 0 {
-			f = fields[0]
-		}
-		l.log(DEBUG, message, f)
+	var f map[string]interface{}
+	if len(fields) > 0 {
+		f = fields[0]
 	}
+	l.log(DEBUG, message, f)
 }
 
 // Info logs an info message
@@ -127,13 +247,18 @@ func (l *Logger) Fatal(message string, fields ...map[string]interface{}) {
 	l.log(FATAL, message, f)
 }
 
-// LogHTTPRequest logs an HTTP request
+// LogHTTPRequest logs an HTTP request. Successful requests are subject to the
+// logger's HTTP sample rate; 4xx and 5xx responses are always logged.
 func (l *Logger) LogHTTPRequest(method, path, remoteAddr string, statusCode int, duration time.Duration) {
-	l.Info("HTTP Request", map[string]interface{}{
-		"method":     method,
-		"path":       path,
-		"remote":     remoteAddr,
-		"status":     statusCode,
+	if statusCode < 400 && l.httpSampleRate < 1 && rand.Float64() >= l.httpSampleRate {
+		return
+	}
+
+	l.log(INFO, "HTTP Request", map[string]interface{}{
+		"method":      method,
+		"path":        path,
+		"remote":      remoteAddr,
+		"status":      statusCode,
 		"duration_ms": duration.Milliseconds(),
 	})
 }
@@ -179,9 +304,14 @@ func Fatal(message string, fields ...map[string]interface{}) {
 	defaultLogger.Fatal(message, fields...)
 }
 
+// WithContext returns the default logger tagged with ctx's trace fields
+func WithContext(ctx context.Context) *Logger {
+	return defaultLogger.WithContext(ctx)
+}
+
 // SetDefaultLogger sets the default logger
 func SetDefaultLogger(logger *Logger) {
 	defaultLogger = logger
-	log.SetOutput(os.Stdout)
+	log.SetOutput(logger.sink.out)
 	log.SetFlags(0) // Disable default log prefix as we handle it
 }
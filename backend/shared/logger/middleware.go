@@ -1,8 +1,11 @@
 package logger
 
 import (
+	"context"
 	"net/http"
 	"time"
+
+	"github.com/google/uuid"
 )
 
 // responseWriter wraps http.ResponseWriter to capture status code
@@ -27,12 +30,35 @@ func (rw *responseWriter) Write(b []byte) (int, error) {
 	return rw.ResponseWriter.Write(b)
 }
 
-// HTTPLoggingMiddleware logs HTTP requests
+// Flush lets streaming handlers (SSE, chunked output) flush through the wrapper
+func (rw *responseWriter) Flush() {
+	if f, ok := rw.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// HTTPLoggingMiddleware logs HTTP requests and stores a request-scoped logger
+// (tagged with request_id) in the request context; handlers retrieve it with
+// FromContext. An incoming X-Request-ID is reused, otherwise one is generated.
+// Register it after tracing.HTTPMiddleware so entries carry the trace_id.
 func HTTPLoggingMiddleware(logger *Logger) func(http.Handler) http.Handler {
 	return func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 			start := time.Now()
 
+			requestID := r.Header.Get(RequestIDHeader)
+			if requestID == "" || len(requestID) > 128 {
+				requestID = uuid.New().String()
+			}
+			w.Header().Set(RequestIDHeader, requestID)
+
+			reqLogger := logger.WithContext(r.Context()).WithFields(map[string]interface{}{
+				"request_id": requestID,
+			})
+			ctx := context.WithValue(r.Context(), requestIDKey{}, requestID)
+			ctx = NewContext(ctx, reqLogger)
+			r = r.WithContext(ctx)
+
 			// Wrap the response writer
 			wrapped := &responseWriter{
 				ResponseWriter: w,
@@ -44,7 +70,7 @@ func HTTPLoggingMiddleware(logger *Logger) func(http.Handler) http.Handler {
 
 			// Log the request
 			duration := time.Since(start)
-			logger.LogHTTPRequest(
+			reqLogger.LogHTTPRequest(
 				r.Method,
 				r.URL.Path,
 				r.RemoteAddr,
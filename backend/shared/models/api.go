@@ -8,12 +8,14 @@ type API struct {
 	Name        string    `json:"name"`
 	Description string    `json:"description"`
 	Version     string    `json:"version"`
-	Runtime     string    `json:"runtime"` // "python", "go", "nodejs"
+	Runtime     string    `json:"runtime"` // a name in the runtimes table
 	Visibility  string    `json:"visibility"` // "public", "private", "paid"
 	Status      string    `json:"status"` // "pending", "deployed", "failed"
 	Endpoint    string    `json:"endpoint"` // Generated endpoint URL
 	CodePath    string    `json:"code_path"` // Path to uploaded code
 	ContainerID string    `json:"container_id,omitempty"`
+	ResourceClass string    `json:"resource_class"` // see ResourceClasses
+	Warnings    []string  `json:"warnings,omitempty"` // e.g. a deprecated runtime; not stored
 	CreatedAt   time.Time `json:"created_at"`
 	UpdatedAt   time.Time `json:"updated_at"`
 }
@@ -0,0 +1,18 @@
+package models
+
+import "time"
+
+// CachedImage is an image held by an executor node: a runtime image it pulled
+// or a custom image it built. Nodes record when each last ran, so the least
+// recently used are removed first when images outgrow the node's disk budget.
+type CachedImage struct {
+	NodeID    string `json:"node_id"`
+	Image     string `json:"image"`
+	APIID     string `json:"api_id,omitempty"` // set on custom images
+	SizeBytes int64  `json:"size_bytes"`
+	// Pinned images are those of enabled runtimes, which are never removed
+	Pinned     bool      `json:"pinned"`
+	LastUsedAt time.Time `json:"last_used_at"`
+	CachedAt   time.Time `json:"cached_at"`
+	UpdatedAt  time.Time `json:"updated_at"`
+}
@@ -0,0 +1,43 @@
+package models
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// APIVersion is a snapshot of an API's code taken on upload
+type APIVersion struct {
+	ID            string    `json:"id"`
+	APIID         string    `json:"api_id"`
+	Version       string    `json:"version"`
+	Runtime       string    `json:"runtime"`
+	CodePath      string    `json:"code_path"`
+	CodeSHA256    string    `json:"code_sha256"`
+	ResourceClass string    `json:"resource_class"`
+	CreatedAt     time.Time `json:"created_at"`
+	UpdatedAt     time.Time `json:"updated_at"`
+}
+
+// CaptureSettings controls whether executions of an API are captured
+type CaptureSettings struct {
+	APIID         string    `json:"api_id"`
+	Enabled       bool      `json:"enabled"`
+	RedactHeaders []string  `json:"redact_headers"` // header names, case-insensitive
+	RedactFields  []string  `json:"redact_fields"`  // JSON keys or dotted paths in input/result
+	UpdatedAt     time.Time `json:"updated_at"`
+}
+
+// ExecutionCapture is the recorded request envelope and response of an execution
+type ExecutionCapture struct {
+	ExecutionID    string            `json:"execution_id"`
+	APIID          string            `json:"api_id"`
+	Version        string            `json:"version"`
+	Method         string            `json:"method"`
+	Path           string            `json:"path"`
+	Query          string            `json:"query"`
+	Headers        map[string]string `json:"headers"`
+	Body           json.RawMessage   `json:"body,omitempty"`
+	ResponseStatus int               `json:"response_status"`
+	ResponseBody   json.RawMessage   `json:"response_body,omitempty"`
+	CreatedAt      time.Time         `json:"created_at"`
+}
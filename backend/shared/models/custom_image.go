@@ -0,0 +1,29 @@
+package models
+
+import "time"
+
+// RuntimeCustom runs an image built from the API's own Dockerfile
+const RuntimeCustom = "custom"
+
+// Custom image build statuses
+const (
+	CustomImagePending  = "pending"
+	CustomImageBuilding = "building"
+	CustomImageReady    = "ready"
+	CustomImageFailed   = "failed"
+)
+
+// CustomImage is the Dockerfile of an API with the custom runtime and the
+// state of its build
+type CustomImage struct {
+	APIID      string `json:"api_id"`
+	Dockerfile string `json:"dockerfile"`
+	Image      string `json:"image,omitempty"` // set once built
+	Status     string `json:"status"`
+	SizeBytes  int64  `json:"size_bytes,omitempty"`
+	// BuildLog is the tail of the build output
+	BuildLog  string    `json:"build_log,omitempty"`
+	Error     string    `json:"error,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
@@ -0,0 +1,11 @@
+package models
+
+import "time"
+
+// EgressPolicy controls outbound network access of an API's executions
+type EgressPolicy struct {
+	APIID     string    `json:"api_id"`
+	Enabled   bool      `json:"enabled"`
+	Allowlist []string  `json:"allowlist"` // domains (*.example.com for subdomains), IPs or CIDRs
+	UpdatedAt time.Time `json:"updated_at"`
+}
@@ -0,0 +1,20 @@
+package models
+
+import "time"
+
+// EnvVar is an environment variable set on an API's execution containers.
+// Secret values are only held encrypted and are never returned by the API.
+type EnvVar struct {
+	ID        string    `json:"id"`
+	APIID     string    `json:"api_id"`
+	Version   string    `json:"version,omitempty"` // empty applies to every version
+	Name      string    `json:"name"`
+	Value     string    `json:"value,omitempty"`
+	Secret    bool      `json:"secret"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+
+	// Encrypted secret value and its wrapped data key
+	Ciphertext []byte `json:"-"`
+	WrappedKey []byte `json:"-"`
+}
@@ -8,8 +8,12 @@ type Execution struct {
 	UserID         string        `json:"user_id"` // Consumer who invoked
 	StatusCode     int           `json:"status_code"`
 	Duration       time.Duration `json:"duration"` // Execution time in ms
+	QueueTime      time.Duration `json:"queue_time"` // waiting for an executor slot, not in Duration
 	RequestSize    int64         `json:"request_size"` // Bytes
 	ResponseSize   int64         `json:"response_size"` // Bytes
 	Error          string        `json:"error,omitempty"`
+	ResourceClass  string        `json:"resource_class"`
+	ComputeUnits   int64         `json:"compute_units"` // billed, see ResourceClass.ComputeUnits
+	EgressBytes    int64         `json:"egress_bytes"` // through the egress proxy
 	ExecutedAt     time.Time     `json:"executed_at"`
 }
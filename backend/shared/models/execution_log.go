@@ -0,0 +1,14 @@
+package models
+
+import "time"
+
+// ExecutionLog is a single line of output produced by user code
+type ExecutionLog struct {
+	ID          int64     `json:"id"`
+	ExecutionID string    `json:"execution_id"`
+	APIID       string    `json:"api_id"`
+	Stream      string    `json:"stream"` // "stdout", "stderr"
+	Level       string    `json:"level"`  // "debug", "info", "warn", "error"
+	Message     string    `json:"message"`
+	LoggedAt    time.Time `json:"logged_at"`
+}
@@ -0,0 +1,40 @@
+package models
+
+import "time"
+
+// ExecutorNode is an executor registered in the executor_nodes table. Nodes
+// refresh their entry with a heartbeat; the gateway sends executions to the
+// live ones.
+type ExecutorNode struct {
+	ID      string `json:"id"`
+	URL     string `json:"url"` // where the gateway reaches the node
+	Backend string `json:"backend"`
+	// Runtimes are the registry runtimes the node can run; nil is any
+	Runtimes    []string  `json:"runtimes"`
+	Capacity    int       `json:"capacity"` // executions it runs at once
+	Running     int       `json:"running"`
+	Queued      int       `json:"queued"`
+	StartedAt   time.Time `json:"started_at"`
+	HeartbeatAt time.Time `json:"heartbeat_at"`
+}
+
+// CanRun reports whether the node runs runtime
+func (n *ExecutorNode) CanRun(runtime string) bool {
+	if n.Runtimes == nil || runtime == "" {
+		return true
+	}
+	for _, name := range n.Runtimes {
+		if name == runtime {
+			return true
+		}
+	}
+	return false
+}
+
+// Load is the node's executions, running and waiting, per slot
+func (n *ExecutorNode) Load() float64 {
+	if n.Capacity <= 0 {
+		return float64(n.Running + n.Queued)
+	}
+	return float64(n.Running+n.Queued) / float64(n.Capacity)
+}
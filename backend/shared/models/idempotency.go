@@ -0,0 +1,26 @@
+package models
+
+import "time"
+
+// Idempotency key statuses
+const (
+	IdempotencyPending   = "pending"
+	IdempotencyCompleted = "completed"
+)
+
+// IdempotencyKey is an execute request sent with an Idempotency-Key header
+// and, once it has finished, the response repeats of it get
+type IdempotencyKey struct {
+	APIID  string `json:"api_id"`
+	Caller string `json:"caller"` // user of the API key, if any
+	Key    string `json:"key"`
+	// Fingerprint tells a repeat of the request from another request that
+	// reuses its key
+	Fingerprint     string              `json:"fingerprint"`
+	Status          string              `json:"status"`
+	ResponseStatus  int                 `json:"response_status"`
+	ResponseHeaders map[string][]string `json:"response_headers,omitempty"`
+	ResponseBody    []byte              `json:"-"`
+	CreatedAt       time.Time           `json:"created_at"`
+	ExpiresAt       time.Time           `json:"expires_at"`
+}
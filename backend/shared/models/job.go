@@ -0,0 +1,37 @@
+package models
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// Job statuses. A job that fails its last attempt is dead-lettered.
+const (
+	JobStatusQueued    = "queued"
+	JobStatusRunning   = "running"
+	JobStatusSucceeded = "succeeded"
+	JobStatusDead      = "dead"
+)
+
+// Job is an asynchronous execution waiting in, or finished with, the queue
+type Job struct {
+	ID            string                 `json:"id"`
+	APIID         string                 `json:"api_id"`
+	UserID        string                 `json:"user_id,omitempty"`
+	ExecutionID   string                 `json:"execution_id,omitempty"` // latest attempt
+	Status        string                 `json:"status"`
+	Runtime       string                 `json:"runtime"`
+	Code          string                 `json:"-"`
+	Input         map[string]interface{} `json:"input,omitempty"`
+	TimeoutSec    int                    `json:"timeout_sec"`
+	ResourceClass string                 `json:"resource_class"`
+	CallbackURL   string                 `json:"callback_url,omitempty"`
+	Attempts      int                    `json:"attempts"`
+	MaxAttempts   int                    `json:"max_attempts"`
+	RunAt         time.Time              `json:"run_at"` // next attempt, while queued
+	Result        json.RawMessage        `json:"result,omitempty"`
+	LastError     string                 `json:"last_error,omitempty"`
+	CreatedAt     time.Time              `json:"created_at"`
+	UpdatedAt     time.Time              `json:"updated_at"`
+	CompletedAt   *time.Time             `json:"completed_at,omitempty"`
+}
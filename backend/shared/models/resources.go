@@ -0,0 +1,73 @@
+package models
+
+import "time"
+
+// ResourceClass is a size of execution container a developer can pick per API
+type ResourceClass struct {
+	Name          string  `json:"name"`
+	MemoryMB      int64   `json:"memory_mb"`
+	CPUs          float64 `json:"cpus"`
+	PidsLimit     int64   `json:"pids_limit"`
+	MaxTimeoutSec int     `json:"max_timeout_sec"` // ceiling for timeout_sec
+	TmpDiskMB     int64   `json:"tmp_disk_mb"`     // size of the writable /tmp
+	// BillingWeight is the compute units charged per millisecond of run time
+	BillingWeight float64 `json:"billing_weight"`
+}
+
+// DefaultResourceClass matches the limits executions had before classes existed
+const DefaultResourceClass = "small"
+
+// ResourceClasses lists the available classes, smallest first
+var ResourceClasses = []*ResourceClass{
+	{Name: "nano", MemoryMB: 128, CPUs: 0.25, PidsLimit: 32, MaxTimeoutSec: 30, TmpDiskMB: 64, BillingWeight: 0.5},
+	{Name: "small", MemoryMB: 256, CPUs: 0.5, PidsLimit: 50, MaxTimeoutSec: 60, TmpDiskMB: 128, BillingWeight: 1},
+	{Name: "medium", MemoryMB: 512, CPUs: 1, PidsLimit: 100, MaxTimeoutSec: 300, TmpDiskMB: 256, BillingWeight: 2},
+	{Name: "large", MemoryMB: 1024, CPUs: 2, PidsLimit: 200, MaxTimeoutSec: 600, TmpDiskMB: 512, BillingWeight: 4},
+	{Name: "xlarge", MemoryMB: 2048, CPUs: 4, PidsLimit: 400, MaxTimeoutSec: 900, TmpDiskMB: 1024, BillingWeight: 8},
+}
+
+// PlanResourceClassLimit is the largest class each developer plan may use
+var PlanResourceClassLimit = map[string]string{
+	"free":    "small",
+	"basic":   "medium",
+	"premium": "xlarge",
+}
+
+// GetResourceClass looks a class up by name; empty selects the default
+func GetResourceClass(name string) (*ResourceClass, bool) {
+	if name == "" {
+		name = DefaultResourceClass
+	}
+	for _, class := range ResourceClasses {
+		if class.Name == name {
+			return class, true
+		}
+	}
+	return nil, false
+}
+
+// AllowedOn reports whether a developer on plan may use the class
+func (c *ResourceClass) AllowedOn(plan string) bool {
+	limit, ok := PlanResourceClassLimit[plan]
+	if !ok {
+		limit = PlanResourceClassLimit["free"]
+	}
+	for _, class := range ResourceClasses {
+		if class.Name == c.Name {
+			return true
+		}
+		if class.Name == limit {
+			return false
+		}
+	}
+	return false
+}
+
+// ComputeUnits is what an execution of duration d in the class is billed
+func (c *ResourceClass) ComputeUnits(d time.Duration) int64 {
+	ms := d.Milliseconds()
+	if ms < 1 {
+		ms = 1
+	}
+	return int64(float64(ms)*c.BillingWeight + 0.5)
+}
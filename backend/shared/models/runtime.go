@@ -0,0 +1,96 @@
+package models
+
+import (
+	"encoding/base64"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// RuntimeWASM runs compiled WebAssembly (WASI) modules instead of source code
+const RuntimeWASM = "wasm"
+
+// Runtime engines: containers on the executor's backend, or WASM modules run
+// in-process
+const (
+	EngineContainer = "container"
+	EngineWASM      = "wasm"
+)
+
+// Runtime is an entry of the runtime registry (the runtimes table). Each
+// version of a language is an entry of its own, e.g. python3.12 in family
+// python.
+type Runtime struct {
+	Name    string `json:"name"`
+	Family  string `json:"family"`
+	Version string `json:"version,omitempty"`
+	// DeprecatedAt is when the runtime stops being offered for new APIs
+	DeprecatedAt *time.Time `json:"deprecated_at,omitempty"`
+	Engine       string     `json:"engine"`
+	Image        string     `json:"image,omitempty"`
+	Extension    string     `json:"extension"`
+	// BuildCommand is a shell command run before RunCommand, if set
+	BuildCommand string `json:"build_command,omitempty"`
+	// RunCommand is the argv to run; {file} and {code} are substituted
+	RunCommand []string `json:"run_command"`
+	// Handler tells developers how code receives input and returns output
+	Handler              string    `json:"handler"`
+	DefaultResourceClass string    `json:"default_resource_class"`
+	DefaultTimeoutSec    int       `json:"default_timeout_sec"`
+	Enabled              bool      `json:"enabled"`
+	CreatedAt            time.Time `json:"created_at"`
+}
+
+// Deprecated reports whether the runtime's deprecation date has passed
+func (rt *Runtime) Deprecated(now time.Time) bool {
+	return rt.DeprecatedAt != nil && !now.Before(*rt.DeprecatedAt)
+}
+
+// DeprecationWarning describes a runtime's deprecation, pointing at
+// successor if there is one; empty if it has no deprecation date
+func (rt *Runtime) DeprecationWarning(successor string, now time.Time) string {
+	if rt.DeprecatedAt == nil {
+		return ""
+	}
+
+	date := rt.DeprecatedAt.Format("2006-01-02")
+	warning := fmt.Sprintf("Runtime %s will be deprecated on %s", rt.Name, date)
+	if rt.Deprecated(now) {
+		warning = fmt.Sprintf("Runtime %s was deprecated on %s", rt.Name, date)
+	}
+	if successor != "" {
+		warning += "; move to " + successor
+	}
+	return warning
+}
+
+// CodeFile is the name code is written to in the working directory
+func (rt *Runtime) CodeFile() string {
+	return "main" + rt.Extension
+}
+
+// Command returns the argv that runs code: RunCommand with {file} and {code}
+// filled in, behind BuildCommand (with {file} filled in) when there is one
+func (rt *Runtime) Command(code string) []string {
+	replacer := strings.NewReplacer("{file}", rt.CodeFile(), "{code}", code)
+
+	var cmd []string
+	if rt.BuildCommand != "" {
+		// "$@" passes the run command through without shell quoting
+		cmd = []string{"/bin/sh", "-c", strings.ReplaceAll(rt.BuildCommand, "{file}", rt.CodeFile()) + ` && exec "$@"`, "sh"}
+	}
+	for _, arg := range rt.RunCommand {
+		cmd = append(cmd, replacer.Replace(arg))
+	}
+	return cmd
+}
+
+// EncodeCode returns uploaded code in the form the executor expects. WASM
+// modules are binary, so they travel base64 encoded through JSON and the jobs
+// table; source code is sent as is.
+func EncodeCode(runtime string, code []byte) string {
+	if runtime == RuntimeWASM {
+		return base64.StdEncoding.EncodeToString(code)
+	}
+	return string(code)
+}
@@ -0,0 +1,87 @@
+package models
+
+import (
+	"fmt"
+	"time"
+)
+
+// MaxReplicasLimit is the most replicas one API may scale to
+const MaxReplicasLimit = 20
+
+// ScalingPolicy controls whether an API runs as persistent replicas and how
+// many. Replicas are long-running servers: the code listens for HTTP on
+// $PORT and every request to the API is forwarded to one of them.
+type ScalingPolicy struct {
+	APIID       string `json:"api_id"`
+	MinReplicas int    `json:"min_replicas"` // 0 scales to zero when idle
+	MaxReplicas int    `json:"max_replicas"` // 0 runs every request as its own execution
+	// TargetConcurrency is the in-flight requests one replica should handle
+	TargetConcurrency int `json:"target_concurrency"`
+	// TargetLatencyMS adds a replica while the average request is slower; 0
+	// scales on concurrency alone
+	TargetLatencyMS int       `json:"target_latency_ms"`
+	IdleTimeoutSec  int       `json:"idle_timeout_sec"`
+	UpdatedAt       time.Time `json:"updated_at"`
+}
+
+// DefaultScalingPolicy is the policy of an API that never set one: no
+// replicas, with the defaults that apply once max_replicas is raised
+func DefaultScalingPolicy(apiID string) *ScalingPolicy {
+	return &ScalingPolicy{
+		APIID:             apiID,
+		TargetConcurrency: 10,
+		IdleTimeoutSec:    300,
+	}
+}
+
+// Persistent reports whether the API runs as replicas
+func (p *ScalingPolicy) Persistent() bool {
+	return p.MaxReplicas > 0
+}
+
+// IdleTimeout is how long the API may go without requests before its
+// replicas are stopped, if MinReplicas allows
+func (p *ScalingPolicy) IdleTimeout() time.Duration {
+	return time.Duration(p.IdleTimeoutSec) * time.Second
+}
+
+// Validate checks the bounds and targets
+func (p *ScalingPolicy) Validate() error {
+	switch {
+	case p.MaxReplicas < 0 || p.MaxReplicas > MaxReplicasLimit:
+		return fmt.Errorf("max_replicas must be between 0 and %d", MaxReplicasLimit)
+	case p.MinReplicas < 0 || p.MinReplicas > p.MaxReplicas:
+		return fmt.Errorf("min_replicas must be between 0 and max_replicas")
+	case p.TargetConcurrency < 1:
+		return fmt.Errorf("target_concurrency must be at least 1")
+	case p.TargetLatencyMS < 0:
+		return fmt.Errorf("target_latency_ms must not be negative")
+	case p.IdleTimeoutSec < 10:
+		return fmt.Errorf("idle_timeout_sec must be at least 10")
+	}
+	return nil
+}
+
+// ReplicaMissingHeader is set on the executor's 404 for a replica it doesn't
+// run, telling it apart from a 404 of the API itself
+const ReplicaMissingHeader = "X-Replica-Missing"
+
+// Replica states
+const (
+	ReplicaStarting = "starting"
+	ReplicaReady    = "ready"
+)
+
+// Replica is one running server of a persistent API, recorded in the
+// api_replicas table by the executor node running it. The gateway reaches it
+// through that node.
+type Replica struct {
+	ID        string    `json:"id"`
+	APIID     string    `json:"api_id"`
+	NodeID    string    `json:"node_id"`
+	Version   string    `json:"version"`
+	Status    string    `json:"status"`
+	InFlight  int       `json:"in_flight"` // as of UpdatedAt
+	StartedAt time.Time `json:"started_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
@@ -0,0 +1,50 @@
+package models
+
+import "time"
+
+// Overlap policies decide what happens when a schedule fires while its
+// previous run is still queued or running
+const (
+	OverlapSkip  = "skip"  // drop the new run
+	OverlapQueue = "queue" // start it once the previous run finishes
+	OverlapAllow = "allow" // run concurrently
+)
+
+// Schedule run statuses. Once enqueued, progress is tracked by the job.
+const (
+	ScheduleRunPending  = "pending"
+	ScheduleRunEnqueued = "enqueued"
+	ScheduleRunSkipped  = "skipped"
+)
+
+// Schedule invokes an API on a cron expression with a fixed input
+type Schedule struct {
+	ID            string                 `json:"id"`
+	APIID         string                 `json:"api_id"`
+	Name          string                 `json:"name"`
+	CronExpr      string                 `json:"cron_expr"` // standard 5-field or @hourly/@daily/...
+	Timezone      string                 `json:"timezone"`  // IANA name, e.g. "Europe/Berlin"
+	Input         map[string]interface{} `json:"input,omitempty"`
+	TimeoutSec    int                    `json:"timeout_sec"`
+	OverlapPolicy string                 `json:"overlap_policy"`
+	CatchUpLimit  int                    `json:"catch_up_limit"`
+	Enabled       bool                   `json:"enabled"`
+	NextRunAt     time.Time              `json:"next_run_at"`
+	LastRunAt     *time.Time             `json:"last_run_at,omitempty"`
+	CreatedAt     time.Time              `json:"created_at"`
+	UpdatedAt     time.Time              `json:"updated_at"`
+}
+
+// ScheduleRun is one fire time of a schedule
+type ScheduleRun struct {
+	ID           string    `json:"id"`
+	ScheduleID   string    `json:"schedule_id"`
+	ScheduledFor time.Time `json:"scheduled_for"`
+	Status       string    `json:"status"`
+	Reason       string    `json:"reason,omitempty"`
+	JobID        string    `json:"job_id,omitempty"`
+	JobStatus    string    `json:"job_status,omitempty"`
+	ExecutionID  string    `json:"execution_id,omitempty"`
+	Error        string    `json:"error,omitempty"`
+	CreatedAt    time.Time `json:"created_at"`
+}
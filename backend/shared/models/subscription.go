@@ -0,0 +1,48 @@
+package models
+
+import "time"
+
+// Subscription plans
+const (
+	PlanFree    = "free"
+	PlanBasic   = "basic"
+	PlanPremium = "premium"
+)
+
+// Subscription statuses
+const (
+	SubscriptionActive    = "active"
+	SubscriptionCancelled = "cancelled"
+	SubscriptionExpired   = "expired"
+)
+
+// SubscriptionPeriod is how long a subscription runs before it has to be
+// renewed
+const SubscriptionPeriod = 30 * 24 * time.Hour
+
+// PlanDailyQuotas is how many executions a day each plan allows a subscriber
+var PlanDailyQuotas = map[string]int64{
+	PlanFree:    100,
+	PlanBasic:   10000,
+	PlanPremium: 100000,
+}
+
+// QuotaNearLimitPercent is the share of the daily quota at which
+// quota.near_limit is raised
+const QuotaNearLimitPercent = 80
+
+// Active reports whether the subscription is in force at now
+func (s *Subscription) Active(now time.Time) bool {
+	return s.Status == SubscriptionActive && now.Before(s.ExpiresAt)
+}
+
+// DailyQuota is how many executions a day the subscription allows
+func (s *Subscription) DailyQuota() int64 {
+	return PlanDailyQuotas[s.Plan]
+}
+
+// NearLimit is the execution count of a day at which the subscriber is told
+// they are close to the quota
+func (s *Subscription) NearLimit() int64 {
+	return s.DailyQuota() * QuotaNearLimitPercent / 100
+}
@@ -6,12 +6,16 @@ import (
 	"golang.org/x/crypto/bcrypt"
 )
 
+// RoleAdmin is the role of the platform's operators. Signup never grants it;
+// it is set in the database.
+const RoleAdmin = "admin"
+
 type User struct {
 	ID                   string    `json:"id"`
 	Email                string    `json:"email"`
 	PasswordHash         string    `json:"-"`
 	Name                 string    `json:"name"`
-	Role                 string    `json:"role"` // "developer" or "consumer"
+	Role                 string    `json:"role"` // "developer", "consumer" or RoleAdmin
 	EmailVerified        bool      `json:"email_verified"`
 	VerificationToken    string    `json:"-"`
 	PasswordResetToken   string    `json:"-"`
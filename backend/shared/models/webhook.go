@@ -0,0 +1,76 @@
+package models
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// Webhook event types
+const (
+	EventDeploymentSucceeded   = "deployment.succeeded"
+	EventDeploymentFailed      = "deployment.failed"
+	EventAPIStopped            = "api.stopped"
+	EventExecutionFailed       = "execution.failed"
+	EventQuotaNearLimit        = "quota.near_limit"
+	EventSubscriptionCreated   = "subscription.created"
+	EventSubscriptionCancelled = "subscription.cancelled"
+	EventKeyExpiring           = "key.expiring"
+)
+
+// WebhookEventTypes lists every event a webhook can subscribe to
+var WebhookEventTypes = []string{
+	EventDeploymentSucceeded,
+	EventDeploymentFailed,
+	EventAPIStopped,
+	EventExecutionFailed,
+	EventQuotaNearLimit,
+	EventSubscriptionCreated,
+	EventSubscriptionCancelled,
+	EventKeyExpiring,
+}
+
+// Webhook delivery statuses
+const (
+	DeliveryPending   = "pending"
+	DeliveryDelivered = "delivered"
+	DeliveryFailed    = "failed" // gave up after max attempts
+)
+
+type Webhook struct {
+	ID        string    `json:"id"`
+	UserID    string    `json:"user_id"`
+	URL       string    `json:"url"`
+	Secret    string    `json:"secret,omitempty"` // only returned when created
+	Events    []string  `json:"events"`           // empty means every event
+	IsActive  bool      `json:"is_active"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// WebhookEvent is the JSON body POSTed to webhook URLs
+type WebhookEvent struct {
+	ID        string                 `json:"id"`
+	Type      string                 `json:"type"`
+	CreatedAt time.Time              `json:"created_at"`
+	Data      map[string]interface{} `json:"data"`
+}
+
+type WebhookDelivery struct {
+	ID             string          `json:"id"`
+	WebhookID      string          `json:"webhook_id"`
+	EventID        string          `json:"event_id"`
+	EventType      string          `json:"event_type"`
+	Payload        json.RawMessage `json:"payload"`
+	Status         string          `json:"status"`
+	Attempts       int             `json:"attempts"`
+	MaxAttempts    int             `json:"max_attempts"`
+	NextAttemptAt  time.Time       `json:"next_attempt_at"`
+	ResponseStatus int             `json:"response_status,omitempty"`
+	LastError      string          `json:"last_error,omitempty"`
+	DeliveredAt    *time.Time      `json:"delivered_at,omitempty"`
+	CreatedAt      time.Time       `json:"created_at"`
+
+	// Set when claimed for sending
+	URL    string `json:"-"`
+	Secret string `json:"-"`
+}
@@ -0,0 +1,72 @@
+// Package nodeauth authenticates gateways to executor nodes with a shared
+// secret
+package nodeauth
+
+import (
+	"crypto/subtle"
+	"fmt"
+	"net/http"
+	"os"
+	"time"
+)
+
+// TokenHeader carries the secret gateways present to executor nodes
+const TokenHeader = "X-Executor-Token"
+
+// minTokenLength keeps the secret from being guessable
+const minTokenLength = 32
+
+// TokenFromEnv reads EXECUTOR_TOKEN, the secret shared by the gateways and
+// executor nodes. It is required: the executor API starts and stops
+// containers and runs code.
+func TokenFromEnv() (string, error) {
+	token := os.Getenv("EXECUTOR_TOKEN")
+	if token == "" {
+		return "", fmt.Errorf("EXECUTOR_TOKEN not set")
+	}
+	if len(token) < minTokenLength {
+		return "", fmt.Errorf("EXECUTOR_TOKEN must be at least %d characters", minTokenLength)
+	}
+	return token, nil
+}
+
+// Require rejects requests without the executor token. The header is
+// removed once checked, so it is never passed on to API code.
+func Require(token string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			got := r.Header.Get(TokenHeader)
+			if subtle.ConstantTimeCompare([]byte(got), []byte(token)) != 1 {
+				http.Error(w, "Unauthorized", http.StatusUnauthorized)
+				return
+			}
+			r.Header.Del(TokenHeader)
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// Client returns a client that sends the executor token with every
+// request; it must only be used for executor nodes, and doesn't follow
+// redirects, which could take the token elsewhere. A zero timeout has none.
+func Client(token string, timeout time.Duration) *http.Client {
+	return &http.Client{
+		Timeout:   timeout,
+		Transport: &executorTransport{token: token, base: http.DefaultTransport},
+		CheckRedirect: func(*http.Request, []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+}
+
+type executorTransport struct {
+	token string
+	base  http.RoundTripper
+}
+
+func (t *executorTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	// A RoundTripper must not modify the request it is given
+	req = req.Clone(req.Context())
+	req.Header.Set(TokenHeader, t.token)
+	return t.base.RoundTrip(req)
+}
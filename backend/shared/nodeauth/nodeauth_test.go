@@ -0,0 +1,77 @@
+package nodeauth
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+const testToken = "0123456789abcdef0123456789abcdef"
+
+func TestRequire(t *testing.T) {
+	tests := []struct {
+		name   string
+		token  string
+		status int
+	}{
+		{"no token", "", http.StatusUnauthorized},
+		{"wrong token", "0123456789abcdef0123456789abcdeX", http.StatusUnauthorized},
+		{"prefix of token", testToken[:16], http.StatusUnauthorized},
+		{"token", testToken, http.StatusOK},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var forwarded string
+			handler := Require(testToken)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				forwarded = r.Header.Get(TokenHeader)
+			}))
+
+			req := httptest.NewRequest(http.MethodPost, "/execute", nil)
+			if tt.token != "" {
+				req.Header.Set(TokenHeader, tt.token)
+			}
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, req)
+
+			if rec.Code != tt.status {
+				t.Errorf("status = %d, want %d", rec.Code, tt.status)
+			}
+			if forwarded != "" {
+				t.Errorf("token passed on to handler")
+			}
+		})
+	}
+}
+
+func TestClientSendsToken(t *testing.T) {
+	server := httptest.NewServer(Require(testToken)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})))
+	defer server.Close()
+
+	resp, err := Client(testToken, 0).Get(server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Errorf("status = %d, want %d", resp.StatusCode, http.StatusOK)
+	}
+}
+
+func TestTokenFromEnv(t *testing.T) {
+	tests := []struct {
+		token   string
+		wantErr bool
+	}{
+		{"", true},
+		{"short", true},
+		{testToken, false},
+	}
+
+	for _, tt := range tests {
+		t.Setenv("EXECUTOR_TOKEN", tt.token)
+		if _, err := TokenFromEnv(); (err != nil) != tt.wantErr {
+			t.Errorf("TokenFromEnv() with %q: err = %v, wantErr %v", tt.token, err, tt.wantErr)
+		}
+	}
+}
@@ -20,14 +20,14 @@ func (r *APIRepository) Create(api *models.API) error {
 	api.ID = uuid.New().String()
 	
 	query := `
-		INSERT INTO apis (id, user_id, name, description, version, runtime, visibility, status, endpoint, code_path)
-		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)
+		INSERT INTO apis (id, user_id, name, description, version, runtime, visibility, status, endpoint, code_path, resource_class)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11)
 		RETURNING created_at, updated_at
 	`
 	
 	return r.db.QueryRow(
 		query, api.ID, api.UserID, api.Name, api.Description, api.Version,
-		api.Runtime, api.Visibility, api.Status, api.Endpoint, api.CodePath,
+		api.Runtime, api.Visibility, api.Status, api.Endpoint, api.CodePath, api.ResourceClass,
 	).Scan(&api.CreatedAt, &api.UpdatedAt)
 }
 
@@ -36,14 +36,14 @@ func (r *APIRepository) GetByID(id string) (*models.API, error) {
 	
 	query := `
 		SELECT id, user_id, name, description, version, runtime, visibility, status,
-		       endpoint, COALESCE(code_path, ''), COALESCE(container_id, ''), created_at, updated_at
+		       endpoint, COALESCE(code_path, ''), COALESCE(container_id, ''), resource_class, created_at, updated_at
 		FROM apis WHERE id = $1
 	`
 	
 	err := r.db.QueryRow(query, id).Scan(
 		&api.ID, &api.UserID, &api.Name, &api.Description, &api.Version,
 		&api.Runtime, &api.Visibility, &api.Status, &api.Endpoint, &api.CodePath,
-		&api.ContainerID, &api.CreatedAt, &api.UpdatedAt,
+		&api.ContainerID, &api.ResourceClass, &api.CreatedAt, &api.UpdatedAt,
 	)
 	
 	if err == sql.ErrNoRows {
@@ -56,7 +56,7 @@ func (r *APIRepository) GetByID(id string) (*models.API, error) {
 func (r *APIRepository) GetByUserID(userID string) ([]*models.API, error) {
 	query := `
 		SELECT id, user_id, name, description, version, runtime, visibility, status,
-		       endpoint, COALESCE(code_path, ''), COALESCE(container_id, ''), created_at, updated_at
+		       endpoint, COALESCE(code_path, ''), COALESCE(container_id, ''), resource_class, created_at, updated_at
 		FROM apis WHERE user_id = $1
 		ORDER BY created_at DESC
 	`
@@ -73,7 +73,7 @@ func (r *APIRepository) GetByUserID(userID string) ([]*models.API, error) {
 		err := rows.Scan(
 			&api.ID, &api.UserID, &api.Name, &api.Description, &api.Version,
 			&api.Runtime, &api.Visibility, &api.Status, &api.Endpoint, &api.CodePath,
-			&api.ContainerID, &api.CreatedAt, &api.UpdatedAt,
+			&api.ContainerID, &api.ResourceClass, &api.CreatedAt, &api.UpdatedAt,
 		)
 		if err != nil {
 			return nil, err
@@ -87,7 +87,7 @@ func (r *APIRepository) GetByUserID(userID string) ([]*models.API, error) {
 func (r *APIRepository) GetPublicAPIs() ([]*models.API, error) {
 	query := `
 		SELECT id, user_id, name, description, version, runtime, visibility, status,
-		       endpoint, COALESCE(code_path, ''), COALESCE(container_id, ''), created_at, updated_at
+		       endpoint, COALESCE(code_path, ''), COALESCE(container_id, ''), resource_class, created_at, updated_at
 		FROM apis WHERE visibility = 'public' AND status = 'deployed'
 		ORDER BY created_at DESC
 	`
@@ -104,7 +104,7 @@ func (r *APIRepository) GetPublicAPIs() ([]*models.API, error) {
 		err := rows.Scan(
 			&api.ID, &api.UserID, &api.Name, &api.Description, &api.Version,
 			&api.Runtime, &api.Visibility, &api.Status, &api.Endpoint, &api.CodePath,
-			&api.ContainerID, &api.CreatedAt, &api.UpdatedAt,
+			&api.ContainerID, &api.ResourceClass, &api.CreatedAt, &api.UpdatedAt,
 		)
 		if err != nil {
 			return nil, err
@@ -140,10 +140,11 @@ func (r *APIRepository) UpdateCodePath(id, codePath string) error {
 func (r *APIRepository) Update(api *models.API) error {
 	query := `
 		UPDATE apis 
-		SET name = $1, description = $2, visibility = $3, endpoint = $4, updated_at = CURRENT_TIMESTAMP
-		WHERE id = $5
+		SET name = $1, description = $2, visibility = $3, endpoint = $4, version = $5, resource_class = $6,
+		    updated_at = CURRENT_TIMESTAMP
+		WHERE id = $7
 	`
-	_, err := r.db.Exec(query, api.Name, api.Description, api.Visibility, api.Endpoint, api.ID)
+	_, err := r.db.Exec(query, api.Name, api.Description, api.Visibility, api.Endpoint, api.Version, api.ResourceClass, api.ID)
 	return err
 }
 
@@ -0,0 +1,81 @@
+package repository
+
+import (
+	"database/sql"
+	"fmt"
+
+	"github.com/aKaddoura96/api-hosting-execution-platform/backend/shared/models"
+)
+
+type APIVersionRepository struct {
+	db *sql.DB
+}
+
+func NewAPIVersionRepository(db *sql.DB) *APIVersionRepository {
+	return &APIVersionRepository{db: db}
+}
+
+// Upsert records the code snapshot for a version, replacing an earlier upload
+// of the same version
+func (r *APIVersionRepository) Upsert(v *models.APIVersion) error {
+	query := `
+		INSERT INTO api_versions (api_id, version, runtime, code_path, code_sha256, resource_class)
+		VALUES ($1, $2, $3, $4, $5, $6)
+		ON CONFLICT (api_id, version) DO UPDATE
+		SET runtime = EXCLUDED.runtime, code_path = EXCLUDED.code_path, code_sha256 = EXCLUDED.code_sha256,
+		    resource_class = EXCLUDED.resource_class, updated_at = CURRENT_TIMESTAMP
+		RETURNING id, created_at, updated_at
+	`
+
+	return r.db.QueryRow(
+		query, v.APIID, v.Version, v.Runtime, v.CodePath, v.CodeSHA256, v.ResourceClass,
+	).Scan(&v.ID, &v.CreatedAt, &v.UpdatedAt)
+}
+
+func (r *APIVersionRepository) GetByVersion(apiID, version string) (*models.APIVersion, error) {
+	v := &models.APIVersion{}
+
+	query := `
+		SELECT id, api_id, version, runtime, code_path, code_sha256, resource_class, created_at, updated_at
+		FROM api_versions WHERE api_id = $1 AND version = $2
+	`
+
+	err := r.db.QueryRow(query, apiID, version).Scan(
+		&v.ID, &v.APIID, &v.Version, &v.Runtime, &v.CodePath, &v.CodeSHA256, &v.ResourceClass,
+		&v.CreatedAt, &v.UpdatedAt,
+	)
+
+	if err == sql.ErrNoRows {
+		return nil, fmt.Errorf("version not found")
+	}
+
+	return v, err
+}
+
+func (r *APIVersionRepository) GetByAPIID(apiID string) ([]*models.APIVersion, error) {
+	query := `
+		SELECT id, api_id, version, runtime, code_path, code_sha256, resource_class, created_at, updated_at
+		FROM api_versions WHERE api_id = $1
+		ORDER BY created_at DESC
+	`
+
+	rows, err := r.db.Query(query, apiID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var versions []*models.APIVersion
+	for rows.Next() {
+		v := &models.APIVersion{}
+		if err := rows.Scan(
+			&v.ID, &v.APIID, &v.Version, &v.Runtime, &v.CodePath, &v.CodeSHA256, &v.ResourceClass,
+			&v.CreatedAt, &v.UpdatedAt,
+		); err != nil {
+			return nil, err
+		}
+		versions = append(versions, v)
+	}
+
+	return versions, rows.Err()
+}
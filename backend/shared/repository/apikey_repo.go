@@ -5,6 +5,7 @@ import (
 	"database/sql"
 	"encoding/hex"
 	"fmt"
+	"time"
 
 	"github.com/aKaddoura96/api-hosting-execution-platform/backend/shared/models"
 	"github.com/google/uuid"
@@ -109,6 +110,53 @@ func (r *APIKeyRepository) Deactivate(id string) error {
 	return err
 }
 
+// GetExpiringUnnotified returns active keys expiring before the given time
+// that have not yet triggered a key.expiring event
+func (r *APIKeyRepository) GetExpiringUnnotified(before time.Time) ([]*models.APIKey, error) {
+	query := `
+		SELECT id, user_id, api_id, key, name, is_active, expires_at, created_at
+		FROM api_keys
+		WHERE is_active = true AND expiry_notified_at IS NULL
+		  AND expires_at IS NOT NULL AND expires_at > CURRENT_TIMESTAMP AND expires_at <= $1
+	`
+
+	rows, err := r.db.Query(query, before.UTC())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var apiKeys []*models.APIKey
+	for rows.Next() {
+		apiKey := &models.APIKey{}
+		var apiID sql.NullString
+
+		if err := rows.Scan(
+			&apiKey.ID, &apiKey.UserID, &apiID, &apiKey.Key,
+			&apiKey.Name, &apiKey.IsActive, &apiKey.ExpiresAt, &apiKey.CreatedAt,
+		); err != nil {
+			return nil, err
+		}
+
+		apiKey.APIID = apiID.String
+		apiKeys = append(apiKeys, apiKey)
+	}
+
+	return apiKeys, rows.Err()
+}
+
+// MarkExpiryNotified claims a key's expiry notification; false means another
+// instance already sent it
+func (r *APIKeyRepository) MarkExpiryNotified(id string) (bool, error) {
+	query := `UPDATE api_keys SET expiry_notified_at = CURRENT_TIMESTAMP WHERE id = $1 AND expiry_notified_at IS NULL`
+	res, err := r.db.Exec(query, id)
+	if err != nil {
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	return n == 1, err
+}
+
 func generateAPIKey() (string, error) {
 	bytes := make([]byte, 32)
 	if _, err := rand.Read(bytes); err != nil {
@@ -0,0 +1,89 @@
+package repository
+
+import (
+	"database/sql"
+
+	"github.com/aKaddoura96/api-hosting-execution-platform/backend/shared/models"
+)
+
+type CachedImageRepository struct {
+	db *sql.DB
+}
+
+func NewCachedImageRepository(db *sql.DB) *CachedImageRepository {
+	return &CachedImageRepository{db: db}
+}
+
+const cachedImageColumns = `
+	node_id, image, api_id, size_bytes, pinned, last_used_at, cached_at, updated_at
+`
+
+func scanCachedImage(row rowScanner) (*models.CachedImage, error) {
+	image := &models.CachedImage{}
+	err := row.Scan(
+		&image.NodeID, &image.Image, &image.APIID, &image.SizeBytes,
+		&image.Pinned, &image.LastUsedAt, &image.CachedAt, &image.UpdatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+	return image, nil
+}
+
+// Save records an image held by a node or refreshes its size and last use
+func (r *CachedImageRepository) Save(image *models.CachedImage) error {
+	query := `
+		INSERT INTO executor_images (node_id, image, api_id, size_bytes, pinned, last_used_at)
+		VALUES ($1, $2, $3, $4, $5, $6)
+		ON CONFLICT (node_id, image) DO UPDATE
+		SET api_id = EXCLUDED.api_id, size_bytes = EXCLUDED.size_bytes, pinned = EXCLUDED.pinned,
+			last_used_at = EXCLUDED.last_used_at, updated_at = CURRENT_TIMESTAMP
+		RETURNING cached_at, updated_at
+	`
+
+	return r.db.QueryRow(
+		query, image.NodeID, image.Image, image.APIID, image.SizeBytes,
+		image.Pinned, image.LastUsedAt,
+	).Scan(&image.CachedAt, &image.UpdatedAt)
+}
+
+// GetByNode returns the images a node recorded
+func (r *CachedImageRepository) GetByNode(nodeID string) ([]*models.CachedImage, error) {
+	query := `SELECT ` + cachedImageColumns + ` FROM executor_images WHERE node_id = $1`
+	return r.query(query, nodeID)
+}
+
+// GetRegistered returns the images of the nodes in the registry, most
+// recently used first
+func (r *CachedImageRepository) GetRegistered() ([]*models.CachedImage, error) {
+	query := `
+		SELECT ` + cachedImageColumns + ` FROM executor_images
+		WHERE node_id IN (SELECT id FROM executor_nodes)
+		ORDER BY node_id, last_used_at DESC
+	`
+	return r.query(query)
+}
+
+func (r *CachedImageRepository) query(query string, args ...interface{}) ([]*models.CachedImage, error) {
+	rows, err := r.db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	images := []*models.CachedImage{}
+	for rows.Next() {
+		image, err := scanCachedImage(rows)
+		if err != nil {
+			return nil, err
+		}
+		images = append(images, image)
+	}
+
+	return images, rows.Err()
+}
+
+func (r *CachedImageRepository) Delete(nodeID, image string) error {
+	_, err := r.db.Exec(`DELETE FROM executor_images WHERE node_id = $1 AND image = $2`, nodeID, image)
+	return err
+}
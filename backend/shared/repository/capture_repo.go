@@ -0,0 +1,114 @@
+package repository
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+
+	"github.com/aKaddoura96/api-hosting-execution-platform/backend/shared/models"
+	"github.com/lib/pq"
+)
+
+type CaptureRepository struct {
+	db *sql.DB
+}
+
+func NewCaptureRepository(db *sql.DB) *CaptureRepository {
+	return &CaptureRepository{db: db}
+}
+
+// GetSettings returns the capture settings for an API (disabled if never set)
+func (r *CaptureRepository) GetSettings(apiID string) (*models.CaptureSettings, error) {
+	settings := &models.CaptureSettings{APIID: apiID}
+
+	query := `
+		SELECT enabled, redact_headers, redact_fields, updated_at
+		FROM capture_settings WHERE api_id = $1
+	`
+
+	err := r.db.QueryRow(query, apiID).Scan(
+		&settings.Enabled, pq.Array(&settings.RedactHeaders), pq.Array(&settings.RedactFields),
+		&settings.UpdatedAt,
+	)
+
+	if err == sql.ErrNoRows {
+		return settings, nil
+	}
+
+	return settings, err
+}
+
+func (r *CaptureRepository) UpsertSettings(settings *models.CaptureSettings) error {
+	query := `
+		INSERT INTO capture_settings (api_id, enabled, redact_headers, redact_fields)
+		VALUES ($1, $2, $3, $4)
+		ON CONFLICT (api_id) DO UPDATE
+		SET enabled = EXCLUDED.enabled, redact_headers = EXCLUDED.redact_headers,
+		    redact_fields = EXCLUDED.redact_fields, updated_at = CURRENT_TIMESTAMP
+		RETURNING updated_at
+	`
+
+	return r.db.QueryRow(
+		query, settings.APIID, settings.Enabled,
+		pq.Array(settings.RedactHeaders), pq.Array(settings.RedactFields),
+	).Scan(&settings.UpdatedAt)
+}
+
+func (r *CaptureRepository) Create(capture *models.ExecutionCapture) error {
+	headers, err := json.Marshal(capture.Headers)
+	if err != nil {
+		return fmt.Errorf("failed to encode headers: %w", err)
+	}
+
+	query := `
+		INSERT INTO execution_captures (execution_id, api_id, version, request_method, request_path,
+		                                request_query, request_headers, request_body, response_status, response_body)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)
+		RETURNING created_at
+	`
+
+	return r.db.QueryRow(
+		query, capture.ExecutionID, capture.APIID, capture.Version, capture.Method, capture.Path,
+		capture.Query, string(headers), nullableJSON(capture.Body),
+		capture.ResponseStatus, nullableJSON(capture.ResponseBody),
+	).Scan(&capture.CreatedAt)
+}
+
+func (r *CaptureRepository) GetByExecutionID(executionID string) (*models.ExecutionCapture, error) {
+	capture := &models.ExecutionCapture{}
+
+	query := `
+		SELECT execution_id, api_id, version, request_method, request_path, request_query,
+		       request_headers, request_body, response_status, response_body, created_at
+		FROM execution_captures WHERE execution_id = $1
+	`
+
+	var headers, body, responseBody []byte
+	err := r.db.QueryRow(query, executionID).Scan(
+		&capture.ExecutionID, &capture.APIID, &capture.Version, &capture.Method, &capture.Path,
+		&capture.Query, &headers, &body, &capture.ResponseStatus, &responseBody, &capture.CreatedAt,
+	)
+
+	if err == sql.ErrNoRows {
+		return nil, fmt.Errorf("capture not found")
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if err := json.Unmarshal(headers, &capture.Headers); err != nil {
+		return nil, fmt.Errorf("failed to decode headers: %w", err)
+	}
+	capture.Body = body
+	capture.ResponseBody = responseBody
+
+	return capture, nil
+}
+
+// nullableJSON passes JSON documents as text (pq would send []byte as bytea)
+func nullableJSON(doc json.RawMessage) interface{} {
+	if len(doc) == 0 {
+		return nil
+	}
+	return string(doc)
+}
@@ -0,0 +1,100 @@
+package repository
+
+import (
+	"database/sql"
+
+	"github.com/aKaddoura96/api-hosting-execution-platform/backend/shared/models"
+)
+
+type CustomImageRepository struct {
+	db *sql.DB
+}
+
+func NewCustomImageRepository(db *sql.DB) *CustomImageRepository {
+	return &CustomImageRepository{db: db}
+}
+
+const customImageColumns = `
+	api_id, dockerfile, image, status, size_bytes, build_log, error, created_at, updated_at
+`
+
+func scanCustomImage(row rowScanner) (*models.CustomImage, error) {
+	img := &models.CustomImage{}
+	err := row.Scan(
+		&img.APIID, &img.Dockerfile, &img.Image, &img.Status, &img.SizeBytes,
+		&img.BuildLog, &img.Error, &img.CreatedAt, &img.UpdatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+	return img, nil
+}
+
+// GetByAPIID returns the API's custom image; sql.ErrNoRows if it has none
+func (r *CustomImageRepository) GetByAPIID(apiID string) (*models.CustomImage, error) {
+	query := `SELECT ` + customImageColumns + ` FROM custom_images WHERE api_id = $1`
+	return scanCustomImage(r.db.QueryRow(query, apiID))
+}
+
+// Upsert sets the API's Dockerfile, leaving the image pending a build
+func (r *CustomImageRepository) Upsert(img *models.CustomImage) error {
+	query := `
+		INSERT INTO custom_images (api_id, dockerfile)
+		VALUES ($1, $2)
+		ON CONFLICT (api_id) DO UPDATE
+		SET dockerfile = EXCLUDED.dockerfile, status = 'pending', build_log = '', error = '',
+		    updated_at = CURRENT_TIMESTAMP
+		RETURNING ` + customImageColumns
+
+	built, err := scanCustomImage(r.db.QueryRow(query, img.APIID, img.Dockerfile))
+	if err != nil {
+		return err
+	}
+	*img = *built
+	return nil
+}
+
+// MarkBuilding claims a pending or failed image for building, returning
+// false if it is already building
+func (r *CustomImageRepository) MarkBuilding(apiID string) (bool, error) {
+	query := `
+		UPDATE custom_images
+		SET status = 'building', updated_at = CURRENT_TIMESTAMP
+		WHERE api_id = $1 AND status != 'building'
+	`
+
+	res, err := r.db.Exec(query, apiID)
+	if err != nil {
+		return false, err
+	}
+	n, _ := res.RowsAffected()
+	return n > 0, nil
+}
+
+// MarkReady records a successful build of dockerfile, unless the API's
+// Dockerfile has been replaced since
+func (r *CustomImageRepository) MarkReady(apiID, dockerfile, image string, sizeBytes int64, buildLog string) error {
+	query := `
+		UPDATE custom_images
+		SET status = 'ready', image = $1, size_bytes = $2, build_log = $3, error = '',
+		    updated_at = CURRENT_TIMESTAMP
+		WHERE api_id = $4 AND dockerfile = $5
+	`
+
+	_, err := r.db.Exec(query, image, sizeBytes, buildLog, apiID, dockerfile)
+	return err
+}
+
+// MarkFailed records a failed build of dockerfile, unless the API's
+// Dockerfile has been replaced since. The previous image, if any, stays in
+// use.
+func (r *CustomImageRepository) MarkFailed(apiID, dockerfile, buildLog, buildErr string) error {
+	query := `
+		UPDATE custom_images
+		SET status = 'failed', build_log = $1, error = $2, updated_at = CURRENT_TIMESTAMP
+		WHERE api_id = $3 AND dockerfile = $4
+	`
+
+	_, err := r.db.Exec(query, buildLog, buildErr, apiID, dockerfile)
+	return err
+}
@@ -0,0 +1,45 @@
+package repository
+
+import (
+	"database/sql"
+
+	"github.com/aKaddoura96/api-hosting-execution-platform/backend/shared/models"
+	"github.com/lib/pq"
+)
+
+type EgressRepository struct {
+	db *sql.DB
+}
+
+func NewEgressRepository(db *sql.DB) *EgressRepository {
+	return &EgressRepository{db: db}
+}
+
+// GetPolicy returns the egress policy of an API (disabled if never set)
+func (r *EgressRepository) GetPolicy(apiID string) (*models.EgressPolicy, error) {
+	policy := &models.EgressPolicy{APIID: apiID, Allowlist: []string{}}
+
+	query := `
+		SELECT enabled, allowlist, updated_at
+		FROM egress_policies WHERE api_id = $1
+	`
+
+	err := r.db.QueryRow(query, apiID).Scan(&policy.Enabled, pq.Array(&policy.Allowlist), &policy.UpdatedAt)
+	if err == sql.ErrNoRows {
+		return policy, nil
+	}
+
+	return policy, err
+}
+
+func (r *EgressRepository) UpsertPolicy(policy *models.EgressPolicy) error {
+	query := `
+		INSERT INTO egress_policies (api_id, enabled, allowlist)
+		VALUES ($1, $2, $3)
+		ON CONFLICT (api_id) DO UPDATE
+		SET enabled = EXCLUDED.enabled, allowlist = EXCLUDED.allowlist, updated_at = CURRENT_TIMESTAMP
+		RETURNING updated_at
+	`
+
+	return r.db.QueryRow(query, policy.APIID, policy.Enabled, pq.Array(policy.Allowlist)).Scan(&policy.UpdatedAt)
+}
@@ -0,0 +1,105 @@
+package repository
+
+import (
+	"database/sql"
+
+	"github.com/aKaddoura96/api-hosting-execution-platform/backend/shared/models"
+)
+
+type EnvVarRepository struct {
+	db *sql.DB
+}
+
+func NewEnvVarRepository(db *sql.DB) *EnvVarRepository {
+	return &EnvVarRepository{db: db}
+}
+
+// Upsert creates the variable or replaces the value of an existing one with
+// the same API, version and name
+func (r *EnvVarRepository) Upsert(v *models.EnvVar) error {
+	query := `
+		INSERT INTO api_env_vars (api_id, version, name, value, is_secret, ciphertext, wrapped_key)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)
+		ON CONFLICT (api_id, version, name) DO UPDATE
+		SET value = EXCLUDED.value, is_secret = EXCLUDED.is_secret, ciphertext = EXCLUDED.ciphertext,
+		    wrapped_key = EXCLUDED.wrapped_key, updated_at = CURRENT_TIMESTAMP
+		RETURNING id, created_at, updated_at
+	`
+
+	return r.db.QueryRow(
+		query, v.APIID, v.Version, v.Name, v.Value, v.Secret, v.Ciphertext, v.WrappedKey,
+	).Scan(&v.ID, &v.CreatedAt, &v.UpdatedAt)
+}
+
+// GetByAPIID lists an API's variables without secret material
+func (r *EnvVarRepository) GetByAPIID(apiID string) ([]*models.EnvVar, error) {
+	query := `
+		SELECT id, api_id, version, name, value, is_secret, created_at, updated_at
+		FROM api_env_vars WHERE api_id = $1
+		ORDER BY version, name
+	`
+
+	rows, err := r.db.Query(query, apiID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var vars []*models.EnvVar
+	for rows.Next() {
+		v := &models.EnvVar{}
+		if err := rows.Scan(
+			&v.ID, &v.APIID, &v.Version, &v.Name, &v.Value, &v.Secret, &v.CreatedAt, &v.UpdatedAt,
+		); err != nil {
+			return nil, err
+		}
+		vars = append(vars, v)
+	}
+
+	return vars, rows.Err()
+}
+
+// Delete removes a variable, reporting whether it existed
+func (r *EnvVarRepository) Delete(apiID, version, name string) (bool, error) {
+	result, err := r.db.Exec(
+		`DELETE FROM api_env_vars WHERE api_id = $1 AND version = $2 AND name = $3`,
+		apiID, version, name,
+	)
+	if err != nil {
+		return false, err
+	}
+	n, err := result.RowsAffected()
+	return n > 0, err
+}
+
+// GetForExecution returns the variables that apply to version of an API
+// (the API's current version if empty), shared ones first so that
+// version-specific values can override them
+func (r *EnvVarRepository) GetForExecution(apiID, version string) ([]*models.EnvVar, error) {
+	query := `
+		SELECT id, api_id, version, name, value, is_secret, ciphertext, wrapped_key, created_at, updated_at
+		FROM api_env_vars
+		WHERE api_id = $1 AND (version = '' OR version = COALESCE(NULLIF($2, ''), (SELECT version FROM apis WHERE id = $1)))
+		ORDER BY version = '' DESC, name
+	`
+
+	rows, err := r.db.Query(query, apiID, version)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var vars []*models.EnvVar
+	for rows.Next() {
+		v := &models.EnvVar{}
+		if err := rows.Scan(
+			&v.ID, &v.APIID, &v.Version, &v.Name, &v.Value, &v.Secret, &v.Ciphertext, &v.WrappedKey,
+			&v.CreatedAt, &v.UpdatedAt,
+		); err != nil {
+			return nil, err
+		}
+		vars = append(vars, v)
+	}
+
+	return vars, rows.Err()
+}
@@ -0,0 +1,121 @@
+package repository
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/aKaddoura96/api-hosting-execution-platform/backend/shared/models"
+)
+
+type ExecutionLogRepository struct {
+	db *sql.DB
+}
+
+func NewExecutionLogRepository(db *sql.DB) *ExecutionLogRepository {
+	return &ExecutionLogRepository{db: db}
+}
+
+// ExecutionLogFilter narrows a log listing. Zero values mean "no filter".
+type ExecutionLogFilter struct {
+	APIID       string
+	ExecutionID string
+	Level       string
+	Since       *time.Time
+	Until       *time.Time
+	Cursor      int64 // return entries with id < Cursor
+	Limit       int
+}
+
+// CreateBatch stores the output lines of one execution in a single transaction
+func (r *ExecutionLogRepository) CreateBatch(logs []*models.ExecutionLog) error {
+	if len(logs) == 0 {
+		return nil
+	}
+
+	tx, err := r.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	stmt, err := tx.Prepare(`
+		INSERT INTO execution_logs (execution_id, api_id, stream, level, message, logged_at)
+		VALUES ($1, $2, $3, $4, $5, $6)
+		RETURNING id
+	`)
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+
+	for _, l := range logs {
+		if err := stmt.QueryRow(
+			l.ExecutionID, l.APIID, l.Stream, l.Level, l.Message, l.LoggedAt,
+		).Scan(&l.ID); err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+// List returns log lines newest first
+func (r *ExecutionLogRepository) List(filter ExecutionLogFilter) ([]*models.ExecutionLog, error) {
+	conditions := []string{"api_id = $1"}
+	args := []interface{}{filter.APIID}
+
+	addCondition := func(clause string, value interface{}) {
+		args = append(args, value)
+		conditions = append(conditions, fmt.Sprintf(clause, len(args)))
+	}
+
+	if filter.ExecutionID != "" {
+		addCondition("execution_id = $%d", filter.ExecutionID)
+	}
+	if filter.Level != "" {
+		addCondition("level = $%d", filter.Level)
+	}
+	if filter.Since != nil {
+		addCondition("logged_at >= $%d", *filter.Since)
+	}
+	if filter.Until != nil {
+		addCondition("logged_at < $%d", *filter.Until)
+	}
+	if filter.Cursor > 0 {
+		addCondition("id < $%d", filter.Cursor)
+	}
+
+	if filter.Limit <= 0 {
+		filter.Limit = 100
+	}
+	args = append(args, filter.Limit)
+
+	query := fmt.Sprintf(`
+		SELECT id, execution_id, api_id, stream, level, message, logged_at
+		FROM execution_logs
+		WHERE %s
+		ORDER BY id DESC
+		LIMIT $%d
+	`, strings.Join(conditions, " AND "), len(args))
+
+	rows, err := r.db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var logs []*models.ExecutionLog
+	for rows.Next() {
+		l := &models.ExecutionLog{}
+		if err := rows.Scan(
+			&l.ID, &l.ExecutionID, &l.APIID, &l.Stream, &l.Level, &l.Message, &l.LoggedAt,
+		); err != nil {
+			return nil, err
+		}
+		logs = append(logs, l)
+	}
+
+	return logs, rows.Err()
+}
@@ -17,11 +17,15 @@ func NewExecutionRepository(db *sql.DB) *ExecutionRepository {
 }
 
 func (r *ExecutionRepository) Create(execution *models.Execution) error {
-	execution.ID = uuid.New().String()
+	// Callers may pre-assign the ID so it can be handed to the executor
+	if execution.ID == "" {
+		execution.ID = uuid.New().String()
+	}
 	
 	query := `
-		INSERT INTO executions (id, api_id, user_id, status_code, duration, request_size, response_size, error)
-		VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+		INSERT INTO executions (id, api_id, user_id, status_code, duration, request_size, response_size, error,
+		                        resource_class, compute_units, egress_bytes, queue_ms)
+		VALUES ($1, $2, NULLIF($3, '')::uuid, $4, $5, $6, $7, $8, $9, $10, $11, $12)
 		RETURNING executed_at
 	`
 	
@@ -29,12 +33,15 @@ func (r *ExecutionRepository) Create(execution *models.Execution) error {
 		query, execution.ID, execution.APIID, execution.UserID,
 		execution.StatusCode, execution.Duration.Milliseconds(),
 		execution.RequestSize, execution.ResponseSize, execution.Error,
+		execution.ResourceClass, execution.ComputeUnits, execution.EgressBytes,
+		execution.QueueTime.Milliseconds(),
 	).Scan(&execution.ExecutedAt)
 }
 
 func (r *ExecutionRepository) GetByAPIID(apiID string, limit int) ([]*models.Execution, error) {
 	query := `
-		SELECT id, api_id, user_id, status_code, duration, request_size, response_size, error, executed_at
+		SELECT id, api_id, user_id, status_code, duration, request_size, response_size, error,
+		       resource_class, compute_units, egress_bytes, queue_ms, executed_at
 		FROM executions
 		WHERE api_id = $1
 		ORDER BY executed_at DESC
@@ -50,12 +57,13 @@ func (r *ExecutionRepository) GetByAPIID(apiID string, limit int) ([]*models.Exe
 	var executions []*models.Execution
 	for rows.Next() {
 		exec := &models.Execution{}
-		var durationMs int64
+		var durationMs, queueMs int64
 		var userID sql.NullString
 		
 		err := rows.Scan(
 			&exec.ID, &exec.APIID, &userID, &exec.StatusCode, &durationMs,
-			&exec.RequestSize, &exec.ResponseSize, &exec.Error, &exec.ExecutedAt,
+			&exec.RequestSize, &exec.ResponseSize, &exec.Error,
+			&exec.ResourceClass, &exec.ComputeUnits, &exec.EgressBytes, &queueMs, &exec.ExecutedAt,
 		)
 		if err != nil {
 			return nil, err
@@ -65,6 +73,7 @@ func (r *ExecutionRepository) GetByAPIID(apiID string, limit int) ([]*models.Exe
 			exec.UserID = userID.String
 		}
 		exec.Duration = time.Duration(durationMs) * time.Millisecond
+		exec.QueueTime = time.Duration(queueMs) * time.Millisecond
 		
 		executions = append(executions, exec)
 	}
@@ -80,17 +89,18 @@ func (r *ExecutionRepository) GetStats(apiID string, since time.Time) (map[strin
 			MIN(duration) as min_duration,
 			MAX(duration) as max_duration,
 			COUNT(CASE WHEN status_code >= 200 AND status_code < 300 THEN 1 END) as success_count,
-			COUNT(CASE WHEN status_code >= 400 THEN 1 END) as error_count
+			COUNT(CASE WHEN status_code >= 400 THEN 1 END) as error_count,
+			COALESCE(SUM(compute_units), 0) as compute_units
 		FROM executions
 		WHERE api_id = $1 AND executed_at >= $2
 	`
 	
-	var totalRequests, successCount, errorCount int64
+	var totalRequests, successCount, errorCount, computeUnits int64
 	var avgDuration, minDuration, maxDuration sql.NullFloat64
 	
 	err := r.db.QueryRow(query, apiID, since).Scan(
 		&totalRequests, &avgDuration, &minDuration, &maxDuration,
-		&successCount, &errorCount,
+		&successCount, &errorCount, &computeUnits,
 	)
 	if err != nil {
 		return nil, err
@@ -101,6 +111,7 @@ func (r *ExecutionRepository) GetStats(apiID string, since time.Time) (map[strin
 		"success_count":  successCount,
 		"error_count":    errorCount,
 		"success_rate":   0.0,
+		"compute_units":  computeUnits,
 	}
 	
 	if totalRequests > 0 {
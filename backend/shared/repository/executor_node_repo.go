@@ -0,0 +1,95 @@
+package repository
+
+import (
+	"database/sql"
+	"time"
+
+	"github.com/aKaddoura96/api-hosting-execution-platform/backend/shared/models"
+	"github.com/lib/pq"
+)
+
+type ExecutorNodeRepository struct {
+	db *sql.DB
+}
+
+func NewExecutorNodeRepository(db *sql.DB) *ExecutorNodeRepository {
+	return &ExecutorNodeRepository{db: db}
+}
+
+const executorNodeColumns = `
+	id, url, backend, runtimes, capacity, running, queued, started_at, heartbeat_at
+`
+
+func scanExecutorNode(row rowScanner) (*models.ExecutorNode, error) {
+	node := &models.ExecutorNode{}
+	err := row.Scan(
+		&node.ID, &node.URL, &node.Backend, pq.Array(&node.Runtimes), &node.Capacity,
+		&node.Running, &node.Queued, &node.StartedAt, &node.HeartbeatAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+	return node, nil
+}
+
+// Heartbeat registers the node or refreshes its entry
+func (r *ExecutorNodeRepository) Heartbeat(node *models.ExecutorNode) error {
+	query := `
+		INSERT INTO executor_nodes (id, url, backend, runtimes, capacity, running, queued)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)
+		ON CONFLICT (id) DO UPDATE
+		SET url = EXCLUDED.url, backend = EXCLUDED.backend, runtimes = EXCLUDED.runtimes,
+		    capacity = EXCLUDED.capacity, running = EXCLUDED.running, queued = EXCLUDED.queued,
+		    heartbeat_at = CURRENT_TIMESTAMP
+		RETURNING started_at, heartbeat_at
+	`
+
+	return r.db.QueryRow(
+		query, node.ID, node.URL, node.Backend, pq.Array(node.Runtimes),
+		node.Capacity, node.Running, node.Queued,
+	).Scan(&node.StartedAt, &node.HeartbeatAt)
+}
+
+// GetLive returns the nodes with a heartbeat within maxAge
+func (r *ExecutorNodeRepository) GetLive(maxAge time.Duration) ([]*models.ExecutorNode, error) {
+	query := `SELECT ` + executorNodeColumns + ` FROM executor_nodes
+		WHERE heartbeat_at > CURRENT_TIMESTAMP - make_interval(secs => $1::float8)
+		ORDER BY id
+	`
+
+	rows, err := r.db.Query(query, maxAge.Seconds())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var nodes []*models.ExecutorNode
+	for rows.Next() {
+		node, err := scanExecutorNode(rows)
+		if err != nil {
+			return nil, err
+		}
+		nodes = append(nodes, node)
+	}
+
+	return nodes, rows.Err()
+}
+
+// Delete removes a node; it registers again with its next heartbeat
+func (r *ExecutorNodeRepository) Delete(id string) error {
+	_, err := r.db.Exec(`DELETE FROM executor_nodes WHERE id = $1`, id)
+	return err
+}
+
+// DeleteStale removes the nodes without a heartbeat within maxAge and
+// returns how many there were
+func (r *ExecutorNodeRepository) DeleteStale(maxAge time.Duration) (int64, error) {
+	result, err := r.db.Exec(
+		`DELETE FROM executor_nodes WHERE heartbeat_at <= CURRENT_TIMESTAMP - make_interval(secs => $1::float8)`,
+		maxAge.Seconds(),
+	)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
@@ -0,0 +1,113 @@
+package repository
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/aKaddoura96/api-hosting-execution-platform/backend/shared/models"
+)
+
+type IdempotencyRepository struct {
+	db *sql.DB
+}
+
+func NewIdempotencyRepository(db *sql.DB) *IdempotencyRepository {
+	return &IdempotencyRepository{db: db}
+}
+
+// Claim records key as pending for up to hold, unless it is already held by
+// a request that hasn't expired. It reports whether the key was claimed.
+func (r *IdempotencyRepository) Claim(key *models.IdempotencyKey, hold time.Duration) (bool, error) {
+	query := `
+		INSERT INTO idempotency_keys (api_id, caller, key, fingerprint, status, expires_at)
+		VALUES ($1, $2, $3, $4, $5, CURRENT_TIMESTAMP + make_interval(secs => $6::float8))
+		ON CONFLICT (api_id, caller, key) DO UPDATE
+		SET fingerprint = EXCLUDED.fingerprint, status = EXCLUDED.status, response_status = 0,
+			response_headers = NULL, response_body = NULL,
+			created_at = CURRENT_TIMESTAMP, expires_at = EXCLUDED.expires_at
+		WHERE idempotency_keys.expires_at <= CURRENT_TIMESTAMP
+		RETURNING created_at, expires_at
+	`
+
+	key.Status = models.IdempotencyPending
+	err := r.db.QueryRow(
+		query, key.APIID, key.Caller, key.Key, key.Fingerprint, key.Status, hold.Seconds(),
+	).Scan(&key.CreatedAt, &key.ExpiresAt)
+	if err == sql.ErrNoRows {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// Get returns a key that hasn't expired
+func (r *IdempotencyRepository) Get(apiID, caller, key string) (*models.IdempotencyKey, error) {
+	query := `
+		SELECT api_id, caller, key, fingerprint, status, response_status, response_headers,
+		       response_body, created_at, expires_at
+		FROM idempotency_keys
+		WHERE api_id = $1 AND caller = $2 AND key = $3 AND expires_at > CURRENT_TIMESTAMP
+	`
+
+	record := &models.IdempotencyKey{}
+	var headers []byte
+	err := r.db.QueryRow(query, apiID, caller, key).Scan(
+		&record.APIID, &record.Caller, &record.Key, &record.Fingerprint, &record.Status,
+		&record.ResponseStatus, &headers, &record.ResponseBody, &record.CreatedAt, &record.ExpiresAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	if headers != nil {
+		if err := json.Unmarshal(headers, &record.ResponseHeaders); err != nil {
+			return nil, fmt.Errorf("failed to decode response headers: %w", err)
+		}
+	}
+	return record, nil
+}
+
+// Complete stores the response of a claimed key, which repeats get until ttl
+// has passed
+func (r *IdempotencyRepository) Complete(key *models.IdempotencyKey, ttl time.Duration) error {
+	headers, err := json.Marshal(key.ResponseHeaders)
+	if err != nil {
+		return fmt.Errorf("failed to encode response headers: %w", err)
+	}
+
+	query := `
+		UPDATE idempotency_keys
+		SET status = $5, response_status = $6, response_headers = $7, response_body = $8,
+			expires_at = CURRENT_TIMESTAMP + make_interval(secs => $9::float8)
+		WHERE api_id = $1 AND caller = $2 AND key = $3 AND fingerprint = $4 AND status = 'pending'
+		RETURNING expires_at
+	`
+
+	key.Status = models.IdempotencyCompleted
+	return r.db.QueryRow(
+		query, key.APIID, key.Caller, key.Key, key.Fingerprint, key.Status,
+		key.ResponseStatus, string(headers), key.ResponseBody, ttl.Seconds(),
+	).Scan(&key.ExpiresAt)
+}
+
+// Release gives up a claimed key, so the next request with it runs
+func (r *IdempotencyRepository) Release(key *models.IdempotencyKey) error {
+	_, err := r.db.Exec(
+		`DELETE FROM idempotency_keys WHERE api_id = $1 AND caller = $2 AND key = $3 AND fingerprint = $4 AND status = 'pending'`,
+		key.APIID, key.Caller, key.Key, key.Fingerprint,
+	)
+	return err
+}
+
+// DeleteExpired removes the keys past their expiry and returns how many
+func (r *IdempotencyRepository) DeleteExpired() (int64, error) {
+	result, err := r.db.Exec(`DELETE FROM idempotency_keys WHERE expires_at <= CURRENT_TIMESTAMP`)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
@@ -0,0 +1,213 @@
+package repository
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/aKaddoura96/api-hosting-execution-platform/backend/shared/models"
+	"github.com/google/uuid"
+)
+
+type JobRepository struct {
+	db *sql.DB
+}
+
+func NewJobRepository(db *sql.DB) *JobRepository {
+	return &JobRepository{db: db}
+}
+
+const jobColumns = `
+	id, api_id, user_id, execution_id, status, runtime, code, input, timeout_sec, resource_class,
+	callback_url, attempts, max_attempts, run_at, result, last_error,
+	created_at, updated_at, completed_at
+`
+
+func (r *JobRepository) Create(job *models.Job) error {
+	if job.ID == "" {
+		job.ID = uuid.New().String()
+	}
+	if job.MaxAttempts <= 0 {
+		job.MaxAttempts = 3
+	}
+
+	input, err := encodeInput(job.Input)
+	if err != nil {
+		return err
+	}
+
+	query := `
+		INSERT INTO jobs (id, api_id, user_id, runtime, code, input, timeout_sec, resource_class, callback_url, max_attempts)
+		VALUES ($1, $2, NULLIF($3, '')::uuid, $4, $5, $6, $7, $8, NULLIF($9, ''), $10)
+		RETURNING status, run_at, created_at, updated_at
+	`
+
+	return r.db.QueryRow(
+		query, job.ID, job.APIID, job.UserID, job.Runtime, job.Code, input,
+		job.TimeoutSec, job.ResourceClass, job.CallbackURL, job.MaxAttempts,
+	).Scan(&job.Status, &job.RunAt, &job.CreatedAt, &job.UpdatedAt)
+}
+
+func (r *JobRepository) GetByID(id string) (*models.Job, error) {
+	job, err := scanJob(r.db.QueryRow(`SELECT `+jobColumns+` FROM jobs WHERE id = $1`, id))
+	if err == sql.ErrNoRows {
+		return nil, fmt.Errorf("job not found")
+	}
+	return job, err
+}
+
+// GetByAPIID lists an API's jobs newest first, optionally only those in status
+func (r *JobRepository) GetByAPIID(apiID, status string, limit int) ([]*models.Job, error) {
+	query := `SELECT ` + jobColumns + ` FROM jobs
+		WHERE api_id = $1 AND ($2 = '' OR status = $2)
+		ORDER BY created_at DESC
+		LIMIT $3
+	`
+
+	rows, err := r.db.Query(query, apiID, status, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var jobs []*models.Job
+	for rows.Next() {
+		job, err := scanJob(rows)
+		if err != nil {
+			return nil, err
+		}
+		jobs = append(jobs, job)
+	}
+
+	return jobs, rows.Err()
+}
+
+// Dequeue claims the next due job for workerID, or returns nil if none is
+// due. The claim lasts the job's timeout plus grace; running jobs whose claim
+// has lapsed (their worker died) are claimed again.
+func (r *JobRepository) Dequeue(workerID string, grace time.Duration) (*models.Job, error) {
+	query := `
+		UPDATE jobs
+		SET status = 'running', attempts = attempts + 1, locked_by = $1,
+		    locked_until = CURRENT_TIMESTAMP + make_interval(secs => timeout_sec + $2::int),
+		    updated_at = CURRENT_TIMESTAMP
+		WHERE id = (
+			SELECT id FROM jobs
+			WHERE (status = 'queued' AND run_at <= CURRENT_TIMESTAMP)
+			   OR (status = 'running' AND locked_until < CURRENT_TIMESTAMP)
+			ORDER BY run_at
+			FOR UPDATE SKIP LOCKED
+			LIMIT 1
+		)
+		RETURNING ` + jobColumns
+
+	job, err := scanJob(r.db.QueryRow(query, workerID, int(grace.Seconds())))
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	return job, err
+}
+
+// Complete marks a job succeeded with the result of its last attempt
+func (r *JobRepository) Complete(id, executionID string, result json.RawMessage) error {
+	query := `
+		UPDATE jobs
+		SET status = 'succeeded', execution_id = $1, result = $2, last_error = NULL,
+		    locked_by = NULL, locked_until = NULL,
+		    updated_at = CURRENT_TIMESTAMP, completed_at = CURRENT_TIMESTAMP
+		WHERE id = $3
+	`
+
+	_, err := r.db.Exec(query, executionID, nullableJSON(result), id)
+	return err
+}
+
+// Retry puts a failed job back in the queue to run again at runAt
+func (r *JobRepository) Retry(id, executionID, lastError string, result json.RawMessage, runAt time.Time) error {
+	query := `
+		UPDATE jobs
+		SET status = 'queued', execution_id = NULLIF($1, '')::uuid, last_error = $2, result = $3,
+		    run_at = $4, locked_by = NULL, locked_until = NULL, updated_at = CURRENT_TIMESTAMP
+		WHERE id = $5
+	`
+
+	_, err := r.db.Exec(query, executionID, lastError, nullableJSON(result), runAt, id)
+	return err
+}
+
+// DeadLetter parks a job that has used up its attempts
+func (r *JobRepository) DeadLetter(id, executionID, lastError string, result json.RawMessage) error {
+	query := `
+		UPDATE jobs
+		SET status = 'dead', execution_id = COALESCE(NULLIF($1, '')::uuid, execution_id),
+		    last_error = $2, result = COALESCE($3::jsonb, result),
+		    locked_by = NULL, locked_until = NULL,
+		    updated_at = CURRENT_TIMESTAMP, completed_at = CURRENT_TIMESTAMP
+		WHERE id = $4
+	`
+
+	_, err := r.db.Exec(query, executionID, lastError, nullableJSON(result), id)
+	return err
+}
+
+// Requeue gives a dead-lettered job a fresh set of attempts
+func (r *JobRepository) Requeue(id string) error {
+	query := `
+		UPDATE jobs
+		SET status = 'queued', attempts = 0, run_at = CURRENT_TIMESTAMP,
+		    callback_delivered_at = NULL, completed_at = NULL, updated_at = CURRENT_TIMESTAMP
+		WHERE id = $1 AND status = 'dead'
+	`
+
+	res, err := r.db.Exec(query, id)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return fmt.Errorf("job is not dead-lettered")
+	}
+	return nil
+}
+
+func (r *JobRepository) MarkCallbackDelivered(id string) error {
+	_, err := r.db.Exec(`UPDATE jobs SET callback_delivered_at = CURRENT_TIMESTAMP WHERE id = $1`, id)
+	return err
+}
+
+// rowScanner is satisfied by *sql.Row and *sql.Rows
+type rowScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+func scanJob(row rowScanner) (*models.Job, error) {
+	job := &models.Job{}
+	var userID, executionID, callbackURL, lastError sql.NullString
+	var input, result []byte
+	var completedAt sql.NullTime
+
+	err := row.Scan(
+		&job.ID, &job.APIID, &userID, &executionID, &job.Status, &job.Runtime, &job.Code,
+		&input, &job.TimeoutSec, &job.ResourceClass, &callbackURL, &job.Attempts, &job.MaxAttempts, &job.RunAt,
+		&result, &lastError, &job.CreatedAt, &job.UpdatedAt, &completedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	job.UserID = userID.String
+	job.ExecutionID = executionID.String
+	job.CallbackURL = callbackURL.String
+	job.LastError = lastError.String
+	job.Result = result
+	if completedAt.Valid {
+		job.CompletedAt = &completedAt.Time
+	}
+	if len(input) > 0 {
+		if err := json.Unmarshal(input, &job.Input); err != nil {
+			return nil, fmt.Errorf("failed to decode input: %w", err)
+		}
+	}
+
+	return job, nil
+}
@@ -0,0 +1,81 @@
+package repository
+
+import (
+	"database/sql"
+
+	"github.com/aKaddoura96/api-hosting-execution-platform/backend/shared/models"
+)
+
+type ReplicaRepository struct {
+	db *sql.DB
+}
+
+func NewReplicaRepository(db *sql.DB) *ReplicaRepository {
+	return &ReplicaRepository{db: db}
+}
+
+const replicaColumns = `
+	id, api_id, node_id, version, status, in_flight, started_at, updated_at
+`
+
+func scanReplica(row rowScanner) (*models.Replica, error) {
+	replica := &models.Replica{}
+	err := row.Scan(
+		&replica.ID, &replica.APIID, &replica.NodeID, &replica.Version,
+		&replica.Status, &replica.InFlight, &replica.StartedAt, &replica.UpdatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+	return replica, nil
+}
+
+// Save records a replica or refreshes its status and in-flight count
+func (r *ReplicaRepository) Save(replica *models.Replica) error {
+	query := `
+		INSERT INTO api_replicas (id, api_id, node_id, version, status, in_flight)
+		VALUES ($1, $2, $3, $4, $5, $6)
+		ON CONFLICT (id) DO UPDATE
+		SET status = EXCLUDED.status, in_flight = EXCLUDED.in_flight, updated_at = CURRENT_TIMESTAMP
+		RETURNING started_at, updated_at
+	`
+
+	return r.db.QueryRow(
+		query, replica.ID, replica.APIID, replica.NodeID, replica.Version,
+		replica.Status, replica.InFlight,
+	).Scan(&replica.StartedAt, &replica.UpdatedAt)
+}
+
+// GetByAPIID returns the replicas of an API on every node
+func (r *ReplicaRepository) GetByAPIID(apiID string) ([]*models.Replica, error) {
+	query := `SELECT ` + replicaColumns + ` FROM api_replicas WHERE api_id = $1 ORDER BY started_at`
+
+	rows, err := r.db.Query(query, apiID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var replicas []*models.Replica
+	for rows.Next() {
+		replica, err := scanReplica(rows)
+		if err != nil {
+			return nil, err
+		}
+		replicas = append(replicas, replica)
+	}
+
+	return replicas, rows.Err()
+}
+
+func (r *ReplicaRepository) Delete(id string) error {
+	_, err := r.db.Exec(`DELETE FROM api_replicas WHERE id = $1`, id)
+	return err
+}
+
+// DeleteByNode removes every replica recorded by a node, which a node
+// restarting has lost
+func (r *ReplicaRepository) DeleteByNode(nodeID string) error {
+	_, err := r.db.Exec(`DELETE FROM api_replicas WHERE node_id = $1`, nodeID)
+	return err
+}
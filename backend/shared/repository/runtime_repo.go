@@ -0,0 +1,82 @@
+package repository
+
+import (
+	"database/sql"
+
+	"github.com/aKaddoura96/api-hosting-execution-platform/backend/shared/models"
+	"github.com/lib/pq"
+)
+
+type RuntimeRepository struct {
+	db *sql.DB
+}
+
+func NewRuntimeRepository(db *sql.DB) *RuntimeRepository {
+	return &RuntimeRepository{db: db}
+}
+
+const runtimeColumns = `
+	name, family, version, deprecated_at, engine, image, extension, build_command, run_command, handler,
+	default_resource_class, default_timeout_sec, enabled, created_at
+`
+
+func scanRuntime(row rowScanner) (*models.Runtime, error) {
+	rt := &models.Runtime{}
+	var deprecatedAt sql.NullTime
+	err := row.Scan(
+		&rt.Name, &rt.Family, &rt.Version, &deprecatedAt, &rt.Engine, &rt.Image, &rt.Extension,
+		&rt.BuildCommand, pq.Array(&rt.RunCommand), &rt.Handler, &rt.DefaultResourceClass,
+		&rt.DefaultTimeoutSec, &rt.Enabled, &rt.CreatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+	if deprecatedAt.Valid {
+		rt.DeprecatedAt = &deprecatedAt.Time
+	}
+	return rt, nil
+}
+
+// GetByName returns a runtime whether or not it is enabled
+func (r *RuntimeRepository) GetByName(name string) (*models.Runtime, error) {
+	query := `SELECT ` + runtimeColumns + ` FROM runtimes WHERE name = $1`
+	return scanRuntime(r.db.QueryRow(query, name))
+}
+
+// GetEnabled lists enabled runtimes, optionally only those of family,
+// including deprecated ones
+func (r *RuntimeRepository) GetEnabled(family string) ([]*models.Runtime, error) {
+	query := `SELECT ` + runtimeColumns + ` FROM runtimes
+		WHERE enabled AND ($1 = '' OR family = $1)
+		ORDER BY family, name
+	`
+
+	rows, err := r.db.Query(query, family)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var runtimes []*models.Runtime
+	for rows.Next() {
+		rt, err := scanRuntime(rows)
+		if err != nil {
+			return nil, err
+		}
+		runtimes = append(runtimes, rt)
+	}
+
+	return runtimes, rows.Err()
+}
+
+// GetLatest returns the newest enabled, undeprecated version in family,
+// preferring versioned names over the family's own; sql.ErrNoRows if none
+func (r *RuntimeRepository) GetLatest(family string) (*models.Runtime, error) {
+	query := `SELECT ` + runtimeColumns + ` FROM runtimes
+		WHERE family = $1 AND enabled AND version ~ '^[0-9]+(\.[0-9]+)*$'
+		  AND (deprecated_at IS NULL OR deprecated_at > CURRENT_DATE)
+		ORDER BY string_to_array(version, '.')::int[] DESC, name = family, name
+		LIMIT 1
+	`
+	return scanRuntime(r.db.QueryRow(query, family))
+}
@@ -0,0 +1,53 @@
+package repository
+
+import (
+	"database/sql"
+
+	"github.com/aKaddoura96/api-hosting-execution-platform/backend/shared/models"
+)
+
+type ScalingRepository struct {
+	db *sql.DB
+}
+
+func NewScalingRepository(db *sql.DB) *ScalingRepository {
+	return &ScalingRepository{db: db}
+}
+
+// GetPolicy returns the scaling policy of an API (the default, without
+// replicas, if never set)
+func (r *ScalingRepository) GetPolicy(apiID string) (*models.ScalingPolicy, error) {
+	policy := models.DefaultScalingPolicy(apiID)
+
+	query := `
+		SELECT min_replicas, max_replicas, target_concurrency, target_latency_ms, idle_timeout_sec, updated_at
+		FROM api_scaling WHERE api_id = $1
+	`
+
+	err := r.db.QueryRow(query, apiID).Scan(
+		&policy.MinReplicas, &policy.MaxReplicas, &policy.TargetConcurrency,
+		&policy.TargetLatencyMS, &policy.IdleTimeoutSec, &policy.UpdatedAt,
+	)
+	if err == sql.ErrNoRows {
+		return policy, nil
+	}
+
+	return policy, err
+}
+
+func (r *ScalingRepository) UpsertPolicy(policy *models.ScalingPolicy) error {
+	query := `
+		INSERT INTO api_scaling (api_id, min_replicas, max_replicas, target_concurrency, target_latency_ms, idle_timeout_sec)
+		VALUES ($1, $2, $3, $4, $5, $6)
+		ON CONFLICT (api_id) DO UPDATE
+		SET min_replicas = EXCLUDED.min_replicas, max_replicas = EXCLUDED.max_replicas,
+		    target_concurrency = EXCLUDED.target_concurrency, target_latency_ms = EXCLUDED.target_latency_ms,
+		    idle_timeout_sec = EXCLUDED.idle_timeout_sec, updated_at = CURRENT_TIMESTAMP
+		RETURNING updated_at
+	`
+
+	return r.db.QueryRow(
+		query, policy.APIID, policy.MinReplicas, policy.MaxReplicas,
+		policy.TargetConcurrency, policy.TargetLatencyMS, policy.IdleTimeoutSec,
+	).Scan(&policy.UpdatedAt)
+}
@@ -0,0 +1,315 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/aKaddoura96/api-hosting-execution-platform/backend/shared/models"
+)
+
+// schedulerLockKey identifies the advisory lock held by the active scheduler
+const schedulerLockKey = 736201
+
+type ScheduleRepository struct {
+	db *sql.DB
+}
+
+func NewScheduleRepository(db *sql.DB) *ScheduleRepository {
+	return &ScheduleRepository{db: db}
+}
+
+const scheduleColumns = `
+	id, api_id, name, cron_expr, timezone, input, timeout_sec, overlap_policy,
+	catch_up_limit, enabled, next_run_at, last_run_at, created_at, updated_at
+`
+
+func (r *ScheduleRepository) Create(s *models.Schedule) error {
+	input, err := encodeInput(s.Input)
+	if err != nil {
+		return err
+	}
+
+	query := `
+		INSERT INTO schedules (api_id, name, cron_expr, timezone, input, timeout_sec,
+		                       overlap_policy, catch_up_limit, enabled, next_run_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)
+		RETURNING id, created_at, updated_at
+	`
+
+	return r.db.QueryRow(
+		query, s.APIID, s.Name, s.CronExpr, s.Timezone, input, s.TimeoutSec,
+		s.OverlapPolicy, s.CatchUpLimit, s.Enabled, s.NextRunAt.UTC(),
+	).Scan(&s.ID, &s.CreatedAt, &s.UpdatedAt)
+}
+
+func (r *ScheduleRepository) GetByID(id string) (*models.Schedule, error) {
+	s, err := scanSchedule(r.db.QueryRow(`SELECT `+scheduleColumns+` FROM schedules WHERE id = $1`, id))
+	if err == sql.ErrNoRows {
+		return nil, fmt.Errorf("schedule not found")
+	}
+	return s, err
+}
+
+func (r *ScheduleRepository) GetByAPIID(apiID string) ([]*models.Schedule, error) {
+	return r.query(`SELECT `+scheduleColumns+` FROM schedules WHERE api_id = $1 ORDER BY created_at`, apiID)
+}
+
+// GetDue returns enabled schedules whose next run is at or before now
+func (r *ScheduleRepository) GetDue(now time.Time, limit int) ([]*models.Schedule, error) {
+	return r.query(`SELECT `+scheduleColumns+` FROM schedules
+		WHERE enabled = true AND next_run_at <= $1
+		ORDER BY next_run_at
+		LIMIT $2
+	`, now.UTC(), limit)
+}
+
+func (r *ScheduleRepository) Update(s *models.Schedule) error {
+	input, err := encodeInput(s.Input)
+	if err != nil {
+		return err
+	}
+
+	query := `
+		UPDATE schedules
+		SET name = $1, cron_expr = $2, timezone = $3, input = $4, timeout_sec = $5,
+		    overlap_policy = $6, catch_up_limit = $7, enabled = $8, next_run_at = $9,
+		    updated_at = CURRENT_TIMESTAMP
+		WHERE id = $10
+		RETURNING updated_at
+	`
+
+	return r.db.QueryRow(
+		query, s.Name, s.CronExpr, s.Timezone, input, s.TimeoutSec, s.OverlapPolicy,
+		s.CatchUpLimit, s.Enabled, s.NextRunAt.UTC(), s.ID,
+	).Scan(&s.UpdatedAt)
+}
+
+// Advance moves a schedule past the fire times just handled
+func (r *ScheduleRepository) Advance(id string, nextRunAt, lastRunAt time.Time) error {
+	query := `
+		UPDATE schedules SET next_run_at = $1, last_run_at = $2
+		WHERE id = $3
+	`
+	_, err := r.db.Exec(query, nextRunAt.UTC(), lastRunAt.UTC(), id)
+	return err
+}
+
+func (r *ScheduleRepository) Delete(id string) error {
+	_, err := r.db.Exec(`DELETE FROM schedules WHERE id = $1`, id)
+	return err
+}
+
+// TryLock makes the caller the active scheduler until release is called.
+// ok is false when another instance holds the lock.
+func (r *ScheduleRepository) TryLock(ctx context.Context) (release func(), ok bool, err error) {
+	conn, err := r.db.Conn(ctx)
+	if err != nil {
+		return nil, false, err
+	}
+
+	if err := conn.QueryRowContext(ctx, `SELECT pg_try_advisory_lock($1)`, schedulerLockKey).Scan(&ok); err != nil || !ok {
+		conn.Close()
+		return nil, false, err
+	}
+
+	return func() {
+		conn.ExecContext(context.Background(), `SELECT pg_advisory_unlock($1)`, schedulerLockKey)
+		conn.Close()
+	}, true, nil
+}
+
+// CreateRun records a fire time. A fire time already recorded is left as is.
+func (r *ScheduleRepository) CreateRun(run *models.ScheduleRun) (bool, error) {
+	query := `
+		INSERT INTO schedule_runs (schedule_id, scheduled_for, status, job_id, reason)
+		VALUES ($1, $2, $3, NULLIF($4, '')::uuid, NULLIF($5, ''))
+		ON CONFLICT (schedule_id, scheduled_for) DO NOTHING
+		RETURNING id, created_at
+	`
+
+	err := r.db.QueryRow(
+		query, run.ScheduleID, run.ScheduledFor.UTC(), run.Status, run.JobID, run.Reason,
+	).Scan(&run.ID, &run.CreatedAt)
+	if err == sql.ErrNoRows {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+func (r *ScheduleRepository) MarkRunEnqueued(runID, jobID string) error {
+	_, err := r.db.Exec(`UPDATE schedule_runs SET status = 'enqueued', job_id = $1 WHERE id = $2`, jobID, runID)
+	return err
+}
+
+func (r *ScheduleRepository) MarkRunSkipped(runID, reason string) error {
+	_, err := r.db.Exec(`UPDATE schedule_runs SET status = 'skipped', reason = $1 WHERE id = $2`, reason, runID)
+	return err
+}
+
+// CountActiveRuns counts runs whose job is still queued or running
+func (r *ScheduleRepository) CountActiveRuns(scheduleID string) (int, error) {
+	query := `
+		SELECT COUNT(*) FROM schedule_runs sr
+		JOIN jobs j ON j.id = sr.job_id
+		WHERE sr.schedule_id = $1 AND sr.status = 'enqueued' AND j.status IN ('queued', 'running')
+	`
+
+	var n int
+	err := r.db.QueryRow(query, scheduleID).Scan(&n)
+	return n, err
+}
+
+// CountPendingRuns counts runs waiting behind an active one (overlap "queue")
+func (r *ScheduleRepository) CountPendingRuns(scheduleID string) (int, error) {
+	var n int
+	err := r.db.QueryRow(
+		`SELECT COUNT(*) FROM schedule_runs WHERE schedule_id = $1 AND status = 'pending'`, scheduleID,
+	).Scan(&n)
+	return n, err
+}
+
+// GetPendingScheduleIDs lists schedules that have runs waiting to start
+func (r *ScheduleRepository) GetPendingScheduleIDs() ([]string, error) {
+	rows, err := r.db.Query(`SELECT DISTINCT schedule_id FROM schedule_runs WHERE status = 'pending'`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var ids []string
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+
+	return ids, rows.Err()
+}
+
+// GetOldestPendingRun returns the next run waiting to start, or nil
+func (r *ScheduleRepository) GetOldestPendingRun(scheduleID string) (*models.ScheduleRun, error) {
+	run := &models.ScheduleRun{}
+
+	query := `
+		SELECT id, schedule_id, scheduled_for, status, created_at
+		FROM schedule_runs
+		WHERE schedule_id = $1 AND status = 'pending'
+		ORDER BY scheduled_for
+		LIMIT 1
+	`
+
+	err := r.db.QueryRow(query, scheduleID).Scan(
+		&run.ID, &run.ScheduleID, &run.ScheduledFor, &run.Status, &run.CreatedAt,
+	)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return run, nil
+}
+
+// GetRuns returns a schedule's run history newest first, with job outcomes
+func (r *ScheduleRepository) GetRuns(scheduleID string, limit int) ([]*models.ScheduleRun, error) {
+	query := `
+		SELECT sr.id, sr.schedule_id, sr.scheduled_for, sr.status, sr.reason, sr.job_id,
+		       j.status, j.execution_id, j.last_error, sr.created_at
+		FROM schedule_runs sr
+		LEFT JOIN jobs j ON j.id = sr.job_id
+		WHERE sr.schedule_id = $1
+		ORDER BY sr.scheduled_for DESC
+		LIMIT $2
+	`
+
+	rows, err := r.db.Query(query, scheduleID, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var runs []*models.ScheduleRun
+	for rows.Next() {
+		run := &models.ScheduleRun{}
+		var reason, jobID, jobStatus, executionID, lastError sql.NullString
+		if err := rows.Scan(
+			&run.ID, &run.ScheduleID, &run.ScheduledFor, &run.Status, &reason, &jobID,
+			&jobStatus, &executionID, &lastError, &run.CreatedAt,
+		); err != nil {
+			return nil, err
+		}
+		run.Reason = reason.String
+		run.JobID = jobID.String
+		run.JobStatus = jobStatus.String
+		run.ExecutionID = executionID.String
+		if jobStatus.String == models.JobStatusDead {
+			run.Error = lastError.String
+		}
+		runs = append(runs, run)
+	}
+
+	return runs, rows.Err()
+}
+
+func (r *ScheduleRepository) query(query string, args ...interface{}) ([]*models.Schedule, error) {
+	rows, err := r.db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var schedules []*models.Schedule
+	for rows.Next() {
+		s, err := scanSchedule(rows)
+		if err != nil {
+			return nil, err
+		}
+		schedules = append(schedules, s)
+	}
+
+	return schedules, rows.Err()
+}
+
+func scanSchedule(row rowScanner) (*models.Schedule, error) {
+	s := &models.Schedule{}
+	var input []byte
+	var lastRunAt sql.NullTime
+
+	err := row.Scan(
+		&s.ID, &s.APIID, &s.Name, &s.CronExpr, &s.Timezone, &input, &s.TimeoutSec,
+		&s.OverlapPolicy, &s.CatchUpLimit, &s.Enabled, &s.NextRunAt, &lastRunAt,
+		&s.CreatedAt, &s.UpdatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	if lastRunAt.Valid {
+		s.LastRunAt = &lastRunAt.Time
+	}
+	if len(input) > 0 {
+		if err := json.Unmarshal(input, &s.Input); err != nil {
+			return nil, fmt.Errorf("failed to decode input: %w", err)
+		}
+	}
+
+	return s, nil
+}
+
+// encodeInput turns an input payload into a JSONB parameter
+func encodeInput(input map[string]interface{}) (interface{}, error) {
+	if input == nil {
+		return nil, nil
+	}
+	encoded, err := json.Marshal(input)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode input: %w", err)
+	}
+	return string(encoded), nil
+}
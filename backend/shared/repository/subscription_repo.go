@@ -0,0 +1,108 @@
+package repository
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/aKaddoura96/api-hosting-execution-platform/backend/shared/models"
+)
+
+type SubscriptionRepository struct {
+	db *sql.DB
+}
+
+func NewSubscriptionRepository(db *sql.DB) *SubscriptionRepository {
+	return &SubscriptionRepository{db: db}
+}
+
+const subscriptionColumns = `id, user_id, api_id, plan, status, expires_at, created_at`
+
+// Subscribe creates the user's subscription to an API, or renews one that was
+// cancelled or has expired. It reports false, changing nothing, if the user
+// already has a subscription in force.
+func (r *SubscriptionRepository) Subscribe(s *models.Subscription) (bool, error) {
+	query := `
+		INSERT INTO subscriptions (user_id, api_id, plan, status, expires_at)
+		VALUES ($1, $2, $3, $4, $5)
+		ON CONFLICT (user_id, api_id) DO UPDATE
+		SET plan = EXCLUDED.plan, status = EXCLUDED.status, expires_at = EXCLUDED.expires_at,
+		    created_at = CURRENT_TIMESTAMP
+		WHERE subscriptions.status <> 'active' OR subscriptions.expires_at <= CURRENT_TIMESTAMP
+		RETURNING id, created_at
+	`
+
+	err := r.db.QueryRow(query, s.UserID, s.APIID, s.Plan, s.Status, s.ExpiresAt.UTC()).Scan(&s.ID, &s.CreatedAt)
+	if err == sql.ErrNoRows {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+// GetByUserAndAPI returns the user's subscription to an API, in force or not
+func (r *SubscriptionRepository) GetByUserAndAPI(userID, apiID string) (*models.Subscription, error) {
+	s, err := scanSubscription(r.db.QueryRow(
+		`SELECT `+subscriptionColumns+` FROM subscriptions WHERE user_id = $1 AND api_id = $2`, userID, apiID,
+	))
+	if err == sql.ErrNoRows {
+		return nil, fmt.Errorf("subscription not found")
+	}
+	return s, err
+}
+
+func (r *SubscriptionRepository) GetByUserID(userID string) ([]*models.Subscription, error) {
+	rows, err := r.db.Query(`SELECT `+subscriptionColumns+` FROM subscriptions WHERE user_id = $1 ORDER BY created_at DESC`, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	subscriptions := []*models.Subscription{}
+	for rows.Next() {
+		s, err := scanSubscription(rows)
+		if err != nil {
+			return nil, err
+		}
+		subscriptions = append(subscriptions, s)
+	}
+	return subscriptions, rows.Err()
+}
+
+// Cancel ends a subscription that is in force. It reports false if there
+// was none to cancel.
+func (r *SubscriptionRepository) Cancel(id string) (bool, error) {
+	result, err := r.db.Exec(`
+		UPDATE subscriptions SET status = 'cancelled'
+		WHERE id = $1 AND status = 'active' AND expires_at > CURRENT_TIMESTAMP
+	`, id)
+	if err != nil {
+		return false, err
+	}
+	n, err := result.RowsAffected()
+	return n > 0, err
+}
+
+// CountRequest adds an execution to the subscription's usage for the UTC day
+// of now and returns the day's count including it
+func (r *SubscriptionRepository) CountRequest(subscriptionID string, now time.Time) (int64, error) {
+	query := `
+		INSERT INTO subscription_usage (subscription_id, date, request_count)
+		VALUES ($1, $2, 1)
+		ON CONFLICT (subscription_id, date) DO UPDATE
+		SET request_count = subscription_usage.request_count + 1
+		RETURNING request_count
+	`
+
+	var count int64
+	err := r.db.QueryRow(query, subscriptionID, now.UTC().Format("2006-01-02")).Scan(&count)
+	return count, err
+}
+
+func scanSubscription(row rowScanner) (*models.Subscription, error) {
+	s := &models.Subscription{}
+	err := row.Scan(&s.ID, &s.UserID, &s.APIID, &s.Plan, &s.Status, &s.ExpiresAt, &s.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+	return s, nil
+}
@@ -191,3 +191,13 @@ func (r *UserRepository) UpdatePassword(userID, passwordHash string) error {
 	_, err := r.db.Exec(query, passwordHash, userID)
 	return err
 }
+
+// GetPlan returns the developer plan of a user
+func (r *UserRepository) GetPlan(id string) (string, error) {
+	var plan string
+	err := r.db.QueryRow(`SELECT plan FROM users WHERE id = $1`, id).Scan(&plan)
+	if err == sql.ErrNoRows {
+		return "", fmt.Errorf("user not found")
+	}
+	return plan, err
+}
@@ -0,0 +1,265 @@
+package repository
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/aKaddoura96/api-hosting-execution-platform/backend/shared/models"
+	"github.com/lib/pq"
+)
+
+type WebhookRepository struct {
+	db *sql.DB
+}
+
+func NewWebhookRepository(db *sql.DB) *WebhookRepository {
+	return &WebhookRepository{db: db}
+}
+
+func (r *WebhookRepository) Create(w *models.Webhook) error {
+	query := `
+		INSERT INTO webhooks (user_id, url, secret, events, is_active)
+		VALUES ($1, $2, $3, $4, $5)
+		RETURNING id, created_at, updated_at
+	`
+
+	return r.db.QueryRow(
+		query, w.UserID, w.URL, w.Secret, pq.Array(w.Events), w.IsActive,
+	).Scan(&w.ID, &w.CreatedAt, &w.UpdatedAt)
+}
+
+func (r *WebhookRepository) GetByID(id string) (*models.Webhook, error) {
+	w := &models.Webhook{}
+
+	query := `
+		SELECT id, user_id, url, secret, events, is_active, created_at, updated_at
+		FROM webhooks WHERE id = $1
+	`
+
+	err := r.db.QueryRow(query, id).Scan(
+		&w.ID, &w.UserID, &w.URL, &w.Secret, pq.Array(&w.Events), &w.IsActive,
+		&w.CreatedAt, &w.UpdatedAt,
+	)
+
+	if err == sql.ErrNoRows {
+		return nil, fmt.Errorf("webhook not found")
+	}
+
+	return w, err
+}
+
+// GetByUserID lists a user's webhooks without their secrets
+func (r *WebhookRepository) GetByUserID(userID string) ([]*models.Webhook, error) {
+	query := `
+		SELECT id, user_id, url, events, is_active, created_at, updated_at
+		FROM webhooks WHERE user_id = $1
+		ORDER BY created_at DESC
+	`
+
+	rows, err := r.db.Query(query, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var webhooks []*models.Webhook
+	for rows.Next() {
+		w := &models.Webhook{}
+		if err := rows.Scan(
+			&w.ID, &w.UserID, &w.URL, pq.Array(&w.Events), &w.IsActive, &w.CreatedAt, &w.UpdatedAt,
+		); err != nil {
+			return nil, err
+		}
+		webhooks = append(webhooks, w)
+	}
+
+	return webhooks, rows.Err()
+}
+
+func (r *WebhookRepository) Update(w *models.Webhook) error {
+	query := `
+		UPDATE webhooks
+		SET url = $1, events = $2, is_active = $3, updated_at = CURRENT_TIMESTAMP
+		WHERE id = $4
+		RETURNING updated_at
+	`
+
+	return r.db.QueryRow(query, w.URL, pq.Array(w.Events), w.IsActive, w.ID).Scan(&w.UpdatedAt)
+}
+
+func (r *WebhookRepository) Delete(id string) error {
+	_, err := r.db.Exec(`DELETE FROM webhooks WHERE id = $1`, id)
+	return err
+}
+
+// CreateDeliveries queues event for every active webhook of userID subscribed to it
+func (r *WebhookRepository) CreateDeliveries(userID string, event *models.WebhookEvent) error {
+	payload, err := json.Marshal(event)
+	if err != nil {
+		return fmt.Errorf("failed to encode event: %w", err)
+	}
+
+	query := `
+		INSERT INTO webhook_deliveries (webhook_id, event_id, event_type, payload)
+		SELECT id, $2, $3, $4 FROM webhooks
+		WHERE user_id = $1 AND is_active = true
+		  AND (cardinality(events) = 0 OR $3 = ANY(events))
+	`
+
+	_, err = r.db.Exec(query, userID, event.ID, event.Type, string(payload))
+	return err
+}
+
+// CreateDeliveriesForAPI queues event for the webhooks of the API's owner
+func (r *WebhookRepository) CreateDeliveriesForAPI(apiID string, event *models.WebhookEvent) error {
+	var userID string
+	if err := r.db.QueryRow(`SELECT user_id FROM apis WHERE id = $1`, apiID).Scan(&userID); err != nil {
+		return err
+	}
+	return r.CreateDeliveries(userID, event)
+}
+
+// ClaimDeliveries leases up to limit due deliveries for sending
+func (r *WebhookRepository) ClaimDeliveries(limit int, lease time.Duration) ([]*models.WebhookDelivery, error) {
+	query := `
+		UPDATE webhook_deliveries d
+		SET locked_until = CURRENT_TIMESTAMP + make_interval(secs => $2::int), updated_at = CURRENT_TIMESTAMP
+		FROM webhooks w
+		WHERE w.id = d.webhook_id AND d.id IN (
+			SELECT id FROM webhook_deliveries
+			WHERE status = 'pending' AND next_attempt_at <= CURRENT_TIMESTAMP
+			  AND (locked_until IS NULL OR locked_until < CURRENT_TIMESTAMP)
+			ORDER BY next_attempt_at
+			FOR UPDATE SKIP LOCKED
+			LIMIT $1
+		)
+		RETURNING d.id, d.webhook_id, d.event_id, d.event_type, d.payload, d.status,
+		          d.attempts, d.max_attempts, d.next_attempt_at, d.created_at, w.url, w.secret
+	`
+
+	rows, err := r.db.Query(query, limit, int(lease.Seconds()))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var deliveries []*models.WebhookDelivery
+	for rows.Next() {
+		d := &models.WebhookDelivery{}
+		if err := rows.Scan(
+			&d.ID, &d.WebhookID, &d.EventID, &d.EventType, &d.Payload, &d.Status,
+			&d.Attempts, &d.MaxAttempts, &d.NextAttemptAt, &d.CreatedAt, &d.URL, &d.Secret,
+		); err != nil {
+			return nil, err
+		}
+		deliveries = append(deliveries, d)
+	}
+
+	return deliveries, rows.Err()
+}
+
+func (r *WebhookRepository) MarkDelivered(id string, responseStatus int) error {
+	query := `
+		UPDATE webhook_deliveries
+		SET status = 'delivered', attempts = attempts + 1, response_status = $1, last_error = NULL,
+		    locked_until = NULL, delivered_at = CURRENT_TIMESTAMP, updated_at = CURRENT_TIMESTAMP
+		WHERE id = $2
+	`
+	_, err := r.db.Exec(query, responseStatus, id)
+	return err
+}
+
+// MarkAttemptFailed records a failed attempt and schedules the next one at
+// nextAttempt, or gives up once max_attempts is reached
+func (r *WebhookRepository) MarkAttemptFailed(id string, responseStatus int, lastError string, nextAttempt time.Time) error {
+	query := `
+		UPDATE webhook_deliveries
+		SET attempts = attempts + 1,
+		    status = CASE WHEN attempts + 1 >= max_attempts THEN 'failed' ELSE 'pending' END,
+		    response_status = NULLIF($1, 0), last_error = $2, next_attempt_at = $3,
+		    locked_until = NULL, updated_at = CURRENT_TIMESTAMP
+		WHERE id = $4
+	`
+	_, err := r.db.Exec(query, responseStatus, lastError, nextAttempt, id)
+	return err
+}
+
+// Redeliver queues a fresh delivery of an earlier delivery's event
+func (r *WebhookRepository) Redeliver(id string) (*models.WebhookDelivery, error) {
+	query := `
+		INSERT INTO webhook_deliveries (webhook_id, event_id, event_type, payload)
+		SELECT webhook_id, event_id, event_type, payload FROM webhook_deliveries WHERE id = $1
+		RETURNING id
+	`
+
+	var newID string
+	if err := r.db.QueryRow(query, id).Scan(&newID); err != nil {
+		if err == sql.ErrNoRows {
+			return nil, fmt.Errorf("delivery not found")
+		}
+		return nil, err
+	}
+	return r.GetDelivery(newID)
+}
+
+const deliveryColumns = `
+	id, webhook_id, event_id, event_type, payload, status, attempts, max_attempts,
+	next_attempt_at, response_status, last_error, delivered_at, created_at
+`
+
+func (r *WebhookRepository) GetDelivery(id string) (*models.WebhookDelivery, error) {
+	d, err := scanDelivery(r.db.QueryRow(`SELECT `+deliveryColumns+` FROM webhook_deliveries WHERE id = $1`, id))
+	if err == sql.ErrNoRows {
+		return nil, fmt.Errorf("delivery not found")
+	}
+	return d, err
+}
+
+// GetDeliveries returns the delivery log of a webhook, newest first
+func (r *WebhookRepository) GetDeliveries(webhookID string, limit int) ([]*models.WebhookDelivery, error) {
+	rows, err := r.db.Query(`SELECT `+deliveryColumns+` FROM webhook_deliveries
+		WHERE webhook_id = $1
+		ORDER BY created_at DESC
+		LIMIT $2
+	`, webhookID, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var deliveries []*models.WebhookDelivery
+	for rows.Next() {
+		d, err := scanDelivery(rows)
+		if err != nil {
+			return nil, err
+		}
+		deliveries = append(deliveries, d)
+	}
+
+	return deliveries, rows.Err()
+}
+
+func scanDelivery(row rowScanner) (*models.WebhookDelivery, error) {
+	d := &models.WebhookDelivery{}
+	var responseStatus sql.NullInt64
+	var lastError sql.NullString
+	var deliveredAt sql.NullTime
+
+	err := row.Scan(
+		&d.ID, &d.WebhookID, &d.EventID, &d.EventType, &d.Payload, &d.Status, &d.Attempts,
+		&d.MaxAttempts, &d.NextAttemptAt, &responseStatus, &lastError, &deliveredAt, &d.CreatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	d.ResponseStatus = int(responseStatus.Int64)
+	d.LastError = lastError.String
+	if deliveredAt.Valid {
+		d.DeliveredAt = &deliveredAt.Time
+	}
+
+	return d, nil
+}
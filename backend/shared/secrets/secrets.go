@@ -0,0 +1,177 @@
+package secrets
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/aKaddoura96/api-hosting-execution-platform/backend/shared/models"
+	"github.com/aKaddoura96/api-hosting-execution-platform/backend/shared/repository"
+)
+
+// ErrNotConfigured is returned when SECRETS_ENCRYPTION_KEY is not set
+var ErrNotConfigured = errors.New("secret encryption is not configured")
+
+// Keyring encrypts secrets with envelope encryption: every value gets its own
+// random data key, and only that data key is encrypted with the platform key.
+type Keyring struct {
+	kek cipher.AEAD
+}
+
+// FromEnv loads the platform key from SECRETS_ENCRYPTION_KEY, 32 bytes encoded
+// as base64 (e.g. the output of `openssl rand -base64 32`)
+func FromEnv() (*Keyring, error) {
+	encoded := os.Getenv("SECRETS_ENCRYPTION_KEY")
+	if encoded == "" {
+		return nil, ErrNotConfigured
+	}
+
+	key, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil || len(key) != 32 {
+		return nil, fmt.Errorf("SECRETS_ENCRYPTION_KEY must be 32 bytes encoded as base64")
+	}
+
+	kek, err := newAEAD(key)
+	if err != nil {
+		return nil, err
+	}
+	return &Keyring{kek: kek}, nil
+}
+
+// Seal encrypts plaintext under a fresh data key and returns the ciphertext
+// and the wrapped data key. aad binds the ciphertext to where it is stored.
+func (k *Keyring) Seal(plaintext, aad []byte) (ciphertext, wrappedKey []byte, err error) {
+	dek := make([]byte, 32)
+	if _, err := rand.Read(dek); err != nil {
+		return nil, nil, err
+	}
+
+	aead, err := newAEAD(dek)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	ciphertext, err = seal(aead, plaintext, aad)
+	if err != nil {
+		return nil, nil, err
+	}
+	wrappedKey, err = seal(k.kek, dek, aad)
+	if err != nil {
+		return nil, nil, err
+	}
+	return ciphertext, wrappedKey, nil
+}
+
+// Open reverses Seal
+func (k *Keyring) Open(ciphertext, wrappedKey, aad []byte) ([]byte, error) {
+	dek, err := open(k.kek, wrappedKey, aad)
+	if err != nil {
+		return nil, fmt.Errorf("failed to unwrap data key: %w", err)
+	}
+
+	aead, err := newAEAD(dek)
+	if err != nil {
+		return nil, err
+	}
+	return open(aead, ciphertext, aad)
+}
+
+// SealEnvVar encrypts value into v, which must already have its API, version
+// and name set: they are bound to the ciphertext so rows can't be swapped
+func (k *Keyring) SealEnvVar(v *models.EnvVar, value string) error {
+	ciphertext, wrappedKey, err := k.Seal([]byte(value), envAAD(v))
+	if err != nil {
+		return err
+	}
+	v.Value = ""
+	v.Secret = true
+	v.Ciphertext = ciphertext
+	v.WrappedKey = wrappedKey
+	return nil
+}
+
+// OpenEnvVar decrypts the value of a secret variable
+func (k *Keyring) OpenEnvVar(v *models.EnvVar) (string, error) {
+	plaintext, err := k.Open(v.Ciphertext, v.WrappedKey, envAAD(v))
+	if err != nil {
+		return "", err
+	}
+	return string(plaintext), nil
+}
+
+func envAAD(v *models.EnvVar) []byte {
+	return []byte(v.APIID + "\x00" + v.Version + "\x00" + v.Name)
+}
+
+// EnvResolver produces the container environment of an API version
+type EnvResolver struct {
+	repo    *repository.EnvVarRepository
+	keyring *Keyring // nil when secrets are not configured
+}
+
+func NewEnvResolver(repo *repository.EnvVarRepository, keyring *Keyring) *EnvResolver {
+	return &EnvResolver{repo: repo, keyring: keyring}
+}
+
+// Resolve returns NAME=value pairs for version of an API (its current version
+// if empty), with version-specific variables overriding shared ones
+func (r *EnvResolver) Resolve(apiID, version string) ([]string, error) {
+	vars, err := r.repo.GetForExecution(apiID, version)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load environment: %w", err)
+	}
+
+	values := make(map[string]string, len(vars))
+	var names []string
+	for _, v := range vars {
+		value := v.Value
+		if v.Secret {
+			if r.keyring == nil {
+				return nil, fmt.Errorf("secret %s: %w", v.Name, ErrNotConfigured)
+			}
+			if value, err = r.keyring.OpenEnvVar(v); err != nil {
+				return nil, fmt.Errorf("failed to decrypt secret %s: %w", v.Name, err)
+			}
+		}
+
+		if _, seen := values[v.Name]; !seen {
+			names = append(names, v.Name)
+		}
+		values[v.Name] = value
+	}
+
+	env := make([]string, 0, len(names))
+	for _, name := range names {
+		env = append(env, name+"="+values[name])
+	}
+	return env, nil
+}
+
+func newAEAD(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// seal returns nonce || ciphertext
+func seal(aead cipher.AEAD, plaintext, aad []byte) ([]byte, error) {
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	return aead.Seal(nonce, nonce, plaintext, aad), nil
+}
+
+func open(aead cipher.AEAD, sealed, aad []byte) ([]byte, error) {
+	if len(sealed) < aead.NonceSize() {
+		return nil, fmt.Errorf("ciphertext too short")
+	}
+	nonce, ciphertext := sealed[:aead.NonceSize()], sealed[aead.NonceSize():]
+	return aead.Open(nil, nonce, ciphertext, aad)
+}
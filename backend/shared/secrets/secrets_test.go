@@ -0,0 +1,190 @@
+package secrets
+
+import (
+	"bytes"
+	"encoding/base64"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/aKaddoura96/api-hosting-execution-platform/backend/shared/models"
+)
+
+// testKeyring returns a keyring whose platform key is fill repeated
+func testKeyring(t *testing.T, fill byte) *Keyring {
+	t.Helper()
+	t.Setenv("SECRETS_ENCRYPTION_KEY", base64.StdEncoding.EncodeToString(bytes.Repeat([]byte{fill}, 32)))
+	k, err := FromEnv()
+	if err != nil {
+		t.Fatalf("FromEnv() error = %v", err)
+	}
+	return k
+}
+
+func TestFromEnv(t *testing.T) {
+	tests := []struct {
+		name    string
+		key     string
+		wantErr bool
+	}{
+		{name: "32 byte key", key: base64.StdEncoding.EncodeToString(make([]byte, 32))},
+		{name: "not base64", key: "not base64!", wantErr: true},
+		{name: "too short", key: base64.StdEncoding.EncodeToString(make([]byte, 16)), wantErr: true},
+		{name: "too long", key: base64.StdEncoding.EncodeToString(make([]byte, 64)), wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("SECRETS_ENCRYPTION_KEY", tt.key)
+			_, err := FromEnv()
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("FromEnv() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err != nil && !strings.Contains(err.Error(), "SECRETS_ENCRYPTION_KEY") {
+				t.Errorf("FromEnv() error = %v, want one naming SECRETS_ENCRYPTION_KEY", err)
+			}
+		})
+	}
+
+	t.Run("not set", func(t *testing.T) {
+		t.Setenv("SECRETS_ENCRYPTION_KEY", "")
+		if _, err := FromEnv(); !errors.Is(err, ErrNotConfigured) {
+			t.Errorf("FromEnv() error = %v, want %v", err, ErrNotConfigured)
+		}
+	})
+}
+
+func TestSealOpen(t *testing.T) {
+	k := testKeyring(t, 7)
+
+	tests := []struct {
+		name      string
+		plaintext []byte
+		aad       []byte
+	}{
+		{name: "value", plaintext: []byte("sk_live_123"), aad: []byte("api\x00v1\x00STRIPE_KEY")},
+		{name: "empty value", plaintext: []byte{}, aad: []byte("api\x00v1\x00EMPTY")},
+		{name: "no aad", plaintext: []byte("value"), aad: nil},
+		{name: "large value", plaintext: bytes.Repeat([]byte("x"), 64<<10), aad: []byte("aad")},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ciphertext, wrappedKey, err := k.Seal(tt.plaintext, tt.aad)
+			if err != nil {
+				t.Fatalf("Seal() error = %v", err)
+			}
+			if len(tt.plaintext) > 0 && bytes.Contains(ciphertext, tt.plaintext) {
+				t.Error("ciphertext contains the plaintext")
+			}
+
+			got, err := k.Open(ciphertext, wrappedKey, tt.aad)
+			if err != nil {
+				t.Fatalf("Open() error = %v", err)
+			}
+			if !bytes.Equal(got, tt.plaintext) {
+				t.Errorf("Open() = %q, want %q", got, tt.plaintext)
+			}
+		})
+	}
+}
+
+func TestSealUsesFreshKeys(t *testing.T) {
+	k := testKeyring(t, 7)
+
+	c1, w1, err := k.Seal([]byte("same"), []byte("aad"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	c2, w2, err := k.Seal([]byte("same"), []byte("aad"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Equal(c1, c2) || bytes.Equal(w1, w2) {
+		t.Error("sealing the same value twice gave the same ciphertext or data key")
+	}
+}
+
+func TestOpenRejectsTampering(t *testing.T) {
+	k := testKeyring(t, 7)
+	aad := []byte("api\x00v1\x00NAME")
+	ciphertext, wrappedKey, err := k.Seal([]byte("secret"), aad)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	flip := func(b []byte) []byte {
+		c := bytes.Clone(b)
+		c[len(c)-1] ^= 1
+		return c
+	}
+	other := testKeyring(t, 8)
+	otherCiphertext, _, err := k.Seal([]byte("other"), aad)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name       string
+		keyring    *Keyring
+		ciphertext []byte
+		wrappedKey []byte
+		aad        []byte
+	}{
+		{name: "modified ciphertext", keyring: k, ciphertext: flip(ciphertext), wrappedKey: wrappedKey, aad: aad},
+		{name: "modified data key", keyring: k, ciphertext: ciphertext, wrappedKey: flip(wrappedKey), aad: aad},
+		{name: "different aad", keyring: k, ciphertext: ciphertext, wrappedKey: wrappedKey, aad: []byte("api\x00v1\x00OTHER")},
+		{name: "another value's data key", keyring: k, ciphertext: otherCiphertext, wrappedKey: wrappedKey, aad: aad},
+		{name: "another platform key", keyring: other, ciphertext: ciphertext, wrappedKey: wrappedKey, aad: aad},
+		{name: "truncated ciphertext", keyring: k, ciphertext: ciphertext[:4], wrappedKey: wrappedKey, aad: aad},
+		{name: "truncated data key", keyring: k, ciphertext: ciphertext, wrappedKey: wrappedKey[:4], aad: aad},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got, err := tt.keyring.Open(tt.ciphertext, tt.wrappedKey, tt.aad); err == nil {
+				t.Errorf("Open() = %q, want an error", got)
+			}
+		})
+	}
+}
+
+func TestEnvVarBinding(t *testing.T) {
+	k := testKeyring(t, 7)
+
+	sealed := &models.EnvVar{APIID: "api-1", Version: "v1", Name: "TOKEN"}
+	if err := k.SealEnvVar(sealed, "s3cret"); err != nil {
+		t.Fatal(err)
+	}
+	if !sealed.Secret || sealed.Value != "" {
+		t.Fatalf("SealEnvVar left Secret = %v, Value = %q", sealed.Secret, sealed.Value)
+	}
+
+	tests := []struct {
+		name    string
+		move    func(v *models.EnvVar)
+		wantErr bool
+	}{
+		{name: "same row", move: func(*models.EnvVar) {}},
+		{name: "another API", move: func(v *models.EnvVar) { v.APIID = "api-2" }, wantErr: true},
+		{name: "another version", move: func(v *models.EnvVar) { v.Version = "v2" }, wantErr: true},
+		{name: "another name", move: func(v *models.EnvVar) { v.Name = "OTHER" }, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			v := *sealed
+			tt.move(&v)
+			got, err := k.OpenEnvVar(&v)
+			if tt.wantErr {
+				if err == nil {
+					t.Errorf("OpenEnvVar() = %q, want an error", got)
+				}
+				return
+			}
+			if err != nil || got != "s3cret" {
+				t.Errorf("OpenEnvVar() = %q, %v, want %q", got, err, "s3cret")
+			}
+		})
+	}
+}
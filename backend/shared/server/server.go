@@ -0,0 +1,109 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/aKaddoura96/api-hosting-execution-platform/backend/shared/logger"
+)
+
+// Server serves HTTP until the process is asked to stop, then drains: it
+// stops accepting connections and waits for the requests in flight
+type Server struct {
+	http         *http.Server
+	drainTimeout time.Duration
+	stopping     chan struct{}
+}
+
+type stoppingKey struct{}
+
+// New creates a server for handler on addr. SHUTDOWN_TIMEOUT sets how long
+// requests in flight are waited for on shutdown (default 30s).
+func New(addr string, handler http.Handler) (*Server, error) {
+	s := &Server{
+		drainTimeout: 30 * time.Second,
+		stopping:     make(chan struct{}),
+	}
+	if v := os.Getenv("SHUTDOWN_TIMEOUT"); v != "" {
+		timeout, err := time.ParseDuration(v)
+		if err != nil || timeout <= 0 {
+			return nil, fmt.Errorf("invalid SHUTDOWN_TIMEOUT: %q", v)
+		}
+		s.drainTimeout = timeout
+	}
+
+	s.http = &http.Server{
+		Addr:    addr,
+		Handler: handler,
+		BaseContext: func(net.Listener) context.Context {
+			return context.WithValue(context.Background(), stoppingKey{}, s.stopping)
+		},
+	}
+	return s, nil
+}
+
+// Stopping returns a channel closed once the server serving the request of
+// ctx starts shutting down. Requests that never finish on their own, such as
+// log streams, end on it so they don't hold up the drain.
+func Stopping(ctx context.Context) <-chan struct{} {
+	stopping, _ := ctx.Value(stoppingKey{}).(chan struct{})
+	return stopping
+}
+
+// Run serves until SIGINT or SIGTERM. It then stops accepting connections and
+// calls drain, which stops background work, while the requests in flight
+// finish; both share a context that expires after the drain timeout, after
+// which the remaining connections are closed. A second signal exits at once.
+func (s *Server) Run(drain func(ctx context.Context)) error {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	served := make(chan error, 1)
+	go func() {
+		served <- s.http.ListenAndServe()
+	}()
+
+	select {
+	case err := <-served:
+		return err
+	case <-ctx.Done():
+	}
+	stop()
+
+	logger.Info("Shutting down, draining requests in flight", map[string]interface{}{
+		"timeout": s.drainTimeout.String(),
+	})
+	close(s.stopping)
+
+	drainCtx, cancel := context.WithTimeout(context.Background(), s.drainTimeout)
+	defer cancel()
+
+	var wg sync.WaitGroup
+	if drain != nil {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			drain(drainCtx)
+		}()
+	}
+	err := s.http.Shutdown(drainCtx)
+	wg.Wait()
+
+	if err != nil {
+		logger.Warn("Drain timed out, closing remaining connections", map[string]interface{}{"error": err.Error()})
+		s.http.Close()
+	}
+	if err := <-served; !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+	logger.Info("Shutdown complete")
+	return nil
+}
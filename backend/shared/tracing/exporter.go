@@ -0,0 +1,284 @@
+package tracing
+
+import (
+	"bytes"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Exporter receives finished spans
+type Exporter interface {
+	Export(span *Span)
+	Shutdown() error
+}
+
+var (
+	exporterMu sync.RWMutex
+	exporter   Exporter = noopExporter{}
+)
+
+func currentExporter() Exporter {
+	exporterMu.RLock()
+	defer exporterMu.RUnlock()
+	return exporter
+}
+
+// SetExporter replaces the global span exporter
+func SetExporter(e Exporter) {
+	exporterMu.Lock()
+	defer exporterMu.Unlock()
+	exporter = e
+}
+
+// Init configures tracing for a service from the environment.
+//
+// OTEL_TRACES_EXPORTER selects the exporter: "otlp", "stdout" or "none" (default).
+// OTEL_EXPORTER_OTLP_ENDPOINT sets the OTLP/HTTP collector base URL.
+// The returned function flushes pending spans and should be deferred by main.
+func Init(service string) func() error {
+	var e Exporter
+	switch strings.ToLower(os.Getenv("OTEL_TRACES_EXPORTER")) {
+	case "otlp":
+		endpoint := os.Getenv("OTEL_EXPORTER_OTLP_ENDPOINT")
+		if endpoint == "" {
+			endpoint = "http://localhost:4318"
+		}
+		e = NewOTLPExporter(endpoint, service)
+	case "stdout", "console":
+		e = NewStdoutExporter(os.Stdout, service)
+	default:
+		e = noopExporter{}
+	}
+
+	SetExporter(e)
+	return e.Shutdown
+}
+
+// noopExporter drops every span
+type noopExporter struct{}
+
+func (noopExporter) Export(*Span)    {}
+func (noopExporter) Shutdown() error { return nil }
+
+// StdoutExporter writes one JSON line per finished span
+type StdoutExporter struct {
+	mu      sync.Mutex
+	out     io.Writer
+	service string
+}
+
+// NewStdoutExporter creates an exporter that prints spans to out
+func NewStdoutExporter(out io.Writer, service string) *StdoutExporter {
+	return &StdoutExporter{out: out, service: service}
+}
+
+func (e *StdoutExporter) Export(span *Span) {
+	entry := map[string]interface{}{
+		"service":     e.service,
+		"name":        span.Name,
+		"trace_id":    span.Context.TraceIDString(),
+		"span_id":     span.Context.SpanIDString(),
+		"start":       span.StartTime.Format(time.RFC3339Nano),
+		"duration_ms": float64(span.EndTime.Sub(span.StartTime).Microseconds()) / 1000,
+		"attributes":  span.Attributes(),
+	}
+	if span.ParentSpanID != [8]byte{} {
+		entry["parent_span_id"] = hex.EncodeToString(span.ParentSpanID[:])
+	}
+	if span.StatusError {
+		entry["error"] = span.StatusMsg
+	}
+
+	line, err := json.Marshal(entry)
+	if err != nil {
+		return
+	}
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	fmt.Fprintf(e.out, "[TRACE] %s\n", line)
+}
+
+func (e *StdoutExporter) Shutdown() error { return nil }
+
+// OTLPExporter batches spans and ships them to an OTLP/HTTP collector as JSON
+type OTLPExporter struct {
+	url     string
+	service string
+	client  *http.Client
+
+	spans chan *Span
+	done  chan struct{}
+	wg    sync.WaitGroup
+}
+
+const (
+	otlpBatchSize     = 256
+	otlpQueueSize     = 2048
+	otlpFlushInterval = 5 * time.Second
+)
+
+// NewOTLPExporter creates an exporter posting to {endpoint}/v1/traces
+func NewOTLPExporter(endpoint, service string) *OTLPExporter {
+	e := &OTLPExporter{
+		url:     strings.TrimRight(endpoint, "/") + "/v1/traces",
+		service: service,
+		client:  &http.Client{Timeout: 10 * time.Second},
+		spans:   make(chan *Span, otlpQueueSize),
+		done:    make(chan struct{}),
+	}
+
+	e.wg.Add(1)
+	go e.loop()
+	return e
+}
+
+// Export queues a span; spans are dropped when the queue is full
+func (e *OTLPExporter) Export(span *Span) {
+	select {
+	case e.spans <- span:
+	default:
+	}
+}
+
+// Shutdown flushes queued spans and stops the background sender
+func (e *OTLPExporter) Shutdown() error {
+	close(e.done)
+	e.wg.Wait()
+	return nil
+}
+
+func (e *OTLPExporter) loop() {
+	defer e.wg.Done()
+
+	ticker := time.NewTicker(otlpFlushInterval)
+	defer ticker.Stop()
+
+	batch := make([]*Span, 0, otlpBatchSize)
+	flush := func() {
+		if len(batch) == 0 {
+			return
+		}
+		if err := e.send(batch); err != nil {
+			fmt.Fprintf(os.Stderr, "tracing: failed to export %d spans: %v\n", len(batch), err)
+		}
+		batch = batch[:0]
+	}
+
+	for {
+		select {
+		case span := <-e.spans:
+			batch = append(batch, span)
+			if len(batch) >= otlpBatchSize {
+				flush()
+			}
+		case <-ticker.C:
+			flush()
+		case <-e.done:
+			// Drain whatever is still queued
+			for {
+				select {
+				case span := <-e.spans:
+					batch = append(batch, span)
+				default:
+					flush()
+					return
+				}
+			}
+		}
+	}
+}
+
+func (e *OTLPExporter) send(spans []*Span) error {
+	body, err := json.Marshal(buildOTLPPayload(e.service, spans))
+	if err != nil {
+		return err
+	}
+
+	resp, err := e.client.Post(e.url, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, resp.Body)
+
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("collector returned status %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// buildOTLPPayload renders spans in the OTLP/JSON ExportTraceServiceRequest shape
+func buildOTLPPayload(service string, spans []*Span) map[string]interface{} {
+	otlpSpans := make([]map[string]interface{}, 0, len(spans))
+	for _, span := range spans {
+		s := map[string]interface{}{
+			"traceId":           span.Context.TraceIDString(),
+			"spanId":            span.Context.SpanIDString(),
+			"name":              span.Name,
+			"kind":              int(span.Kind),
+			"startTimeUnixNano": strconv.FormatInt(span.StartTime.UnixNano(), 10),
+			"endTimeUnixNano":   strconv.FormatInt(span.EndTime.UnixNano(), 10),
+			"attributes":        otlpAttributes(span.Attributes()),
+		}
+		if span.ParentSpanID != [8]byte{} {
+			s["parentSpanId"] = hex.EncodeToString(span.ParentSpanID[:])
+		}
+		if span.StatusError {
+			s["status"] = map[string]interface{}{"code": 2, "message": span.StatusMsg}
+		}
+		otlpSpans = append(otlpSpans, s)
+	}
+
+	return map[string]interface{}{
+		"resourceSpans": []interface{}{
+			map[string]interface{}{
+				"resource": map[string]interface{}{
+					"attributes": otlpAttributes(map[string]interface{}{"service.name": service}),
+				},
+				"scopeSpans": []interface{}{
+					map[string]interface{}{
+						"scope": map[string]interface{}{"name": "api-platform/tracing"},
+						"spans": otlpSpans,
+					},
+				},
+			},
+		},
+	}
+}
+
+func otlpAttributes(attrs map[string]interface{}) []map[string]interface{} {
+	keys := make([]string, 0, len(attrs))
+	for k := range attrs {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	result := make([]map[string]interface{}, 0, len(attrs))
+	for _, k := range keys {
+		var value map[string]interface{}
+		switch v := attrs[k].(type) {
+		case bool:
+			value = map[string]interface{}{"boolValue": v}
+		case int:
+			value = map[string]interface{}{"intValue": strconv.Itoa(v)}
+		case int64:
+			value = map[string]interface{}{"intValue": strconv.FormatInt(v, 10)}
+		case float64:
+			value = map[string]interface{}{"doubleValue": v}
+		default:
+			value = map[string]interface{}{"stringValue": fmt.Sprint(v)}
+		}
+		result = append(result, map[string]interface{}{"key": k, "value": value})
+	}
+	return result
+}
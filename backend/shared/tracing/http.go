@@ -0,0 +1,91 @@
+package tracing
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+)
+
+// TraceparentHeader is the W3C Trace Context request header
+const TraceparentHeader = "traceparent"
+
+// statusRecorder captures the response status for the server span
+type statusRecorder struct {
+	http.ResponseWriter
+	statusCode int
+}
+
+func (rw *statusRecorder) WriteHeader(code int) {
+	rw.statusCode = code
+	rw.ResponseWriter.WriteHeader(code)
+}
+
+// Flush lets streaming handlers flush through the recorder
+func (rw *statusRecorder) Flush() {
+	if f, ok := rw.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// HTTPMiddleware accepts an incoming traceparent (or starts a new trace) and
+// wraps each request in a server span
+func HTTPMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+		if parent, err := ParseTraceparent(r.Header.Get(TraceparentHeader)); err == nil {
+			ctx = ContextWithSpanContext(ctx, parent)
+		}
+
+		ctx, span := StartSpan(ctx, r.Method+" "+r.URL.Path, SpanKindServer)
+		defer span.End()
+
+		span.SetAttribute("http.method", r.Method)
+		span.SetAttribute("http.target", r.URL.Path)
+
+		// Let callers correlate their request with our logs
+		w.Header().Set(TraceparentHeader, span.Context.Traceparent())
+
+		rec := &statusRecorder{ResponseWriter: w, statusCode: http.StatusOK}
+		next.ServeHTTP(rec, r.WithContext(ctx))
+
+		span.SetAttribute("http.status_code", rec.statusCode)
+		if rec.statusCode >= 500 {
+			span.SetError(fmt.Errorf("HTTP %d", rec.statusCode))
+		}
+	})
+}
+
+// Inject writes the span context carried by ctx into outbound headers
+func Inject(ctx context.Context, header http.Header) {
+	if sc, ok := SpanContextFromContext(ctx); ok {
+		header.Set(TraceparentHeader, sc.Traceparent())
+	}
+}
+
+// NewRequest builds an outbound request wrapped in a client span and carrying
+// its traceparent. The caller must End the returned span once the call completes.
+func NewRequest(ctx context.Context, method, url string, body io.Reader) (*http.Request, *Span, error) {
+	ctx, span := StartSpan(ctx, method+" "+url, SpanKindClient)
+	span.SetAttribute("http.method", method)
+	span.SetAttribute("http.url", url)
+
+	req, err := http.NewRequestWithContext(ctx, method, url, body)
+	if err != nil {
+		span.SetError(err)
+		span.End()
+		return nil, nil, err
+	}
+
+	Inject(ctx, req.Header)
+	return req, span, nil
+}
+
+// Env returns the TRACEPARENT environment entry for child processes, or "" if
+// ctx carries no trace
+func Env(ctx context.Context) string {
+	if sc, ok := SpanContextFromContext(ctx); ok {
+		return "TRACEPARENT=" + sc.Traceparent()
+	}
+	return ""
+}
@@ -0,0 +1,205 @@
+package webhooks
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/aKaddoura96/api-hosting-execution-platform/backend/shared/egress"
+	"github.com/aKaddoura96/api-hosting-execution-platform/backend/shared/logger"
+	"github.com/aKaddoura96/api-hosting-execution-platform/backend/shared/models"
+	"github.com/aKaddoura96/api-hosting-execution-platform/backend/shared/repository"
+)
+
+const (
+	// claimBatch is how many deliveries are sent per poll
+	claimBatch = 20
+	// claimLease keeps other dispatchers off a delivery while it is sent
+	claimLease = 60 * time.Second
+	// baseBackoff doubles per attempt up to maxBackoff
+	baseBackoff = 30 * time.Second
+	maxBackoff  = 6 * time.Hour
+	// keyExpiryWarning is how far ahead key.expiring is raised
+	keyExpiryWarning = 7 * 24 * time.Hour
+	// keySweepInterval is how often keys are checked for expiry
+	keySweepInterval = time.Hour
+)
+
+// Dispatcher sends queued webhook deliveries and raises time-based events
+type Dispatcher struct {
+	webhooks     *repository.WebhookRepository
+	apiKeys      *repository.APIKeyRepository
+	client       *http.Client
+	pollInterval time.Duration
+}
+
+// NewDispatcher creates a dispatcher. WEBHOOK_POLL_INTERVAL sets how often
+// the outbox is checked (default 5s, 0 disables dispatching on this instance).
+func NewDispatcher(webhooks *repository.WebhookRepository, apiKeys *repository.APIKeyRepository) *Dispatcher {
+	d := &Dispatcher{
+		webhooks:     webhooks,
+		apiKeys:      apiKeys,
+		client:       egress.PublicClient(10 * time.Second),
+		pollInterval: 5 * time.Second,
+	}
+
+	if v := os.Getenv("WEBHOOK_POLL_INTERVAL"); v != "" {
+		if interval, err := time.ParseDuration(v); err == nil && interval >= 0 {
+			d.pollInterval = interval
+		}
+	}
+
+	return d
+}
+
+// Run delivers webhooks until ctx is cancelled. Deliveries already claimed
+// are still sent, and Run returns once they have been.
+func (d *Dispatcher) Run(ctx context.Context) {
+	if d.pollInterval == 0 {
+		logger.Info("Webhook dispatcher disabled")
+		return
+	}
+
+	ticker := time.NewTicker(d.pollInterval)
+	defer ticker.Stop()
+	var lastSweep time.Time
+
+	for {
+		if time.Since(lastSweep) >= keySweepInterval {
+			d.sweepExpiringKeys(ctx)
+			lastSweep = time.Now()
+		}
+		d.deliverDue(ctx)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (d *Dispatcher) deliverDue(ctx context.Context) {
+	deliveries, err := d.webhooks.ClaimDeliveries(claimBatch, claimLease)
+	if err != nil {
+		logger.Error("Failed to claim webhook deliveries", map[string]interface{}{"error": err.Error()})
+		return
+	}
+
+	// Claimed deliveries are sent even if ctx is cancelled meanwhile, rather
+	// than failed and retried; the client timeout bounds them
+	sendCtx := context.WithoutCancel(ctx)
+	var wg sync.WaitGroup
+	for _, delivery := range deliveries {
+		wg.Add(1)
+		go func(delivery *models.WebhookDelivery) {
+			defer wg.Done()
+			d.deliver(sendCtx, delivery)
+		}(delivery)
+	}
+	wg.Wait()
+}
+
+// deliver makes one signed attempt at a delivery and records the outcome
+func (d *Dispatcher) deliver(ctx context.Context, delivery *models.WebhookDelivery) {
+	log := logger.WithContext(ctx).WithFields(map[string]interface{}{
+		"webhook_id":  delivery.WebhookID,
+		"delivery_id": delivery.ID,
+		"event":       delivery.EventType,
+	})
+
+	status, err := d.send(ctx, delivery)
+	if err == nil {
+		if err := d.webhooks.MarkDelivered(delivery.ID, status); err != nil {
+			log.Error("Failed to record webhook delivery", map[string]interface{}{"error": err.Error()})
+		}
+		return
+	}
+
+	attempt := delivery.Attempts + 1
+	next := time.Now().Add(backoff(attempt))
+	if err := d.webhooks.MarkAttemptFailed(delivery.ID, status, err.Error(), next); err != nil {
+		log.Error("Failed to record webhook attempt", map[string]interface{}{"error": err.Error()})
+		return
+	}
+
+	fields := map[string]interface{}{"attempt": attempt, "error": err.Error()}
+	if attempt >= delivery.MaxAttempts {
+		log.Error("Webhook delivery failed permanently", fields)
+	} else {
+		log.Warn("Webhook delivery failed, will retry", fields)
+	}
+}
+
+func (d *Dispatcher) send(ctx context.Context, delivery *models.WebhookDelivery) (int, error) {
+	// The URL was checked when the webhook was registered, but its host may
+	// have been pointed at an internal address since; the client also refuses
+	// to dial one, whatever the resolver answers at connect time
+	if err := egress.CheckPublicURL(ctx, delivery.URL); err != nil {
+		return 0, err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "POST", delivery.URL, bytes.NewReader(delivery.Payload))
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "api-platform-webhooks/1.0")
+	req.Header.Set(EventHeader, delivery.EventType)
+	req.Header.Set(EventIDHeader, delivery.EventID)
+	req.Header.Set(DeliveryHeader, delivery.ID)
+	req.Header.Set(SignatureHeader, Sign(delivery.Secret, time.Now(), delivery.Payload))
+
+	resp, err := d.client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 64*1024))
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return resp.StatusCode, fmt.Errorf("endpoint returned status %d", resp.StatusCode)
+	}
+	return resp.StatusCode, nil
+}
+
+// sweepExpiringKeys raises key.expiring once per key, a week ahead
+func (d *Dispatcher) sweepExpiringKeys(ctx context.Context) {
+	keys, err := d.apiKeys.GetExpiringUnnotified(time.Now().Add(keyExpiryWarning))
+	if err != nil {
+		logger.Error("Failed to check expiring API keys", map[string]interface{}{"error": err.Error()})
+		return
+	}
+
+	for _, key := range keys {
+		claimed, err := d.apiKeys.MarkExpiryNotified(key.ID)
+		if err != nil {
+			logger.Error("Failed to mark API key expiry notified", map[string]interface{}{"error": err.Error()})
+			continue
+		}
+		if !claimed {
+			continue
+		}
+
+		Emit(ctx, d.webhooks, key.UserID, models.EventKeyExpiring, map[string]interface{}{
+			"key_id":     key.ID,
+			"name":       key.Name,
+			"api_id":     key.APIID,
+			"expires_at": key.ExpiresAt,
+		})
+	}
+}
+
+// backoff returns the delay before the attempt after the given one
+func backoff(attempt int) time.Duration {
+	delay := baseBackoff << uint(attempt-1)
+	if delay <= 0 || delay > maxBackoff {
+		delay = maxBackoff
+	}
+	return delay
+}
@@ -0,0 +1,101 @@
+package webhooks
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/aKaddoura96/api-hosting-execution-platform/backend/shared/logger"
+	"github.com/aKaddoura96/api-hosting-execution-platform/backend/shared/models"
+	"github.com/aKaddoura96/api-hosting-execution-platform/backend/shared/repository"
+	"github.com/google/uuid"
+)
+
+// Headers sent with every delivery
+const (
+	SignatureHeader = "X-Webhook-Signature"
+	EventHeader     = "X-Webhook-Event"
+	EventIDHeader   = "X-Webhook-ID"
+	DeliveryHeader  = "X-Webhook-Delivery"
+)
+
+// NewEvent builds an event envelope with a fresh ID
+func NewEvent(eventType string, data map[string]interface{}) *models.WebhookEvent {
+	return &models.WebhookEvent{
+		ID:        uuid.New().String(),
+		Type:      eventType,
+		CreatedAt: time.Now().UTC(),
+		Data:      data,
+	}
+}
+
+// Emit queues an event for a user's webhooks. Failures are logged, never
+// returned: webhooks must not break the operation that raised the event.
+func Emit(ctx context.Context, repo *repository.WebhookRepository, userID, eventType string, data map[string]interface{}) {
+	if repo == nil {
+		return
+	}
+	if err := repo.CreateDeliveries(userID, NewEvent(eventType, data)); err != nil {
+		logger.FromContext(ctx).Error("Failed to queue webhook event", map[string]interface{}{
+			"event": eventType,
+			"error": err.Error(),
+		})
+	}
+}
+
+// EmitForAPI queues an event for the webhooks of an API's owner
+func EmitForAPI(ctx context.Context, repo *repository.WebhookRepository, apiID, eventType string, data map[string]interface{}) {
+	if repo == nil {
+		return
+	}
+	if err := repo.CreateDeliveriesForAPI(apiID, NewEvent(eventType, data)); err != nil {
+		logger.FromContext(ctx).Error("Failed to queue webhook event", map[string]interface{}{
+			"event":  eventType,
+			"api_id": apiID,
+			"error":  err.Error(),
+		})
+	}
+}
+
+// EmitExecutionFailed raises execution.failed for a failed execution
+func EmitExecutionFailed(ctx context.Context, repo *repository.WebhookRepository, execution *models.Execution) {
+	if execution.StatusCode < 400 && execution.Error == "" {
+		return
+	}
+
+	EmitForAPI(ctx, repo, execution.APIID, models.EventExecutionFailed, map[string]interface{}{
+		"execution_id": execution.ID,
+		"api_id":       execution.APIID,
+		"status_code":  execution.StatusCode,
+		"error":        execution.Error,
+		"duration_ms":  execution.Duration.Milliseconds(),
+	})
+}
+
+// GenerateSecret returns a new signing secret
+func GenerateSecret() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return "whsec_" + hex.EncodeToString(b), nil
+}
+
+// Sign returns the X-Webhook-Signature value for body sent at timestamp:
+// "t=<unix seconds>,v1=<hex HMAC-SHA256 of "<t>.<body>" keyed by secret>".
+// Receivers should recompute it and reject stale timestamps.
+func Sign(secret string, timestamp time.Time, body []byte) string {
+	t := strconv.FormatInt(timestamp.Unix(), 10)
+
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(t))
+	mac.Write([]byte("."))
+	mac.Write(body)
+
+	return fmt.Sprintf("t=%s,v1=%s", t, hex.EncodeToString(mac.Sum(nil)))
+}
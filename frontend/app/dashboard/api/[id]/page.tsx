@@ -14,6 +14,7 @@ interface API {
   status: string;
   visibility: string;
   code_path?: string;
+  warnings?: string[];
   created_at: string;
 }
 
@@ -42,9 +43,9 @@ export default function APIDetailPage() {
       setApiData(data);
       
       // Set default test code based on runtime
-      if (data.runtime === 'nodejs') {
+      if (data.runtime.startsWith('nodejs')) {
         setTestCode('console.log("Hello from API!");');
-      } else if (data.runtime === 'go') {
+      } else if (data.runtime.startsWith('go')) {
         setTestCode('package main\n\nimport "fmt"\n\nfunc main() {\n\tfmt.Println("Hello from API!")\n}');
       }
     } catch (err: any) {
@@ -104,16 +105,7 @@ export default function APIDetailPage() {
     setTestResult(null);
     
     try {
-      const response = await fetch('http://localhost:8081/execute', {
-        method: 'POST',
-        headers: { 'Content-Type': 'application/json' },
-        body: JSON.stringify({
-          code: testCode,
-          runtime: apiData?.runtime || 'python',
-        }),
-      });
-      
-      const result = await response.json();
+      const result = await api.testCode(apiId, testCode);
       setTestResult(result);
     } catch (err: any) {
       setTestResult({ error: err.message });
@@ -218,6 +210,11 @@ export default function APIDetailPage() {
                   {apiData.status}
                 </span>
               </div>
+              {apiData.warnings?.map((warning) => (
+                <p key={warning} className="mt-3 px-3 py-2 bg-yellow-50 text-yellow-800 border border-yellow-200 rounded text-sm">
+                  ⚠️ {warning}
+                </p>
+              ))}
             </div>
             <div className="flex flex-col sm:flex-row gap-2 w-full sm:w-auto">
               {apiData.status === 'deployed' ? (
@@ -213,6 +213,16 @@ function CreateAPIModal({ onClose, onSuccess }: { onClose: () => void; onSuccess
   const [visibility, setVisibility] = useState('private');
   const [loading, setLoading] = useState(false);
   const [error, setError] = useState('');
+  const [runtimes, setRuntimes] = useState<{ name: string; deprecated_at?: string }[]>([]);
+
+  useEffect(() => {
+    // Deprecated runtimes can't be chosen for new APIs
+    api.getRuntimes()
+      .then((data: any) => setRuntimes((data || []).filter(
+        (rt: { deprecated_at?: string }) => !rt.deprecated_at || new Date(rt.deprecated_at) > new Date()
+      )))
+      .catch((error) => console.error('Failed to load runtimes:', error));
+  }, []);
 
   const handleSubmit = async (e: React.FormEvent) => {
     e.preventDefault();
@@ -271,9 +281,9 @@ function CreateAPIModal({ onClose, onSuccess }: { onClose: () => void; onSuccess
               onChange={(e) => setRuntime(e.target.value)}
               className="w-full px-3 py-2 border rounded"
             >
-              <option value="python">Python</option>
-              <option value="nodejs">Node.js</option>
-              <option value="go">Go</option>
+              {runtimes.map((rt) => (
+                <option key={rt.name} value={rt.name}>{rt.name}</option>
+              ))}
             </select>
           </div>
 
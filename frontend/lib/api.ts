@@ -61,6 +61,10 @@ class APIClient {
     return this.request(`/api/v1/apis/${id}`);
   }
 
+  async getRuntimes() {
+    return this.request('/api/v1/runtimes');
+  }
+
   async createAPI(data: {
     name: string;
     description: string;
@@ -116,6 +120,13 @@ class APIClient {
     });
   }
 
+  async testCode(id: string, code: string) {
+    return this.request(`/api/v1/apis/${id}/test`, {
+      method: 'POST',
+      body: JSON.stringify({ code }),
+    });
+  }
+
   async stopAPI(id: string) {
     return this.request(`/api/v1/apis/${id}/stop`, {
       method: 'POST',
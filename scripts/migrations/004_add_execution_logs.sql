@@ -0,0 +1,17 @@
+-- Persist user code output per execution for the log viewer
+
+CREATE TABLE IF NOT EXISTS execution_logs (
+    id BIGSERIAL PRIMARY KEY,
+    -- No FK: lines are written while the execution is still running,
+    -- before its executions row exists
+    execution_id UUID NOT NULL,
+    api_id UUID NOT NULL REFERENCES apis(id) ON DELETE CASCADE,
+    stream VARCHAR(10) NOT NULL CHECK (stream IN ('stdout', 'stderr')),
+    level VARCHAR(10) NOT NULL CHECK (level IN ('debug', 'info', 'warn', 'error')),
+    message TEXT NOT NULL,
+    logged_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_execution_logs_api_id ON execution_logs(api_id, id DESC);
+CREATE INDEX IF NOT EXISTS idx_execution_logs_execution_id ON execution_logs(execution_id);
+CREATE INDEX IF NOT EXISTS idx_execution_logs_logged_at ON execution_logs(logged_at);
@@ -0,0 +1,41 @@
+-- Code snapshots per API version so captured requests can be replayed
+-- against the current or an earlier version
+CREATE TABLE IF NOT EXISTS api_versions (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    api_id UUID NOT NULL REFERENCES apis(id) ON DELETE CASCADE,
+    version VARCHAR(50) NOT NULL,
+    runtime VARCHAR(50) NOT NULL,
+    code_path VARCHAR(500) NOT NULL,
+    code_sha256 VARCHAR(64) NOT NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE(api_id, version)
+);
+
+CREATE INDEX IF NOT EXISTS idx_api_versions_api_id ON api_versions(api_id);
+
+-- Opt-in request/response capture, per API
+CREATE TABLE IF NOT EXISTS capture_settings (
+    api_id UUID PRIMARY KEY REFERENCES apis(id) ON DELETE CASCADE,
+    enabled BOOLEAN NOT NULL DEFAULT false,
+    redact_headers TEXT[] NOT NULL DEFAULT '{}',
+    redact_fields TEXT[] NOT NULL DEFAULT '{}',
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+-- Captured envelope for an execution (redacted before storage)
+CREATE TABLE IF NOT EXISTS execution_captures (
+    execution_id UUID PRIMARY KEY REFERENCES executions(id) ON DELETE CASCADE,
+    api_id UUID NOT NULL REFERENCES apis(id) ON DELETE CASCADE,
+    version VARCHAR(50) NOT NULL,
+    request_method VARCHAR(10) NOT NULL,
+    request_path VARCHAR(500) NOT NULL,
+    request_query TEXT NOT NULL DEFAULT '',
+    request_headers JSONB NOT NULL DEFAULT '{}',
+    request_body JSONB,
+    response_status INTEGER NOT NULL,
+    response_body JSONB,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_execution_captures_api_id ON execution_captures(api_id, created_at DESC);
@@ -0,0 +1,30 @@
+-- Durable queue for asynchronous executions (?async=true). Workers claim
+-- jobs with FOR UPDATE SKIP LOCKED; a claim is a lease that expires after
+-- locked_until so jobs held by a crashed worker are picked up again.
+CREATE TABLE IF NOT EXISTS jobs (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    api_id UUID NOT NULL REFERENCES apis(id) ON DELETE CASCADE,
+    user_id UUID REFERENCES users(id) ON DELETE SET NULL,
+    execution_id UUID, -- latest attempt
+    status VARCHAR(20) NOT NULL DEFAULT 'queued' CHECK (status IN ('queued', 'running', 'succeeded', 'dead')),
+    runtime VARCHAR(50) NOT NULL,
+    code TEXT NOT NULL,
+    input JSONB,
+    timeout_sec INTEGER NOT NULL DEFAULT 30,
+    callback_url VARCHAR(1000),
+    attempts INTEGER NOT NULL DEFAULT 0,
+    max_attempts INTEGER NOT NULL DEFAULT 3,
+    run_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    locked_by VARCHAR(255),
+    locked_until TIMESTAMP,
+    result JSONB,
+    last_error TEXT,
+    callback_delivered_at TIMESTAMP,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    completed_at TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_jobs_queued ON jobs(run_at) WHERE status = 'queued';
+CREATE INDEX IF NOT EXISTS idx_jobs_running ON jobs(locked_until) WHERE status = 'running';
+CREATE INDEX IF NOT EXISTS idx_jobs_api_id ON jobs(api_id, created_at DESC);
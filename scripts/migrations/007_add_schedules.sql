@@ -0,0 +1,36 @@
+-- Cron schedules that invoke an API with a fixed payload. Runs are fired
+-- through the async job queue, so they are recorded like any other execution.
+CREATE TABLE IF NOT EXISTS schedules (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    api_id UUID NOT NULL REFERENCES apis(id) ON DELETE CASCADE,
+    name VARCHAR(255) NOT NULL,
+    cron_expr VARCHAR(255) NOT NULL,
+    timezone VARCHAR(100) NOT NULL DEFAULT 'UTC',
+    input JSONB,
+    timeout_sec INTEGER NOT NULL DEFAULT 30,
+    overlap_policy VARCHAR(10) NOT NULL DEFAULT 'skip' CHECK (overlap_policy IN ('skip', 'queue', 'allow')),
+    catch_up_limit INTEGER NOT NULL DEFAULT 0, -- missed runs replayed after downtime
+    enabled BOOLEAN NOT NULL DEFAULT true,
+    next_run_at TIMESTAMP NOT NULL,
+    last_run_at TIMESTAMP,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_schedules_api_id ON schedules(api_id);
+CREATE INDEX IF NOT EXISTS idx_schedules_next_run_at ON schedules(next_run_at) WHERE enabled = true;
+
+-- Every fire time of a schedule and what happened to it
+CREATE TABLE IF NOT EXISTS schedule_runs (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    schedule_id UUID NOT NULL REFERENCES schedules(id) ON DELETE CASCADE,
+    scheduled_for TIMESTAMP NOT NULL,
+    status VARCHAR(20) NOT NULL CHECK (status IN ('pending', 'enqueued', 'skipped')),
+    job_id UUID REFERENCES jobs(id) ON DELETE SET NULL,
+    reason TEXT,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE(schedule_id, scheduled_for)
+);
+
+CREATE INDEX IF NOT EXISTS idx_schedule_runs_schedule_id ON schedule_runs(schedule_id, scheduled_for DESC);
+CREATE INDEX IF NOT EXISTS idx_schedule_runs_pending ON schedule_runs(schedule_id) WHERE status = 'pending';
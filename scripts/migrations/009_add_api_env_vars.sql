@@ -0,0 +1,20 @@
+-- Per-API environment variables injected into execution containers.
+-- version '' applies to every version; a row for a specific version
+-- overrides it. Secrets keep no plaintext: value is empty and the value is
+-- AES-GCM encrypted under a per-row data key, itself encrypted (wrapped)
+-- with the platform key from SECRETS_ENCRYPTION_KEY.
+CREATE TABLE IF NOT EXISTS api_env_vars (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    api_id UUID NOT NULL REFERENCES apis(id) ON DELETE CASCADE,
+    version VARCHAR(50) NOT NULL DEFAULT '',
+    name VARCHAR(255) NOT NULL,
+    value TEXT NOT NULL DEFAULT '',
+    is_secret BOOLEAN NOT NULL DEFAULT false,
+    ciphertext BYTEA,
+    wrapped_key BYTEA,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE(api_id, version, name)
+);
+
+CREATE INDEX IF NOT EXISTS idx_api_env_vars_api_id ON api_env_vars(api_id);
@@ -0,0 +1,14 @@
+-- Developer plan, which caps the resource class an API may use
+ALTER TABLE users ADD COLUMN IF NOT EXISTS plan VARCHAR(50) NOT NULL DEFAULT 'free';
+ALTER TABLE users DROP CONSTRAINT IF EXISTS users_plan_check;
+ALTER TABLE users ADD CONSTRAINT users_plan_check CHECK (plan IN ('free', 'basic', 'premium'));
+
+-- Resource class per API and per version snapshot; the classes themselves
+-- are defined in code (models.ResourceClasses)
+ALTER TABLE apis ADD COLUMN IF NOT EXISTS resource_class VARCHAR(50) NOT NULL DEFAULT 'small';
+ALTER TABLE api_versions ADD COLUMN IF NOT EXISTS resource_class VARCHAR(50) NOT NULL DEFAULT 'small';
+ALTER TABLE jobs ADD COLUMN IF NOT EXISTS resource_class VARCHAR(50) NOT NULL DEFAULT 'small';
+
+-- Billing: the class each execution ran in and the compute units charged
+ALTER TABLE executions ADD COLUMN IF NOT EXISTS resource_class VARCHAR(50) NOT NULL DEFAULT 'small';
+ALTER TABLE executions ADD COLUMN IF NOT EXISTS compute_units BIGINT NOT NULL DEFAULT 0;
@@ -0,0 +1,12 @@
+-- Opt-in outbound network access, per API. Containers of APIs with egress
+-- enabled join an internal Docker network whose only way out is the
+-- executor's proxy, which admits hosts on the allowlist (domains or CIDRs).
+CREATE TABLE IF NOT EXISTS egress_policies (
+    api_id UUID PRIMARY KEY REFERENCES apis(id) ON DELETE CASCADE,
+    enabled BOOLEAN NOT NULL DEFAULT false,
+    allowlist TEXT[] NOT NULL DEFAULT '{}',
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+-- Bytes sent and received through the proxy by each execution
+ALTER TABLE executions ADD COLUMN IF NOT EXISTS egress_bytes BIGINT NOT NULL DEFAULT 0;
@@ -0,0 +1,3 @@
+-- WebAssembly (WASI) modules run in-process in the executor
+ALTER TABLE apis DROP CONSTRAINT IF EXISTS apis_runtime_check;
+ALTER TABLE apis ADD CONSTRAINT apis_runtime_check CHECK (runtime IN ('python', 'go', 'nodejs', 'wasm'));
@@ -0,0 +1,43 @@
+-- Runtimes are data: adding one is an INSERT here, with no code change or
+-- constraint migration. In run_command, {file} is the code file (main plus
+-- the extension, in the working directory) and {code} the code itself.
+-- build_command is a shell command run before it, in the same directory.
+CREATE TABLE IF NOT EXISTS runtimes (
+    name VARCHAR(50) PRIMARY KEY,
+    engine VARCHAR(20) NOT NULL DEFAULT 'container' CHECK (engine IN ('container', 'wasm')),
+    image VARCHAR(255) NOT NULL DEFAULT '',
+    extension VARCHAR(20) NOT NULL,
+    build_command TEXT NOT NULL DEFAULT '',
+    run_command TEXT[] NOT NULL,
+    handler TEXT NOT NULL DEFAULT '',
+    default_resource_class VARCHAR(20) NOT NULL DEFAULT 'small',
+    default_timeout_sec INTEGER NOT NULL DEFAULT 30,
+    enabled BOOLEAN NOT NULL DEFAULT true,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+INSERT INTO runtimes (name, engine, image, extension, run_command, handler, default_timeout_sec) VALUES
+    ('python', 'container', 'python:3.11-slim', '.py', ARRAY['python', '-c', '{code}'],
+        'Read the input JSON from input.json and print the response JSON to stdout.', 30),
+    ('nodejs', 'container', 'node:18-alpine', '.js', ARRAY['node', '-e', '{code}'],
+        'Read the input JSON from input.json and print the response JSON to stdout.', 30),
+    ('go', 'container', 'golang:1.22-alpine', '.go', ARRAY['go', 'run', '{file}'],
+        'A main package in one file. Read the input JSON from input.json and print the response JSON to stdout.', 60),
+    ('wasm', 'wasm', '', '.wasm', ARRAY['{file}'],
+        'A compiled WASI (preview 1) module. Read the input JSON from stdin and print the response JSON to stdout.', 30),
+    ('ruby', 'container', 'ruby:3.3-alpine', '.rb', ARRAY['ruby', '{file}'],
+        'Read the input JSON from input.json and print the response JSON to stdout.', 30),
+    ('php', 'container', 'php:8.3-cli-alpine', '.php', ARRAY['php', '{file}'],
+        'A script starting with <?php. Read the input JSON from input.json and echo the response JSON.', 30),
+    ('java', 'container', 'eclipse-temurin:21-jdk-alpine', '.java', ARRAY['java', '{file}'],
+        'A single source file whose first class has main; it is compiled and run in one step. Read the input JSON from input.json and print the response JSON to System.out.', 60),
+    ('deno', 'container', 'denoland/deno:alpine', '.ts', ARRAY['deno', 'run', '--no-prompt', '--allow-read=.', '--allow-env', '{file}'],
+        'A TypeScript or JavaScript module. Read the input JSON with Deno.readTextFile("input.json") and print the response JSON with console.log.', 30),
+    ('bash', 'container', 'bash:5.2', '.sh', ARRAY['bash', '{file}'],
+        'A Bash script. Read the input JSON from input.json and print the response JSON to stdout.', 30)
+ON CONFLICT (name) DO NOTHING;
+
+-- Replace the fixed list with a reference to the registry
+ALTER TABLE apis DROP CONSTRAINT IF EXISTS apis_runtime_check;
+ALTER TABLE apis DROP CONSTRAINT IF EXISTS apis_runtime_fkey;
+ALTER TABLE apis ADD CONSTRAINT apis_runtime_fkey FOREIGN KEY (runtime) REFERENCES runtimes(name);
@@ -0,0 +1,22 @@
+-- APIs with the custom runtime run an image built by the executor from a
+-- Dockerfile the developer supplies. The image's CMD or ENTRYPOINT is the
+-- handler: it runs in /app next to the uploaded code file (main) and
+-- input.json and prints the response JSON to stdout.
+INSERT INTO runtimes (name, engine, image, extension, run_command, handler, default_timeout_sec) VALUES
+    ('custom', 'container', '', '', '{}',
+        'A Dockerfile whose CMD or ENTRYPOINT runs the handler in /app, where the uploaded code is saved as main. Read the input JSON from input.json and print the response JSON to stdout.', 30)
+ON CONFLICT (name) DO NOTHING;
+
+CREATE TABLE IF NOT EXISTS custom_images (
+    api_id UUID PRIMARY KEY REFERENCES apis(id) ON DELETE CASCADE,
+    dockerfile TEXT NOT NULL,
+    -- The built image, tagged with a hash of the Dockerfile so an unchanged
+    -- Dockerfile is never rebuilt
+    image VARCHAR(255) NOT NULL DEFAULT '',
+    status VARCHAR(20) NOT NULL DEFAULT 'pending' CHECK (status IN ('pending', 'building', 'ready', 'failed')),
+    size_bytes BIGINT NOT NULL DEFAULT 0,
+    build_log TEXT NOT NULL DEFAULT '',
+    error TEXT NOT NULL DEFAULT '',
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
@@ -0,0 +1,42 @@
+-- Runtime versions: each version is its own registry entry (python3.12,
+-- nodejs20, go1.23) grouped by family. The unversioned names stay as the
+-- versions they have always run. Past its deprecation date a runtime can't
+-- be chosen for new APIs and existing ones show a warning;
+-- scripts/migrate-runtimes.sh moves them to the newest version.
+ALTER TABLE runtimes ADD COLUMN IF NOT EXISTS family VARCHAR(50) NOT NULL DEFAULT '';
+ALTER TABLE runtimes ADD COLUMN IF NOT EXISTS version VARCHAR(20) NOT NULL DEFAULT '';
+ALTER TABLE runtimes ADD COLUMN IF NOT EXISTS deprecated_at DATE;
+
+UPDATE runtimes SET family = name WHERE family = '';
+UPDATE runtimes SET version = '3.11', deprecated_at = '2027-10-31' WHERE name = 'python' AND version = '';
+UPDATE runtimes SET version = '18', deprecated_at = '2025-04-30' WHERE name = 'nodejs' AND version = '';
+UPDATE runtimes SET version = '1.22', deprecated_at = '2025-02-11' WHERE name = 'go' AND version = '';
+UPDATE runtimes SET version = '3.3' WHERE name = 'ruby' AND version = '';
+UPDATE runtimes SET version = '8.3' WHERE name = 'php' AND version = '';
+UPDATE runtimes SET version = '21' WHERE name = 'java' AND version = '';
+UPDATE runtimes SET version = '5.2' WHERE name = 'bash' AND version = '';
+
+INSERT INTO runtimes (name, family, version, deprecated_at, engine, image, extension, run_command, handler, default_timeout_sec) VALUES
+    ('python3.11', 'python', '3.11', '2027-10-31', 'container', 'python:3.11-slim', '.py', ARRAY['python', '-c', '{code}'],
+        'Read the input JSON from input.json and print the response JSON to stdout.', 30),
+    ('python3.12', 'python', '3.12', NULL, 'container', 'python:3.12-slim', '.py', ARRAY['python', '-c', '{code}'],
+        'Read the input JSON from input.json and print the response JSON to stdout.', 30),
+    ('python3.13', 'python', '3.13', NULL, 'container', 'python:3.13-slim', '.py', ARRAY['python', '-c', '{code}'],
+        'Read the input JSON from input.json and print the response JSON to stdout.', 30),
+    ('nodejs18', 'nodejs', '18', '2025-04-30', 'container', 'node:18-alpine', '.js', ARRAY['node', '-e', '{code}'],
+        'Read the input JSON from input.json and print the response JSON to stdout.', 30),
+    ('nodejs20', 'nodejs', '20', '2026-04-30', 'container', 'node:20-alpine', '.js', ARRAY['node', '-e', '{code}'],
+        'Read the input JSON from input.json and print the response JSON to stdout.', 30),
+    ('nodejs22', 'nodejs', '22', NULL, 'container', 'node:22-alpine', '.js', ARRAY['node', '-e', '{code}'],
+        'Read the input JSON from input.json and print the response JSON to stdout.', 30),
+    ('go1.22', 'go', '1.22', '2025-02-11', 'container', 'golang:1.22-alpine', '.go', ARRAY['go', 'run', '{file}'],
+        'A main package in one file. Read the input JSON from input.json and print the response JSON to stdout.', 60),
+    ('go1.23', 'go', '1.23', '2025-08-12', 'container', 'golang:1.23-alpine', '.go', ARRAY['go', 'run', '{file}'],
+        'A main package in one file. Read the input JSON from input.json and print the response JSON to stdout.', 60),
+    ('go1.24', 'go', '1.24', NULL, 'container', 'golang:1.24-alpine', '.go', ARRAY['go', 'run', '{file}'],
+        'A main package in one file. Read the input JSON from input.json and print the response JSON to stdout.', 60),
+    ('go1.25', 'go', '1.25', NULL, 'container', 'golang:1.25-alpine', '.go', ARRAY['go', 'run', '{file}'],
+        'A main package in one file. Read the input JSON from input.json and print the response JSON to stdout.', 60)
+ON CONFLICT (name) DO NOTHING;
+
+CREATE INDEX IF NOT EXISTS idx_runtimes_family ON runtimes(family);
@@ -0,0 +1,3 @@
+-- Time each execution waited for an executor slot. It is not part of
+-- duration, so it is not billed.
+ALTER TABLE executions ADD COLUMN IF NOT EXISTS queue_ms INTEGER NOT NULL DEFAULT 0;
@@ -0,0 +1,16 @@
+-- Executors register here and refresh their entry every few seconds with
+-- what they can run and how busy they are. The gateway sends executions to
+-- nodes with a recent heartbeat and evicts the ones that stop answering.
+CREATE TABLE IF NOT EXISTS executor_nodes (
+    id VARCHAR(255) PRIMARY KEY,
+    url VARCHAR(500) NOT NULL,
+    backend VARCHAR(50) NOT NULL DEFAULT '',
+    runtimes TEXT[], -- NULL runs any runtime
+    capacity INTEGER NOT NULL DEFAULT 0,
+    running INTEGER NOT NULL DEFAULT 0,
+    queued INTEGER NOT NULL DEFAULT 0,
+    started_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    heartbeat_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_executor_nodes_heartbeat ON executor_nodes(heartbeat_at);
@@ -0,0 +1,30 @@
+-- APIs with max_replicas above zero run as persistent replicas: long-running
+-- servers the executor scales between min_replicas and max_replicas, instead
+-- of a fresh run per request. min_replicas 0 stops every replica once the API
+-- has been idle for idle_timeout_sec; the next request starts one again.
+CREATE TABLE IF NOT EXISTS api_scaling (
+    api_id UUID PRIMARY KEY REFERENCES apis(id) ON DELETE CASCADE,
+    min_replicas INTEGER NOT NULL DEFAULT 0,
+    max_replicas INTEGER NOT NULL DEFAULT 0,
+    target_concurrency INTEGER NOT NULL DEFAULT 10, -- in-flight requests per replica
+    target_latency_ms INTEGER NOT NULL DEFAULT 0, -- 0 scales on concurrency alone
+    idle_timeout_sec INTEGER NOT NULL DEFAULT 300,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    CHECK (min_replicas >= 0 AND min_replicas <= max_replicas)
+);
+
+-- Replicas are recorded by the executor node running them, so gateways can
+-- spread requests across them. They go with their node when it deregisters
+-- or is evicted.
+CREATE TABLE IF NOT EXISTS api_replicas (
+    id VARCHAR(255) PRIMARY KEY,
+    api_id UUID NOT NULL REFERENCES apis(id) ON DELETE CASCADE,
+    node_id VARCHAR(255) NOT NULL REFERENCES executor_nodes(id) ON DELETE CASCADE,
+    version VARCHAR(50) NOT NULL DEFAULT '',
+    status VARCHAR(20) NOT NULL DEFAULT 'ready',
+    in_flight INTEGER NOT NULL DEFAULT 0,
+    started_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_api_replicas_api_id ON api_replicas(api_id);
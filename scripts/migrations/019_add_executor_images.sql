@@ -0,0 +1,20 @@
+-- Admins look after the platform rather than APIs of their own. Signup never
+-- grants the role; it is set here, in the database.
+ALTER TABLE users DROP CONSTRAINT IF EXISTS users_role_check;
+ALTER TABLE users ADD CONSTRAINT users_role_check CHECK (role IN ('developer', 'consumer', 'admin'));
+
+-- Executors record the images they hold, runtime images they pulled and
+-- custom images they built, with when each last ran; the least recently used
+-- are removed first once the images outgrow the node's disk budget. Rows
+-- outlive an eviction of their node, so a node restarting keeps its history.
+CREATE TABLE IF NOT EXISTS executor_images (
+    node_id VARCHAR(255) NOT NULL,
+    image VARCHAR(500) NOT NULL,
+    api_id VARCHAR(255) NOT NULL DEFAULT '', -- set on custom images
+    size_bytes BIGINT NOT NULL DEFAULT 0,
+    pinned BOOLEAN NOT NULL DEFAULT false, -- an enabled runtime's image, never removed
+    last_used_at TIMESTAMP NOT NULL,
+    cached_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (node_id, image)
+);
@@ -0,0 +1,19 @@
+-- Execute requests sent with an Idempotency-Key header run once per key:
+-- the first claims the key, and repeats get the response stored here until
+-- expires_at. A request still running holds its key until expires_at too, so
+-- a key is only taken over from a gateway that died mid-request.
+CREATE TABLE IF NOT EXISTS idempotency_keys (
+    api_id UUID NOT NULL REFERENCES apis(id) ON DELETE CASCADE,
+    caller VARCHAR(255) NOT NULL DEFAULT '', -- user of the API key, if any
+    key VARCHAR(255) NOT NULL,
+    fingerprint VARCHAR(64) NOT NULL, -- SHA-256 of the method, path, query and body
+    status VARCHAR(20) NOT NULL DEFAULT 'pending',
+    response_status INTEGER NOT NULL DEFAULT 0,
+    response_headers JSONB,
+    response_body BYTEA,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    expires_at TIMESTAMP NOT NULL,
+    PRIMARY KEY (api_id, caller, key)
+);
+
+CREATE INDEX IF NOT EXISTS idx_idempotency_keys_expires_at ON idempotency_keys(expires_at);
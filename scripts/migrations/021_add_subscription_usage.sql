@@ -0,0 +1,8 @@
+-- Executions by a subscriber, per subscription and UTC day, counted against
+-- the daily quota of the subscription's plan
+CREATE TABLE IF NOT EXISTS subscription_usage (
+    subscription_id UUID NOT NULL REFERENCES subscriptions(id) ON DELETE CASCADE,
+    date DATE NOT NULL,
+    request_count BIGINT NOT NULL DEFAULT 0,
+    PRIMARY KEY (subscription_id, date)
+);
@@ -0,0 +1,135 @@
+#!/bin/bash
+
+# Runs code that tries to break out of each sandbox restriction through a
+# running executor and checks every attempt is refused. Needs curl and jq.
+#
+#   EXECUTOR_URL=http://localhost:8081 EXECUTOR_TOKEN=... ./scripts/sandbox-escape-test.sh
+
+EXECUTOR_URL="${EXECUTOR_URL:-http://localhost:8081}"
+EXECUTOR_TOKEN="${EXECUTOR_TOKEN:?EXECUTOR_TOKEN must be set to the executor's token}"
+
+failed=0
+
+# attempt NAME CODE: CODE is Python that prints "ESCAPED" if it got through
+attempt() {
+    local name="$1" code="$2"
+    local body output
+    body=$(jq -n --arg code "$code" '{runtime: "python", code: $code, timeout_sec: 20}')
+    output=$(curl -s -X POST "$EXECUTOR_URL/execute" -H "Content-Type: application/json" -H "X-Executor-Token: $EXECUTOR_TOKEN" -d "$body" | jq -r '.output // .error // empty')
+
+    if [ -z "$output" ]; then
+        echo "✗ $name: no response from executor"
+        failed=1
+    elif echo "$output" | grep -q "ESCAPED"; then
+        echo "✗ $name: $output"
+        failed=1
+    else
+        echo "✓ $name"
+    fi
+}
+
+attempt "read-only rootfs" '
+try:
+    open("/etc/escaped", "w").write("x")
+    print("ESCAPED")
+except OSError as e:
+    print("blocked:", e)
+'
+
+attempt "/tmp is size-limited" '
+import os
+try:
+    with open("/tmp/fill", "wb") as f:
+        for _ in range(4096):
+            f.write(b"\0" * (1024 * 1024))
+    print("ESCAPED")
+except OSError as e:
+    print("blocked:", e)
+'
+
+attempt "non-root user" '
+import os
+print("ESCAPED" if os.getuid() == 0 or os.geteuid() == 0 else "uid %d" % os.getuid())
+'
+
+attempt "capabilities dropped" '
+for line in open("/proc/self/status"):
+    if line.startswith(("CapEff", "CapPrm", "CapBnd")):
+        print("ESCAPED" if int(line.split()[1], 16) else line.strip())
+'
+
+attempt "no-new-privileges" '
+for line in open("/proc/self/status"):
+    if line.startswith("NoNewPrivs"):
+        print("ESCAPED" if line.split()[1] != "1" else line.strip())
+'
+
+attempt "setuid refused" '
+import os
+try:
+    os.setuid(0)
+    print("ESCAPED")
+except OSError as e:
+    print("blocked:", e)
+'
+
+attempt "mount refused" '
+import ctypes, os
+libc = ctypes.CDLL(None, use_errno=True)
+if libc.mount(b"none", b"/tmp", b"tmpfs", 0, None) == 0:
+    print("ESCAPED")
+else:
+    print("blocked:", os.strerror(ctypes.get_errno()))
+'
+
+attempt "user namespaces refused" '
+import ctypes, os
+libc = ctypes.CDLL(None, use_errno=True)
+CLONE_NEWUSER = 0x10000000
+if libc.unshare(CLONE_NEWUSER) == 0:
+    print("ESCAPED")
+else:
+    print("blocked:", os.strerror(ctypes.get_errno()))
+'
+
+attempt "ptrace refused" '
+import ctypes, os
+libc = ctypes.CDLL(None, use_errno=True)
+PTRACE_TRACEME = 0
+if libc.ptrace(PTRACE_TRACEME, 0, None, None) == 0:
+    print("ESCAPED")
+else:
+    print("blocked:", os.strerror(ctypes.get_errno()))
+'
+
+attempt "open file limit" '
+import resource
+soft, hard = resource.getrlimit(resource.RLIMIT_NOFILE)
+try:
+    resource.setrlimit(resource.RLIMIT_NOFILE, (hard + 1, hard + 1))
+    print("ESCAPED")
+except (ValueError, OSError) as e:
+    files = []
+    try:
+        for _ in range(hard + 1):
+            files.append(open("/dev/null"))
+        print("ESCAPED")
+    except OSError:
+        print("blocked at", len(files), "files")
+'
+
+attempt "network disabled" '
+import socket
+try:
+    socket.create_connection(("1.1.1.1", 53), timeout=3)
+    print("ESCAPED")
+except OSError as e:
+    print("blocked:", e)
+'
+
+if [ $failed -ne 0 ]; then
+    echo "Sandbox escape test failed"
+    exit 1
+fi
+
+echo "All sandbox restrictions held"
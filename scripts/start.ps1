@@ -83,7 +83,7 @@ try {
     
     Write-Host "  Building Executor..." -ForegroundColor White
     cd "$ProjectRoot\backend\executor"
-    go build -o executor.exe -mod=mod main_simple.go
+    go build -o executor.exe -mod=mod .
     if ($LASTEXITCODE -ne 0) {
         throw "Failed to build Executor"
     }
@@ -105,7 +105,7 @@ try {
     Start-Process powershell -ArgumentList "-NoExit", "-Command", "cd '$ProjectRoot\backend\api-gateway'; .\api-gateway.exe" -WindowStyle Normal
     
     Write-Host "  Starting Executor (Port 8081)..." -ForegroundColor White
-    Start-Process powershell -ArgumentList "-NoExit", "-Command", "cd '$ProjectRoot\backend\executor'; .\executor.exe" -WindowStyle Normal
+    Start-Process powershell -ArgumentList "-NoExit", "-Command", "cd '$ProjectRoot\backend\executor'; `$env:EXECUTOR_BACKEND='stub'; .\executor.exe" -WindowStyle Normal
     
     Write-Host "  Starting Analytics (Port 8082)..." -ForegroundColor White
     Start-Process powershell -ArgumentList "-NoExit", "-Command", "cd '$ProjectRoot\backend\analytics'; .\analytics.exe" -WindowStyle Normal